@@ -0,0 +1,102 @@
+package client
+
+import (
+	dto "GoApp/dto/auth"
+	"GoApp/models"
+	"context"
+	"net/http"
+	"net/url"
+)
+
+type loginResponse struct {
+	AccessToken  string      `json:"accessToken"`
+	RefreshToken string      `json:"refreshToken"`
+	User         models.User `json:"user"`
+}
+
+// Login opens a session, the following calls are made as the user
+func (client *Client) Login(ctx context.Context, credentials dto.LoginCredentials) (*models.User, error) {
+	req, err := jsonRequest(http.MethodPost, "/v1/auth/login", credentials, false)
+	if err != nil {
+		return nil, err
+	}
+	var res loginResponse
+	if err := client.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	client.setTokens(res.AccessToken, res.RefreshToken)
+	return &res.User, nil
+}
+
+// Register creates a user, who receives an activation email
+func (client *Client) Register(ctx context.Context, credentials dto.RegisterCredentials) error {
+	return client.post(ctx, "/v1/auth/register", credentials)
+}
+
+// VerifyEmail activates the user with the code of the activation email
+func (client *Client) VerifyEmail(ctx context.Context, verify dto.VerifyEmail) error {
+	return client.post(ctx, "/v1/auth/verify", verify)
+}
+
+// ResendActivationEmail sends a new activation email
+func (client *Client) ResendActivationEmail(ctx context.Context, resend dto.ResendActivationEmail) error {
+	return client.post(ctx, "/v1/auth/resend-activation-email", resend)
+}
+
+// ForgotPassword emails a password reset code
+func (client *Client) ForgotPassword(ctx context.Context, forgot dto.ForgotPass) error {
+	return client.post(ctx, "/v1/auth/forgot-password", forgot)
+}
+
+// ResetPassword sets a new password with the emailed code
+func (client *Client) ResetPassword(ctx context.Context, reset dto.ResetPassword) error {
+	return client.post(ctx, "/v1/auth/reset-password", reset)
+}
+
+// Refresh gets a new access token with the refresh token. Calls made as the
+// user refresh it on their own when it expires.
+func (client *Client) Refresh(ctx context.Context) error {
+	client.refreshMutex.Lock()
+	defer client.refreshMutex.Unlock()
+	return client.refresh(ctx)
+}
+
+// refresh is Refresh, the caller holds refreshMutex
+func (client *Client) refresh(ctx context.Context) error {
+	_, refreshToken := client.Tokens()
+	if refreshToken == "" {
+		return ErrNotLoggedIn
+	}
+	req := request{method: http.MethodPut, path: "/v1/auth/refresh/" + url.PathEscape(refreshToken)}
+	var res struct {
+		AccessToken string `json:"accessToken"`
+	}
+	if err := client.do(ctx, req, &res); err != nil {
+		return err
+	}
+	client.setTokens(res.AccessToken, refreshToken)
+	return nil
+}
+
+// Logout revokes the refresh token and forgets the session
+func (client *Client) Logout(ctx context.Context) error {
+	_, refreshToken := client.Tokens()
+	if refreshToken == "" {
+		return ErrNotLoggedIn
+	}
+	req := request{method: http.MethodPut, path: "/v1/auth/logout/" + url.PathEscape(refreshToken)}
+	if err := client.do(ctx, req, nil); err != nil {
+		return err
+	}
+	client.setTokens("", "")
+	return nil
+}
+
+// post sends a form of the auth routes, which answer with no data
+func (client *Client) post(ctx context.Context, path string, body interface{}) error {
+	req, err := jsonRequest(http.MethodPost, path, body, false)
+	if err != nil {
+		return err
+	}
+	return client.do(ctx, req, nil)
+}
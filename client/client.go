@@ -0,0 +1,195 @@
+// Package client is a typed Go client of the API. It sends the X-Auth-Key
+// header, keeps the tokens of the logged in user and refreshes the access
+// token when it expires.
+//
+//	api := client.New("https://api.example.com", authKey)
+//	user, err := api.Login(ctx, dto.LoginCredentials{Email: &email, Password: &password})
+//	if errors.Is(err, client.ErrUserNotVerified) {
+//		...
+//	}
+package client
+
+import (
+	"GoApp/lib"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type Client struct {
+	baseUrl    string
+	authKey    string
+	httpClient *http.Client
+
+	mutex        sync.Mutex
+	accessToken  string
+	refreshToken string
+	onTokens     func(accessToken, refreshToken string)
+
+	// refreshMutex is held while refreshing, so that the calls failing
+	// together with an expired token refresh it once
+	refreshMutex sync.Mutex
+}
+
+type Option func(client *Client)
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts or tracing
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = httpClient
+	}
+}
+
+// WithTokens resumes a session saved from Tokens
+func WithTokens(accessToken, refreshToken string) Option {
+	return func(client *Client) {
+		client.accessToken = accessToken
+		client.refreshToken = refreshToken
+	}
+}
+
+// OnTokens is called whenever the tokens change, to persist the session.
+// Both are empty after Logout.
+func OnTokens(fn func(accessToken, refreshToken string)) Option {
+	return func(client *Client) {
+		client.onTokens = fn
+	}
+}
+
+// New returns a client of the API at baseUrl, e.g. https://api.example.com
+func New(baseUrl, authKey string, options ...Option) *Client {
+	client := &Client{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		authKey:    authKey,
+		httpClient: http.DefaultClient,
+	}
+	for _, option := range options {
+		option(client)
+	}
+	return client
+}
+
+// Tokens returns the current access and refresh tokens
+func (client *Client) Tokens() (accessToken, refreshToken string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.accessToken, client.refreshToken
+}
+
+func (client *Client) setTokens(accessToken, refreshToken string) {
+	client.mutex.Lock()
+	client.accessToken, client.refreshToken = accessToken, refreshToken
+	onTokens := client.onTokens
+	client.mutex.Unlock()
+
+	if onTokens != nil {
+		onTokens(accessToken, refreshToken)
+	}
+}
+
+// request describes one API call. The body is kept as bytes so that the
+// call can be replayed after refreshing the access token.
+type request struct {
+	method      string
+	path        string
+	body        []byte
+	contentType string
+	// authorized calls send the access token
+	authorized bool
+}
+
+func jsonRequest(method, path string, body interface{}, authorized bool) (request, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return request{}, err
+	}
+	return request{method: method, path: path, body: encoded, contentType: "application/json", authorized: authorized}, nil
+}
+
+// envelope is the body of every JSON response, see lib.JsonResponse and
+// lib.AbortWithError. Code and Detail are set instead of Error and Message
+// by the application/problem+json documents.
+type envelope struct {
+	Status    string           `json:"status"`
+	Data      json.RawMessage  `json:"data"`
+	Error     string           `json:"error"`
+	Message   string           `json:"message"`
+	Code      string           `json:"code"`
+	Detail    string           `json:"detail"`
+	Fields    []lib.FieldError `json:"fields"`
+	RequestId string           `json:"requestId"`
+}
+
+// do sends the request and decodes the data of the response into data,
+// unless it is nil. An expired access token is refreshed once.
+func (client *Client) do(ctx context.Context, req request, data interface{}) error {
+	expired, _ := client.Tokens()
+	err := client.send(ctx, req, data)
+	if !req.authorized || !isUnauthorized(err) {
+		return err
+	}
+	if refreshErr := client.refreshExpired(ctx, expired); refreshErr != nil {
+		return err
+	}
+	return client.send(ctx, req, data)
+}
+
+// refreshExpired refreshes the access token unless another call replaced
+// expired while this one waited for the refresh lock
+func (client *Client) refreshExpired(ctx context.Context, expired string) error {
+	client.refreshMutex.Lock()
+	defer client.refreshMutex.Unlock()
+	if accessToken, _ := client.Tokens(); accessToken != expired {
+		return nil
+	}
+	return client.refresh(ctx)
+}
+
+func isUnauthorized(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+func (client *Client) send(ctx context.Context, req request, data interface{}) error {
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, client.baseUrl+req.path, body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("X-Auth-Key", client.authKey)
+	httpReq.Header.Set("Accept", "application/json")
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	if req.authorized {
+		if accessToken, _ := client.Tokens(); accessToken != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+	}
+
+	res, err := client.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var decoded envelope
+	decodeErr := json.NewDecoder(res.Body).Decode(&decoded)
+	if res.StatusCode >= 400 {
+		return newError(res.StatusCode, decoded)
+	}
+	if decodeErr != nil {
+		return decodeErr
+	}
+	if data != nil && len(decoded.Data) > 0 {
+		return json.Unmarshal(decoded.Data, data)
+	}
+	return nil
+}
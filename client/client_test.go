@@ -0,0 +1,140 @@
+package client
+
+import (
+	"GoApp/lib"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResponses(t *testing.T) {
+	responses := map[string]struct {
+		status      int
+		contentType string
+		body        string
+	}{
+		"/success": {http.StatusOK, "application/json", `{"status":"Success","data":{"email":"ada@example.com"}}`},
+		"/envelope": {http.StatusBadRequest, "application/json",
+			`{"status":"Failed","error":"InvalidParameter","message":"invalid parameters","fields":[{"field":"email","code":"email","message":"must be an email"}],"requestId":"request-id"}`},
+		"/problem": {http.StatusConflict, lib.ProblemContentType,
+			`{"type":"urn:problem-type:UserExists","title":"Conflict","status":409,"detail":"user exists","code":"UserExists","requestId":"request-id"}`},
+		"/gateway": {http.StatusBadGateway, "text/html", "<html>bad gateway</html>"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Key") != "auth-key" {
+			t.Errorf("%s: got X-Auth-Key %q", r.URL.Path, r.Header.Get("X-Auth-Key"))
+		}
+		response := responses[r.URL.Path]
+		w.Header().Set("Content-Type", response.contentType)
+		w.WriteHeader(response.status)
+		w.Write([]byte(response.body))
+	}))
+	defer server.Close()
+	client := New(server.URL+"/", "auth-key")
+	ctx := context.Background()
+
+	var data struct {
+		Email string `json:"email"`
+	}
+	if err := client.do(ctx, request{method: http.MethodGet, path: "/success"}, &data); err != nil || data.Email != "ada@example.com" {
+		t.Fatalf("got %+v, %v", data, err)
+	}
+
+	for path, want := range map[string]Error{
+		"/envelope": {StatusCode: http.StatusBadRequest, Code: lib.InvalidParameter, Message: "invalid parameters", RequestId: "request-id"},
+		"/problem":  {StatusCode: http.StatusConflict, Code: lib.UserExists, Message: "user exists", RequestId: "request-id"},
+		"/gateway":  {StatusCode: http.StatusBadGateway, Code: "Bad Gateway"},
+	} {
+		err := client.do(ctx, request{method: http.MethodGet, path: path}, nil)
+		var apiErr *Error
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: got %v", path, err)
+			continue
+		}
+		if apiErr.StatusCode != want.StatusCode || apiErr.Code != want.Code || apiErr.Message != want.Message || apiErr.RequestId != want.RequestId {
+			t.Errorf("%s: got %+v, want %+v", path, *apiErr, want)
+		}
+	}
+
+	err := client.do(ctx, request{method: http.MethodGet, path: "/envelope"}, nil)
+	if !errors.Is(err, ErrInvalidParameter) || errors.Is(err, ErrUserExists) {
+		t.Errorf("got %v", err)
+	}
+	if !strings.Contains(err.Error(), "email must be an email") {
+		t.Errorf("the fields are missing from %q", err)
+	}
+	if err := client.do(ctx, request{method: http.MethodGet, path: "/problem"}, nil); !errors.Is(err, ErrUserExists) {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestRefreshExpiredToken(t *testing.T) {
+	var refreshes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/auth/refresh/refresh-token":
+			refreshes.Add(1)
+			// the concurrent calls all get their 401 before the refresh ends
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte(`{"status":"Success","data":{"accessToken":"fresh"}}`))
+		case r.URL.Path == "/v1/auth/refresh/revoked":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"status":"Failed","error":"TokenNotFound"}`))
+		case r.URL.Path == "/v1/user/details" && r.Header.Get("Authorization") == "Bearer fresh":
+			w.Write([]byte(`{"status":"Success","data":{"email":"ada@example.com"}}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"status":"Failed","error":"InvalidToken"}`))
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	var saved []string
+	var savedMutex sync.Mutex
+	client := New(server.URL, "auth-key", WithTokens("expired", "refresh-token"), OnTokens(func(accessToken, refreshToken string) {
+		savedMutex.Lock()
+		defer savedMutex.Unlock()
+		saved = append(saved, accessToken+" "+refreshToken)
+	}))
+
+	var wait sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			user, err := client.Me(ctx)
+			if err != nil {
+				t.Error(err)
+			} else if *user.Email != "ada@example.com" {
+				t.Errorf("got %+v", user)
+			}
+		}()
+	}
+	wait.Wait()
+	if refreshes.Load() != 1 {
+		t.Errorf("refreshed %d times", refreshes.Load())
+	}
+	if len(saved) != 1 || saved[0] != "fresh refresh-token" {
+		t.Errorf("saved %v", saved)
+	}
+	if accessToken, refreshToken := client.Tokens(); accessToken != "fresh" || refreshToken != "refresh-token" {
+		t.Errorf("got %s %s", accessToken, refreshToken)
+	}
+
+	// a failed refresh answers with the error of the call
+	client = New(server.URL, "auth-key", WithTokens("expired", "revoked"))
+	if _, err := client.Me(ctx); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got %v", err)
+	}
+	if _, err := New(server.URL, "auth-key").Me(ctx); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("without tokens: got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"GoApp/lib"
+	"errors"
+	"net/http"
+)
+
+// ErrNotLoggedIn is returned by Refresh and Logout without a refresh token
+var ErrNotLoggedIn = errors.New("client: not logged in")
+
+// Error is an error response of the API. Code is one of the lib error codes
+// when the API sent one, otherwise the status text. RequestId identifies the
+// request in the logs of the API.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Fields     []lib.FieldError
+	RequestId  string
+}
+
+func newError(statusCode int, body envelope) *Error {
+	// the envelope sends error and message, the problem documents code and detail
+	code, message := body.Error, body.Message
+	if code == "" {
+		code = body.Code
+	}
+	if message == "" {
+		message = body.Detail
+	}
+	if code == "" {
+		code = http.StatusText(statusCode)
+	}
+	return &Error{StatusCode: statusCode, Code: code, Message: message, Fields: body.Fields, RequestId: body.RequestId}
+}
+
+func (err *Error) Error() string {
+	message := "api: " + err.Code
+	if err.Message != "" {
+		message += ": " + err.Message
+	}
+	for _, field := range err.Fields {
+		message += ", " + field.Field + " " + field.Message
+	}
+	return message
+}
+
+// Is matches the errors below by code, whatever the status:
+//
+//	errors.Is(err, client.ErrUserExists)
+func (err *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.StatusCode == 0 && other.Code == err.Code
+}
+
+var (
+	ErrIncorrectUserNameOrPassword = &Error{Code: lib.IncorrectUserNameOrPassword}
+	ErrUserNotVerified             = &Error{Code: lib.UserNotVerified}
+	ErrUserNotFound                = &Error{Code: lib.UserNotFound}
+	ErrUserAlreadyActivated        = &Error{Code: lib.UserAlreadyActivated}
+	ErrUserExists                  = &Error{Code: lib.UserExists}
+	ErrTokenExpired                = &Error{Code: lib.TokenExpired}
+	ErrTokenNotFound               = &Error{Code: lib.TokenNotFound}
+	ErrIncorrectOldPassword        = &Error{Code: lib.IncorrectOldPassword}
+	ErrInvalidImage                = &Error{Code: lib.InvalidImage}
+	ErrImageTooLarge               = &Error{Code: lib.ImageTooLarge}
+	ErrInvalidRequest              = &Error{Code: lib.InvalidRequest}
+	ErrInvalidParameter            = &Error{Code: lib.InvalidParameter}
+	ErrInvalidAuthKey              = &Error{Code: lib.InvalidAuthKey}
+	ErrInvalidToken                = &Error{Code: lib.InvalidToken}
+	ErrUserRequired                = &Error{Code: lib.UserRequired}
+	ErrFirstPartyTokenRequired     = &Error{Code: lib.FirstPartyTokenRequired}
+	ErrUserDeactivated             = &Error{Code: lib.UserDeactivated}
+	ErrRecaptchaFailed             = &Error{Code: lib.RecaptchaFailed}
+	ErrRequestTooLarge             = &Error{Code: lib.RequestTooLarge}
+	ErrUnsupportedMediaType        = &Error{Code: lib.UnsupportedMediaType}
+	ErrUnsupportedTusVersion       = &Error{Code: lib.UnsupportedTusVersion}
+	ErrUploadNotFound              = &Error{Code: lib.UploadNotFound}
+	ErrUploadOffsetConflict        = &Error{Code: lib.UploadOffsetConflict}
+	ErrAvatarNotFound              = &Error{Code: lib.AvatarNotFound}
+	ErrCSRF                        = &Error{Code: lib.CSRFCheckFailed}
+	ErrInternal                    = &Error{Code: lib.InternalError}
+)
@@ -0,0 +1,76 @@
+package client
+
+import (
+	dto "GoApp/dto/user"
+	"GoApp/models"
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// ProfilePictures are the URLs of a stored profile picture
+type ProfilePictures struct {
+	// Filepath is the largest size
+	Filepath string `json:"filepath"`
+	// Profiles is by size in pixels
+	Profiles map[string]string `json:"profiles"`
+}
+
+// Me returns the logged in user
+func (client *Client) Me(ctx context.Context) (*models.User, error) {
+	var user models.User
+	if err := client.do(ctx, request{method: http.MethodGet, path: "/v1/user/details", authorized: true}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ChangePassword needs the current password of the user
+func (client *Client) ChangePassword(ctx context.Context, change dto.ChangePassword) error {
+	req, err := jsonRequest(http.MethodPost, "/v1/user/change-password", change, true)
+	if err != nil {
+		return err
+	}
+	return client.do(ctx, req, nil)
+}
+
+// UpdateUserDetails renames the user
+func (client *Client) UpdateUserDetails(ctx context.Context, details dto.UpdateUserDetails) error {
+	req, err := jsonRequest(http.MethodPost, "/v1/user/details", details, true)
+	if err != nil {
+		return err
+	}
+	return client.do(ctx, req, nil)
+}
+
+// UploadProfile replaces the profile picture with the image read from image
+func (client *Client) UploadProfile(ctx context.Context, filename string, image io.Reader) (*ProfilePictures, error) {
+	// buffered, the upload is replayed when the access token needs a refresh
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, image); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req := request{
+		method:      http.MethodPost,
+		path:        "/v1/user/profile",
+		body:        body.Bytes(),
+		contentType: form.FormDataContentType(),
+		authorized:  true,
+	}
+	var pictures ProfilePictures
+	if err := client.do(ctx, req, &pictures); err != nil {
+		return nil, err
+	}
+	return &pictures, nil
+}
@@ -6,12 +6,10 @@ import (
 	"GoApp/lib"
 	"GoApp/models"
 	"GoApp/providers"
-	"net/http"
-	"time"
+	"errors"
+	"log/slog"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -28,12 +26,14 @@ type AuthController interface {
 }
 
 type authController struct {
+	logger              *slog.Logger
 	jWtService          providers.JWTService
 	configs             providers.Config
 	userService         db.UserService
 	refreshTokenService db.RefreshTokenService
 	emailService        providers.EmailService
-	validate            validator.Validate
+	blobStore           providers.BlobStore
+	sessionCookies      providers.SessionCookieService
 }
 
 func AuthHandler(
@@ -41,88 +41,119 @@ func AuthHandler(
 	userService *db.UserService,
 	refreshTokenService *db.RefreshTokenService,
 	emailService *providers.EmailService,
+	blobStore *providers.BlobStore,
+	sessionCookies *providers.SessionCookieService,
 	configs *providers.Config,
+	logger *slog.Logger,
 ) AuthController {
 	return &authController{
+		logger:              logger,
 		jWtService:          *jWtService,
 		configs:             *configs,
 		userService:         *userService,
 		refreshTokenService: *refreshTokenService,
 		emailService:        *emailService,
-		validate:            *validator.New(),
+		blobStore:           *blobStore,
+		sessionCookies:      *sessionCookies,
 	}
 }
 
 // POST /api/auth/login
 // Log in the user
 func (controller *authController) Login(c *gin.Context) {
-	var dto dto.LoginCredentials
-
-	if err := c.ShouldBind(&dto); err != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	dto, ok := lib.Bind[dto.LoginCredentials](c)
+	if !ok {
+		loginFailed("InvalidRequest")
 		return
 	}
 
-	if validationErr := controller.validate.Struct(dto); validationErr != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, validationErr.Error())
+	user, err := controller.userService.FindUser(c.Request.Context(), *dto.Email)
+	if errors.Is(err, db.ErrNotFound) {
+		loginFailed(lib.IncorrectUserNameOrPassword)
+		lib.AbortWithError(c, lib.ErrIncorrectUserNameOrPassword)
 		return
 	}
-
-	user, err := controller.userService.FindUser(*dto.Email)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		loginFailed("InternalError")
+		lib.AbortWithError(c, err)
 		return
 	}
-	if user == nil {
-		lib.ErrorResponse(c, http.StatusUnprocessableEntity, lib.IncorrectUserNameOrPassword)
+	_, span := providers.Tracer.Start(c.Request.Context(), "bcrypt.compare")
+	err = bcrypt.CompareHashAndPassword([]byte(*user.Password), []byte(*dto.Password))
+	span.End()
+	if err != nil {
+		loginFailed(lib.IncorrectUserNameOrPassword)
+		lib.AbortWithError(c, lib.ErrIncorrectUserNameOrPassword)
 		return
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(*user.Password), []byte(*dto.Password)); err != nil {
-		lib.ErrorResponse(c, http.StatusUnprocessableEntity, lib.IncorrectUserNameOrPassword)
+
+	if user.Deprovisioned() {
+		loginFailed(lib.UserDeactivated)
+		lib.AbortWithError(c, lib.ErrUserDeactivated)
 		return
 	}
-
 	if !user.Activated {
-		lib.ErrorResponse(c, http.StatusUnprocessableEntity, lib.UserNotVerified)
+		loginFailed(lib.UserNotVerified)
+		lib.AbortWithError(c, lib.ErrUserNotVerified)
 		return
 	}
 
-	token := controller.jWtService.GenerateToken(user.ID.Hex(), true, time.Minute*15)
+	token := controller.jWtService.GenerateToken(user.ID, true, providers.AccessTokenExpiry)
+
+	refreshToken, err := controller.refreshTokenService.CreateRefreshToken(c.Request.Context(), user.ID)
+	if err != nil {
+		loginFailed("InternalError")
+		lib.AbortWithError(c, err)
+		return
+	}
 
-	refreshToken, err := controller.refreshTokenService.CreateRefreshToken(user.ID)
+	_user, err := models.GetUser(c.Request.Context(), user, controller.blobStore, &controller.configs)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		loginFailed("InternalError")
+		lib.AbortWithError(c, err)
 		return
 	}
 
+	providers.LoginAttemptsTotal.WithLabelValues("success", "").Inc()
+	if controller.sessionCookies.Requested(c) {
+		// the tokens stay in HttpOnly cookies, out of reach of scripts
+		csrfToken, err := controller.sessionCookies.SetSession(c, token, refreshToken)
+		if err != nil {
+			lib.AbortWithError(c, err)
+			return
+		}
+		lib.JsonResponse(c, gin.H{
+			"csrfToken": csrfToken,
+			"user":      _user,
+		})
+		return
+	}
 	lib.JsonResponse(c, gin.H{
 		"accessToken":  token,
 		"refreshToken": refreshToken,
-		"user":         models.GetUser(user, &controller.configs),
+		"user":         _user,
 	})
 }
 
+// loginFailed counts a failed login attempt by reason
+func loginFailed(reason string) {
+	providers.LoginAttemptsTotal.WithLabelValues("failure", reason).Inc()
+}
+
 // POST /api/auth/verify
 func (controller *authController) VerifyEmail(c *gin.Context) {
-	var dto dto.VerifyEmail
-
-	if err := c.ShouldBind(&dto); err != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	dto, ok := lib.Bind[dto.VerifyEmail](c)
+	if !ok {
 		return
 	}
 
-	if validationErr := controller.validate.Struct(dto); validationErr != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, validationErr.Error())
+	_, err := controller.userService.ActivateUser(c.Request.Context(), *dto.Email, *dto.Code, "")
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrTokenExpired)
 		return
 	}
-
-	user, err := controller.userService.ActivateUser(*dto.Email, *dto.Code, "")
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
-		return
-	}
-	if user == nil {
-		lib.ErrorResponse(c, http.StatusUnprocessableEntity, lib.TokenExpired)
+		lib.AbortWithError(c, err)
 		return
 	}
 
@@ -132,37 +163,35 @@ func (controller *authController) VerifyEmail(c *gin.Context) {
 // POST /api/auth/register
 // Register a user
 func (controller *authController) Register(c *gin.Context) {
-	var dto dto.RegisterCredentials
-
-	if err := c.ShouldBind(&dto); err != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, err.Error())
-		return
-	}
-
-	if validationErr := controller.validate.Struct(dto); validationErr != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, validationErr.Error())
+	dto, ok := lib.Bind[dto.RegisterCredentials](c)
+	if !ok {
 		return
 	}
 
-	isUserExists, err := controller.userService.UserExists(*dto.Email)
+	isUserExists, err := controller.userService.UserExists(c.Request.Context(), *dto.Email)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		lib.AbortWithError(c, err)
 		return
 	}
 	if isUserExists {
-		lib.ErrorResponse(c, http.StatusUnprocessableEntity, lib.UserExists)
+		lib.AbortWithError(c, lib.ErrUserExists)
 		return
 	}
 
-	user, err := controller.userService.CreateUser(dto)
+	user, err := controller.userService.CreateUser(c.Request.Context(), *dto)
+	if errors.Is(err, db.ErrDuplicate) {
+		lib.AbortWithError(c, lib.ErrUserExists)
+		return
+	}
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		lib.AbortWithError(c, err)
 		return
 	}
 
-	err = controller.emailService.SendActivationEmail(*user.Email, *user.Firstname, user.ActivationCode)
+	err = controller.emailService.SendActivationEmail(c.Request.Context(), *user.Email, *user.Firstname, user.ActivationCode)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		controller.logger.ErrorContext(c.Request.Context(), "sending email", slog.String("template", "activation"), slog.Any("error", err))
+		lib.AbortWithError(c, err)
 		return
 	}
 
@@ -170,68 +199,102 @@ func (controller *authController) Register(c *gin.Context) {
 }
 
 // PUT /api/auth/refresh/:tokenId
-// Register a user
+// PUT /api/auth/refresh, with the refresh token cookie
+// Get a new access token
 func (controller *authController) RefreshToken(c *gin.Context) {
-	tokenId := c.Param("tokenId")
+	tokenId, fromCookie := controller.refreshTokenId(c)
+	if tokenId == "" {
+		return
+	}
 
-	userId, err := controller.refreshTokenService.FindUserIdbyRefreshToken(tokenId)
+	userId, err := controller.refreshTokenService.FindUserIdbyRefreshToken(c.Request.Context(), tokenId)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			lib.ErrorResponse(c, http.StatusUnprocessableEntity, lib.TokenNotFound)
+		if errors.Is(err, db.ErrNotFound) {
+			lib.AbortWithError(c, lib.ErrTokenNotFound)
 			return
 		}
-		lib.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+		lib.AbortWithError(c, err)
 		return
 	}
 
-	token := controller.jWtService.GenerateToken(userId.Hex(), true, time.Minute*15)
+	token := controller.jWtService.GenerateToken(userId, true, providers.AccessTokenExpiry)
 
+	if fromCookie {
+		controller.sessionCookies.SetAccessToken(c, token)
+		lib.JsonResponse(c, nil)
+		return
+	}
 	lib.JsonResponse(c, gin.H{
 		"accessToken": token,
 	})
 }
 
 // PUT /api/auth/logout/:tokenId
+// PUT /api/auth/logout, with the refresh token cookie
 // Log the user out by removing the refresh token
 func (controller *authController) Logout(c *gin.Context) {
-	tokenId := c.Param("tokenId")
+	tokenId, fromCookie := controller.refreshTokenId(c)
+	if tokenId == "" {
+		return
+	}
 
-	err := controller.refreshTokenService.RemoveRefreshToken(tokenId)
+	err := controller.refreshTokenService.RemoveRefreshToken(c.Request.Context(), tokenId)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		lib.AbortWithError(c, err)
 		return
 	}
+	if fromCookie {
+		controller.sessionCookies.ClearSession(c)
+	}
 
 	lib.JsonResponse(c, nil)
 }
 
+// refreshTokenId returns the refresh token of the :tokenId param or else of
+// the cookie, whose requests must pass the csrf check. It responds and
+// returns an empty id when there is none.
+func (controller *authController) refreshTokenId(c *gin.Context) (string, bool) {
+	if tokenId := c.Param("tokenId"); tokenId != "" {
+		return tokenId, false
+	}
+	tokenId := controller.sessionCookies.RefreshToken(c)
+	if tokenId == "" {
+		lib.AbortWithError(c, lib.ErrTokenNotFound)
+		return "", false
+	}
+	if err := controller.sessionCookies.CheckCSRF(c); err != nil {
+		lib.AbortWithError(c, lib.ErrCSRF)
+		return "", false
+	}
+	return tokenId, true
+}
+
 // POST /api/auth/forgot-pass
 func (controller *authController) ForgotPass(c *gin.Context) {
-	var dto dto.ForgotPass
-
-	if err := c.ShouldBind(&dto); err != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	dto, ok := lib.Bind[dto.ForgotPass](c)
+	if !ok {
 		return
 	}
 
-	if validationErr := controller.validate.Struct(dto); validationErr != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, validationErr.Error())
+	user, err := controller.userService.UpdateActivationCode(c.Request.Context(), *dto.Email)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrUserNotFound)
 		return
 	}
-
-	user, err := controller.userService.UpdateActivationCode(*dto.Email)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		lib.AbortWithError(c, err)
 		return
 	}
-	if user == nil {
-		lib.ErrorResponse(c, http.StatusUnprocessableEntity, lib.UserNotFound)
+	// the reset link would activate the user again
+	if user.Deprovisioned() {
+		lib.AbortWithError(c, lib.ErrUserDeactivated)
 		return
 	}
 
-	err = controller.emailService.SendResetPassEmail(*user.Email, *user.Firstname, user.ActivationCode)
+	err = controller.emailService.SendResetPassEmail(c.Request.Context(), *user.Email, *user.Firstname, user.ActivationCode)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		controller.logger.ErrorContext(c.Request.Context(), "sending email", slog.String("template", "reset_password"), slog.Any("error", err))
+		lib.AbortWithError(c, err)
 		return
 	}
 
@@ -240,36 +303,34 @@ func (controller *authController) ForgotPass(c *gin.Context) {
 
 // POST /api/auth/resend-activation-email
 func (controller *authController) ResendActivationEmail(c *gin.Context) {
-	var dto dto.ResendActivationEmail
-
-	if err := c.ShouldBind(&dto); err != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	dto, ok := lib.Bind[dto.ResendActivationEmail](c)
+	if !ok {
 		return
 	}
 
-	if validationErr := controller.validate.Struct(dto); validationErr != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, validationErr.Error())
+	user, err := controller.userService.FindUser(c.Request.Context(), *dto.Email)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrUserNotFound)
 		return
 	}
-
-	user, err := controller.userService.FindUser(*dto.Email)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		lib.AbortWithError(c, err)
 		return
 	}
-	if user == nil {
-		lib.ErrorResponse(c, http.StatusUnprocessableEntity, lib.UserNotFound)
+
+	if user.Deprovisioned() {
+		lib.AbortWithError(c, lib.ErrUserDeactivated)
 		return
 	}
-
 	if user.Activated {
-		lib.ErrorResponse(c, http.StatusUnprocessableEntity, lib.UserAlreadyActivated)
+		lib.AbortWithError(c, lib.ErrUserAlreadyActivated)
 		return
 	}
 
-	err = controller.emailService.SendActivationEmail(*user.Email, *user.Firstname, user.ActivationCode)
+	err = controller.emailService.SendActivationEmail(c.Request.Context(), *user.Email, *user.Firstname, user.ActivationCode)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		controller.logger.ErrorContext(c.Request.Context(), "sending email", slog.String("template", "activation"), slog.Any("error", err))
+		lib.AbortWithError(c, err)
 		return
 	}
 
@@ -278,25 +339,18 @@ func (controller *authController) ResendActivationEmail(c *gin.Context) {
 
 // POST /api/auth/reset-password
 func (controller *authController) ResetPass(c *gin.Context) {
-	var dto dto.ResetPassword
-
-	if err := c.ShouldBind(&dto); err != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	dto, ok := lib.Bind[dto.ResetPassword](c)
+	if !ok {
 		return
 	}
 
-	if validationErr := controller.validate.Struct(dto); validationErr != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, validationErr.Error())
+	_, err := controller.userService.ActivateUser(c.Request.Context(), *dto.Email, *dto.Code, *dto.Password)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrTokenExpired)
 		return
 	}
-
-	user, err := controller.userService.ActivateUser(*dto.Email, *dto.Code, *dto.Password)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
-		return
-	}
-	if user == nil {
-		lib.ErrorResponse(c, http.StatusUnprocessableEntity, lib.TokenExpired)
+		lib.AbortWithError(c, err)
 		return
 	}
 
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"GoApp/db"
+	"GoApp/lib"
+	"GoApp/providers"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// avatar controllers interface
+type AvatarController interface {
+	Avatar(c *gin.Context)
+}
+
+type avatarController struct {
+	logger        *slog.Logger
+	configs       providers.Config
+	userService   db.UserService
+	avatarService providers.AvatarService
+}
+
+func AvatarHandler(
+	userService *db.UserService,
+	avatarService *providers.AvatarService,
+	configs *providers.Config,
+	logger *slog.Logger,
+) AvatarController {
+	return &avatarController{
+		logger:        logger,
+		configs:       *configs,
+		userService:   *userService,
+		avatarService: *avatarService,
+	}
+}
+
+// GET /public/avatar/:file
+// generated avatar of a user, :file is the user id followed by .svg or .png
+// the optional size and style (initials, identicon) query params tune the image
+func (controller *avatarController) Avatar(c *gin.Context) {
+	file := c.Param("file")
+	format := strings.TrimPrefix(path.Ext(file), ".")
+	if format != providers.AvatarFormatSVG && format != providers.AvatarFormatPNG {
+		lib.AbortWithError(c, lib.ErrAvatarNotFound)
+		return
+	}
+	userId := strings.TrimSuffix(file, path.Ext(file))
+
+	size := controller.configs.AvatarSize
+	if c.Query("size") != "" {
+		var err error
+		size, err = strconv.Atoi(c.Query("size"))
+		if err != nil || size < 16 || size > controller.configs.AvatarMaxSize {
+			lib.AbortWithError(c, lib.NewError(http.StatusBadRequest, lib.InvalidParameter, "invalid size"))
+			return
+		}
+	}
+	style := c.DefaultQuery("style", controller.configs.AvatarStyle)
+	if style != providers.AvatarStyleInitials && style != providers.AvatarStyleIdenticon {
+		lib.AbortWithError(c, lib.NewError(http.StatusBadRequest, lib.InvalidParameter, "invalid style"))
+		return
+	}
+
+	user, err := controller.userService.FindById(c.Request.Context(), userId)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrAvatarNotFound)
+		return
+	}
+	if err != nil {
+		lib.AbortWithError(c, err)
+		return
+	}
+
+	options := providers.AvatarOptions{
+		Seed:      userId,
+		Firstname: *user.Firstname,
+		Lastname:  *user.Lastname,
+		Style:     style,
+		Format:    format,
+		Size:      size,
+	}
+
+	// the avatar only changes with its inputs, so they make a stable etag
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%v|%v", options, controller.avatarService.Palette())))
+	etag := fmt.Sprintf(`"%x"`, hash[:16])
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(controller.configs.AvatarMaxAge.Seconds())))
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	data, err := controller.avatarService.Generate(options)
+	if err != nil {
+		controller.logger.ErrorContext(c.Request.Context(), "generating avatar", slog.Any("error", err))
+		lib.AbortWithError(c, err)
+		return
+	}
+
+	contentType := "image/png"
+	if format == providers.AvatarFormatSVG {
+		contentType = "image/svg+xml"
+		// never let a served svg run scripts
+		c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"GoApp/db"
+	dto "GoApp/dto/user"
+	"GoApp/lib"
+	"GoApp/providers"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceCodeGrantType is the grant_type of the polls of the devices
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DeviceCodeExpiry is how long the user has to enter the code of a device
+const DeviceCodeExpiry = 10 * time.Minute
+
+// DevicePollInterval is how long a device waits between two polls, it grows
+// by DeviceSlowDown every time the device polls too often
+const DevicePollInterval = 5 * time.Second
+const DeviceSlowDown = 5 * time.Second
+
+// DeviceController implements the device authorization grant of RFC 8628
+// for the TVs and CLIs which cannot show the sign in page. The device gets
+// its codes at /oauth/device/code and polls /oauth/token, see
+// TokenController, while a signed in user enters the user code on the page
+// of FE_DEVICE_URL, which approves it through /v1/user/device.
+type DeviceController interface {
+	DeviceCode(c *gin.Context)
+	Device(c *gin.Context)
+	DecideDevice(c *gin.Context)
+}
+
+// DeviceCodeResponse is the response of the device authorization endpoint,
+// RFC 8628 section 3.2
+type DeviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code" description:"to show to the user, such as BCDF-GHJK"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete" description:"the verification_uri with the user code, for a QR code"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval" description:"seconds to wait between two polls of the token endpoint"`
+}
+
+// DeviceResponse describes a pending device authorization to the user
+// approving it
+type DeviceResponse struct {
+	UserCode   string    `json:"userCode"`
+	ClientName string    `json:"clientName"`
+	Scopes     []string  `json:"scopes" description:"what the device will be able to do"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type deviceController struct {
+	logger                     *slog.Logger
+	configs                    providers.Config
+	clientService              db.ClientService
+	deviceAuthorizationService db.DeviceAuthorizationService
+}
+
+func DeviceHandler(
+	clientService *db.ClientService,
+	deviceAuthorizationService *db.DeviceAuthorizationService,
+	configs *providers.Config,
+	logger *slog.Logger,
+) DeviceController {
+	return &deviceController{
+		logger:                     logger,
+		configs:                    *configs,
+		clientService:              *clientService,
+		deviceAuthorizationService: *deviceAuthorizationService,
+	}
+}
+
+// POST /oauth/device/code
+// Start a device authorization, RFC 8628 section 3.1
+func (controller *deviceController) DeviceCode(c *gin.Context) {
+	if controller.configs.DeviceUrl == "" {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthUnauthorizedClient, "the device authorization grant is not enabled")
+		return
+	}
+
+	request := db.DeviceAuthorization{
+		ClientId:  c.GetString("clientId"),
+		Scope:     strings.Join(supportedScopes(c.PostForm("scope")), " "),
+		Interval:  DevicePollInterval,
+		ExpiresAt: time.Now().Add(DeviceCodeExpiry),
+	}
+	var authorization *db.DeviceAuthorization
+	var err error
+	// the user codes are short, another pending request may have the same
+	for attempt := 0; attempt < 3; attempt++ {
+		authorization, err = controller.deviceAuthorizationService.CreateDeviceAuthorization(c.Request.Context(), request)
+		if !errors.Is(err, db.ErrDuplicate) {
+			break
+		}
+	}
+	if err != nil {
+		lib.OAuthInternalError(c, err)
+		return
+	}
+
+	userCode := formatUserCode(authorization.UserCode)
+	lib.OAuthResponse(c, DeviceCodeResponse{
+		DeviceCode:              authorization.DeviceCode,
+		UserCode:                userCode,
+		VerificationUri:         controller.configs.DeviceUrl,
+		VerificationUriComplete: controller.configs.DeviceUrl + "?" + url.Values{"user_code": {userCode}}.Encode(),
+		ExpiresIn:               int64(DeviceCodeExpiry.Seconds()),
+		Interval:                int64(authorization.Interval.Seconds()),
+	})
+}
+
+// GET /v1/user/device
+// Describe the pending device authorization of a user code, before the user
+// approves it
+func (controller *deviceController) Device(c *gin.Context) {
+	authorization, ok := controller.pendingAuthorization(c, c.Query("userCode"))
+	if !ok {
+		return
+	}
+	client, err := controller.clientService.FindClient(c.Request.Context(), authorization.ClientId)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrTokenExpired)
+		return
+	}
+	if err != nil {
+		lib.AbortWithError(c, err)
+		return
+	}
+
+	lib.JsonResponse(c, DeviceResponse{
+		UserCode:   formatUserCode(authorization.UserCode),
+		ClientName: client.Name,
+		Scopes:     scopeDescriptions(authorization.Scope),
+		ExpiresAt:  authorization.ExpiresAt,
+	})
+}
+
+// POST /v1/user/device
+// Approve or deny a device authorization
+func (controller *deviceController) DecideDevice(c *gin.Context) {
+	userId := c.MustGet("userId").(string)
+	dto, ok := lib.Bind[dto.DecideDevice](c)
+	if !ok {
+		return
+	}
+	authorization, ok := controller.pendingAuthorization(c, dto.UserCode)
+	if !ok {
+		return
+	}
+
+	var err error
+	if dto.Action == "allow" {
+		err = controller.deviceAuthorizationService.ApproveDeviceAuthorization(c.Request.Context(), authorization.UserCode, userId, time.Now())
+	} else {
+		err = controller.deviceAuthorizationService.DenyDeviceAuthorization(c.Request.Context(), authorization.UserCode, time.Now())
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		// decided or expired since it was found
+		lib.AbortWithError(c, lib.ErrTokenExpired)
+		return
+	}
+	if err != nil {
+		lib.AbortWithError(c, err)
+		return
+	}
+	controller.logger.InfoContext(c.Request.Context(), "Device authorization decided",
+		slog.String("client_id", authorization.ClientId), slog.String("action", dto.Action))
+	lib.JsonResponse(c, nil)
+}
+
+// pendingAuthorization returns the pending authorization of a user code as
+// typed by the user, responding when there is none
+func (controller *deviceController) pendingAuthorization(c *gin.Context, userCode string) (*db.DeviceAuthorization, bool) {
+	authorization, err := controller.deviceAuthorizationService.FindDeviceAuthorization(c.Request.Context(), normalizeUserCode(userCode), time.Now())
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrTokenExpired)
+		return nil, false
+	}
+	if err != nil {
+		lib.AbortWithError(c, err)
+		return nil, false
+	}
+	return authorization, true
+}
+
+// normalizeUserCode accepts the user codes in lower case and without or
+// with other separators than the dash of formatUserCode
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, userCode)
+}
+
+// formatUserCode splits a user code in two halves, easier to read out
+func formatUserCode(userCode string) string {
+	if len(userCode) != 8 {
+		return userCode
+	}
+	return userCode[:4] + "-" + userCode[4:]
+}
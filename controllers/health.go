@@ -2,6 +2,13 @@ package controllers
 
 import (
 	"GoApp/lib"
+	"GoApp/providers"
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,16 +16,133 @@ import (
 //auth controllers interface
 type HealthController interface {
 	Status(c *gin.Context)
+	Liveness(c *gin.Context)
+	Readiness(c *gin.Context)
+	Drain()
+}
+
+// HealthCheck is a dependency probed by the readiness endpoint. Results of
+// slow or expensive checks can be reused for CacheFor, and failing Optional
+// checks are reported without making the service unready.
+type HealthCheck struct {
+	Name     string
+	Check    func(ctx context.Context) error
+	Timeout  time.Duration
+	CacheFor time.Duration
+	Optional bool
+}
+
+// healthCheckResult is what the readiness endpoint tells of a check, which
+// is public: the errors are logged, not returned
+type healthCheckResult struct {
+	Status    string `json:"status"`
+	checkedAt time.Time
 }
 
 type healthController struct {
+	logger   *slog.Logger
+	checks   []HealthCheck
+	draining int32
+
+	mutex   sync.Mutex
+	results map[string]healthCheckResult
 }
 
-func HealthControllerHandler() HealthController {
-	return &healthController{}
+func HealthControllerHandler(checks []HealthCheck, logger *slog.Logger) HealthController {
+	return &healthController{
+		logger:  logger,
+		checks:  checks,
+		results: map[string]healthCheckResult{},
+	}
 }
 
 // GET /
 func (controller *healthController) Status(c *gin.Context) {
 	lib.JsonResponse(c, nil)
 }
+
+// GET /healthz
+// the process is up and serving requests
+func (controller *healthController) Liveness(c *gin.Context) {
+	lib.JsonResponse(c, nil)
+}
+
+// GET /readyz
+// the service and the dependencies it needs are able to handle traffic
+func (controller *healthController) Readiness(c *gin.Context) {
+	ready := atomic.LoadInt32(&controller.draining) == 0
+	results := map[string]healthCheckResult{}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range controller.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			result := controller.run(c.Request.Context(), check)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			results[check.Name] = result
+			if result.Status != "up" && !check.Optional {
+				ready = false
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	status, httpStatus := "Success", http.StatusOK
+	if !ready {
+		status, httpStatus = "Failed", http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(httpStatus, gin.H{
+		"status": status,
+		"data": gin.H{
+			"draining": atomic.LoadInt32(&controller.draining) == 1,
+			"checks":   results,
+			"build":    providers.GetBuildInfo(),
+		},
+	})
+}
+
+// Drain makes the readiness probe fail from now on, so load balancers stop
+// routing new traffic while the server shuts down
+func (controller *healthController) Drain() {
+	atomic.StoreInt32(&controller.draining, 1)
+}
+
+// run executes a check, or returns its cached result while that is still fresh
+func (controller *healthController) run(ctx context.Context, check HealthCheck) healthCheckResult {
+	if check.CacheFor > 0 {
+		controller.mutex.Lock()
+		cached, ok := controller.results[check.Name]
+		controller.mutex.Unlock()
+		if ok && time.Since(cached.checkedAt) < check.CacheFor {
+			return cached
+		}
+	}
+
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := healthCheckResult{Status: "up", checkedAt: start}
+	if err != nil {
+		result.Status = "down"
+		controller.logger.WarnContext(ctx, "Health check failed", slog.String("check", check.Name),
+			slog.Bool("optional", check.Optional), slog.Duration("latency", time.Since(start)), slog.Any("error", err))
+	}
+
+	if check.CacheFor > 0 {
+		controller.mutex.Lock()
+		controller.results[check.Name] = result
+		controller.mutex.Unlock()
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadinessHidesErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	failure := errors.New("dial tcp db.internal:5432: password authentication failed for user admin")
+	controller := HealthControllerHandler([]HealthCheck{
+		{Name: "database", Check: func(ctx context.Context) error { return failure }},
+		{Name: "smtp", Check: func(ctx context.Context) error { return failure }, Optional: true},
+		{Name: "storage", Check: func(ctx context.Context) error { return nil }},
+	}, slog.New(slog.NewTextHandler(&logs, nil)))
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	controller.Readiness(c)
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d", recorder.Code)
+	}
+	body := recorder.Body.String()
+	if strings.Contains(body, "db.internal") || strings.Contains(body, "password") {
+		t.Fatalf("the response leaks the error: %s", body)
+	}
+	for _, check := range []string{`"database":{"status":"down"}`, `"smtp":{"status":"down"}`, `"storage":{"status":"up"}`} {
+		if !strings.Contains(body, check) {
+			t.Errorf("%s missing from %s", check, body)
+		}
+	}
+	if !strings.Contains(logs.String(), "db.internal:5432") || !strings.Contains(logs.String(), "check=database") {
+		t.Fatalf("the error was not logged: %s", logs.String())
+	}
+}
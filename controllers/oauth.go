@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"GoApp/db"
+	"GoApp/lib"
+	"GoApp/providers"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthController implements the token endpoints for the registered clients,
+// which AuthenticateClient authenticates beforehand. A client only revokes
+// and introspects the tokens issued to it, RFC 7009 section 2.1, so that the
+// relying parties and the service accounts cannot end or probe the sessions
+// of every user. The resource servers are allowed ScopeIntrospect or
+// ScopeRevoke instead, and handle every token, those of login included.
+type OAuthController interface {
+	Revoke(c *gin.Context)
+	Introspect(c *gin.Context)
+}
+
+// The allowed scopes of the clients acting as resource servers, see client create --scope
+const (
+	ScopeIntrospect = "introspect"
+	ScopeRevoke     = "revoke"
+)
+
+// IntrospectionResponse is the RFC 7662 description of a token, inactive
+// tokens only have Active set
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty" validate:"omitempty,oneof=access_token refresh_token"`
+	Sub       string `json:"sub,omitempty" description:"the user id, or the client id of a service account"`
+	ClientId  string `json:"client_id,omitempty" description:"the client the token was issued to, none for the tokens of login"`
+	Scope     string `json:"scope,omitempty" description:"the scopes of a service account, or what the user consented to"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+type oauthController struct {
+	logger              *slog.Logger
+	jWtService          providers.JWTService
+	configs             providers.Config
+	refreshTokenService db.RefreshTokenService
+	revokedTokenService db.RevokedTokenService
+}
+
+func OAuthHandler(
+	jWtService *providers.JWTService,
+	refreshTokenService *db.RefreshTokenService,
+	revokedTokenService *db.RevokedTokenService,
+	configs *providers.Config,
+	logger *slog.Logger,
+) OAuthController {
+	return &oauthController{
+		logger:              logger,
+		jWtService:          *jWtService,
+		configs:             *configs,
+		refreshTokenService: *refreshTokenService,
+		revokedTokenService: *revokedTokenService,
+	}
+}
+
+// POST /oauth/revoke
+// Revoke an access or refresh token, RFC 7009. Unknown and invalid tokens,
+// and those of other clients unless allowed ScopeRevoke, are answered like
+// revoked ones and left alone, so that clients cannot probe for tokens.
+func (controller *oauthController) Revoke(c *gin.Context) {
+	token, ok := tokenParam(c)
+	if !ok {
+		return
+	}
+	clientId := c.GetString("clientId")
+	anyToken := allowedScope(c, ScopeRevoke)
+
+	if isJWT(token) {
+		claims, ok := controller.accessTokenClaims(token)
+		if !ok || (!anyToken && tokenClient(claims) != clientId) {
+			c.Status(http.StatusOK)
+			return
+		}
+		jti, _ := claims["jti"].(string)
+		if jti == "" {
+			// issued before tokens had an id, they expire soon enough
+			lib.OAuthError(c, http.StatusBadRequest, lib.OAuthUnsupportedTokenType, "the token has no jti and cannot be revoked")
+			return
+		}
+		if err := controller.revokedTokenService.RevokeToken(c.Request.Context(), jti, claimTime(claims, "exp")); err != nil {
+			lib.OAuthInternalError(c, err)
+			return
+		}
+		controller.logger.InfoContext(c.Request.Context(), "Access token revoked", slog.String("jti", jti), slog.String("client_id", clientId))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	refreshToken, err := controller.refreshTokenService.FindRefreshToken(c.Request.Context(), token)
+	if errors.Is(err, db.ErrNotFound) {
+		c.Status(http.StatusOK)
+		return
+	}
+	if err != nil {
+		lib.OAuthInternalError(c, err)
+		return
+	}
+	if !anyToken && refreshToken.ClientId != clientId {
+		c.Status(http.StatusOK)
+		return
+	}
+	if err := controller.refreshTokenService.RemoveRefreshToken(c.Request.Context(), token); err != nil && !errors.Is(err, db.ErrNotFound) {
+		lib.OAuthInternalError(c, err)
+		return
+	}
+	controller.logger.InfoContext(c.Request.Context(), "Refresh token revoked", slog.String("client_id", clientId))
+	c.Status(http.StatusOK)
+}
+
+// POST /oauth/introspect
+// Describe an access or refresh token, RFC 7662. The tokens of other clients
+// are inactive unless allowed ScopeIntrospect.
+func (controller *oauthController) Introspect(c *gin.Context) {
+	token, ok := tokenParam(c)
+	if !ok {
+		return
+	}
+	clientId := c.GetString("clientId")
+	anyToken := allowedScope(c, ScopeIntrospect)
+
+	if isJWT(token) {
+		claims, ok := controller.accessTokenClaims(token)
+		if !ok || (!anyToken && tokenClient(claims) != clientId) {
+			lib.OAuthResponse(c, IntrospectionResponse{Active: false})
+			return
+		}
+		jti, _ := claims["jti"].(string)
+		if jti != "" {
+			revoked, err := controller.revokedTokenService.IsTokenRevoked(c.Request.Context(), jti)
+			if err != nil {
+				lib.OAuthInternalError(c, err)
+				return
+			}
+			if revoked {
+				lib.OAuthResponse(c, IntrospectionResponse{Active: false})
+				return
+			}
+		}
+		sub, _ := claims["sub"].(string)
+		iss, _ := claims["iss"].(string)
+		scope, _ := claims["scope"].(string)
+		lib.OAuthResponse(c, IntrospectionResponse{
+			Active:    true,
+			TokenType: "access_token",
+			Sub:       sub,
+			ClientId:  tokenClient(claims),
+			Scope:     scope,
+			Exp:       claimTime(claims, "exp").Unix(),
+			Iat:       claimTime(claims, "iat").Unix(),
+			Iss:       iss,
+			Jti:       jti,
+		})
+		return
+	}
+
+	refreshToken, err := controller.refreshTokenService.FindRefreshToken(c.Request.Context(), token)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.OAuthResponse(c, IntrospectionResponse{Active: false})
+		return
+	}
+	if err != nil {
+		lib.OAuthInternalError(c, err)
+		return
+	}
+	if !anyToken && refreshToken.ClientId != clientId {
+		lib.OAuthResponse(c, IntrospectionResponse{Active: false})
+		return
+	}
+	lib.OAuthResponse(c, IntrospectionResponse{
+		Active:    true,
+		TokenType: "refresh_token",
+		Sub:       refreshToken.UserId,
+		ClientId:  refreshToken.ClientId,
+		Scope:     refreshToken.Scope,
+		Iat:       refreshToken.CreatedAt.Unix(),
+	})
+}
+
+// allowedScope reports whether the authenticated client is allowed scope
+func allowedScope(c *gin.Context, scope string) bool {
+	client, ok := c.MustGet("client").(*db.Client)
+	return ok && client.HasScope(scope)
+}
+
+// tokenParam returns the token form parameter, responding with
+// invalid_request when there is none. token_type_hint is only a hint,
+// both kinds of tokens are told apart by their format.
+func tokenParam(c *gin.Context) (string, bool) {
+	token := c.PostForm("token")
+	if token == "" {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidRequest, "the token parameter is required")
+		return "", false
+	}
+	return token, true
+}
+
+// isJWT tells the access tokens from the refresh tokens, which are uuids
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// accessTokenClaims returns the claims of a valid access token of this app
+func (controller *oauthController) accessTokenClaims(token string) (jwt.MapClaims, bool) {
+	parsed, err := controller.jWtService.ValidateToken(token)
+	if err != nil || !parsed.Valid {
+		return nil, false
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, false
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, false
+	}
+	return claims, true
+}
+
+// tokenClient returns the client an access token was issued to: the service
+// account itself, or the aud of the tokens of its users. The tokens of login
+// have none.
+func tokenClient(claims jwt.MapClaims) string {
+	if isUser, _ := claims["user"].(bool); !isUser {
+		sub, _ := claims["sub"].(string)
+		return sub
+	}
+	aud, _ := claims["aud"].(string)
+	return aud
+}
+
+// claimTime reads a NumericDate claim, which jwt-go decodes as a float64
+func claimTime(claims jwt.MapClaims, name string) time.Time {
+	seconds, _ := claims[name].(float64)
+	return time.Unix(int64(seconds), 0)
+}
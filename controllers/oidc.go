@@ -0,0 +1,593 @@
+package controllers
+
+import (
+	"GoApp/db"
+	"GoApp/lib"
+	"GoApp/models"
+	"GoApp/providers"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AuthorizationCodeExpiry is how long the clients have to exchange a code
+const AuthorizationCodeExpiry = time.Minute
+
+// RecaptchaAuthorizeAction is the reCAPTCHA action of the sign in form of
+// /oauth/authorize
+const RecaptchaAuthorizeAction = "authorize"
+
+// OIDCScopes are the supported scopes, in the order of the consent screen,
+// with what they let the client do
+var OIDCScopes = []struct{ Name, Description string }{
+	{"openid", "Sign you in"},
+	{"profile", "See your name and profile picture"},
+	{"email", "See your email address"},
+}
+
+// supportedScopes returns the supported scopes of a scope parameter in the
+// order of OIDCScopes, unknown scopes are ignored, OpenID Connect Core
+// section 3.1.2.1
+func supportedScopes(scope string) []string {
+	requested := strings.Fields(scope)
+	scopes := []string{}
+	for _, supported := range OIDCScopes {
+		if hasValue(requested, supported.Name) {
+			scopes = append(scopes, supported.Name)
+		}
+	}
+	return scopes
+}
+
+// scopeDescriptions describes the supported scopes of scope to the user
+func scopeDescriptions(scope string) []string {
+	requested := strings.Fields(scope)
+	descriptions := []string{}
+	for _, supported := range OIDCScopes {
+		if hasValue(requested, supported.Name) {
+			descriptions = append(descriptions, supported.Description)
+		}
+	}
+	return descriptions
+}
+
+// OIDCController makes the app an OpenID Connect provider: the users of the
+// registered clients sign in at /oauth/authorize, see TokenController for
+// the code exchange
+type OIDCController interface {
+	Discovery(c *gin.Context)
+	JWKS(c *gin.Context)
+	Authorize(c *gin.Context)
+	AuthorizeForm(c *gin.Context)
+	UserInfo(c *gin.Context)
+}
+
+// UserInfoResponse holds the standard claims of the user, OpenID Connect
+// Core section 5.3, with only those of the scope the user consented to
+type UserInfoResponse struct {
+	Sub           string `json:"sub"`
+	Email         string `json:"email,omitempty" description:"email scope"`
+	EmailVerified *bool  `json:"email_verified,omitempty" description:"email scope"`
+	Name          string `json:"name,omitempty" description:"profile scope"`
+	GivenName     string `json:"given_name,omitempty" description:"profile scope"`
+	FamilyName    string `json:"family_name,omitempty" description:"profile scope"`
+	Picture       string `json:"picture,omitempty" description:"profile scope"`
+	UpdatedAt     int64  `json:"updated_at,omitempty" description:"profile scope"`
+}
+
+type oidcController struct {
+	logger                   *slog.Logger
+	configs                  providers.Config
+	idTokenService           providers.IDTokenService
+	userService              db.UserService
+	refreshTokenService      db.RefreshTokenService
+	clientService            db.ClientService
+	authorizationCodeService db.AuthorizationCodeService
+	sessionCookies           providers.SessionCookieService
+	blobStore                providers.BlobStore
+	authorizeTemplate        *template.Template
+}
+
+func OIDCHandler(
+	idTokenService *providers.IDTokenService,
+	userService *db.UserService,
+	refreshTokenService *db.RefreshTokenService,
+	clientService *db.ClientService,
+	authorizationCodeService *db.AuthorizationCodeService,
+	sessionCookies *providers.SessionCookieService,
+	blobStore *providers.BlobStore,
+	configs *providers.Config,
+	logger *slog.Logger,
+) OIDCController {
+	authorizeTemplate, err := template.ParseFiles("templates/Authorize.html")
+	if err != nil {
+		panic(err)
+	}
+	return &oidcController{
+		logger:                   logger,
+		configs:                  *configs,
+		idTokenService:           *idTokenService,
+		userService:              *userService,
+		refreshTokenService:      *refreshTokenService,
+		clientService:            *clientService,
+		authorizationCodeService: *authorizationCodeService,
+		sessionCookies:           *sessionCookies,
+		blobStore:                *blobStore,
+		authorizeTemplate:        authorizeTemplate,
+	}
+}
+
+// GET /.well-known/openid-configuration
+// The provider metadata the clients configure themselves with
+func (controller *oidcController) Discovery(c *gin.Context) {
+	issuer := controller.idTokenService.Issuer()
+	scopes := []string{}
+	for _, scope := range OIDCScopes {
+		scopes = append(scopes, scope.Name)
+	}
+	grantTypes := []string{"authorization_code", "refresh_token", "client_credentials"}
+	discovery := gin.H{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"revocation_endpoint":                   issuer + "/oauth/revoke",
+		"introspection_endpoint":                issuer + "/oauth/introspect",
+		"scopes_supported":                      scopes,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 grantTypes,
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "nonce", "email", "email_verified", "name", "given_name", "family_name", "picture"},
+	}
+	if controller.configs.DeviceUrl != "" {
+		discovery["device_authorization_endpoint"] = issuer + "/oauth/device/code"
+		discovery["grant_types_supported"] = append(grantTypes, DeviceCodeGrantType)
+	}
+	c.JSON(http.StatusOK, discovery)
+}
+
+// GET /.well-known/jwks.json
+// The public keys verifying the ID tokens
+func (controller *oidcController) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, controller.idTokenService.JWKS())
+}
+
+// authorizationRequest holds the parameters of /oauth/authorize, which the
+// forms of the page send back as hidden fields
+type authorizationRequest struct {
+	ClientId            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+}
+
+func readAuthorizationRequest(form url.Values) authorizationRequest {
+	return authorizationRequest{
+		ClientId:            form.Get("client_id"),
+		RedirectURI:         form.Get("redirect_uri"),
+		ResponseType:        form.Get("response_type"),
+		Scope:               form.Get("scope"),
+		State:               form.Get("state"),
+		Nonce:               form.Get("nonce"),
+		CodeChallenge:       form.Get("code_challenge"),
+		CodeChallengeMethod: form.Get("code_challenge_method"),
+		Prompt:              form.Get("prompt"),
+	}
+}
+
+type formParam struct {
+	Name  string
+	Value string
+}
+
+func (request *authorizationRequest) params() []formParam {
+	params := []formParam{}
+	for _, param := range []formParam{
+		{"client_id", request.ClientId},
+		{"redirect_uri", request.RedirectURI},
+		{"response_type", request.ResponseType},
+		{"scope", request.Scope},
+		{"state", request.State},
+		{"nonce", request.Nonce},
+		{"code_challenge", request.CodeChallenge},
+		{"code_challenge_method", request.CodeChallengeMethod},
+	} {
+		if param.Value != "" {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// authorizePage is the data of templates/Authorize.html
+type authorizePage struct {
+	AppName    string
+	ClientName string
+	// Fatal errors cannot be sent back to the client, the page only shows them
+	Fatal     bool
+	Login     bool
+	Error     string
+	Email     string
+	Scopes    []string
+	CSRFToken string
+	Params    []formParam
+	// the sign in form runs reCAPTCHA when a site key is configured
+	RecaptchaSiteKey string
+	ScriptNonce      string
+}
+
+// GET /oauth/authorize
+// Sign the user in and ask for their consent
+func (controller *oidcController) Authorize(c *gin.Context) {
+	request := readAuthorizationRequest(c.Request.URL.Query())
+	client, ok := controller.checkAuthorizationRequest(c, &request)
+	if !ok {
+		return
+	}
+	user, err := controller.signedInUser(c)
+	if err != nil {
+		controller.renderFatal(c, err)
+		return
+	}
+
+	prompts := strings.Fields(request.Prompt)
+	switch {
+	case hasValue(prompts, "none") && user == nil:
+		controller.redirectError(c, &request, lib.OAuthLoginRequired, "the user is not signed in")
+	case hasValue(prompts, "none"):
+		// the consent is asked every time
+		controller.redirectError(c, &request, lib.OAuthConsentRequired, "the user has to consent")
+	case user == nil || hasValue(prompts, "login"):
+		controller.renderLogin(c, http.StatusOK, &request, client, "", "")
+	default:
+		controller.renderConsent(c, &request, client, user)
+	}
+}
+
+// POST /oauth/authorize
+// The sign in and consent forms
+func (controller *oidcController) AuthorizeForm(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		controller.renderPage(c, http.StatusBadRequest, authorizePage{Fatal: true, Error: "The form could not be read."})
+		return
+	}
+	request := readAuthorizationRequest(c.Request.PostForm)
+	client, ok := controller.checkAuthorizationRequest(c, &request)
+	if !ok {
+		return
+	}
+	if err := controller.sessionCookies.CheckSignInForm(c, c.PostForm("csrf_token")); err != nil {
+		controller.renderPage(c, http.StatusForbidden, authorizePage{Fatal: true, Error: "The form has expired, go back to " + client.Name + " and sign in again."})
+		return
+	}
+
+	switch c.PostForm("action") {
+	case "login":
+		controller.login(c, &request, client)
+	case "switch":
+		if err := controller.endSignInSession(c); err != nil {
+			controller.renderFatal(c, err)
+			return
+		}
+		controller.renderLogin(c, http.StatusOK, &request, client, "", "")
+	case "allow":
+		user, err := controller.signedInUser(c)
+		if err != nil {
+			controller.renderFatal(c, err)
+			return
+		}
+		if user == nil {
+			controller.renderLogin(c, http.StatusOK, &request, client, "", "Your session has ended, sign in again.")
+			return
+		}
+		code, err := controller.authorizationCodeService.CreateAuthorizationCode(c.Request.Context(), db.AuthorizationCode{
+			ClientId:      client.ClientId,
+			UserId:        user.ID,
+			RedirectURI:   request.RedirectURI,
+			Scope:         request.Scope,
+			Nonce:         request.Nonce,
+			CodeChallenge: request.CodeChallenge,
+			ExpiresAt:     time.Now().Add(AuthorizationCodeExpiry),
+		})
+		if err != nil {
+			controller.renderFatal(c, err)
+			return
+		}
+		controller.redirect(c, &request, url.Values{"code": {code}})
+	case "deny":
+		controller.redirectError(c, &request, lib.OAuthAccessDenied, "the user denied the access")
+	default:
+		controller.renderPage(c, http.StatusBadRequest, authorizePage{Fatal: true, Error: "The form could not be read."})
+	}
+}
+
+// login checks the reCAPTCHA and the credentials of the sign in form like
+// Login does, then asks for the consent
+func (controller *oidcController) login(c *gin.Context, request *authorizationRequest, client *db.Client) {
+	email, password := c.PostForm("email"), c.PostForm("password")
+	if secret := controller.configs.RecaptchaSecret; secret != "" {
+		if err := providers.CheckRecaptcha(c.Request.Context(), secret, c.PostForm("g-recaptcha-response"), RecaptchaAuthorizeAction); err != nil {
+			c.Error(lib.ErrRecaptchaFailed.Wrap(err))
+			loginFailed(lib.RecaptchaFailed)
+			controller.renderLogin(c, http.StatusUnauthorized, request, client, email, "The reCAPTCHA check failed, try again.")
+			return
+		}
+	}
+	user, err := controller.userService.FindUser(c.Request.Context(), email)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		loginFailed("InternalError")
+		controller.renderFatal(c, err)
+		return
+	}
+	if err == nil {
+		_, span := providers.Tracer.Start(c.Request.Context(), "bcrypt.compare")
+		err = bcrypt.CompareHashAndPassword([]byte(*user.Password), []byte(password))
+		span.End()
+	}
+	if err != nil {
+		loginFailed(lib.IncorrectUserNameOrPassword)
+		controller.renderLogin(c, http.StatusUnauthorized, request, client, email, "Incorrect email or password.")
+		return
+	}
+	if !user.Activated {
+		loginFailed(lib.UserNotVerified)
+		controller.renderLogin(c, http.StatusForbidden, request, client, email, "Verify your email address before signing in.")
+		return
+	}
+
+	if err := controller.endSignInSession(c); err != nil {
+		controller.renderFatal(c, err)
+		return
+	}
+	refreshToken, err := controller.refreshTokenService.CreateRefreshToken(c.Request.Context(), user.ID)
+	if err != nil {
+		loginFailed("InternalError")
+		controller.renderFatal(c, err)
+		return
+	}
+	providers.LoginAttemptsTotal.WithLabelValues("success", "").Inc()
+	controller.sessionCookies.SetSignInSession(c, refreshToken)
+	controller.renderConsent(c, request, client, user)
+}
+
+// checkAuthorizationRequest validates the request, normalizing its scope.
+// Until the client and the redirect URI are known to be valid, errors are
+// shown to the user instead of being sent to the redirect URI, RFC 6749
+// section 4.1.2.1.
+func (controller *oidcController) checkAuthorizationRequest(c *gin.Context, request *authorizationRequest) (*db.Client, bool) {
+	if request.ClientId == "" {
+		controller.renderPage(c, http.StatusBadRequest, authorizePage{Fatal: true, Error: "The application did not say who it is."})
+		return nil, false
+	}
+	client, err := controller.clientService.FindClient(c.Request.Context(), request.ClientId)
+	if errors.Is(err, db.ErrNotFound) {
+		controller.renderPage(c, http.StatusBadRequest, authorizePage{Fatal: true, Error: "The application is not registered."})
+		return nil, false
+	}
+	if err != nil {
+		controller.renderFatal(c, err)
+		return nil, false
+	}
+	if !client.HasRedirectURI(request.RedirectURI) {
+		controller.renderPage(c, http.StatusBadRequest, authorizePage{Fatal: true, Error: "The redirect URI is not registered for " + client.Name + "."})
+		return nil, false
+	}
+
+	if request.ResponseType != "code" {
+		controller.redirectError(c, request, lib.OAuthUnsupportedResponseType, "only the code response type is supported")
+		return nil, false
+	}
+	scopes := supportedScopes(request.Scope)
+	if !hasValue(scopes, "openid") {
+		controller.redirectError(c, request, lib.OAuthInvalidScope, "the openid scope is required")
+		return nil, false
+	}
+	request.Scope = strings.Join(scopes, " ")
+	if len(request.CodeChallenge) != 43 || request.CodeChallengeMethod != "S256" {
+		controller.redirectError(c, request, lib.OAuthInvalidRequest, "a S256 code_challenge is required")
+		return nil, false
+	}
+	if prompts := strings.Fields(request.Prompt); hasValue(prompts, "none") && len(prompts) > 1 {
+		controller.redirectError(c, request, lib.OAuthInvalidRequest, "prompt none cannot be combined")
+		return nil, false
+	}
+	return client, true
+}
+
+// signedInUser returns the user of the sign in session, nil without one
+func (controller *oidcController) signedInUser(c *gin.Context) (*db.User, error) {
+	tokenId := controller.sessionCookies.SignInSession(c)
+	if tokenId == "" {
+		return nil, nil
+	}
+	userId, err := controller.refreshTokenService.FindUserIdbyRefreshToken(c.Request.Context(), tokenId)
+	if errors.Is(err, db.ErrNotFound) {
+		controller.sessionCookies.ClearSignInSession(c)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := controller.userService.FindById(c.Request.Context(), userId)
+	if errors.Is(err, db.ErrNotFound) {
+		controller.sessionCookies.ClearSignInSession(c)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.Activated {
+		return nil, nil
+	}
+	return user, nil
+}
+
+// endSignInSession revokes the sign in session, if any
+func (controller *oidcController) endSignInSession(c *gin.Context) error {
+	tokenId := controller.sessionCookies.SignInSession(c)
+	if tokenId == "" {
+		return nil
+	}
+	if err := controller.refreshTokenService.RemoveRefreshToken(c.Request.Context(), tokenId); err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	controller.sessionCookies.ClearSignInSession(c)
+	return nil
+}
+
+// redirect sends the user back to the client with params and the state
+func (controller *oidcController) redirect(c *gin.Context, request *authorizationRequest, params url.Values) {
+	location, err := url.Parse(request.RedirectURI)
+	if err != nil {
+		controller.renderFatal(c, err)
+		return
+	}
+	query := location.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+	// RFC 9207, against mix-up attacks between providers
+	query.Set("iss", controller.idTokenService.Issuer())
+	location.RawQuery = query.Encode()
+
+	c.Header("Cache-Control", "no-store")
+	// 303 so that the form is not posted again to the client
+	c.Redirect(http.StatusSeeOther, location.String())
+}
+
+func (controller *oidcController) redirectError(c *gin.Context, request *authorizationRequest, code string, description string) {
+	controller.redirect(c, request, url.Values{"error": {code}, "error_description": {description}})
+}
+
+func (controller *oidcController) renderLogin(c *gin.Context, status int, request *authorizationRequest, client *db.Client, email string, message string) {
+	controller.renderPage(c, status, authorizePage{
+		ClientName:       client.Name,
+		Login:            true,
+		Email:            email,
+		Error:            message,
+		Params:           request.params(),
+		RecaptchaSiteKey: controller.configs.RecaptchaSiteKey,
+	})
+}
+
+func (controller *oidcController) renderConsent(c *gin.Context, request *authorizationRequest, client *db.Client, user *db.User) {
+	controller.renderPage(c, http.StatusOK, authorizePage{
+		ClientName: client.Name,
+		Email:      *user.Email,
+		Scopes:     scopeDescriptions(request.Scope),
+		Params:     request.params(),
+	})
+}
+
+// renderFatal logs err with the request and shows a generic error
+func (controller *oidcController) renderFatal(c *gin.Context, err error) {
+	// logged by LoggerMiddleware along with the request
+	c.Error(err)
+	controller.renderPage(c, http.StatusInternalServerError, authorizePage{
+		Fatal: true,
+		Error: "Something went wrong, try again later. Request id: " + c.GetString("requestId"),
+	})
+}
+
+func (controller *oidcController) renderPage(c *gin.Context, status int, page authorizePage) {
+	page.AppName = controller.configs.AppName
+	if !page.Fatal {
+		token, err := controller.sessionCookies.SignInFormToken(c)
+		if err != nil {
+			controller.renderFatal(c, err)
+			return
+		}
+		page.CSRFToken = token
+	}
+	if page.RecaptchaSiteKey != "" {
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			controller.renderFatal(c, err)
+			return
+		}
+		page.ScriptNonce = base64.RawStdEncoding.EncodeToString(nonce)
+	}
+	var body bytes.Buffer
+	if err := controller.authorizeTemplate.Execute(&body, page); err != nil {
+		c.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	// the consent screen must not be framed by another site
+	c.Header("X-Frame-Options", "DENY")
+	policy := "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'"
+	if page.RecaptchaSiteKey != "" {
+		policy += "; script-src 'nonce-" + page.ScriptNonce + "' https://www.google.com/recaptcha/ https://www.gstatic.com/recaptcha/" +
+			"; frame-src https://www.google.com/recaptcha/; connect-src https://www.google.com/recaptcha/"
+	}
+	c.Header("Content-Security-Policy", policy)
+	c.Data(status, "text/html; charset=utf-8", body.Bytes())
+}
+
+// GET /oauth/userinfo
+// The claims of the user of the access token, by the scope of its consent
+func (controller *oidcController) UserInfo(c *gin.Context) {
+	user, err := controller.userService.FindById(c.Request.Context(), c.GetString("userId"))
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrUserNotFound)
+		return
+	}
+	if err != nil {
+		lib.AbortWithError(c, err)
+		return
+	}
+
+	scopes := strings.Fields(c.GetString("scope"))
+	response := UserInfoResponse{Sub: user.ID}
+	if hasValue(scopes, "email") {
+		response.Email = *user.Email
+		response.EmailVerified = &user.Activated
+	}
+	if hasValue(scopes, "profile") {
+		_user, err := models.GetUser(c.Request.Context(), user, controller.blobStore, &controller.configs)
+		if err != nil {
+			lib.AbortWithError(c, err)
+			return
+		}
+		response.Name = _user.DisplayName
+		response.GivenName = *user.Firstname
+		response.FamilyName = *user.Lastname
+		response.Picture = _user.Profile
+		response.UpdatedAt = user.UpdatedAt.Unix()
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+func hasValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"GoApp/db"
+	"GoApp/lib"
+	"GoApp/providers"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// profileUploader is the processing pipeline shared by every way a profile
+// picture can be uploaded: validate, resize, store and swap out the old one.
+type profileUploader struct {
+	logger       *slog.Logger
+	userService  db.UserService
+	blobStore    providers.BlobStore
+	imageService providers.ImageService
+}
+
+// Save processes the image read from reader and makes it the profile picture of user
+func (uploader *profileUploader) Save(ctx context.Context, user *db.User, reader io.Reader) error {
+	variants, err := uploader.imageService.Process(reader)
+	if err != nil {
+		return err
+	}
+
+	profile := uuid.NewString()
+	sizes := make([]int, 0, len(variants))
+	for _, variant := range variants {
+		key := db.ProfileSizeKey(profile, variant.Size)
+		err = uploader.blobStore.Put(ctx, key, bytes.NewReader(variant.Data), int64(len(variant.Data)), variant.ContentType)
+		if err != nil {
+			return err
+		}
+		sizes = append(sizes, variant.Size)
+	}
+
+	err = uploader.userService.UpdateProfile(ctx, user.ID, profile, sizes)
+	if err != nil {
+		return err
+	}
+
+	if user.Profile != "" {
+		keys := []string{db.ProfileKey(user.Profile)}
+		if len(user.ProfileSizes) > 0 {
+			keys = keys[:0]
+			for _, size := range user.ProfileSizes {
+				keys = append(keys, db.ProfileSizeKey(user.Profile, size))
+			}
+		}
+		for _, key := range keys {
+			if err := uploader.blobStore.Delete(ctx, key); err != nil {
+				uploader.logger.WarnContext(ctx, "removing previous profile picture", slog.String("key", key), slog.Any("error", err))
+			}
+		}
+	}
+
+	user.Profile = profile
+	user.ProfileSizes = sizes
+	return nil
+}
+
+// profileErrorResponse maps errors returned by profileUploader.Save onto responses
+func profileErrorResponse(c *gin.Context, err error) {
+	switch err {
+	case providers.ErrUnsupportedImage:
+		lib.AbortWithError(c, lib.ErrInvalidImage)
+	case providers.ErrImageTooLarge:
+		lib.AbortWithError(c, lib.ErrImageTooLarge)
+	default:
+		lib.AbortWithError(c, err)
+	}
+}
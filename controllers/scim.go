@@ -0,0 +1,722 @@
+package controllers
+
+import (
+	"GoApp/db"
+	"GoApp/lib"
+	"GoApp/providers"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The SCIM schemas of RFC 7643 and messages of RFC 7644
+const (
+	SCIMUserSchema                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+	SCIMServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SCIMListResponseSchema          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMPatchOpSchema               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+)
+
+// SCIMMaxResults is the most users of a page, and of a page without count
+const SCIMMaxResults = 100
+
+// SCIMController lets the identity providers of the tenants, such as Okta
+// or Azure AD, provision and deprovision their users with SCIM 2.0. The
+// userName of a SCIM user is its email address. Deactivating a user revokes
+// its refresh tokens, its access tokens last until they expire.
+type SCIMController interface {
+	ServiceProviderConfig(c *gin.Context)
+	Schemas(c *gin.Context)
+	Schema(c *gin.Context)
+	Users(c *gin.Context)
+	CreateUser(c *gin.Context)
+	User(c *gin.Context)
+	ReplaceUser(c *gin.Context)
+	PatchUser(c *gin.Context)
+	DeleteUser(c *gin.Context)
+}
+
+// SCIMUser is the User resource of RFC 7643 section 4.1, with the attributes
+// stored by the API. The others sent by the identity providers are ignored.
+type SCIMUser struct {
+	Schemas  []string    `json:"schemas"`
+	Id       string      `json:"id,omitempty"`
+	UserName string      `json:"userName" validate:"required" description:"the email address of the user"`
+	Name     *SCIMName   `json:"name,omitempty"`
+	Emails   []SCIMEmail `json:"emails,omitempty" description:"the userName, as the primary work email, ignored in requests"`
+	Active   *bool       `json:"active,omitempty" description:"true by default, false deactivates the user and revokes its refresh tokens"`
+	Password string      `json:"password,omitempty" description:"never returned, the users created without one choose theirs with the forgot password email"`
+	Meta     *SCIMMeta   `json:"meta,omitempty"`
+}
+
+type SCIMName struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type SCIMMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+}
+
+// SCIMPatch is the body of a PATCH request, RFC 7644 section 3.5.2
+type SCIMPatch struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations" validate:"required,min=1"`
+}
+
+type SCIMPatchOperation struct {
+	Op    string      `json:"op" validate:"required" description:"add, replace or remove, in any case"`
+	Path  string      `json:"path,omitempty" description:"such as active or name.givenName, without it the value is an object of the attributes to set"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// SCIMList is the header of the list responses, RFC 7644 section 3.4.2
+type SCIMList struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults" description:"how many match in all"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	StartIndex   int      `json:"startIndex" description:"1-based index of the first resource"`
+}
+
+type SCIMUserList struct {
+	SCIMList
+	Resources []SCIMUser `json:"Resources"`
+}
+
+type SCIMSchemaList struct {
+	SCIMList
+	Resources []SCIMSchema `json:"Resources"`
+}
+
+// SCIMServiceProviderConfig describes what the API supports of SCIM, RFC
+// 7643 section 5
+type SCIMServiceProviderConfig struct {
+	Schemas               []string                   `json:"schemas"`
+	DocumentationUri      string                     `json:"documentationUri"`
+	Patch                 SCIMSupported              `json:"patch"`
+	Bulk                  SCIMBulk                   `json:"bulk"`
+	Filter                SCIMFilter                 `json:"filter"`
+	ChangePassword        SCIMSupported              `json:"changePassword"`
+	Sort                  SCIMSupported              `json:"sort"`
+	Etag                  SCIMSupported              `json:"etag"`
+	AuthenticationSchemes []SCIMAuthenticationScheme `json:"authenticationSchemes"`
+	Meta                  SCIMMeta                   `json:"meta"`
+}
+
+type SCIMSupported struct {
+	Supported bool `json:"supported"`
+}
+
+type SCIMBulk struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type SCIMFilter struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type SCIMAuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+// SCIMSchema describes a resource, RFC 7643 section 7
+type SCIMSchema struct {
+	Schemas     []string        `json:"schemas"`
+	Id          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Attributes  []SCIMAttribute `json:"attributes"`
+	Meta        *SCIMMeta       `json:"meta,omitempty"`
+}
+
+type SCIMAttribute struct {
+	Name          string          `json:"name"`
+	Type          string          `json:"type"`
+	MultiValued   bool            `json:"multiValued"`
+	Description   string          `json:"description"`
+	Required      bool            `json:"required"`
+	CaseExact     bool            `json:"caseExact"`
+	Mutability    string          `json:"mutability"`
+	Returned      string          `json:"returned"`
+	Uniqueness    string          `json:"uniqueness"`
+	SubAttributes []SCIMAttribute `json:"subAttributes,omitempty"`
+}
+
+// scimUserAttributes are the attributes of SCIMUser
+var scimUserAttributes = []SCIMAttribute{
+	{Name: "userName", Type: "string", Description: "The email address of the user.", Required: true,
+		Mutability: "readWrite", Returned: "default", Uniqueness: "server"},
+	{Name: "name", Type: "complex", Description: "The name of the user.", Mutability: "readWrite", Returned: "default", Uniqueness: "none",
+		SubAttributes: []SCIMAttribute{
+			{Name: "givenName", Type: "string", Description: "The first name.", Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+			{Name: "familyName", Type: "string", Description: "The last name.", Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+		}},
+	{Name: "emails", Type: "complex", MultiValued: true, Description: "The userName, as the primary work email.",
+		Mutability: "readOnly", Returned: "default", Uniqueness: "none",
+		SubAttributes: []SCIMAttribute{
+			{Name: "value", Type: "string", Description: "The email address.", Mutability: "readOnly", Returned: "default", Uniqueness: "none"},
+			{Name: "type", Type: "string", Description: "Always work.", Mutability: "readOnly", Returned: "default", Uniqueness: "none"},
+			{Name: "primary", Type: "boolean", Description: "Always true.", Mutability: "readOnly", Returned: "default", Uniqueness: "none"},
+		}},
+	{Name: "active", Type: "boolean", Description: "Whether the user may sign in, deactivating revokes the refresh tokens.",
+		Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+	{Name: "password", Type: "string", Description: "The password of the user.", CaseExact: true,
+		Mutability: "writeOnly", Returned: "never", Uniqueness: "none"},
+}
+
+// scimUserValues are the values of a user once a request applied, validated
+// before they are stored
+type scimUserValues struct {
+	UserName   string `json:"userName" validate:"required,emailaddress"`
+	GivenName  string `json:"name.givenName" validate:"max=100"`
+	FamilyName string `json:"name.familyName" validate:"max=100"`
+	Active     bool   `json:"active"`
+	Password   string `json:"password" validate:"omitempty,password"`
+}
+
+// scimRequestError is a request the API cannot apply, answered with 400
+type scimRequestError struct {
+	scimType string
+	detail   string
+}
+
+func (err *scimRequestError) Error() string {
+	return err.detail
+}
+
+type scimController struct {
+	logger              *slog.Logger
+	configs             providers.Config
+	userService         db.UserService
+	refreshTokenService db.RefreshTokenService
+}
+
+func SCIMHandler(
+	userService *db.UserService,
+	refreshTokenService *db.RefreshTokenService,
+	configs *providers.Config,
+	logger *slog.Logger,
+) SCIMController {
+	return &scimController{
+		logger:              logger,
+		configs:             *configs,
+		userService:         *userService,
+		refreshTokenService: *refreshTokenService,
+	}
+}
+
+// GET /scim/v2/ServiceProviderConfig
+func (controller *scimController) ServiceProviderConfig(c *gin.Context) {
+	lib.SCIMResponse(c, http.StatusOK, SCIMServiceProviderConfig{
+		Schemas:          []string{SCIMServiceProviderConfigSchema},
+		DocumentationUri: controller.configs.Domain + "/docs/",
+		Patch:            SCIMSupported{Supported: true},
+		Bulk:             SCIMBulk{},
+		Filter:           SCIMFilter{Supported: true, MaxResults: SCIMMaxResults},
+		ChangePassword:   SCIMSupported{Supported: true},
+		Sort:             SCIMSupported{},
+		Etag:             SCIMSupported{},
+		AuthenticationSchemes: []SCIMAuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "Bearer token",
+			Description: "The token of the tenant, given once by the tenant create command",
+			Primary:     true,
+		}},
+		Meta: SCIMMeta{ResourceType: "ServiceProviderConfig", Location: controller.configs.Domain + "/scim/v2/ServiceProviderConfig"},
+	})
+}
+
+// GET /scim/v2/Schemas
+func (controller *scimController) Schemas(c *gin.Context) {
+	lib.SCIMResponse(c, http.StatusOK, SCIMSchemaList{
+		SCIMList:  SCIMList{Schemas: []string{SCIMListResponseSchema}, TotalResults: 1, ItemsPerPage: 1, StartIndex: 1},
+		Resources: []SCIMSchema{controller.userSchema()},
+	})
+}
+
+// GET /scim/v2/Schemas/:id
+func (controller *scimController) Schema(c *gin.Context) {
+	if c.Param("id") != SCIMUserSchema {
+		lib.SCIMError(c, http.StatusNotFound, "", "schema not found")
+		return
+	}
+	lib.SCIMResponse(c, http.StatusOK, controller.userSchema())
+}
+
+func (controller *scimController) userSchema() SCIMSchema {
+	return SCIMSchema{
+		Schemas:     []string{SCIMSchemaSchema},
+		Id:          SCIMUserSchema,
+		Name:        "User",
+		Description: "User Account",
+		Attributes:  scimUserAttributes,
+		Meta:        &SCIMMeta{ResourceType: "Schema", Location: controller.configs.Domain + "/scim/v2/Schemas/" + SCIMUserSchema},
+	}
+}
+
+// GET /scim/v2/Users
+// List the users of the tenant, filtered with userName eq "..." only
+func (controller *scimController) Users(c *gin.Context) {
+	filter := db.UserFilter{TenantId: c.GetString("tenantId"), Limit: SCIMMaxResults}
+	if query := c.Query("filter"); query != "" {
+		userName, err := parseUserNameFilter(query)
+		if err != nil {
+			controller.invalid(c, err)
+			return
+		}
+		filter.Email = userName
+	}
+	startIndex, err := scimInteger(c, "startIndex", 1)
+	if err != nil {
+		controller.invalid(c, err)
+		return
+	}
+	// out of range values are clamped, RFC 7644 section 3.4.2.4
+	startIndex = max(startIndex, 1)
+	filter.Offset = startIndex - 1
+	if filter.Limit, err = scimInteger(c, "count", SCIMMaxResults); err != nil {
+		controller.invalid(c, err)
+		return
+	}
+	filter.Limit = min(max(filter.Limit, 0), SCIMMaxResults)
+
+	users := []db.User{}
+	var total int64
+	// an empty filter would match every user, no user has an empty email
+	if c.Query("filter") == "" || filter.Email != "" {
+		users, total, err = controller.userService.ListUsers(c.Request.Context(), filter)
+		if err != nil {
+			lib.SCIMInternalError(c, err)
+			return
+		}
+	}
+	resources := make([]SCIMUser, 0, len(users))
+	for i := range users {
+		resources = append(resources, controller.resource(&users[i]))
+	}
+	lib.SCIMResponse(c, http.StatusOK, SCIMUserList{
+		SCIMList: SCIMList{
+			Schemas:      []string{SCIMListResponseSchema},
+			TotalResults: total,
+			ItemsPerPage: len(resources),
+			StartIndex:   startIndex,
+		},
+		Resources: resources,
+	})
+}
+
+// POST /scim/v2/Users
+// Provision a user
+func (controller *scimController) CreateUser(c *gin.Context) {
+	var request SCIMUser
+	if !bindSCIM(c, &request) {
+		return
+	}
+	values := scimUserValues{Active: true}
+	values.replace(request)
+	if !controller.validate(c, values) {
+		return
+	}
+
+	user, err := controller.userService.ProvisionUser(c.Request.Context(), values.provisioned(c.GetString("tenantId")))
+	if errors.Is(err, db.ErrDuplicate) {
+		lib.SCIMError(c, http.StatusConflict, lib.SCIMUniqueness, "userName is already taken")
+		return
+	}
+	if err != nil {
+		lib.SCIMInternalError(c, err)
+		return
+	}
+	controller.logger.InfoContext(c.Request.Context(), "User provisioned",
+		slog.String("user_id", user.ID), slog.String("tenant_id", user.TenantId))
+	resource := controller.resource(user)
+	c.Header("Location", resource.Meta.Location)
+	lib.SCIMResponse(c, http.StatusCreated, resource)
+}
+
+// GET /scim/v2/Users/:id
+func (controller *scimController) User(c *gin.Context) {
+	user, ok := controller.tenantUser(c)
+	if !ok {
+		return
+	}
+	lib.SCIMResponse(c, http.StatusOK, controller.resource(user))
+}
+
+// PUT /scim/v2/Users/:id
+// Replace the attributes of a user, the omitted active and password stay as they are
+func (controller *scimController) ReplaceUser(c *gin.Context) {
+	user, ok := controller.tenantUser(c)
+	if !ok {
+		return
+	}
+	var request SCIMUser
+	if !bindSCIM(c, &request) {
+		return
+	}
+	values := scimValuesOf(user)
+	values.GivenName, values.FamilyName = "", ""
+	values.replace(request)
+	controller.update(c, user, values)
+}
+
+// PATCH /scim/v2/Users/:id
+// Apply add, replace and remove operations to a user
+func (controller *scimController) PatchUser(c *gin.Context) {
+	user, ok := controller.tenantUser(c)
+	if !ok {
+		return
+	}
+	var request SCIMPatch
+	if !bindSCIM(c, &request) {
+		return
+	}
+	if len(request.Operations) == 0 {
+		controller.invalid(c, &scimRequestError{lib.SCIMInvalidSyntax, "Operations are required"})
+		return
+	}
+	values := scimValuesOf(user)
+	for _, operation := range request.Operations {
+		if err := values.patch(operation); err != nil {
+			controller.invalid(c, err)
+			return
+		}
+	}
+	controller.update(c, user, values)
+}
+
+// DELETE /scim/v2/Users/:id
+// Remove a user along with its refresh tokens
+func (controller *scimController) DeleteUser(c *gin.Context) {
+	user, ok := controller.tenantUser(c)
+	if !ok {
+		return
+	}
+	if _, err := controller.refreshTokenService.RemoveUserRefreshTokens(c.Request.Context(), user.ID); err != nil {
+		lib.SCIMInternalError(c, err)
+		return
+	}
+	err := controller.userService.RemoveUser(c.Request.Context(), user.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.SCIMError(c, http.StatusNotFound, "", "user not found")
+		return
+	}
+	if err != nil {
+		lib.SCIMInternalError(c, err)
+		return
+	}
+	controller.logger.InfoContext(c.Request.Context(), "User removed",
+		slog.String("user_id", user.ID), slog.String("tenant_id", user.TenantId))
+	c.Status(http.StatusNoContent)
+}
+
+// tenantUser returns the user of the :id parameter, responding with 404 when
+// the tenant has no such user
+func (controller *scimController) tenantUser(c *gin.Context) (*db.User, bool) {
+	user, err := controller.userService.FindById(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, db.ErrNotFound) || (err == nil && user.TenantId != c.GetString("tenantId")) {
+		lib.SCIMError(c, http.StatusNotFound, "", "user not found")
+		return nil, false
+	}
+	if err != nil {
+		lib.SCIMInternalError(c, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// update stores the values of a user and responds with it, revoking the
+// refresh tokens of the users deactivated
+func (controller *scimController) update(c *gin.Context, user *db.User, values scimUserValues) {
+	if !controller.validate(c, values) {
+		return
+	}
+	updated, err := controller.userService.UpdateProvisionedUser(c.Request.Context(), user.ID, values.provisioned(user.TenantId))
+	if errors.Is(err, db.ErrDuplicate) {
+		lib.SCIMError(c, http.StatusConflict, lib.SCIMUniqueness, "userName is already taken")
+		return
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		lib.SCIMError(c, http.StatusNotFound, "", "user not found")
+		return
+	}
+	if err != nil {
+		lib.SCIMInternalError(c, err)
+		return
+	}
+	if !updated.Activated {
+		// also when it was inactive already, a retry must not leave tokens behind
+		if _, err := controller.refreshTokenService.RemoveUserRefreshTokens(c.Request.Context(), updated.ID); err != nil {
+			lib.SCIMInternalError(c, err)
+			return
+		}
+		if user.Activated {
+			controller.logger.InfoContext(c.Request.Context(), "User deactivated",
+				slog.String("user_id", updated.ID), slog.String("tenant_id", updated.TenantId))
+		}
+	}
+	lib.SCIMResponse(c, http.StatusOK, controller.resource(updated))
+}
+
+func (controller *scimController) validate(c *gin.Context, values scimUserValues) bool {
+	if err := lib.Validate(values); err != nil {
+		invalid := lib.RequestError(err)
+		detail := invalid.Message
+		if len(invalid.Fields) > 0 {
+			detail = invalid.Fields[0].Field + " " + invalid.Fields[0].Message
+		}
+		lib.SCIMError(c, http.StatusBadRequest, lib.SCIMInvalidValue, detail)
+		return false
+	}
+	return true
+}
+
+// invalid responds to the scimRequestError err, or with a 500 for other errors
+func (controller *scimController) invalid(c *gin.Context, err error) {
+	var invalid *scimRequestError
+	if errors.As(err, &invalid) {
+		lib.SCIMError(c, http.StatusBadRequest, invalid.scimType, invalid.detail)
+		return
+	}
+	lib.SCIMInternalError(c, err)
+}
+
+func (controller *scimController) resource(user *db.User) SCIMUser {
+	active := user.Activated
+	resource := SCIMUser{
+		Schemas: []string{SCIMUserSchema},
+		Id:      user.ID,
+		Active:  &active,
+		Meta: &SCIMMeta{
+			ResourceType: "User",
+			Created:      &user.CreatedAt,
+			LastModified: &user.UpdatedAt,
+			Location:     controller.configs.Domain + "/scim/v2/Users/" + user.ID,
+		},
+	}
+	if user.Email != nil {
+		resource.UserName = *user.Email
+		resource.Emails = []SCIMEmail{{Value: *user.Email, Type: "work", Primary: true}}
+	}
+	values := scimValuesOf(user)
+	if values.GivenName != "" || values.FamilyName != "" {
+		resource.Name = &SCIMName{GivenName: values.GivenName, FamilyName: values.FamilyName}
+	}
+	return resource
+}
+
+func scimValuesOf(user *db.User) scimUserValues {
+	values := scimUserValues{Active: user.Activated}
+	if user.Email != nil {
+		values.UserName = *user.Email
+	}
+	if user.Firstname != nil {
+		values.GivenName = *user.Firstname
+	}
+	if user.Lastname != nil {
+		values.FamilyName = *user.Lastname
+	}
+	return values
+}
+
+// replace sets the values of a POST or PUT request
+func (values *scimUserValues) replace(request SCIMUser) {
+	values.UserName = strings.TrimSpace(request.UserName)
+	if request.Name != nil {
+		values.GivenName = request.Name.GivenName
+		values.FamilyName = request.Name.FamilyName
+	}
+	if request.Active != nil {
+		values.Active = *request.Active
+	}
+	if request.Password != "" {
+		values.Password = request.Password
+	}
+}
+
+func (values *scimUserValues) provisioned(tenantId string) db.ProvisionedUser {
+	return db.ProvisionedUser{
+		TenantId:  tenantId,
+		Email:     values.UserName,
+		Firstname: values.GivenName,
+		Lastname:  values.FamilyName,
+		Active:    values.Active,
+		Password:  values.Password,
+	}
+}
+
+// patch applies an operation of a PATCH request
+func (values *scimUserValues) patch(operation SCIMPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return &scimRequestError{lib.SCIMInvalidSyntax, "unknown op " + strconv.Quote(operation.Op)}
+	}
+	if operation.Path != "" {
+		return values.set(op, operation.Path, operation.Value)
+	}
+	if op == "remove" {
+		return &scimRequestError{lib.SCIMNoTarget, "remove requires a path"}
+	}
+	attributes, ok := operation.Value.(map[string]interface{})
+	if !ok {
+		return &scimRequestError{lib.SCIMInvalidValue, "the value of an operation without a path must be an object"}
+	}
+	for path, value := range attributes {
+		if err := values.set(op, path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set applies op to the attribute at path, the attributes which are not
+// stored are ignored
+func (values *scimUserValues) set(op string, path string, value interface{}) error {
+	attribute := strings.ToLower(path)
+	attribute = strings.TrimPrefix(attribute, strings.ToLower(SCIMUserSchema)+":")
+	remove := op == "remove"
+	switch attribute {
+	case "username", "active", "password":
+		if remove {
+			return &scimRequestError{lib.SCIMMutability, path + " cannot be removed"}
+		}
+	}
+
+	var err error
+	switch attribute {
+	case "username":
+		values.UserName, err = scimString(path, value)
+		values.UserName = strings.TrimSpace(values.UserName)
+	case "active":
+		values.Active, err = scimBool(path, value)
+	case "password":
+		values.Password, err = scimString(path, value)
+	case "name":
+		if remove {
+			values.GivenName, values.FamilyName = "", ""
+			return nil
+		}
+		name, ok := value.(map[string]interface{})
+		if !ok {
+			return &scimRequestError{lib.SCIMInvalidValue, path + " must be an object"}
+		}
+		for subAttribute, subValue := range name {
+			if err := values.set(op, "name."+subAttribute, subValue); err != nil {
+				return err
+			}
+		}
+	case "name.givenname":
+		values.GivenName = ""
+		if !remove {
+			values.GivenName, err = scimString(path, value)
+		}
+	case "name.familyname":
+		values.FamilyName = ""
+		if !remove {
+			values.FamilyName, err = scimString(path, value)
+		}
+	}
+	return err
+}
+
+func scimString(path string, value interface{}) (string, error) {
+	text, ok := value.(string)
+	if !ok {
+		return "", &scimRequestError{lib.SCIMInvalidValue, path + " must be a string"}
+	}
+	return text, nil
+}
+
+// scimBool accepts the "True" and "False" strings sent by Azure AD too
+func scimBool(path string, value interface{}) (bool, error) {
+	switch value := value.(type) {
+	case bool:
+		return value, nil
+	case string:
+		if parsed, err := strconv.ParseBool(strings.ToLower(value)); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, &scimRequestError{lib.SCIMInvalidValue, path + " must be a boolean"}
+}
+
+// scimInteger reads the integer query parameter name, def when it is missing
+func scimInteger(c *gin.Context, name string, def int) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return def, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &scimRequestError{lib.SCIMInvalidValue, name + " must be an integer"}
+	}
+	return parsed, nil
+}
+
+var userNameFilter = regexp.MustCompile(`(?i)^\s*userName\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// parseUserNameFilter returns the userName of a userName eq "..." filter,
+// the only one the identity providers need to find their users
+func parseUserNameFilter(filter string) (string, error) {
+	match := userNameFilter.FindStringSubmatch(filter)
+	if match == nil {
+		return "", &scimRequestError{lib.SCIMInvalidFilter, `only the userName eq "..." filter is supported`}
+	}
+	var userName string
+	if err := json.Unmarshal([]byte(match[1]), &userName); err != nil {
+		return "", &scimRequestError{lib.SCIMInvalidFilter, "the userName is not a valid string"}
+	}
+	return strings.TrimSpace(userName), nil
+}
+
+// bindSCIM decodes the JSON body of a SCIM request, unlike lib.Bind it
+// accepts application/scim+json and ignores the unknown attributes, which
+// the identity providers send plenty of. On failure it responds and returns
+// false.
+func bindSCIM(c *gin.Context, value interface{}) bool {
+	if contentType := c.GetHeader("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != lib.SCIMContentType && mediaType != gin.MIMEJSON) {
+			lib.SCIMError(c, http.StatusUnsupportedMediaType, "", "the request body must be "+lib.SCIMContentType)
+			return false
+		}
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(value); err != nil {
+		invalid := lib.RequestError(err)
+		scimType := lib.SCIMInvalidSyntax
+		if invalid.Status != http.StatusBadRequest {
+			scimType = ""
+		}
+		detail := invalid.Message
+		if len(invalid.Fields) > 0 {
+			detail = invalid.Fields[0].Field + " " + invalid.Fields[0].Message
+		}
+		lib.SCIMError(c, invalid.Status, scimType, detail)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"GoApp/lib"
+	"errors"
+	"testing"
+)
+
+func TestParseUserNameFilter(t *testing.T) {
+	for filter, want := range map[string]string{
+		`userName eq "ada@example.com"`:        "ada@example.com",
+		`USERNAME EQ "ada@example.com"`:        "ada@example.com",
+		`  userName  eq  " ada@example.com " `: "ada@example.com",
+		`userName eq "a\"da@example.com"`:      `a"da@example.com`,
+		"userName\teq \"ada@example.com\"":     "ada@example.com",
+		`userName eq ""`:                       "",
+	} {
+		userName, err := parseUserNameFilter(filter)
+		if err != nil || userName != want {
+			t.Errorf("%s: got %q, %v, want %q", filter, userName, err, want)
+		}
+	}
+
+	for _, filter := range []string{
+		`userName ne "ada@example.com"`,
+		`userName co "ada"`,
+		`emails.value eq "ada@example.com"`,
+		`userName eq "ada@example.com" or userName eq "bob@example.com"`,
+		`userName eq ada@example.com`,
+		`userName eq "ada@example.com`,
+		`userName eq "\x"`,
+	} {
+		_, err := parseUserNameFilter(filter)
+		var invalid *scimRequestError
+		if !errors.As(err, &invalid) || invalid.scimType != lib.SCIMInvalidFilter {
+			t.Errorf("%s: got %v, want an invalidFilter error", filter, err)
+		}
+	}
+}
+
+func TestSCIMPatch(t *testing.T) {
+	user := func() scimUserValues {
+		return scimUserValues{UserName: "ada@example.com", GivenName: "Ada", FamilyName: "Lovelace", Active: true}
+	}
+
+	for name, test := range map[string]struct {
+		operations []SCIMPatchOperation
+		want       scimUserValues
+	}{
+		"path": {
+			[]SCIMPatchOperation{{Op: "replace", Path: "name.givenName", Value: "Augusta"}},
+			scimUserValues{UserName: "ada@example.com", GivenName: "Augusta", FamilyName: "Lovelace", Active: true},
+		},
+		"path with the schema": {
+			[]SCIMPatchOperation{{Op: "Replace", Path: SCIMUserSchema + ":userName", Value: " augusta@example.com "}},
+			scimUserValues{UserName: "augusta@example.com", GivenName: "Ada", FamilyName: "Lovelace", Active: true},
+		},
+		"remove": {
+			[]SCIMPatchOperation{{Op: "remove", Path: "name.familyName"}},
+			scimUserValues{UserName: "ada@example.com", GivenName: "Ada", Active: true},
+		},
+		"without path": {
+			[]SCIMPatchOperation{{Op: "replace", Value: map[string]interface{}{
+				"active": false,
+				"name":   map[string]interface{}{"familyName": "King"},
+				"title":  "Countess",
+			}}},
+			scimUserValues{UserName: "ada@example.com", GivenName: "Ada", FamilyName: "King", Active: false},
+		},
+		"Azure False": {
+			[]SCIMPatchOperation{{Op: "Replace", Path: "active", Value: "False"}},
+			scimUserValues{UserName: "ada@example.com", GivenName: "Ada", FamilyName: "Lovelace", Active: false},
+		},
+		"Azure True without path": {
+			[]SCIMPatchOperation{{Op: "Replace", Path: "active", Value: "False"}, {Op: "Add", Value: map[string]interface{}{"active": "True"}}},
+			user(),
+		},
+	} {
+		values := user()
+		for _, operation := range test.operations {
+			if err := values.patch(operation); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if values != test.want {
+			t.Errorf("%s: got %+v, want %+v", name, values, test.want)
+		}
+	}
+
+	for name, test := range map[string]struct {
+		operation SCIMPatchOperation
+		scimType  string
+	}{
+		"unknown op":             {SCIMPatchOperation{Op: "move", Path: "active", Value: true}, lib.SCIMInvalidSyntax},
+		"remove without path":    {SCIMPatchOperation{Op: "remove"}, lib.SCIMNoTarget},
+		"remove active":          {SCIMPatchOperation{Op: "remove", Path: "active"}, lib.SCIMMutability},
+		"value not an object":    {SCIMPatchOperation{Op: "replace", Value: "ada"}, lib.SCIMInvalidValue},
+		"active not a boolean":   {SCIMPatchOperation{Op: "replace", Path: "active", Value: "yes please"}, lib.SCIMInvalidValue},
+		"userName not a string":  {SCIMPatchOperation{Op: "replace", Path: "userName", Value: 1.0}, lib.SCIMInvalidValue},
+		"name not an object":     {SCIMPatchOperation{Op: "add", Path: "name", Value: "Ada Lovelace"}, lib.SCIMInvalidValue},
+		"bad value without path": {SCIMPatchOperation{Op: "add", Value: map[string]interface{}{"active": 1.0}}, lib.SCIMInvalidValue},
+	} {
+		values := user()
+		err := values.patch(test.operation)
+		var invalid *scimRequestError
+		if !errors.As(err, &invalid) || invalid.scimType != test.scimType {
+			t.Errorf("%s: got %v, want %s", name, err, test.scimType)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"GoApp/db"
+	"GoApp/lib"
+	"GoApp/providers"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenController is the token endpoint of the registered clients, which
+// AuthenticateClient authenticates beforehand
+type TokenController interface {
+	Token(c *gin.Context)
+}
+
+// TokenResponse is the successful response of the token endpoint, RFC 6749
+// section 5.1
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type" validate:"oneof=Bearer"`
+	ExpiresIn    int64  `json:"expires_in" description:"lifetime of the access token in seconds"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type tokenController struct {
+	logger                     *slog.Logger
+	jWtService                 providers.JWTService
+	idTokenService             providers.IDTokenService
+	configs                    providers.Config
+	userService                db.UserService
+	refreshTokenService        db.RefreshTokenService
+	authorizationCodeService   db.AuthorizationCodeService
+	deviceAuthorizationService db.DeviceAuthorizationService
+}
+
+func TokenHandler(
+	jWtService *providers.JWTService,
+	idTokenService *providers.IDTokenService,
+	userService *db.UserService,
+	refreshTokenService *db.RefreshTokenService,
+	authorizationCodeService *db.AuthorizationCodeService,
+	deviceAuthorizationService *db.DeviceAuthorizationService,
+	configs *providers.Config,
+	logger *slog.Logger,
+) TokenController {
+	return &tokenController{
+		logger:                     logger,
+		jWtService:                 *jWtService,
+		idTokenService:             *idTokenService,
+		configs:                    *configs,
+		userService:                *userService,
+		refreshTokenService:        *refreshTokenService,
+		authorizationCodeService:   *authorizationCodeService,
+		deviceAuthorizationService: *deviceAuthorizationService,
+	}
+}
+
+// POST /oauth/token
+// Exchange a grant for tokens
+func (controller *tokenController) Token(c *gin.Context) {
+	switch grantType := c.PostForm("grant_type"); grantType {
+	case "authorization_code":
+		controller.authorizationCodeGrant(c)
+	case "refresh_token":
+		controller.refreshTokenGrant(c)
+	case "client_credentials":
+		controller.clientCredentialsGrant(c)
+	case DeviceCodeGrantType:
+		controller.deviceCodeGrant(c)
+	case "":
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidRequest, "the grant_type parameter is required")
+	default:
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthUnsupportedGrantType, "unsupported grant type "+grantType)
+	}
+}
+
+// authorizationCodeGrant exchanges the code of /oauth/authorize, checking
+// the PKCE verifier of its challenge, RFC 7636
+func (controller *tokenController) authorizationCodeGrant(c *gin.Context) {
+	code, redirectURI, verifier := c.PostForm("code"), c.PostForm("redirect_uri"), c.PostForm("code_verifier")
+	if code == "" || redirectURI == "" || verifier == "" {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidRequest, "the code, redirect_uri and code_verifier parameters are required")
+		return
+	}
+
+	authorization, err := controller.authorizationCodeService.ConsumeAuthorizationCode(c.Request.Context(), code, time.Now())
+	if errors.Is(err, db.ErrNotFound) {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidGrant, "the code is invalid, expired or already used")
+		return
+	}
+	if err != nil {
+		lib.OAuthInternalError(c, err)
+		return
+	}
+	if authorization.ClientId != c.GetString("clientId") || authorization.RedirectURI != redirectURI {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidGrant, "the code was issued to another client or redirect URI")
+		return
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(authorization.CodeChallenge)) != 1 {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidGrant, "the code_verifier does not match the code_challenge")
+		return
+	}
+
+	user, ok := controller.grantUser(c, authorization.UserId)
+	if !ok {
+		return
+	}
+	refreshToken, err := controller.refreshTokenService.CreateClientRefreshToken(c.Request.Context(), user.ID, authorization.ClientId, authorization.Scope)
+	if err != nil {
+		lib.OAuthInternalError(c, err)
+		return
+	}
+	controller.respond(c, user, refreshToken, authorization.Scope, authorization.Nonce)
+}
+
+// refreshTokenGrant issues new tokens for a refresh token, which is kept,
+// with the scope it was granted. Only the client the token was issued to may
+// redeem it, RFC 6749 section 6, the tokens of login are refused.
+func (controller *tokenController) refreshTokenGrant(c *gin.Context) {
+	tokenId := c.PostForm("refresh_token")
+	if tokenId == "" {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidRequest, "the refresh_token parameter is required")
+		return
+	}
+	refreshToken, err := controller.refreshTokenService.FindRefreshToken(c.Request.Context(), tokenId)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidGrant, "the refresh token is invalid or revoked")
+		return
+	}
+	if err != nil {
+		lib.OAuthInternalError(c, err)
+		return
+	}
+	if refreshToken.ClientId == "" || refreshToken.ClientId != c.GetString("clientId") {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidGrant, "the refresh token was issued to another client")
+		return
+	}
+	scope := refreshToken.Scope
+	if requested := strings.Fields(c.PostForm("scope")); len(requested) > 0 {
+		// the scope may only be narrowed, RFC 6749 section 6
+		for _, name := range requested {
+			if !hasValue(strings.Fields(refreshToken.Scope), name) {
+				lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidScope, "the scope "+name+" was not granted")
+				return
+			}
+		}
+		scope = strings.Join(requested, " ")
+	}
+	user, ok := controller.grantUser(c, refreshToken.UserId)
+	if !ok {
+		return
+	}
+	controller.respond(c, user, "", scope, "")
+}
+
+// clientCredentialsGrant issues an access token to a service account for
+// itself, RFC 6749 section 4.4. Without a scope parameter every allowed scope
+// is granted. There is no refresh token, the secret gets a new access token.
+func (controller *tokenController) clientCredentialsGrant(c *gin.Context) {
+	client := c.MustGet("client").(*db.Client)
+	if !client.ServiceAccount() {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthUnauthorizedClient, "the client is not a service account")
+		return
+	}
+	scopes := client.Scopes
+	if requested := strings.Fields(c.PostForm("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !client.HasScope(scope) {
+				lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidScope, "the scope "+scope+" is not allowed for the client")
+				return
+			}
+		}
+		scopes = requested
+	}
+
+	scope := strings.Join(scopes, " ")
+	controller.logger.InfoContext(c.Request.Context(), "Service token issued", slog.String("scope", scope))
+	lib.OAuthResponse(c, TokenResponse{
+		AccessToken: controller.jWtService.GenerateServiceToken(client.ClientId, scopes, providers.ServiceTokenExpiry),
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(providers.ServiceTokenExpiry.Seconds()),
+		Scope:       scope,
+	})
+}
+
+// deviceCodeGrant answers the polls of a device until its user decides, RFC
+// 8628 section 3.4. The tokens are only issued once, to the poll which
+// removes the approved authorization.
+func (controller *tokenController) deviceCodeGrant(c *gin.Context) {
+	deviceCode := c.PostForm("device_code")
+	if deviceCode == "" {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidRequest, "the device_code parameter is required")
+		return
+	}
+	now := time.Now()
+	authorization, err := controller.deviceAuthorizationService.PollDeviceAuthorization(c.Request.Context(), deviceCode, now)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidGrant, "the device code is invalid or already used")
+		return
+	}
+	if err != nil {
+		lib.OAuthInternalError(c, err)
+		return
+	}
+	if authorization.ClientId != c.GetString("clientId") {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidGrant, "the device code was issued to another client")
+		return
+	}
+	if !authorization.ExpiresAt.After(now) {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthExpiredToken, "the device code has expired")
+		return
+	}
+
+	switch authorization.Status {
+	case db.DeviceAuthorizationPending:
+		// a second of leeway for the devices waiting exactly the interval
+		if !authorization.LastPolledAt.IsZero() && now.Sub(authorization.LastPolledAt) < authorization.Interval-time.Second {
+			err := controller.deviceAuthorizationService.SlowDownDeviceAuthorization(c.Request.Context(), deviceCode, authorization.Interval+DeviceSlowDown)
+			if err != nil && !errors.Is(err, db.ErrNotFound) {
+				lib.OAuthInternalError(c, err)
+				return
+			}
+			lib.OAuthError(c, http.StatusBadRequest, lib.OAuthSlowDown, "poll less often")
+			return
+		}
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthAuthorizationPending, "the user has not decided yet")
+	case db.DeviceAuthorizationDenied:
+		if err := controller.deviceAuthorizationService.RemoveDeviceAuthorization(c.Request.Context(), deviceCode); err != nil && !errors.Is(err, db.ErrNotFound) {
+			lib.OAuthInternalError(c, err)
+			return
+		}
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthAccessDenied, "the user denied the authorization")
+	default:
+		err := controller.deviceAuthorizationService.RemoveDeviceAuthorization(c.Request.Context(), deviceCode)
+		if errors.Is(err, db.ErrNotFound) {
+			lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidGrant, "the device code is invalid or already used")
+			return
+		}
+		if err != nil {
+			lib.OAuthInternalError(c, err)
+			return
+		}
+		user, ok := controller.grantUser(c, authorization.UserId)
+		if !ok {
+			return
+		}
+		refreshToken, err := controller.refreshTokenService.CreateClientRefreshToken(c.Request.Context(), user.ID, authorization.ClientId, authorization.Scope)
+		if err != nil {
+			lib.OAuthInternalError(c, err)
+			return
+		}
+		controller.respond(c, user, refreshToken, authorization.Scope, "")
+	}
+}
+
+// grantUser returns the user a grant was given by, who must still be active
+func (controller *tokenController) grantUser(c *gin.Context, userId string) (*db.User, bool) {
+	user, err := controller.userService.FindById(c.Request.Context(), userId)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidGrant, "the user does not exist anymore")
+		return nil, false
+	}
+	if err != nil {
+		lib.OAuthInternalError(c, err)
+		return nil, false
+	}
+	if !user.Activated {
+		lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidGrant, "the user is not activated")
+		return nil, false
+	}
+	return user, true
+}
+
+// respond issues the access token and the ID token of user, with the claims
+// of the granted scope. The access token is only valid for the client, on
+// /oauth/userinfo.
+func (controller *tokenController) respond(c *gin.Context, user *db.User, refreshToken string, scope string, nonce string) {
+	scopes := strings.Fields(scope)
+	claims := providers.IDTokenClaims{Nonce: nonce}
+	claims.Subject = user.ID
+	claims.Audience = c.GetString("clientId")
+	if hasValue(scopes, "email") {
+		claims.Email = *user.Email
+		claims.EmailVerified = &user.Activated
+	}
+	if hasValue(scopes, "profile") {
+		claims.GivenName = *user.Firstname
+		claims.FamilyName = *user.Lastname
+		claims.Name = strings.TrimSpace(*user.Firstname + " " + *user.Lastname)
+	}
+	idToken, err := controller.idTokenService.GenerateIDToken(claims)
+	if err != nil {
+		lib.OAuthInternalError(c, err)
+		return
+	}
+
+	lib.OAuthResponse(c, TokenResponse{
+		AccessToken:  controller.jWtService.GenerateClientToken(user.ID, c.GetString("clientId"), scope, providers.AccessTokenExpiry),
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(providers.AccessTokenExpiry.Seconds()),
+		RefreshToken: refreshToken,
+		IdToken:      idToken,
+		Scope:        scope,
+	})
+}
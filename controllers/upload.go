@@ -0,0 +1,365 @@
+package controllers
+
+import (
+	"GoApp/db"
+	"GoApp/lib"
+	"GoApp/providers"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Resumable uploads following the tus 1.0.0 protocol (https://tus.io/protocols/resumable-upload),
+// with the creation, termination and expiration extensions.
+const tusVersion = "1.0.0"
+
+// upload purposes, passed by the client in the "purpose" metadata entry
+const uploadPurposeProfile = "profile"
+
+// upload controllers interface
+type UploadController interface {
+	Options(c *gin.Context)
+	Create(c *gin.Context)
+	Head(c *gin.Context)
+	Patch(c *gin.Context)
+	Delete(c *gin.Context)
+}
+
+type uploadController struct {
+	logger          *slog.Logger
+	configs         providers.Config
+	userService     db.UserService
+	uploadService   db.UploadService
+	blobStore       providers.BlobStore
+	profileUploader profileUploader
+}
+
+func UploadHandler(
+	userService *db.UserService,
+	uploadService *db.UploadService,
+	blobStore *providers.BlobStore,
+	imageService *providers.ImageService,
+	configs *providers.Config,
+	logger *slog.Logger,
+) UploadController {
+	return &uploadController{
+		logger:        logger,
+		configs:       *configs,
+		userService:   *userService,
+		uploadService: *uploadService,
+		blobStore:     *blobStore,
+		profileUploader: profileUploader{
+			logger:       logger,
+			userService:  *userService,
+			blobStore:    *blobStore,
+			imageService: *imageService,
+		},
+	}
+}
+
+// uploadPartKey returns the blob storage key of a chunk received at offset
+func uploadPartKey(uploadId string, offset int64) string {
+	return fmt.Sprintf("uploads/%s/%020d-%s", uploadId, offset, uuid.NewString())
+}
+
+// OPTIONS /api/uploads
+// advertise the supported tus version and extensions
+func (controller *uploadController) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", "creation,termination,expiration")
+	c.Header("Tus-Max-Size", strconv.FormatInt(controller.configs.ImageMaxBytes, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// POST /api/uploads
+// start a new upload session
+func (controller *uploadController) Create(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	userId := c.MustGet("userId").(string)
+
+	user, err := controller.userService.FindById(c.Request.Context(), userId)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrInvalidToken)
+		return
+	}
+	if err != nil {
+		lib.AbortWithError(c, err)
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		lib.AbortWithError(c, lib.NewError(http.StatusBadRequest, lib.InvalidParameter, "invalid Upload-Length"))
+		return
+	}
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		lib.AbortWithError(c, lib.NewError(http.StatusBadRequest, lib.InvalidParameter, err.Error()))
+		return
+	}
+	if metadata["purpose"] == "" {
+		metadata["purpose"] = uploadPurposeProfile
+	}
+	if metadata["purpose"] != uploadPurposeProfile {
+		lib.AbortWithError(c, lib.NewError(http.StatusBadRequest, lib.InvalidParameter, "unsupported upload purpose"))
+		return
+	}
+	if length > controller.configs.ImageMaxBytes {
+		lib.AbortWithError(c, lib.ErrImageTooLarge)
+		return
+	}
+
+	expiresAt := time.Now().Add(controller.configs.UploadExpiry)
+	upload, err := controller.uploadService.CreateUpload(c.Request.Context(), user.ID, metadata["purpose"], length, metadata, expiresAt)
+	if err != nil {
+		lib.AbortWithError(c, err)
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.UploadId)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// HEAD /api/uploads/:uploadId
+// report how many bytes of the upload were received so far
+func (controller *uploadController) Head(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	upload := controller.findUpload(c)
+	if upload == nil {
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusOK)
+}
+
+// PATCH /api/uploads/:uploadId
+// append a chunk to the upload, processing the file once it is complete
+func (controller *uploadController) Patch(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		lib.AbortWithError(c, lib.NewError(http.StatusUnsupportedMediaType, lib.UnsupportedMediaType, "The chunk must be sent as application/offset+octet-stream"))
+		return
+	}
+	upload := controller.findUpload(c)
+	if upload == nil {
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		lib.AbortWithError(c, lib.NewError(http.StatusBadRequest, lib.InvalidParameter, "invalid Upload-Offset"))
+		return
+	}
+	if offset != upload.Offset {
+		lib.AbortWithError(c, lib.ErrUploadOffsetConflict)
+		return
+	}
+	size := c.Request.ContentLength
+	if size <= 0 || offset+size > upload.Length {
+		lib.AbortWithError(c, lib.NewError(http.StatusBadRequest, lib.InvalidParameter, "invalid Content-Length"))
+		return
+	}
+
+	// a chunk is only recorded once it was received completely, after an
+	// interruption the client asks for the offset again and resends it
+	part := uploadPartKey(upload.UploadId, offset)
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, size)
+	err = controller.blobStore.Put(c.Request.Context(), part, body, size, "application/octet-stream")
+	if err != nil {
+		controller.blobStore.Delete(context.Background(), part)
+		lib.AbortWithError(c, err)
+		return
+	}
+
+	upload, err = controller.uploadService.AppendPart(c.Request.Context(), upload.UploadId, offset, size, part)
+	if err != nil {
+		controller.blobStore.Delete(context.Background(), part)
+		switch {
+		case errors.Is(err, db.ErrConflict):
+			lib.AbortWithError(c, lib.ErrUploadOffsetConflict)
+		case errors.Is(err, db.ErrNotFound):
+			lib.AbortWithError(c, lib.ErrUploadNotFound)
+		default:
+			lib.AbortWithError(c, err)
+		}
+		return
+	}
+
+	if upload.Offset == upload.Length {
+		if err := controller.complete(c.Request.Context(), upload); err != nil {
+			profileErrorResponse(c, err)
+			return
+		}
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusNoContent)
+}
+
+// DELETE /api/uploads/:uploadId
+// abort the upload and discard the received bytes
+func (controller *uploadController) Delete(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	upload := controller.findUpload(c)
+	if upload == nil {
+		return
+	}
+
+	if err := DiscardUpload(c.Request.Context(), controller.uploadService, controller.blobStore, upload); err != nil {
+		lib.AbortWithError(c, err)
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Status(http.StatusNoContent)
+}
+
+// findUpload loads the upload named in the url, responding with 404 when it
+// does not exist, has expired or belongs to another user
+func (controller *uploadController) findUpload(c *gin.Context) *db.Upload {
+	userId := c.MustGet("userId").(string)
+
+	upload, err := controller.uploadService.FindUpload(c.Request.Context(), c.Param("uploadId"))
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, err)
+		return nil
+	}
+	if err != nil || upload.UserId != userId || upload.ExpiresAt.Before(time.Now()) {
+		lib.AbortWithError(c, lib.ErrUploadNotFound)
+		return nil
+	}
+	return upload
+}
+
+// complete hands the assembled file to the pipeline of its purpose and removes the session
+func (controller *uploadController) complete(ctx context.Context, upload *db.Upload) error {
+	defer func() {
+		if err := DiscardUpload(context.Background(), controller.uploadService, controller.blobStore, upload); err != nil {
+			controller.logger.WarnContext(ctx, "discarding completed upload", slog.String("uploadId", upload.UploadId), slog.Any("error", err))
+		}
+	}()
+
+	user, err := controller.userService.FindById(ctx, upload.UserId)
+	if err != nil {
+		return err
+	}
+
+	reader := &partsReader{ctx: ctx, blobStore: controller.blobStore, parts: upload.Parts}
+	defer reader.Close()
+
+	return controller.profileUploader.Save(ctx, user, reader)
+}
+
+// DiscardUpload removes the received chunks and the session of an upload
+func DiscardUpload(ctx context.Context, uploadService db.UploadService, blobStore providers.BlobStore, upload *db.Upload) error {
+	for _, part := range upload.Parts {
+		if err := blobStore.Delete(ctx, part); err != nil {
+			return err
+		}
+	}
+	return uploadService.RemoveUpload(ctx, upload.UploadId)
+}
+
+// checkTusResumable rejects requests made for another protocol version
+func checkTusResumable(c *gin.Context) bool {
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		lib.AbortWithError(c, lib.ErrUnsupportedTusVersion)
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header: comma separated
+// pairs of a key and a base64 encoded value
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid Upload-Metadata")
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("invalid Upload-Metadata")
+		}
+	}
+	return metadata, nil
+}
+
+// partsReader reads the stored chunks of an upload one after the other,
+// opening each only when the previous one is exhausted
+type partsReader struct {
+	ctx       context.Context
+	blobStore providers.BlobStore
+	parts     []string
+	current   io.ReadCloser
+}
+
+func (reader *partsReader) Read(p []byte) (int, error) {
+	for {
+		if reader.current == nil {
+			if len(reader.parts) == 0 {
+				return 0, io.EOF
+			}
+			current, err := reader.blobStore.Get(reader.ctx, reader.parts[0])
+			if err != nil {
+				return 0, err
+			}
+			reader.current = current
+			reader.parts = reader.parts[1:]
+		}
+		n, err := reader.current.Read(p)
+		if err == io.EOF {
+			reader.current.Close()
+			reader.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (reader *partsReader) Close() error {
+	if reader.current != nil {
+		return reader.current.Close()
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	for header, want := range map[string]map[string]string{
+		"":                                       {},
+		"purpose cHJvZmlsZQ==":                   {"purpose": "profile"},
+		"purpose cHJvZmlsZQ==,filename YS5wbmc=": {"purpose": "profile", "filename": "a.png"},
+		" purpose  cHJvZmlsZQ== , , is-draft ":   {"purpose": "profile", "is-draft": ""},
+		"filename ":                              {"filename": ""},
+	} {
+		metadata, err := parseUploadMetadata(header)
+		if err != nil || !reflect.DeepEqual(metadata, want) {
+			t.Errorf("%q: got %v, %v, want %v", header, metadata, err, want)
+		}
+	}
+
+	for _, header := range []string{
+		"purpose profile",
+		"purpose cHJvZmlsZQ",
+		"purpose cHJvZmlsZQ== extra",
+		"purpose cHJvZmlsZQ==,filename !!!",
+	} {
+		if metadata, err := parseUploadMetadata(header); err == nil {
+			t.Errorf("%q: got %v, want an error", header, metadata)
+		}
+	}
+}
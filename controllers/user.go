@@ -6,15 +6,11 @@ import (
 	"GoApp/lib"
 	"GoApp/models"
 	"GoApp/providers"
-	"io"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
-	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -27,19 +23,31 @@ type UserController interface {
 }
 
 type userController struct {
-	configs     providers.Config
-	userService db.UserService
-	validate    validator.Validate
+	logger          *slog.Logger
+	configs         providers.Config
+	userService     db.UserService
+	blobStore       providers.BlobStore
+	profileUploader profileUploader
 }
 
 func UserHandler(
 	userService *db.UserService,
+	blobStore *providers.BlobStore,
+	imageService *providers.ImageService,
 	configs *providers.Config,
+	logger *slog.Logger,
 ) UserController {
 	return &userController{
+		logger:      logger,
 		configs:     *configs,
 		userService: *userService,
-		validate:    *validator.New(),
+		blobStore:   *blobStore,
+		profileUploader: profileUploader{
+			logger:       logger,
+			userService:  *userService,
+			blobStore:    *blobStore,
+			imageService: *imageService,
+		},
 	}
 }
 
@@ -48,17 +56,23 @@ func UserHandler(
 func (controller *userController) Me(c *gin.Context) {
 	userId := c.MustGet("userId").(string)
 
-	user, err := controller.userService.FindById(userId)
+	user, err := controller.userService.FindById(c.Request.Context(), userId)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrInvalidToken)
+		return
+	}
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		lib.AbortWithError(c, err)
 		return
 	}
-	if user == nil {
-		lib.ErrorResponse(c, http.StatusUnauthorized, "")
+
+	_user, err := models.GetUser(c.Request.Context(), user, controller.blobStore, &controller.configs)
+	if err != nil {
+		lib.AbortWithError(c, err)
 		return
 	}
 
-	lib.JsonResponse(c, models.GetUser(user, &controller.configs))
+	lib.JsonResponse(c, _user)
 }
 
 // POST /api/user/details
@@ -66,21 +80,14 @@ func (controller *userController) Me(c *gin.Context) {
 func (controller *userController) UpdateUserDetails(c *gin.Context) {
 	userId := c.MustGet("userId").(string)
 
-	var dto dto.UpdateUserDetails
-
-	if err := c.ShouldBind(&dto); err != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	dto, ok := lib.Bind[dto.UpdateUserDetails](c)
+	if !ok {
 		return
 	}
 
-	if validationErr := controller.validate.Struct(dto); validationErr != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, validationErr.Error())
-		return
-	}
-
-	err := controller.userService.UpdateDetail(userId, *dto.Firstname, *dto.Lastname)
+	err := controller.userService.UpdateDetail(c.Request.Context(), userId, *dto.Firstname, *dto.Lastname)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		lib.AbortWithError(c, err)
 		return
 	}
 
@@ -90,86 +97,73 @@ func (controller *userController) UpdateUserDetails(c *gin.Context) {
 // POST /api/user/change-password
 func (controller *userController) ChangePassword(c *gin.Context) {
 	userId := c.MustGet("userId").(string)
-	var dto dto.ChangePassword
-
-	if err := c.ShouldBind(&dto); err != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	dto, ok := lib.Bind[dto.ChangePassword](c)
+	if !ok {
 		return
 	}
 
-	if validationErr := controller.validate.Struct(dto); validationErr != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, validationErr.Error())
+	user, err := controller.userService.FindById(c.Request.Context(), userId)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrInvalidToken)
 		return
 	}
-
-	user, err := controller.userService.FindById(userId)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
-		return
-	}
-	if user == nil {
-		lib.ErrorResponse(c, http.StatusUnauthorized, "")
+		lib.AbortWithError(c, err)
 		return
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(*user.Password), []byte(*dto.OldPassword)); err != nil {
-		lib.ErrorResponse(c, http.StatusUnprocessableEntity, lib.IncorrectOldPassword)
+		lib.AbortWithError(c, lib.ErrIncorrectOldPassword)
 		return
 	}
 
-	err = controller.userService.UpdatePassword(user.ID, *dto.NewPassword)
+	err = controller.userService.UpdatePassword(c.Request.Context(), user.ID, *dto.NewPassword)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		lib.AbortWithError(c, err)
 		return
 	}
 
 	lib.JsonResponse(c, nil)
 }
 
+// POST /api/user/profile
+// upload a new profile picture, stored in every configured size
 func (controller *userController) UploadProfile(c *gin.Context) {
 	userId := c.MustGet("userId").(string)
 
-	user, err := controller.userService.FindById(userId)
-	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+	user, err := controller.userService.FindById(c.Request.Context(), userId)
+	if errors.Is(err, db.ErrNotFound) {
+		lib.AbortWithError(c, lib.ErrInvalidToken)
 		return
 	}
-	if user == nil {
-		lib.ErrorResponse(c, http.StatusUnauthorized, "")
+	if err != nil {
+		lib.AbortWithError(c, err)
 		return
 	}
 
-	file, header, err := c.Request.FormFile("file")
-	if err != nil {
-		lib.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	// leave some room for the multipart envelope around the file itself
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, controller.configs.ImageMaxBytes+1<<20)
+	file, _, err := c.Request.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		lib.AbortWithError(c, lib.ErrImageTooLarge.Wrap(err))
 		return
 	}
-	fileExtension := filepath.Ext(header.Filename)
-	filename := uuid.NewString() + fileExtension
-	out, err := os.Create("public/profile/" + filename)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		lib.AbortWithError(c, lib.NewError(http.StatusBadRequest, lib.InvalidRequest, "The file field is missing or unreadable").Wrap(err))
 		return
 	}
-	defer out.Close()
-	_, err = io.Copy(out, file)
+	defer file.Close()
+
+	err = controller.profileUploader.Save(c.Request.Context(), user, file)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		profileErrorResponse(c, err)
 		return
 	}
 
-	if user.Profile != "" {
-		err = os.Remove("public/profile/" + user.Profile)
-		if err != nil {
-			log.Default().Println(err.Error())
-		}
-	}
-
-	err = controller.userService.UpdateProfile(user.ID, filename)
+	_user, err := models.GetUser(c.Request.Context(), user, controller.blobStore, &controller.configs)
 	if err != nil {
-		lib.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		lib.AbortWithError(c, err)
 		return
 	}
-
-	filepath := controller.configs.Domain + "/public/profile/" + filename
-	lib.JsonResponse(c, gin.H{"filepath": filepath})
+	lib.JsonResponse(c, gin.H{"filepath": _user.Profile, "profiles": _user.Profiles})
 }
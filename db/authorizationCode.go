@@ -0,0 +1,113 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AuthorizationCode is what the user consented to at /authorize, until the
+// client exchanges the code for tokens
+type AuthorizationCode struct {
+	Code          string
+	ClientId      string
+	UserId        string
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
+
+// AuthorizationCodeService stores the authorization codes. A code can only be
+// consumed once, consuming an unknown, used or expired code returns ErrNotFound.
+type AuthorizationCodeService interface {
+	// CreateAuthorizationCode generates the code of authorization and returns it
+	CreateAuthorizationCode(ctx context.Context, authorization AuthorizationCode) (string, error)
+	ConsumeAuthorizationCode(ctx context.Context, code string, now time.Time) (*AuthorizationCode, error)
+	RemoveExpiredAuthorizationCodes(ctx context.Context, now time.Time) (int64, error)
+}
+
+func newAuthorizationCode(authorization AuthorizationCode) *AuthorizationCode {
+	authorization.Code = uuid.NewString()
+	authorization.CreatedAt = time.Now()
+	return &authorization
+}
+
+// authorizationCodeDocument is how an authorization code is stored in
+// MongoDB, a TTL index on expiresAt removes it once expired
+type authorizationCodeDocument struct {
+	Code          string    `bson:"_id"`
+	ClientId      string    `bson:"clientId"`
+	UserId        string    `bson:"userId"`
+	RedirectURI   string    `bson:"redirectUri"`
+	Scope         string    `bson:"scope"`
+	Nonce         string    `bson:"nonce,omitempty"`
+	CodeChallenge string    `bson:"codeChallenge"`
+	ExpiresAt     time.Time `bson:"expiresAt"`
+	CreatedAt     time.Time `bson:"createdAt"`
+}
+
+type authorizationCodeService struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewAuthorizationCodeService expects the TTL index of the
+// "authorizationCode" collection, which the Mongo migrations create
+func NewAuthorizationCodeService(client *mongo.Client, configs *providers.Config) AuthorizationCodeService {
+	return &authorizationCodeService{
+		collection: OpenCollection(client, "authorizationCode", configs.DatabaseName),
+		timeout:    configs.DbTimeout,
+	}
+}
+
+func (service *authorizationCodeService) CreateAuthorizationCode(ctx context.Context, authorization AuthorizationCode) (string, error) {
+	code := newAuthorizationCode(authorization)
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	_, err := service.collection.InsertOne(ctx, authorizationCodeDocument(*code))
+	if err != nil {
+		return "", mongoError(err)
+	}
+	return code.Code, nil
+}
+
+func (service *authorizationCodeService) ConsumeAuthorizationCode(ctx context.Context, code string, now time.Time) (*AuthorizationCode, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	// removed as it is read, so that only one exchange gets it
+	var document authorizationCodeDocument
+	err := service.collection.FindOneAndDelete(ctx, bson.M{"_id": code}).Decode(&document)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	if !document.ExpiresAt.After(now) {
+		return nil, ErrNotFound
+	}
+	authorization := AuthorizationCode(document)
+	return &authorization, nil
+}
+
+func (service *authorizationCodeService) RemoveExpiredAuthorizationCodes(ctx context.Context, now time.Time) (int64, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	// the TTL index does it too, but only once a minute
+	res, err := service.collection.DeleteMany(ctx, bson.M{"expiresAt": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, mongoError(err)
+	}
+	return res.DeletedCount, nil
+}
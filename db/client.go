@@ -0,0 +1,213 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Client is a registered OAuth client, such as another backend service or
+// an app signing its users in with OpenID Connect. Only the SHA-256 of its
+// secret is stored: the secrets are random and long, unlike passwords they
+// need no slow hash, which would slow down every call.
+type Client struct {
+	ClientId   string
+	Name       string
+	SecretHash string
+	// RedirectURIs are where the authorization responses may be sent, compared as is
+	RedirectURIs []string
+	// Scopes are the scopes the client may get for itself with the
+	// client_credentials grant, the clients having some are service accounts
+	Scopes    []string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Public clients, such as mobile apps, cannot keep a secret and have none
+func (client *Client) Public() bool {
+	return client.SecretHash == ""
+}
+
+// CheckSecret reports whether secret is the secret of the client
+func (client *Client) CheckSecret(secret string) bool {
+	if client.Public() {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashSecret(secret))) == 1
+}
+
+// ServiceAccount reports whether the client may use the client_credentials
+// grant, which needs a secret and allowed scopes
+func (client *Client) ServiceAccount() bool {
+	return !client.Public() && len(client.Scopes) > 0
+}
+
+// HasScope reports whether scope is one of the allowed scopes
+func (client *Client) HasScope(scope string) bool {
+	for _, allowed := range client.Scopes {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRedirectURI reports whether uri is one of the registered redirect URIs
+func (client *Client) HasRedirectURI(uri string) bool {
+	for _, registered := range client.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientService stores the registered OAuth clients. Looking up or removing
+// an unknown client returns ErrNotFound.
+type ClientService interface {
+	// CreateClient registers a public client when secret is empty
+	CreateClient(ctx context.Context, name string, secret string, redirectURIs []string, scopes []string) (*Client, error)
+	FindClient(ctx context.Context, clientId string) (*Client, error)
+	ListClients(ctx context.Context) ([]Client, error)
+	RemoveClient(ctx context.Context, clientId string) error
+}
+
+func newClient(name string, secret string, redirectURIs []string, scopes []string) *Client {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	client := &Client{
+		ClientId:     uuid.NewString(),
+		Name:         name,
+		RedirectURIs: append([]string{}, redirectURIs...),
+		Scopes:       append([]string{}, scopes...),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if secret != "" {
+		client.SecretHash = hashSecret(secret)
+	}
+	return client
+}
+
+// clientDocument is how a client is stored in MongoDB
+type clientDocument struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	ClientId     string             `bson:"clientId,omitempty"`
+	Name         string             `bson:"name,omitempty"`
+	SecretHash   string             `bson:"secretHash,omitempty"`
+	RedirectURIs []string           `bson:"redirectUris,omitempty"`
+	Scopes       []string           `bson:"scopes,omitempty"`
+	CreatedAt    time.Time          `bson:"createdAt,omitempty"`
+	UpdatedAt    time.Time          `bson:"updatedAt,omitempty"`
+}
+
+func (document *clientDocument) client() *Client {
+	return &Client{
+		ClientId:     document.ClientId,
+		Name:         document.Name,
+		SecretHash:   document.SecretHash,
+		RedirectURIs: append([]string{}, document.RedirectURIs...),
+		Scopes:       append([]string{}, document.Scopes...),
+		CreatedAt:    document.CreatedAt,
+		UpdatedAt:    document.UpdatedAt,
+	}
+}
+
+type clientService struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewClientService expects the indexes of the "client" collection, which the
+// Mongo migrations create
+func NewClientService(client *mongo.Client, configs *providers.Config) ClientService {
+	return &clientService{
+		collection: OpenCollection(client, "client", configs.DatabaseName),
+		timeout:    configs.DbTimeout,
+	}
+}
+
+func (service *clientService) CreateClient(ctx context.Context, name string, secret string, redirectURIs []string, scopes []string) (*Client, error) {
+	client := newClient(name, secret, redirectURIs, scopes)
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	document := clientDocument{
+		ID:           primitive.NewObjectID(),
+		ClientId:     client.ClientId,
+		Name:         client.Name,
+		SecretHash:   client.SecretHash,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		CreatedAt:    client.CreatedAt,
+		UpdatedAt:    client.UpdatedAt,
+	}
+	_, err := service.collection.InsertOne(ctx, document)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return client, nil
+}
+
+func (service *clientService) FindClient(ctx context.Context, clientId string) (*Client, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var document clientDocument
+	err := service.collection.FindOne(ctx, bson.M{"clientId": clientId}).Decode(&document)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return document.client(), nil
+}
+
+func (service *clientService) ListClients(ctx context.Context) ([]Client, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	cursor, err := service.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	var documents []clientDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, mongoError(err)
+	}
+	clients := make([]Client, 0, len(documents))
+	for i := range documents {
+		clients = append(clients, *documents[i].client())
+	}
+	return clients, nil
+}
+
+func (service *clientService) RemoveClient(ctx context.Context, clientId string) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.collection.DeleteOne(ctx, bson.M{"clientId": clientId})
+	if err != nil {
+		return mongoError(err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
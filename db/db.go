@@ -3,19 +3,24 @@ package db
 import (
 	"GoApp/providers"
 	"context"
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
+	"os"
 	"time"
 
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 //DBinstance func
-func GetClient(configs providers.Config) *mongo.Client {
-	client, err := mongo.NewClient(options.Client().ApplyURI(configs.MongoDbUrl))
+func GetClient(configs providers.Config, logger *slog.Logger) *mongo.Client {
+	client, err := mongo.NewClient(options.Client().ApplyURI(configs.MongoDbUrl).SetMonitor(chainMonitors(otelmongo.NewMonitor(), newMetricsMonitor())))
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("MongoDB client", slog.Any("error", err))
+		os.Exit(1)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -23,9 +28,10 @@ func GetClient(configs providers.Config) *mongo.Client {
 	defer cancel()
 	err = client.Connect(ctx)
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("MongoDB connect", slog.Any("error", err))
+		os.Exit(1)
 	}
-	fmt.Println("Connected to MongoDB!")
+	logger.Info("Connected to MongoDB!")
 
 	return client
 }
@@ -37,3 +43,41 @@ func OpenCollection(client *mongo.Client, collectionName string, databaseName st
 
 	return collection
 }
+
+// Ping checks that the primary of the MongoDB deployment is reachable
+func Ping(ctx context.Context, client *mongo.Client) error {
+	return client.Ping(ctx, readpref.Primary())
+}
+
+// chainMonitors forwards every command event to all of the given monitors
+func chainMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, monitor := range monitors {
+				monitor.Started(ctx, e)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, monitor := range monitors {
+				monitor.Succeeded(ctx, e)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, monitor := range monitors {
+				monitor.Failed(ctx, e)
+			}
+		},
+	}
+}
+
+// mongoError translates driver errors into the errors of this package
+func mongoError(err error) error {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return ErrDuplicate
+	default:
+		return err
+	}
+}
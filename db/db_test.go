@@ -0,0 +1,101 @@
+package db_test
+
+import (
+	"GoApp/db"
+	"GoApp/db/dbtest"
+	"GoApp/providers"
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestMemoryServices(t *testing.T) {
+	services := dbtest.Services{
+		Users:                db.NewMemoryUserService(),
+		RefreshTokens:        db.NewMemoryRefreshTokenService(),
+		Uploads:              db.NewMemoryUploadService(),
+		Clients:              db.NewMemoryClientService(),
+		RevokedTokens:        db.NewMemoryRevokedTokenService(),
+		AuthorizationCodes:   db.NewMemoryAuthorizationCodeService(),
+		DeviceAuthorizations: db.NewMemoryDeviceAuthorizationService(),
+		Tenants:              db.NewMemoryTenantService(),
+	}
+	if err := dbtest.TestServices(context.Background(), services); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPostgresServices needs TEST_POSTGRES_URL, a disposable database the migrations are applied to
+func TestPostgresServices(t *testing.T) {
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	ctx := context.Background()
+	configs := &providers.Config{DatabaseDriver: "postgres", DatabaseUrl: url, DbTimeout: 10 * time.Second}
+	sqlDB := db.OpenSQL(configs, logger)
+	defer sqlDB.Close()
+
+	if err := db.NewSQLMigrator(sqlDB, configs.DatabaseDriver, logger).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbtest.TestServices(ctx, sqlServices(sqlDB, configs)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMongoServices needs TEST_MONGODB_URL, the suite runs in a database of its own dropped afterwards
+func TestMongoServices(t *testing.T) {
+	url := os.Getenv("TEST_MONGODB_URL")
+	if url == "" {
+		t.Skip("TEST_MONGODB_URL is not set")
+	}
+	ctx := context.Background()
+	configs := &providers.Config{DatabaseDriver: "mongo", MongoDbUrl: url, DatabaseName: "test_" + uuid.NewString(), DbTimeout: 10 * time.Second}
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+	defer client.Database(configs.DatabaseName).Drop(ctx)
+
+	if err := db.NewMongoMigrator(client, configs, logger).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	services := dbtest.Services{
+		Users:                db.NewUserService(client, configs),
+		RefreshTokens:        db.NewRefreshTokenService(client, configs),
+		Uploads:              db.NewUploadService(client, configs),
+		Clients:              db.NewClientService(client, configs),
+		RevokedTokens:        db.NewRevokedTokenService(client, configs),
+		AuthorizationCodes:   db.NewAuthorizationCodeService(client, configs),
+		DeviceAuthorizations: db.NewDeviceAuthorizationService(client, configs),
+		Tenants:              db.NewTenantService(client, configs),
+	}
+	if err := dbtest.TestServices(ctx, services); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sqlServices(sqlDB *sql.DB, configs *providers.Config) dbtest.Services {
+	return dbtest.Services{
+		Users:                db.NewSQLUserService(sqlDB, configs),
+		RefreshTokens:        db.NewSQLRefreshTokenService(sqlDB, configs),
+		Uploads:              db.NewSQLUploadService(sqlDB, configs),
+		Clients:              db.NewSQLClientService(sqlDB, configs),
+		RevokedTokens:        db.NewSQLRevokedTokenService(sqlDB, configs),
+		AuthorizationCodes:   db.NewSQLAuthorizationCodeService(sqlDB, configs),
+		DeviceAuthorizations: db.NewSQLDeviceAuthorizationService(sqlDB, configs),
+		Tenants:              db.NewSQLTenantService(sqlDB, configs),
+	}
+}
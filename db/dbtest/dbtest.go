@@ -0,0 +1,756 @@
+// Package dbtest is a conformance suite for the services of package db.
+// Every implementation must pass it, so handlers behave the same whichever
+// database is configured. go test ./db runs it against the memory services,
+// against SQLite with -tags sqlite, and against Postgres or MongoDB when
+// TEST_POSTGRES_URL or TEST_MONGODB_URL is set:
+//
+//	services := dbtest.Services{
+//		Users:                db.NewMemoryUserService(),
+//		RefreshTokens:        db.NewMemoryRefreshTokenService(),
+//		Uploads:              db.NewMemoryUploadService(),
+//		Clients:              db.NewMemoryClientService(),
+//		RevokedTokens:        db.NewMemoryRevokedTokenService(),
+//		AuthorizationCodes:   db.NewMemoryAuthorizationCodeService(),
+//		DeviceAuthorizations: db.NewMemoryDeviceAuthorizationService(),
+//		Tenants:              db.NewMemoryTenantService(),
+//	}
+//	if err := dbtest.TestServices(ctx, services); err != nil {
+//		t.Fatal(err)
+//	}
+package dbtest
+
+import (
+	"GoApp/db"
+	dto "GoApp/dto/auth"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Services are the implementations under test, all backed by the same database
+type Services struct {
+	Users                db.UserService
+	RefreshTokens        db.RefreshTokenService
+	Uploads              db.UploadService
+	Clients              db.ClientService
+	RevokedTokens        db.RevokedTokenService
+	AuthorizationCodes   db.AuthorizationCodeService
+	DeviceAuthorizations db.DeviceAuthorizationService
+	Tenants              db.TenantService
+}
+
+// TestServices runs the whole suite and returns every failure found, or nil
+func TestServices(ctx context.Context, services Services) error {
+	return errors.Join(
+		TestUserService(ctx, services.Users),
+		TestRefreshTokenService(ctx, services.Users, services.RefreshTokens),
+		TestUploadService(ctx, services.Users, services.Uploads),
+		TestClientService(ctx, services.Clients),
+		TestRevokedTokenService(ctx, services.RevokedTokens),
+		TestAuthorizationCodeService(ctx, services.Users, services.Clients, services.AuthorizationCodes),
+		TestDeviceAuthorizationService(ctx, services.Users, services.Clients, services.DeviceAuthorizations),
+		TestTenantService(ctx, services.Tenants),
+	)
+}
+
+// suite collects the failures of one service
+type suite struct {
+	name   string
+	errors []error
+}
+
+func (s *suite) errorf(format string, args ...interface{}) {
+	s.errors = append(s.errors, fmt.Errorf(s.name+": "+format, args...))
+}
+
+// check records err unless it is nil, it reports whether err was nil
+func (s *suite) check(step string, err error) bool {
+	if err != nil {
+		s.errorf("%s: %v", step, err)
+		return false
+	}
+	return true
+}
+
+// expect records a failure unless err is target
+func (s *suite) expect(step string, err, target error) {
+	if !errors.Is(err, target) {
+		s.errorf("%s: got error %v, want %v", step, err, target)
+	}
+}
+
+func (s *suite) err() error {
+	return errors.Join(s.errors...)
+}
+
+func newCredentials() dto.RegisterCredentials {
+	email := uuid.NewString() + "@example.com"
+	password := "password"
+	firstname := "Jane"
+	lastname := "Doe"
+	return dto.RegisterCredentials{
+		Email:     &email,
+		Password:  &password,
+		Firstname: &firstname,
+		Lastname:  &lastname,
+	}
+}
+
+// TestUserService checks users.
+func TestUserService(ctx context.Context, users db.UserService) error {
+	s := &suite{name: "UserService"}
+
+	credentials := newCredentials()
+	user, err := users.CreateUser(ctx, credentials)
+	if !s.check("CreateUser", err) {
+		return s.err()
+	}
+	if user.ID == "" || user.ActivationCode == "" || user.Activated {
+		s.errorf("CreateUser: got id %q, activation code %q and activated %v", user.ID, user.ActivationCode, user.Activated)
+	}
+	if user.Password == nil || bcrypt.CompareHashAndPassword([]byte(*user.Password), []byte(*credentials.Password)) != nil {
+		s.errorf("CreateUser: password is not stored as a bcrypt hash of the given password")
+	}
+
+	_, err = users.CreateUser(ctx, credentials)
+	s.expect("CreateUser with a taken email", err, db.ErrDuplicate)
+
+	exists, err := users.UserExists(ctx, *credentials.Email)
+	if s.check("UserExists", err) && !exists {
+		s.errorf("UserExists: got false for a created user")
+	}
+	exists, err = users.UserExists(ctx, "missing@example.com")
+	if s.check("UserExists", err) && exists {
+		s.errorf("UserExists: got true for a missing user")
+	}
+
+	found, err := users.FindUser(ctx, *credentials.Email)
+	if s.check("FindUser", err) && found.ID != user.ID {
+		s.errorf("FindUser: got id %q, want %q", found.ID, user.ID)
+	}
+	_, err = users.FindUser(ctx, "missing@example.com")
+	s.expect("FindUser of a missing user", err, db.ErrNotFound)
+
+	found, err = users.FindById(ctx, user.ID)
+	if s.check("FindById", err) && (found.Email == nil || *found.Email != *credentials.Email) {
+		s.errorf("FindById: got a different user")
+	}
+	_, err = users.FindById(ctx, "missing")
+	s.expect("FindById of a malformed id", err, db.ErrNotFound)
+
+	_, err = users.ActivateUser(ctx, *credentials.Email, "wrong code", "")
+	s.expect("ActivateUser with a wrong code", err, db.ErrNotFound)
+	activated, err := users.ActivateUser(ctx, *credentials.Email, user.ActivationCode, "")
+	if s.check("ActivateUser", err) && !activated.Activated {
+		s.errorf("ActivateUser: user is not activated")
+	}
+
+	updated, err := users.UpdateActivationCode(ctx, *credentials.Email)
+	if s.check("UpdateActivationCode", err) && (updated.ActivationCode == "" || updated.ActivationCode == user.ActivationCode) {
+		s.errorf("UpdateActivationCode: activation code did not change")
+	}
+	_, err = users.UpdateActivationCode(ctx, "missing@example.com")
+	s.expect("UpdateActivationCode of a missing user", err, db.ErrNotFound)
+
+	if updated != nil {
+		_, err = users.ActivateUser(ctx, *credentials.Email, updated.ActivationCode, "new password")
+		s.check("ActivateUser with a password", err)
+		found, err = users.FindById(ctx, user.ID)
+		if s.check("FindById", err) && bcrypt.CompareHashAndPassword([]byte(*found.Password), []byte("new password")) != nil {
+			s.errorf("ActivateUser: password was not changed")
+		}
+	}
+
+	s.check("UpdatePassword", users.UpdatePassword(ctx, user.ID, "other password"))
+	found, err = users.FindById(ctx, user.ID)
+	if s.check("FindById", err) && bcrypt.CompareHashAndPassword([]byte(*found.Password), []byte("other password")) != nil {
+		s.errorf("UpdatePassword: password was not changed")
+	}
+
+	s.check("UpdateProfile", users.UpdateProfile(ctx, user.ID, "profile", []int{64, 256}))
+	s.check("UpdateDetail", users.UpdateDetail(ctx, user.ID, "John", "Smith"))
+	found, err = users.FindById(ctx, user.ID)
+	if s.check("FindById", err) {
+		if found.Profile != "profile" || len(found.ProfileSizes) != 2 || found.ProfileSizes[0] != 64 || found.ProfileSizes[1] != 256 {
+			s.errorf("UpdateProfile: got profile %q with sizes %v", found.Profile, found.ProfileSizes)
+		}
+		if *found.Firstname != "John" || *found.Lastname != "Smith" {
+			s.errorf("UpdateDetail: got %s %s", *found.Firstname, *found.Lastname)
+		}
+	}
+
+	s.expect("UpdatePassword of a malformed id", users.UpdatePassword(ctx, "missing", "password"), db.ErrNotFound)
+	s.expect("UpdateProfile of a malformed id", users.UpdateProfile(ctx, "missing", "profile", nil), db.ErrNotFound)
+	s.expect("UpdateDetail of a malformed id", users.UpdateDetail(ctx, "missing", "John", "Smith"), db.ErrNotFound)
+
+	found, err = users.FindById(ctx, user.ID)
+	if s.check("FindById", err) && found.Admin {
+		s.errorf("CreateUser: new users must not be admins")
+	}
+	s.check("UpdateAdmin", users.UpdateAdmin(ctx, user.ID, true))
+	found, err = users.FindById(ctx, user.ID)
+	if s.check("FindById", err) && !found.Admin {
+		s.errorf("UpdateAdmin: user is not an admin")
+	}
+	s.check("UpdateAdmin", users.UpdateAdmin(ctx, user.ID, false))
+	found, err = users.FindById(ctx, user.ID)
+	if s.check("FindById", err) && found.Admin {
+		s.errorf("UpdateAdmin: user is still an admin")
+	}
+	s.expect("UpdateAdmin of a malformed id", users.UpdateAdmin(ctx, "missing", true), db.ErrNotFound)
+
+	testProvisioning(ctx, s, users, *credentials.Email)
+	return s.err()
+}
+
+// testProvisioning checks the users of SCIM tenants, taken is the email of a
+// registered user
+func testProvisioning(ctx context.Context, s *suite, users db.UserService, taken string) {
+	tenantId := uuid.NewString()
+	provisioned := db.ProvisionedUser{
+		TenantId:  tenantId,
+		Email:     uuid.NewString() + "@example.com",
+		Firstname: "Jane",
+		Lastname:  "Doe",
+		Active:    true,
+	}
+	user, err := users.ProvisionUser(ctx, provisioned)
+	if !s.check("ProvisionUser", err) {
+		return
+	}
+	if user.TenantId != tenantId || !user.Activated || user.Deprovisioned() || user.Password == nil {
+		s.errorf("ProvisionUser: got %+v", user)
+	}
+	_, err = users.ProvisionUser(ctx, db.ProvisionedUser{TenantId: tenantId, Email: taken, Active: true})
+	s.expect("ProvisionUser with a taken email", err, db.ErrDuplicate)
+
+	second := provisioned
+	second.Email = uuid.NewString() + "@example.com"
+	second.Password = "password"
+	second.Active = false
+	other, err := users.ProvisionUser(ctx, second)
+	if s.check("ProvisionUser with a password", err) {
+		if other.Activated || !other.Deprovisioned() || bcrypt.CompareHashAndPassword([]byte(*other.Password), []byte("password")) != nil {
+			s.errorf("ProvisionUser: got %+v", other)
+		}
+	}
+
+	found, err := users.FindById(ctx, user.ID)
+	if s.check("FindById of a provisioned user", err) && (found.TenantId != tenantId || *found.Email != provisioned.Email) {
+		s.errorf("FindById: got %+v", found)
+	}
+
+	// created in the same second, their order is up to the database
+	all, total, err := users.ListUsers(ctx, db.UserFilter{TenantId: tenantId, Limit: 10})
+	if s.check("ListUsers", err) && (total != 2 || len(all) != 2 || (all[0].ID != user.ID && all[1].ID != user.ID)) {
+		s.errorf("ListUsers: got %d of %d users", len(all), total)
+	}
+	list, total, err := users.ListUsers(ctx, db.UserFilter{TenantId: tenantId, Offset: 1, Limit: 10})
+	if s.check("ListUsers from an offset", err) && (total != 2 || len(list) != 1 || (len(all) == 2 && list[0].ID != all[1].ID)) {
+		s.errorf("ListUsers from an offset: got %d of %d users", len(list), total)
+	}
+	list, total, err = users.ListUsers(ctx, db.UserFilter{TenantId: tenantId, Email: provisioned.Email, Limit: 10})
+	if s.check("ListUsers by email", err) && (total != 1 || len(list) != 1 || list[0].ID != user.ID) {
+		s.errorf("ListUsers by email: got %d of %d users", len(list), total)
+	}
+	list, total, err = users.ListUsers(ctx, db.UserFilter{TenantId: tenantId})
+	if s.check("ListUsers without a limit", err) && (total != 2 || len(list) != 0) {
+		s.errorf("ListUsers without a limit: got %d of %d users", len(list), total)
+	}
+	_, total, err = users.ListUsers(ctx, db.UserFilter{TenantId: tenantId, Email: taken})
+	if s.check("ListUsers of another tenant", err) && total != 0 {
+		s.errorf("ListUsers: got a user of another tenant")
+	}
+
+	provisioned.Email = uuid.NewString() + "@example.com"
+	provisioned.Firstname = "John"
+	provisioned.Active = false
+	updated, err := users.UpdateProvisionedUser(ctx, user.ID, provisioned)
+	if s.check("UpdateProvisionedUser", err) {
+		if *updated.Email != provisioned.Email || *updated.Firstname != "John" || !updated.Deprovisioned() || updated.TenantId != tenantId {
+			s.errorf("UpdateProvisionedUser: got %+v", updated)
+		}
+		if updated.ActivationCode == user.ActivationCode {
+			s.errorf("UpdateProvisionedUser: deactivating kept the activation code")
+		}
+		_, err = users.ActivateUser(ctx, provisioned.Email, user.ActivationCode, "")
+		s.expect("ActivateUser with the code from before the deactivation", err, db.ErrNotFound)
+	}
+	provisioned.Email = taken
+	_, err = users.UpdateProvisionedUser(ctx, user.ID, provisioned)
+	s.expect("UpdateProvisionedUser with a taken email", err, db.ErrDuplicate)
+	_, err = users.UpdateProvisionedUser(ctx, "missing", provisioned)
+	s.expect("UpdateProvisionedUser of a malformed id", err, db.ErrNotFound)
+
+	s.check("RemoveUser", users.RemoveUser(ctx, user.ID))
+	_, err = users.FindById(ctx, user.ID)
+	s.expect("FindById of a removed user", err, db.ErrNotFound)
+	s.expect("RemoveUser of a removed user", users.RemoveUser(ctx, user.ID), db.ErrNotFound)
+	s.expect("RemoveUser of a malformed id", users.RemoveUser(ctx, "missing"), db.ErrNotFound)
+}
+
+// TestRefreshTokenService checks refresh tokens, users is used to create their owner.
+func TestRefreshTokenService(ctx context.Context, users db.UserService, refreshTokens db.RefreshTokenService) error {
+	s := &suite{name: "RefreshTokenService"}
+
+	user, err := users.CreateUser(ctx, newCredentials())
+	if !s.check("CreateUser", err) {
+		return s.err()
+	}
+
+	before, err := refreshTokens.CountRefreshTokens(ctx)
+	s.check("CountRefreshTokens", err)
+
+	tokenId, err := refreshTokens.CreateRefreshToken(ctx, user.ID)
+	if !s.check("CreateRefreshToken", err) {
+		return s.err()
+	}
+	other, err := refreshTokens.CreateRefreshToken(ctx, user.ID)
+	if s.check("CreateRefreshToken", err) && other == tokenId {
+		s.errorf("CreateRefreshToken: got the same token twice")
+	}
+
+	// the count may be an estimate, it has to move in the right direction
+	after, err := refreshTokens.CountRefreshTokens(ctx)
+	if s.check("CountRefreshTokens", err) && after <= before {
+		s.errorf("CountRefreshTokens: got %d after creating tokens, %d before", after, before)
+	}
+
+	userId, err := refreshTokens.FindUserIdbyRefreshToken(ctx, tokenId)
+	if s.check("FindUserIdbyRefreshToken", err) && userId != user.ID {
+		s.errorf("FindUserIdbyRefreshToken: got user %q, want %q", userId, user.ID)
+	}
+	_, err = refreshTokens.FindUserIdbyRefreshToken(ctx, "missing")
+	s.expect("FindUserIdbyRefreshToken of a missing token", err, db.ErrNotFound)
+	found, err := refreshTokens.FindRefreshToken(ctx, tokenId)
+	if s.check("FindRefreshToken", err) && (found.UserId != user.ID || found.ClientId != "" || found.Scope != "") {
+		s.errorf("FindRefreshToken: got %+v, want a login token of user %q", found, user.ID)
+	}
+	_, err = refreshTokens.FindRefreshToken(ctx, "missing")
+	s.expect("FindRefreshToken of a missing token", err, db.ErrNotFound)
+
+	clientToken, err := refreshTokens.CreateClientRefreshToken(ctx, user.ID, "client", "openid email")
+	if s.check("CreateClientRefreshToken", err) {
+		found, err := refreshTokens.FindRefreshToken(ctx, clientToken)
+		if s.check("FindRefreshToken", err) && (found.UserId != user.ID || found.ClientId != "client" || found.Scope != "openid email") {
+			s.errorf("FindRefreshToken: got %+v, want the token of client %q", found, "client")
+		}
+		_, err = refreshTokens.FindUserIdbyRefreshToken(ctx, clientToken)
+		s.expect("FindUserIdbyRefreshToken of a client token", err, db.ErrNotFound)
+		s.check("RemoveRefreshToken", refreshTokens.RemoveRefreshToken(ctx, clientToken))
+	}
+
+	s.check("RemoveRefreshToken", refreshTokens.RemoveRefreshToken(ctx, tokenId))
+	_, err = refreshTokens.FindUserIdbyRefreshToken(ctx, tokenId)
+	s.expect("FindUserIdbyRefreshToken of a removed token", err, db.ErrNotFound)
+	s.check("RemoveRefreshToken of a removed token", refreshTokens.RemoveRefreshToken(ctx, tokenId))
+
+	userId, err = refreshTokens.FindUserIdbyRefreshToken(ctx, other)
+	if s.check("FindUserIdbyRefreshToken", err) && userId != user.ID {
+		s.errorf("RemoveRefreshToken: removed other tokens of the user")
+	}
+
+	stranger, err := users.CreateUser(ctx, newCredentials())
+	if !s.check("CreateUser", err) {
+		return s.err()
+	}
+	strangerToken, err := refreshTokens.CreateRefreshToken(ctx, stranger.ID)
+	s.check("CreateRefreshToken", err)
+	_, err = refreshTokens.CreateRefreshToken(ctx, user.ID)
+	s.check("CreateRefreshToken", err)
+	removed, err := refreshTokens.RemoveUserRefreshTokens(ctx, user.ID)
+	if s.check("RemoveUserRefreshTokens", err) && removed != 2 {
+		s.errorf("RemoveUserRefreshTokens: removed %d tokens, want 2", removed)
+	}
+	_, err = refreshTokens.FindUserIdbyRefreshToken(ctx, other)
+	s.expect("FindUserIdbyRefreshToken of a revoked token", err, db.ErrNotFound)
+	userId, err = refreshTokens.FindUserIdbyRefreshToken(ctx, strangerToken)
+	if s.check("FindUserIdbyRefreshToken", err) && userId != stranger.ID {
+		s.errorf("RemoveUserRefreshTokens: removed the tokens of another user")
+	}
+	removed, err = refreshTokens.RemoveUserRefreshTokens(ctx, "missing")
+	if s.check("RemoveUserRefreshTokens of a malformed id", err) && removed != 0 {
+		s.errorf("RemoveUserRefreshTokens of a malformed id: removed %d tokens", removed)
+	}
+
+	return s.err()
+}
+
+// TestUploadService checks upload sessions, users is used to create their owner.
+func TestUploadService(ctx context.Context, users db.UserService, uploads db.UploadService) error {
+	s := &suite{name: "UploadService"}
+
+	user, err := users.CreateUser(ctx, newCredentials())
+	if !s.check("CreateUser", err) {
+		return s.err()
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	metadata := map[string]string{"purpose": "profile", "filename": "me.png"}
+	upload, err := uploads.CreateUpload(ctx, user.ID, "profile", 10, metadata, expiresAt)
+	if !s.check("CreateUpload", err) {
+		return s.err()
+	}
+	if upload.UploadId == "" || upload.UserId != user.ID || upload.Offset != 0 || len(upload.Parts) != 0 {
+		s.errorf("CreateUpload: got %+v", upload)
+	}
+
+	found, err := uploads.FindUpload(ctx, upload.UploadId)
+	if s.check("FindUpload", err) {
+		if found.UserId != user.ID || found.Purpose != "profile" || found.Length != 10 || found.Metadata["filename"] != "me.png" {
+			s.errorf("FindUpload: got %+v", found)
+		}
+		if !found.ExpiresAt.Equal(expiresAt) {
+			s.errorf("FindUpload: got expiry %v, want %v", found.ExpiresAt, expiresAt)
+		}
+	}
+	_, err = uploads.FindUpload(ctx, "missing")
+	s.expect("FindUpload of a missing upload", err, db.ErrNotFound)
+
+	appended, err := uploads.AppendPart(ctx, upload.UploadId, 0, 4, "part-0")
+	if s.check("AppendPart", err) && (appended.Offset != 4 || len(appended.Parts) != 1 || appended.Parts[0] != "part-0") {
+		s.errorf("AppendPart: got offset %d and parts %v", appended.Offset, appended.Parts)
+	}
+	_, err = uploads.AppendPart(ctx, upload.UploadId, 0, 4, "part-0-again")
+	s.expect("AppendPart at a stale offset", err, db.ErrConflict)
+	appended, err = uploads.AppendPart(ctx, upload.UploadId, 4, 6, "part-4")
+	if s.check("AppendPart", err) && (appended.Offset != 10 || len(appended.Parts) != 2 || appended.Parts[1] != "part-4") {
+		s.errorf("AppendPart: got offset %d and parts %v", appended.Offset, appended.Parts)
+	}
+	_, err = uploads.AppendPart(ctx, "missing", 0, 4, "part-0")
+	s.expect("AppendPart of a missing upload", err, db.ErrNotFound)
+
+	expired, err := uploads.CreateUpload(ctx, user.ID, "profile", 10, nil, time.Now().Add(-time.Minute))
+	if s.check("CreateUpload", err) {
+		list, err := uploads.FindExpiredUploads(ctx, time.Now())
+		if s.check("FindExpiredUploads", err) {
+			foundExpired := false
+			for _, item := range list {
+				if item.UploadId == upload.UploadId {
+					s.errorf("FindExpiredUploads: returned an upload that did not expire")
+				}
+				foundExpired = foundExpired || item.UploadId == expired.UploadId
+			}
+			if !foundExpired {
+				s.errorf("FindExpiredUploads: did not return the expired upload")
+			}
+		}
+		s.check("RemoveUpload", uploads.RemoveUpload(ctx, expired.UploadId))
+	}
+
+	s.check("RemoveUpload", uploads.RemoveUpload(ctx, upload.UploadId))
+	_, err = uploads.FindUpload(ctx, upload.UploadId)
+	s.expect("FindUpload of a removed upload", err, db.ErrNotFound)
+	s.check("RemoveUpload of a removed upload", uploads.RemoveUpload(ctx, upload.UploadId))
+
+	return s.err()
+}
+
+// TestClientService checks the registered clients and their secrets
+func TestClientService(ctx context.Context, clients db.ClientService) error {
+	s := &suite{name: "ClientService"}
+
+	redirectURIs := []string{"https://app.example.com/callback", "http://localhost:8080/callback"}
+	client, err := clients.CreateClient(ctx, "billing", "secret", redirectURIs, nil)
+	if !s.check("CreateClient", err) {
+		return s.err()
+	}
+	if client.ClientId == "" || client.Name != "billing" {
+		s.errorf("CreateClient: got %+v", client)
+	}
+	if client.SecretHash == "secret" || !client.CheckSecret("secret") {
+		s.errorf("CreateClient: the secret is not hashed")
+	}
+	scopes := []string{"reports:read", "users:read"}
+	other, err := clients.CreateClient(ctx, "billing", "secret", nil, scopes)
+	if s.check("CreateClient of the same name", err) && other.ClientId == client.ClientId {
+		s.errorf("CreateClient: got the same client id twice")
+	}
+
+	found, err := clients.FindClient(ctx, client.ClientId)
+	if s.check("FindClient", err) {
+		if found.Name != client.Name || !found.CheckSecret("secret") || found.CheckSecret("wrong") || found.Public() {
+			s.errorf("FindClient: got %+v", found)
+		}
+		if !reflect.DeepEqual(found.RedirectURIs, redirectURIs) || !found.HasRedirectURI(redirectURIs[1]) || found.HasRedirectURI("https://app.example.com/") {
+			s.errorf("FindClient: got the redirect URIs %v, want %v", found.RedirectURIs, redirectURIs)
+		}
+		if found.ServiceAccount() || len(found.Scopes) != 0 {
+			s.errorf("FindClient: got the scopes %v, want none", found.Scopes)
+		}
+	}
+	if other != nil {
+		found, err := clients.FindClient(ctx, other.ClientId)
+		if s.check("FindClient of a service account", err) && (!reflect.DeepEqual(found.Scopes, scopes) || !found.ServiceAccount() || !found.HasScope(scopes[1]) || found.HasScope("reports")) {
+			s.errorf("FindClient: got the scopes %v, want %v", found.Scopes, scopes)
+		}
+	}
+	public, err := clients.CreateClient(ctx, "mobile", "", redirectURIs[:1], nil)
+	if s.check("CreateClient of a public client", err) {
+		found, err := clients.FindClient(ctx, public.ClientId)
+		if s.check("FindClient of a public client", err) && (!found.Public() || found.CheckSecret("")) {
+			s.errorf("FindClient: the public client %+v has a secret", found)
+		}
+	}
+	_, err = clients.FindClient(ctx, "missing")
+	s.expect("FindClient of a missing client", err, db.ErrNotFound)
+
+	list, err := clients.ListClients(ctx)
+	if s.check("ListClients", err) {
+		listed := map[string]bool{}
+		for _, listedClient := range list {
+			listed[listedClient.ClientId] = true
+		}
+		if !listed[client.ClientId] || !listed[other.ClientId] {
+			s.errorf("ListClients: missing the created clients")
+		}
+	}
+
+	s.check("RemoveClient", clients.RemoveClient(ctx, client.ClientId))
+	_, err = clients.FindClient(ctx, client.ClientId)
+	s.expect("FindClient of a removed client", err, db.ErrNotFound)
+	s.expect("RemoveClient of a removed client", clients.RemoveClient(ctx, client.ClientId), db.ErrNotFound)
+	_, err = clients.FindClient(ctx, other.ClientId)
+	s.check("RemoveClient kept the other clients", err)
+
+	return s.err()
+}
+
+// TestRevokedTokenService checks the denylist of access tokens
+func TestRevokedTokenService(ctx context.Context, revokedTokens db.RevokedTokenService) error {
+	s := &suite{name: "RevokedTokenService"}
+
+	now := time.Now().Truncate(time.Second)
+	expired, live := uuid.NewString(), uuid.NewString()
+	s.check("RevokeToken", revokedTokens.RevokeToken(ctx, expired, now.Add(-time.Minute)))
+	s.check("RevokeToken", revokedTokens.RevokeToken(ctx, live, now.Add(time.Hour)))
+	s.check("RevokeToken of a revoked token", revokedTokens.RevokeToken(ctx, live, now.Add(time.Hour)))
+
+	revoked, err := revokedTokens.IsTokenRevoked(ctx, live)
+	if s.check("IsTokenRevoked", err) && !revoked {
+		s.errorf("IsTokenRevoked: a revoked token is not")
+	}
+	revoked, err = revokedTokens.IsTokenRevoked(ctx, uuid.NewString())
+	if s.check("IsTokenRevoked", err) && revoked {
+		s.errorf("IsTokenRevoked: an unknown token is revoked")
+	}
+
+	removed, err := revokedTokens.RemoveExpiredRevokedTokens(ctx, now)
+	if s.check("RemoveExpiredRevokedTokens", err) && removed < 1 {
+		s.errorf("RemoveExpiredRevokedTokens: removed %d tokens, want at least 1", removed)
+	}
+	revoked, err = revokedTokens.IsTokenRevoked(ctx, expired)
+	if s.check("IsTokenRevoked", err) && revoked {
+		s.errorf("RemoveExpiredRevokedTokens: kept an expired token")
+	}
+	revoked, err = revokedTokens.IsTokenRevoked(ctx, live)
+	if s.check("IsTokenRevoked", err) && !revoked {
+		s.errorf("RemoveExpiredRevokedTokens: removed a token which has not expired")
+	}
+
+	return s.err()
+}
+
+// TestAuthorizationCodeService checks that codes are consumed once
+func TestAuthorizationCodeService(ctx context.Context, users db.UserService, clients db.ClientService, codes db.AuthorizationCodeService) error {
+	s := &suite{name: "AuthorizationCodeService"}
+
+	user, err := users.CreateUser(ctx, newCredentials())
+	if !s.check("CreateUser", err) {
+		return s.err()
+	}
+	client, err := clients.CreateClient(ctx, "sso", "secret", []string{"https://app.example.com/callback"}, nil)
+	if !s.check("CreateClient", err) {
+		return s.err()
+	}
+
+	now := time.Now().Truncate(time.Second)
+	authorization := db.AuthorizationCode{
+		ClientId:      client.ClientId,
+		UserId:        user.ID,
+		RedirectURI:   client.RedirectURIs[0],
+		Scope:         "openid email",
+		Nonce:         uuid.NewString(),
+		CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		ExpiresAt:     now.Add(time.Minute),
+	}
+	code, err := codes.CreateAuthorizationCode(ctx, authorization)
+	if !s.check("CreateAuthorizationCode", err) {
+		return s.err()
+	}
+	other, err := codes.CreateAuthorizationCode(ctx, authorization)
+	if s.check("CreateAuthorizationCode", err) && (other == code || code == "") {
+		s.errorf("CreateAuthorizationCode: got the codes %q and %q", code, other)
+	}
+
+	consumed, err := codes.ConsumeAuthorizationCode(ctx, code, now)
+	if s.check("ConsumeAuthorizationCode", err) {
+		if consumed.Code != code || consumed.ClientId != authorization.ClientId || consumed.UserId != authorization.UserId ||
+			consumed.RedirectURI != authorization.RedirectURI || consumed.Scope != authorization.Scope ||
+			consumed.Nonce != authorization.Nonce || consumed.CodeChallenge != authorization.CodeChallenge ||
+			!consumed.ExpiresAt.Equal(authorization.ExpiresAt) {
+			s.errorf("ConsumeAuthorizationCode: got %+v, want %+v", consumed, authorization)
+		}
+	}
+	_, err = codes.ConsumeAuthorizationCode(ctx, code, now)
+	s.expect("ConsumeAuthorizationCode of a consumed code", err, db.ErrNotFound)
+	_, err = codes.ConsumeAuthorizationCode(ctx, uuid.NewString(), now)
+	s.expect("ConsumeAuthorizationCode of an unknown code", err, db.ErrNotFound)
+	_, err = codes.ConsumeAuthorizationCode(ctx, other, now.Add(time.Hour))
+	s.expect("ConsumeAuthorizationCode of an expired code", err, db.ErrNotFound)
+
+	authorization.ExpiresAt = now.Add(-time.Minute)
+	expired, err := codes.CreateAuthorizationCode(ctx, authorization)
+	s.check("CreateAuthorizationCode", err)
+	removed, err := codes.RemoveExpiredAuthorizationCodes(ctx, now)
+	if s.check("RemoveExpiredAuthorizationCodes", err) && removed < 1 {
+		s.errorf("RemoveExpiredAuthorizationCodes: removed %d codes, want at least 1", removed)
+	}
+	_, err = codes.ConsumeAuthorizationCode(ctx, expired, now.Add(-time.Hour))
+	s.expect("ConsumeAuthorizationCode of a removed code", err, db.ErrNotFound)
+
+	return s.err()
+}
+
+// TestDeviceAuthorizationService checks the device authorization requests
+// from their creation to their decision
+func TestDeviceAuthorizationService(ctx context.Context, users db.UserService, clients db.ClientService, devices db.DeviceAuthorizationService) error {
+	s := &suite{name: "DeviceAuthorizationService"}
+
+	user, err := users.CreateUser(ctx, newCredentials())
+	if !s.check("CreateUser", err) {
+		return s.err()
+	}
+	client, err := clients.CreateClient(ctx, "tv", "", nil, nil)
+	if !s.check("CreateClient", err) {
+		return s.err()
+	}
+
+	now := time.Now().Truncate(time.Second)
+	request := db.DeviceAuthorization{
+		ClientId:  client.ClientId,
+		Scope:     "openid profile",
+		Interval:  5 * time.Second,
+		ExpiresAt: now.Add(10 * time.Minute),
+	}
+	created, err := devices.CreateDeviceAuthorization(ctx, request)
+	if !s.check("CreateDeviceAuthorization", err) {
+		return s.err()
+	}
+	if created.DeviceCode == "" || len(created.UserCode) != 8 || created.Status != db.DeviceAuthorizationPending {
+		s.errorf("CreateDeviceAuthorization: got %+v", created)
+	}
+	other, err := devices.CreateDeviceAuthorization(ctx, request)
+	if s.check("CreateDeviceAuthorization", err) && (other.DeviceCode == created.DeviceCode || other.UserCode == created.UserCode) {
+		s.errorf("CreateDeviceAuthorization: got the same codes twice")
+	}
+
+	found, err := devices.FindDeviceAuthorization(ctx, created.UserCode, now)
+	if s.check("FindDeviceAuthorization", err) {
+		if found.DeviceCode != created.DeviceCode || found.ClientId != request.ClientId || found.Scope != request.Scope ||
+			found.Interval != request.Interval || !found.ExpiresAt.Equal(request.ExpiresAt) || !found.LastPolledAt.IsZero() {
+			s.errorf("FindDeviceAuthorization: got %+v, want %+v", found, request)
+		}
+	}
+	_, err = devices.FindDeviceAuthorization(ctx, created.UserCode, now.Add(time.Hour))
+	s.expect("FindDeviceAuthorization of an expired request", err, db.ErrNotFound)
+	_, err = devices.FindDeviceAuthorization(ctx, "BCDFGHJK", now)
+	s.expect("FindDeviceAuthorization of an unknown code", err, db.ErrNotFound)
+
+	polled, err := devices.PollDeviceAuthorization(ctx, created.DeviceCode, now)
+	if s.check("PollDeviceAuthorization", err) && (polled.Status != db.DeviceAuthorizationPending || !polled.LastPolledAt.IsZero()) {
+		s.errorf("PollDeviceAuthorization: got %+v before the first poll", polled)
+	}
+	s.check("SlowDownDeviceAuthorization", devices.SlowDownDeviceAuthorization(ctx, created.DeviceCode, 10*time.Second))
+	polled, err = devices.PollDeviceAuthorization(ctx, created.DeviceCode, now.Add(time.Second))
+	if s.check("PollDeviceAuthorization", err) && (!polled.LastPolledAt.Equal(now) || polled.Interval != 10*time.Second) {
+		s.errorf("PollDeviceAuthorization: got the last poll %v and the interval %v, want %v and 10s", polled.LastPolledAt, polled.Interval, now)
+	}
+	_, err = devices.PollDeviceAuthorization(ctx, uuid.NewString(), now)
+	s.expect("PollDeviceAuthorization of an unknown code", err, db.ErrNotFound)
+
+	s.expect("ApproveDeviceAuthorization of an expired request",
+		devices.ApproveDeviceAuthorization(ctx, created.UserCode, user.ID, now.Add(time.Hour)), db.ErrNotFound)
+	s.check("ApproveDeviceAuthorization", devices.ApproveDeviceAuthorization(ctx, created.UserCode, user.ID, now))
+	s.expect("DenyDeviceAuthorization of a decided request", devices.DenyDeviceAuthorization(ctx, created.UserCode, now), db.ErrNotFound)
+	_, err = devices.FindDeviceAuthorization(ctx, created.UserCode, now)
+	s.expect("FindDeviceAuthorization of a decided request", err, db.ErrNotFound)
+	polled, err = devices.PollDeviceAuthorization(ctx, created.DeviceCode, now.Add(10*time.Second))
+	if s.check("PollDeviceAuthorization of an approved request", err) && (polled.Status != db.DeviceAuthorizationApproved || polled.UserId != user.ID) {
+		s.errorf("PollDeviceAuthorization: got %+v, want it approved by %s", polled, user.ID)
+	}
+	s.check("RemoveDeviceAuthorization", devices.RemoveDeviceAuthorization(ctx, created.DeviceCode))
+	s.expect("RemoveDeviceAuthorization of a removed request", devices.RemoveDeviceAuthorization(ctx, created.DeviceCode), db.ErrNotFound)
+
+	if other != nil {
+		s.check("DenyDeviceAuthorization", devices.DenyDeviceAuthorization(ctx, other.UserCode, now))
+		polled, err := devices.PollDeviceAuthorization(ctx, other.DeviceCode, now)
+		if s.check("PollDeviceAuthorization of a denied request", err) && (polled.Status != db.DeviceAuthorizationDenied || polled.UserId != "") {
+			s.errorf("PollDeviceAuthorization: got %+v, want it denied", polled)
+		}
+	}
+
+	request.ExpiresAt = now.Add(-time.Minute)
+	expired, err := devices.CreateDeviceAuthorization(ctx, request)
+	s.check("CreateDeviceAuthorization", err)
+	removed, err := devices.RemoveExpiredDeviceAuthorizations(ctx, now)
+	if s.check("RemoveExpiredDeviceAuthorizations", err) && removed < 1 {
+		s.errorf("RemoveExpiredDeviceAuthorizations: removed %d requests, want at least 1", removed)
+	}
+	if expired != nil {
+		_, err = devices.PollDeviceAuthorization(ctx, expired.DeviceCode, now)
+		s.expect("PollDeviceAuthorization of a removed request", err, db.ErrNotFound)
+	}
+
+	return s.err()
+}
+
+// TestTenantService checks the SCIM tenants
+func TestTenantService(ctx context.Context, tenants db.TenantService) error {
+	s := &suite{name: "TenantService"}
+
+	token := uuid.NewString()
+	tenant, err := tenants.CreateTenant(ctx, "acme", token)
+	if !s.check("CreateTenant", err) {
+		return s.err()
+	}
+	if tenant.TenantId == "" || tenant.Name != "acme" || tenant.TokenHash == "" || tenant.TokenHash == token {
+		s.errorf("CreateTenant: got %+v", tenant)
+	}
+	_, err = tenants.CreateTenant(ctx, "other", token)
+	s.expect("CreateTenant with a taken token", err, db.ErrDuplicate)
+	other, err := tenants.CreateTenant(ctx, "acme", uuid.NewString())
+	if s.check("CreateTenant of the same name", err) && other.TenantId == tenant.TenantId {
+		s.errorf("CreateTenant: got the same tenant id twice")
+	}
+
+	found, err := tenants.FindTenantByToken(ctx, token)
+	if s.check("FindTenantByToken", err) && (found.TenantId != tenant.TenantId || found.Name != "acme") {
+		s.errorf("FindTenantByToken: got %+v", found)
+	}
+	_, err = tenants.FindTenantByToken(ctx, "wrong")
+	s.expect("FindTenantByToken of a wrong token", err, db.ErrNotFound)
+
+	list, err := tenants.ListTenants(ctx)
+	if s.check("ListTenants", err) {
+		listed := map[string]bool{}
+		for _, listedTenant := range list {
+			listed[listedTenant.TenantId] = true
+		}
+		if !listed[tenant.TenantId] || (other != nil && !listed[other.TenantId]) {
+			s.errorf("ListTenants: missing the created tenants")
+		}
+	}
+
+	s.check("RemoveTenant", tenants.RemoveTenant(ctx, tenant.TenantId))
+	_, err = tenants.FindTenantByToken(ctx, token)
+	s.expect("FindTenantByToken of a removed tenant", err, db.ErrNotFound)
+	s.expect("RemoveTenant of a removed tenant", tenants.RemoveTenant(ctx, tenant.TenantId), db.ErrNotFound)
+
+	return s.err()
+}
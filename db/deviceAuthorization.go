@@ -0,0 +1,255 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"crypto/rand"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The statuses of a device authorization, pending until the user decides
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+)
+
+// DeviceAuthorization is a device authorization request of RFC 8628. The
+// device polls with the DeviceCode while the user enters the UserCode on
+// another screen to approve it.
+type DeviceAuthorization struct {
+	DeviceCode string
+	// UserCode is 8 consonants, easy to type on a phone and hard to misread
+	UserCode string
+	ClientId string
+	Scope    string
+	Status   string
+	// UserId is the user who approved the request
+	UserId string
+	// Interval is how long the device must wait between two polls
+	Interval     time.Duration
+	LastPolledAt time.Time
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// DeviceAuthorizationService stores the device authorization requests. The
+// user codes are unique, creating a request whose user code is taken returns
+// ErrDuplicate and can be retried with a new one.
+type DeviceAuthorizationService interface {
+	// CreateDeviceAuthorization generates the device and user codes of a
+	// pending authorization
+	CreateDeviceAuthorization(ctx context.Context, authorization DeviceAuthorization) (*DeviceAuthorization, error)
+	// FindDeviceAuthorization returns the pending authorization of a user
+	// code, or ErrNotFound once it expired or was decided
+	FindDeviceAuthorization(ctx context.Context, userCode string, now time.Time) (*DeviceAuthorization, error)
+	// ApproveDeviceAuthorization and DenyDeviceAuthorization decide a pending
+	// authorization, returning ErrNotFound like FindDeviceAuthorization
+	ApproveDeviceAuthorization(ctx context.Context, userCode string, userId string, now time.Time) error
+	DenyDeviceAuthorization(ctx context.Context, userCode string, now time.Time) error
+	// PollDeviceAuthorization records a poll of the device and returns the
+	// authorization as it was before, expired ones included
+	PollDeviceAuthorization(ctx context.Context, deviceCode string, now time.Time) (*DeviceAuthorization, error)
+	// SlowDownDeviceAuthorization sets the interval of a device which polls too often
+	SlowDownDeviceAuthorization(ctx context.Context, deviceCode string, interval time.Duration) error
+	// RemoveDeviceAuthorization removes a decided authorization once the
+	// device is told, only one poll succeeds in removing it
+	RemoveDeviceAuthorization(ctx context.Context, deviceCode string) error
+	RemoveExpiredDeviceAuthorizations(ctx context.Context, now time.Time) (int64, error)
+}
+
+// userCodeAlphabet has no vowels, so that the codes spell no words, RFC 8628
+// section 6.1
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+func newUserCode() string {
+	code := make([]byte, 8)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			panic(err)
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code)
+}
+
+func newDeviceAuthorization(authorization DeviceAuthorization) *DeviceAuthorization {
+	authorization.DeviceCode = uuid.NewString()
+	authorization.UserCode = newUserCode()
+	authorization.Status = DeviceAuthorizationPending
+	authorization.UserId = ""
+	authorization.LastPolledAt = time.Time{}
+	authorization.CreatedAt = time.Now()
+	return &authorization
+}
+
+// deviceAuthorizationDocument is how a device authorization is stored in
+// MongoDB, a TTL index on expiresAt removes it once expired
+type deviceAuthorizationDocument struct {
+	DeviceCode   string    `bson:"_id"`
+	UserCode     string    `bson:"userCode"`
+	ClientId     string    `bson:"clientId"`
+	Scope        string    `bson:"scope"`
+	Status       string    `bson:"status"`
+	UserId       string    `bson:"userId,omitempty"`
+	Interval     int64     `bson:"interval"`
+	LastPolledAt time.Time `bson:"lastPolledAt,omitempty"`
+	ExpiresAt    time.Time `bson:"expiresAt"`
+	CreatedAt    time.Time `bson:"createdAt"`
+}
+
+func (document *deviceAuthorizationDocument) deviceAuthorization() *DeviceAuthorization {
+	return &DeviceAuthorization{
+		DeviceCode:   document.DeviceCode,
+		UserCode:     document.UserCode,
+		ClientId:     document.ClientId,
+		Scope:        document.Scope,
+		Status:       document.Status,
+		UserId:       document.UserId,
+		Interval:     time.Duration(document.Interval) * time.Second,
+		LastPolledAt: document.LastPolledAt,
+		ExpiresAt:    document.ExpiresAt,
+		CreatedAt:    document.CreatedAt,
+	}
+}
+
+type deviceAuthorizationService struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewDeviceAuthorizationService expects the indexes of the
+// "deviceAuthorization" collection, which the Mongo migrations create
+func NewDeviceAuthorizationService(client *mongo.Client, configs *providers.Config) DeviceAuthorizationService {
+	return &deviceAuthorizationService{
+		collection: OpenCollection(client, "deviceAuthorization", configs.DatabaseName),
+		timeout:    configs.DbTimeout,
+	}
+}
+
+func (service *deviceAuthorizationService) CreateDeviceAuthorization(ctx context.Context, authorization DeviceAuthorization) (*DeviceAuthorization, error) {
+	created := newDeviceAuthorization(authorization)
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	_, err := service.collection.InsertOne(ctx, deviceAuthorizationDocument{
+		DeviceCode: created.DeviceCode,
+		UserCode:   created.UserCode,
+		ClientId:   created.ClientId,
+		Scope:      created.Scope,
+		Status:     created.Status,
+		Interval:   int64(created.Interval / time.Second),
+		ExpiresAt:  created.ExpiresAt,
+		CreatedAt:  created.CreatedAt,
+	})
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return created, nil
+}
+
+func (service *deviceAuthorizationService) FindDeviceAuthorization(ctx context.Context, userCode string, now time.Time) (*DeviceAuthorization, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var document deviceAuthorizationDocument
+	err := service.collection.FindOne(ctx, pendingDeviceAuthorization(userCode, now)).Decode(&document)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return document.deviceAuthorization(), nil
+}
+
+func pendingDeviceAuthorization(userCode string, now time.Time) bson.M {
+	return bson.M{"userCode": userCode, "status": DeviceAuthorizationPending, "expiresAt": bson.M{"$gt": now}}
+}
+
+func (service *deviceAuthorizationService) ApproveDeviceAuthorization(ctx context.Context, userCode string, userId string, now time.Time) error {
+	return service.decide(ctx, userCode, bson.M{"status": DeviceAuthorizationApproved, "userId": userId}, now)
+}
+
+func (service *deviceAuthorizationService) DenyDeviceAuthorization(ctx context.Context, userCode string, now time.Time) error {
+	return service.decide(ctx, userCode, bson.M{"status": DeviceAuthorizationDenied}, now)
+}
+
+func (service *deviceAuthorizationService) decide(ctx context.Context, userCode string, decision bson.M, now time.Time) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.collection.UpdateOne(ctx, pendingDeviceAuthorization(userCode, now), bson.M{"$set": decision})
+	if err != nil {
+		return mongoError(err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (service *deviceAuthorizationService) PollDeviceAuthorization(ctx context.Context, deviceCode string, now time.Time) (*DeviceAuthorization, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var document deviceAuthorizationDocument
+	err := service.collection.FindOneAndUpdate(ctx, bson.M{"_id": deviceCode}, bson.M{"$set": bson.M{"lastPolledAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&document)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return document.deviceAuthorization(), nil
+}
+
+func (service *deviceAuthorizationService) SlowDownDeviceAuthorization(ctx context.Context, deviceCode string, interval time.Duration) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.collection.UpdateOne(ctx, bson.M{"_id": deviceCode}, bson.M{"$set": bson.M{"interval": int64(interval / time.Second)}})
+	if err != nil {
+		return mongoError(err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (service *deviceAuthorizationService) RemoveDeviceAuthorization(ctx context.Context, deviceCode string) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.collection.DeleteOne(ctx, bson.M{"_id": deviceCode})
+	if err != nil {
+		return mongoError(err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (service *deviceAuthorizationService) RemoveExpiredDeviceAuthorizations(ctx context.Context, now time.Time) (int64, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	// the TTL index does it too, but only once a minute
+	res, err := service.collection.DeleteMany(ctx, bson.M{"expiresAt": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, mongoError(err)
+	}
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,14 @@
+package db
+
+import "errors"
+
+// Errors returned by every implementation of the services in this package,
+// so callers never have to know which database is behind them.
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("db: not found")
+	// ErrDuplicate is returned when a record with the same unique key already exists
+	ErrDuplicate = errors.New("db: duplicate")
+	// ErrConflict is returned when a record changed since it was read
+	ErrConflict = errors.New("db: conflict")
+)
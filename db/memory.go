@@ -0,0 +1,794 @@
+package db
+
+import (
+	dto "GoApp/dto/auth"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The memory services keep everything in maps guarded by a mutex. They are
+// meant for tests and demos: nothing survives a restart. Records are copied
+// on the way in and out so callers can never change the stored state.
+
+type memoryUserService struct {
+	mutex sync.RWMutex
+	users map[string]*User
+}
+
+func NewMemoryUserService() UserService {
+	return &memoryUserService{
+		users: map[string]*User{},
+	}
+}
+
+func (service *memoryUserService) CreateUser(ctx context.Context, dto dto.RegisterCredentials) (*User, error) {
+	user, err := newUser(uuid.NewString(), dto)
+	if err != nil {
+		return nil, err
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if service.findByEmail(*user.Email) != nil {
+		return nil, ErrDuplicate
+	}
+	service.users[user.ID] = copyUser(user)
+	return user, nil
+}
+
+func (service *memoryUserService) FindUser(ctx context.Context, email string) (*User, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	user := service.findByEmail(email)
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (service *memoryUserService) FindById(ctx context.Context, id string) (*User, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	user, ok := service.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (service *memoryUserService) UserExists(ctx context.Context, email string) (bool, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return service.findByEmail(email) != nil, nil
+}
+
+func (service *memoryUserService) ActivateUser(ctx context.Context, email, code, password string) (*User, error) {
+	var hash string
+	if password != "" {
+		var err error
+		if hash, err = hashPassword(password); err != nil {
+			return nil, err
+		}
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	user := service.findByEmail(email)
+	if user == nil || user.ActivationCode != code {
+		return nil, ErrNotFound
+	}
+	user.Activated = true
+	if hash != "" {
+		user.Password = &hash
+	}
+	return copyUser(user), nil
+}
+
+func (service *memoryUserService) UpdateActivationCode(ctx context.Context, email string) (*User, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	user := service.findByEmail(email)
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	user.ActivationCode = uuid.NewString()
+	return copyUser(user), nil
+}
+
+func (service *memoryUserService) UpdatePassword(ctx context.Context, id string, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return service.update(id, func(user *User) {
+		user.Password = &hash
+	})
+}
+
+func (service *memoryUserService) UpdateProfile(ctx context.Context, id string, profile string, sizes []int) error {
+	return service.update(id, func(user *User) {
+		user.Profile = profile
+		user.ProfileSizes = append([]int(nil), sizes...)
+	})
+}
+
+func (service *memoryUserService) UpdateDetail(ctx context.Context, userId, firstname, lastname string) error {
+	return service.update(userId, func(user *User) {
+		user.Firstname = &firstname
+		user.Lastname = &lastname
+	})
+}
+
+func (service *memoryUserService) UpdateAdmin(ctx context.Context, id string, admin bool) error {
+	return service.update(id, func(user *User) {
+		user.Admin = admin
+	})
+}
+
+func (service *memoryUserService) ProvisionUser(ctx context.Context, provisioned ProvisionedUser) (*User, error) {
+	user, err := newProvisionedUser(uuid.NewString(), provisioned)
+	if err != nil {
+		return nil, err
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if service.findByEmail(*user.Email) != nil {
+		return nil, ErrDuplicate
+	}
+	service.users[user.ID] = copyUser(user)
+	return user, nil
+}
+
+func (service *memoryUserService) UpdateProvisionedUser(ctx context.Context, id string, provisioned ProvisionedUser) (*User, error) {
+	var hash string
+	if provisioned.Password != "" {
+		var err error
+		if hash, err = hashPassword(provisioned.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	user, ok := service.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if other := service.findByEmail(provisioned.Email); other != nil && other.ID != id {
+		return nil, ErrDuplicate
+	}
+	user.Email = &provisioned.Email
+	user.Firstname = &provisioned.Firstname
+	user.Lastname = &provisioned.Lastname
+	user.Activated = provisioned.Active
+	if !provisioned.Active {
+		user.ActivationCode = uuid.NewString()
+	}
+	if hash != "" {
+		user.Password = &hash
+	}
+	user.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return copyUser(user), nil
+}
+
+func (service *memoryUserService) ListUsers(ctx context.Context, filter UserFilter) ([]User, int64, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	matching := []User{}
+	for _, user := range service.users {
+		if filter.TenantId != "" && user.TenantId != filter.TenantId {
+			continue
+		}
+		if filter.Email != "" && (user.Email == nil || *user.Email != filter.Email) {
+			continue
+		}
+		matching = append(matching, *copyUser(user))
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		if !matching[i].CreatedAt.Equal(matching[j].CreatedAt) {
+			return matching[i].CreatedAt.Before(matching[j].CreatedAt)
+		}
+		return matching[i].ID < matching[j].ID
+	})
+
+	users := []User{}
+	if filter.Offset < len(matching) {
+		users = matching[filter.Offset:]
+	}
+	if len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+	return users, int64(len(matching)), nil
+}
+
+func (service *memoryUserService) RemoveUser(ctx context.Context, id string) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if _, ok := service.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(service.users, id)
+	return nil
+}
+
+func (service *memoryUserService) update(id string, apply func(user *User)) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	user, ok := service.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	apply(user)
+	return nil
+}
+
+// findByEmail must be called with the mutex held
+func (service *memoryUserService) findByEmail(email string) *User {
+	for _, user := range service.users {
+		if user.Email != nil && *user.Email == email {
+			return user
+		}
+	}
+	return nil
+}
+
+func copyUser(user *User) *User {
+	copied := *user
+	copied.Email = copyString(user.Email)
+	copied.Password = copyString(user.Password)
+	copied.Firstname = copyString(user.Firstname)
+	copied.Lastname = copyString(user.Lastname)
+	copied.ProfileSizes = append([]int(nil), user.ProfileSizes...)
+	return &copied
+}
+
+func copyString(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+type memoryRefreshTokenService struct {
+	mutex  sync.RWMutex
+	tokens map[string]RefreshToken
+}
+
+func NewMemoryRefreshTokenService() RefreshTokenService {
+	return &memoryRefreshTokenService{
+		tokens: map[string]RefreshToken{},
+	}
+}
+
+func (service *memoryRefreshTokenService) CreateRefreshToken(ctx context.Context, userId string) (string, error) {
+	return service.CreateClientRefreshToken(ctx, userId, "", "")
+}
+
+func (service *memoryRefreshTokenService) CreateClientRefreshToken(ctx context.Context, userId string, clientId string, scope string) (string, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	refreshToken := RefreshToken{
+		ID:        uuid.NewString(),
+		UserId:    userId,
+		TokenId:   uuid.NewString(),
+		ClientId:  clientId,
+		Scope:     scope,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	service.tokens[refreshToken.TokenId] = refreshToken
+	return refreshToken.TokenId, nil
+}
+
+func (service *memoryRefreshTokenService) FindUserIdbyRefreshToken(ctx context.Context, tokenId string) (string, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	refreshToken, ok := service.tokens[tokenId]
+	if !ok || refreshToken.ClientId != "" {
+		return "", ErrNotFound
+	}
+	return refreshToken.UserId, nil
+}
+
+func (service *memoryRefreshTokenService) FindRefreshToken(ctx context.Context, tokenId string) (*RefreshToken, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	refreshToken, ok := service.tokens[tokenId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &refreshToken, nil
+}
+
+func (service *memoryRefreshTokenService) RemoveRefreshToken(ctx context.Context, tokenId string) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	delete(service.tokens, tokenId)
+	return nil
+}
+
+func (service *memoryRefreshTokenService) RemoveUserRefreshTokens(ctx context.Context, userId string) (int64, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	var count int64
+	for tokenId, refreshToken := range service.tokens {
+		if refreshToken.UserId == userId {
+			delete(service.tokens, tokenId)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (service *memoryRefreshTokenService) CountRefreshTokens(ctx context.Context) (int64, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return int64(len(service.tokens)), nil
+}
+
+type memoryUploadService struct {
+	mutex   sync.Mutex
+	uploads map[string]*Upload
+}
+
+func NewMemoryUploadService() UploadService {
+	return &memoryUploadService{
+		uploads: map[string]*Upload{},
+	}
+}
+
+func (service *memoryUploadService) CreateUpload(ctx context.Context, userId string, purpose string, length int64, metadata map[string]string, expiresAt time.Time) (*Upload, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	upload := &Upload{
+		UploadId:  uuid.NewString(),
+		UserId:    userId,
+		Purpose:   purpose,
+		Length:    length,
+		Offset:    0,
+		Parts:     []string{},
+		Metadata:  metadata,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	service.uploads[upload.UploadId] = copyUpload(upload)
+	return upload, nil
+}
+
+func (service *memoryUploadService) FindUpload(ctx context.Context, uploadId string) (*Upload, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	upload, ok := service.uploads[uploadId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyUpload(upload), nil
+}
+
+func (service *memoryUploadService) AppendPart(ctx context.Context, uploadId string, offset, size int64, part string) (*Upload, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	upload, ok := service.uploads[uploadId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if upload.Offset != offset {
+		return nil, ErrConflict
+	}
+	upload.Offset += size
+	upload.Parts = append(upload.Parts, part)
+	upload.UpdatedAt = time.Now()
+	return copyUpload(upload), nil
+}
+
+func (service *memoryUploadService) RemoveUpload(ctx context.Context, uploadId string) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	delete(service.uploads, uploadId)
+	return nil
+}
+
+func (service *memoryUploadService) FindExpiredUploads(ctx context.Context, now time.Time) ([]Upload, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	uploads := []Upload{}
+	for _, upload := range service.uploads {
+		if upload.ExpiresAt.Before(now) {
+			uploads = append(uploads, *copyUpload(upload))
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].ExpiresAt.Before(uploads[j].ExpiresAt)
+	})
+	if len(uploads) > 100 {
+		uploads = uploads[:100]
+	}
+	return uploads, nil
+}
+
+func copyUpload(upload *Upload) *Upload {
+	copied := *upload
+	copied.Parts = append([]string{}, upload.Parts...)
+	if upload.Metadata != nil {
+		copied.Metadata = make(map[string]string, len(upload.Metadata))
+		for key, value := range upload.Metadata {
+			copied.Metadata[key] = value
+		}
+	}
+	return &copied
+}
+
+type memoryClientService struct {
+	mutex   sync.RWMutex
+	clients map[string]Client
+}
+
+func NewMemoryClientService() ClientService {
+	return &memoryClientService{
+		clients: map[string]Client{},
+	}
+}
+
+func (service *memoryClientService) CreateClient(ctx context.Context, name string, secret string, redirectURIs []string, scopes []string) (*Client, error) {
+	client := newClient(name, secret, redirectURIs, scopes)
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.clients[client.ClientId] = *client
+	return client, nil
+}
+
+func (service *memoryClientService) FindClient(ctx context.Context, clientId string) (*Client, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	client, ok := service.clients[clientId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &client, nil
+}
+
+func (service *memoryClientService) ListClients(ctx context.Context) ([]Client, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	clients := make([]Client, 0, len(service.clients))
+	for _, client := range service.clients {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if !clients[i].CreatedAt.Equal(clients[j].CreatedAt) {
+			return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+		}
+		return clients[i].ClientId < clients[j].ClientId
+	})
+	return clients, nil
+}
+
+func (service *memoryClientService) RemoveClient(ctx context.Context, clientId string) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if _, ok := service.clients[clientId]; !ok {
+		return ErrNotFound
+	}
+	delete(service.clients, clientId)
+	return nil
+}
+
+type memoryRevokedTokenService struct {
+	mutex sync.RWMutex
+	// expiry by jti
+	tokens map[string]time.Time
+}
+
+func NewMemoryRevokedTokenService() RevokedTokenService {
+	return &memoryRevokedTokenService{
+		tokens: map[string]time.Time{},
+	}
+}
+
+func (service *memoryRevokedTokenService) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if _, ok := service.tokens[jti]; !ok {
+		service.tokens[jti] = expiresAt
+	}
+	return nil
+}
+
+func (service *memoryRevokedTokenService) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	_, ok := service.tokens[jti]
+	return ok, nil
+}
+
+func (service *memoryRevokedTokenService) RemoveExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	var removed int64
+	for jti, expiresAt := range service.tokens {
+		if !expiresAt.After(now) {
+			delete(service.tokens, jti)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+type memoryAuthorizationCodeService struct {
+	mutex sync.Mutex
+	codes map[string]AuthorizationCode
+}
+
+func NewMemoryAuthorizationCodeService() AuthorizationCodeService {
+	return &memoryAuthorizationCodeService{
+		codes: map[string]AuthorizationCode{},
+	}
+}
+
+func (service *memoryAuthorizationCodeService) CreateAuthorizationCode(ctx context.Context, authorization AuthorizationCode) (string, error) {
+	code := newAuthorizationCode(authorization)
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.codes[code.Code] = *code
+	return code.Code, nil
+}
+
+func (service *memoryAuthorizationCodeService) ConsumeAuthorizationCode(ctx context.Context, code string, now time.Time) (*AuthorizationCode, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	authorization, ok := service.codes[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(service.codes, code)
+	if !authorization.ExpiresAt.After(now) {
+		return nil, ErrNotFound
+	}
+	return &authorization, nil
+}
+
+func (service *memoryAuthorizationCodeService) RemoveExpiredAuthorizationCodes(ctx context.Context, now time.Time) (int64, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	var removed int64
+	for code, authorization := range service.codes {
+		if !authorization.ExpiresAt.After(now) {
+			delete(service.codes, code)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+type memoryDeviceAuthorizationService struct {
+	mutex          sync.Mutex
+	authorizations map[string]DeviceAuthorization
+}
+
+func NewMemoryDeviceAuthorizationService() DeviceAuthorizationService {
+	return &memoryDeviceAuthorizationService{
+		authorizations: map[string]DeviceAuthorization{},
+	}
+}
+
+func (service *memoryDeviceAuthorizationService) CreateDeviceAuthorization(ctx context.Context, authorization DeviceAuthorization) (*DeviceAuthorization, error) {
+	created := newDeviceAuthorization(authorization)
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	for _, other := range service.authorizations {
+		if other.UserCode == created.UserCode {
+			return nil, ErrDuplicate
+		}
+	}
+	service.authorizations[created.DeviceCode] = *created
+	return created, nil
+}
+
+// pending returns the device code of the pending authorization of userCode
+func (service *memoryDeviceAuthorizationService) pending(userCode string, now time.Time) (string, bool) {
+	for deviceCode, authorization := range service.authorizations {
+		if authorization.UserCode == userCode && authorization.Status == DeviceAuthorizationPending && authorization.ExpiresAt.After(now) {
+			return deviceCode, true
+		}
+	}
+	return "", false
+}
+
+func (service *memoryDeviceAuthorizationService) FindDeviceAuthorization(ctx context.Context, userCode string, now time.Time) (*DeviceAuthorization, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	deviceCode, ok := service.pending(userCode, now)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	authorization := service.authorizations[deviceCode]
+	return &authorization, nil
+}
+
+func (service *memoryDeviceAuthorizationService) ApproveDeviceAuthorization(ctx context.Context, userCode string, userId string, now time.Time) error {
+	return service.decide(userCode, DeviceAuthorizationApproved, userId, now)
+}
+
+func (service *memoryDeviceAuthorizationService) DenyDeviceAuthorization(ctx context.Context, userCode string, now time.Time) error {
+	return service.decide(userCode, DeviceAuthorizationDenied, "", now)
+}
+
+func (service *memoryDeviceAuthorizationService) decide(userCode string, status string, userId string, now time.Time) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	deviceCode, ok := service.pending(userCode, now)
+	if !ok {
+		return ErrNotFound
+	}
+	authorization := service.authorizations[deviceCode]
+	authorization.Status = status
+	authorization.UserId = userId
+	service.authorizations[deviceCode] = authorization
+	return nil
+}
+
+func (service *memoryDeviceAuthorizationService) PollDeviceAuthorization(ctx context.Context, deviceCode string, now time.Time) (*DeviceAuthorization, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	authorization, ok := service.authorizations[deviceCode]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	polled := authorization
+	polled.LastPolledAt = now
+	service.authorizations[deviceCode] = polled
+	return &authorization, nil
+}
+
+func (service *memoryDeviceAuthorizationService) SlowDownDeviceAuthorization(ctx context.Context, deviceCode string, interval time.Duration) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	authorization, ok := service.authorizations[deviceCode]
+	if !ok {
+		return ErrNotFound
+	}
+	authorization.Interval = interval
+	service.authorizations[deviceCode] = authorization
+	return nil
+}
+
+func (service *memoryDeviceAuthorizationService) RemoveDeviceAuthorization(ctx context.Context, deviceCode string) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if _, ok := service.authorizations[deviceCode]; !ok {
+		return ErrNotFound
+	}
+	delete(service.authorizations, deviceCode)
+	return nil
+}
+
+func (service *memoryDeviceAuthorizationService) RemoveExpiredDeviceAuthorizations(ctx context.Context, now time.Time) (int64, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	var removed int64
+	for deviceCode, authorization := range service.authorizations {
+		if !authorization.ExpiresAt.After(now) {
+			delete(service.authorizations, deviceCode)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+type memoryTenantService struct {
+	mutex   sync.RWMutex
+	tenants map[string]Tenant
+}
+
+func NewMemoryTenantService() TenantService {
+	return &memoryTenantService{
+		tenants: map[string]Tenant{},
+	}
+}
+
+func (service *memoryTenantService) CreateTenant(ctx context.Context, name string, token string) (*Tenant, error) {
+	tenant := newTenant(name, token)
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	for _, other := range service.tenants {
+		if other.TokenHash == tenant.TokenHash {
+			return nil, ErrDuplicate
+		}
+	}
+	service.tenants[tenant.TenantId] = *tenant
+	return tenant, nil
+}
+
+func (service *memoryTenantService) FindTenantByToken(ctx context.Context, token string) (*Tenant, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	tokenHash := hashSecret(token)
+	for _, tenant := range service.tenants {
+		if tenant.TokenHash == tokenHash {
+			return &tenant, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (service *memoryTenantService) ListTenants(ctx context.Context) ([]Tenant, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	tenants := make([]Tenant, 0, len(service.tenants))
+	for _, tenant := range service.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		if !tenants[i].CreatedAt.Equal(tenants[j].CreatedAt) {
+			return tenants[i].CreatedAt.Before(tenants[j].CreatedAt)
+		}
+		return tenants[i].TenantId < tenants[j].TenantId
+	})
+	return tenants, nil
+}
+
+func (service *memoryTenantService) RemoveTenant(ctx context.Context, tenantId string) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if _, ok := service.tenants[tenantId]; !ok {
+		return ErrNotFound
+	}
+	delete(service.tenants, tenantId)
+	return nil
+}
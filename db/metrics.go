@@ -0,0 +1,58 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// newMetricsMonitor records the latency of every command sent to MongoDB by
+// collection. Collections are only known when a command starts, so they are
+// kept by request id until the command finishes.
+func newMetricsMonitor() *event.CommandMonitor {
+	var collections sync.Map
+
+	finished := func(e event.CommandFinishedEvent, outcome string) {
+		collection, ok := collections.LoadAndDelete(e.RequestID)
+		if !ok {
+			return
+		}
+		providers.MongoOperationDuration.
+			WithLabelValues(collection.(string), e.CommandName, outcome).
+			Observe((time.Duration(e.DurationNanos)).Seconds())
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if collection := commandCollection(e.Command); collection != "" {
+				collections.Store(e.RequestID, collection)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finished(e.CommandFinishedEvent, "success")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finished(e.CommandFinishedEvent, "failure")
+		},
+	}
+}
+
+// commandCollection returns the collection a command operates on: the value
+// of its first element (find, insert, update, ...) or of "collection" (getMore)
+func commandCollection(command bson.Raw) string {
+	elements, err := command.Elements()
+	if err != nil || len(elements) == 0 {
+		return ""
+	}
+	if collection, ok := elements[0].Value().StringValueOK(); ok {
+		return collection
+	}
+	if collection, ok := command.Lookup("collection").StringValueOK(); ok {
+		return collection
+	}
+	return ""
+}
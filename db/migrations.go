@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrIrreversible is returned when reverting a migration that has no down step
+var ErrIrreversible = errors.New("db: migration cannot be reverted")
+
+// MigrationStatus describes one known migration, AppliedAt is nil while it is pending
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrator applies the schema migrations of a database. Migrations are
+// ordered by version, every applied one is recorded in the database and a
+// lock keeps replicas starting at the same time from running them twice.
+type Migrator interface {
+	// Up applies every pending migration
+	Up(ctx context.Context) error
+	// Down reverts the last steps applied migrations
+	Down(ctx context.Context, steps int) error
+	// Status lists every known migration
+	Status(ctx context.Context) ([]MigrationStatus, error)
+}
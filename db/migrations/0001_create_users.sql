@@ -0,0 +1,14 @@
+CREATE TABLE users (
+    id              TEXT PRIMARY KEY,
+    email           TEXT NOT NULL UNIQUE,
+    password        TEXT,
+    firstname       TEXT,
+    lastname        TEXT,
+    activation_code TEXT NOT NULL DEFAULT '',
+    activated       BOOLEAN NOT NULL DEFAULT FALSE,
+    profile         TEXT NOT NULL DEFAULT '',
+    -- JSON array of the stored profile picture sizes
+    profile_sizes   TEXT,
+    created_at      TIMESTAMP NOT NULL,
+    updated_at      TIMESTAMP NOT NULL
+);
@@ -0,0 +1,22 @@
+CREATE TABLE uploads (
+    upload_id     TEXT PRIMARY KEY,
+    user_id       TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose       TEXT NOT NULL,
+    length        BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    -- JSON object of the Upload-Metadata header
+    metadata      TEXT,
+    expires_at    TIMESTAMP NOT NULL,
+    created_at    TIMESTAMP NOT NULL,
+    updated_at    TIMESTAMP NOT NULL
+);
+
+CREATE INDEX uploads_expires_at ON uploads (expires_at);
+
+-- one row per received chunk, in the order of their offsets
+CREATE TABLE upload_parts (
+    upload_id   TEXT NOT NULL REFERENCES uploads (upload_id) ON DELETE CASCADE,
+    part_offset BIGINT NOT NULL,
+    part        TEXT NOT NULL,
+    PRIMARY KEY (upload_id, part_offset)
+);
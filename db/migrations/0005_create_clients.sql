@@ -0,0 +1,8 @@
+-- registered OAuth clients, such as other backend services
+CREATE TABLE clients (
+    client_id   TEXT PRIMARY KEY,
+    name        TEXT NOT NULL,
+    secret_hash TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
@@ -0,0 +1,8 @@
+-- access tokens revoked before they expire, kept until they do
+CREATE TABLE revoked_tokens (
+    jti        TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX revoked_tokens_expires_at ON revoked_tokens (expires_at);
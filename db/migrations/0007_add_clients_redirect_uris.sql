@@ -0,0 +1,2 @@
+-- space separated redirect URIs of the OpenID Connect clients
+ALTER TABLE clients ADD COLUMN redirect_uris TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+-- OpenID Connect authorization codes, exchanged once for tokens
+CREATE TABLE authorization_codes (
+    code           TEXT PRIMARY KEY,
+    client_id      TEXT NOT NULL REFERENCES clients (client_id) ON DELETE CASCADE,
+    user_id        TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri   TEXT NOT NULL,
+    scope          TEXT NOT NULL,
+    nonce          TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    expires_at     TIMESTAMP NOT NULL,
+    created_at     TIMESTAMP NOT NULL
+);
+
+CREATE INDEX authorization_codes_expires_at ON authorization_codes (expires_at);
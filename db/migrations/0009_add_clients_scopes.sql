@@ -0,0 +1,2 @@
+-- space separated scopes the service accounts may get with the client_credentials grant
+ALTER TABLE clients ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
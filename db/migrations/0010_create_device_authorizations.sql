@@ -0,0 +1,15 @@
+-- device authorization requests of RFC 8628, polled by the devices until a user decides
+CREATE TABLE device_authorizations (
+    device_code      TEXT PRIMARY KEY,
+    user_code        TEXT NOT NULL UNIQUE,
+    client_id        TEXT NOT NULL REFERENCES clients (client_id) ON DELETE CASCADE,
+    scope            TEXT NOT NULL,
+    status           TEXT NOT NULL,
+    user_id          TEXT REFERENCES users (id) ON DELETE CASCADE,
+    interval_seconds INTEGER NOT NULL,
+    last_polled_at   TIMESTAMP,
+    expires_at       TIMESTAMP NOT NULL,
+    created_at       TIMESTAMP NOT NULL
+);
+
+CREATE INDEX device_authorizations_expires_at ON device_authorizations (expires_at);
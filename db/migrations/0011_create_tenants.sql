@@ -0,0 +1,7 @@
+-- customer organizations provisioning their users through SCIM
+CREATE TABLE tenants (
+    tenant_id  TEXT PRIMARY KEY,
+    name       TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP INDEX users_tenant_id;
+ALTER TABLE users DROP COLUMN tenant_id;
@@ -0,0 +1,4 @@
+-- the tenant which provisioned the user, NULL for the users who registered
+ALTER TABLE users ADD COLUMN tenant_id TEXT;
+
+CREATE INDEX users_tenant_id ON users (tenant_id);
@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens DROP COLUMN scope;
+ALTER TABLE refresh_tokens DROP COLUMN client_id;
@@ -0,0 +1,4 @@
+-- the registered client a refresh token was handed out to, with the scope its
+-- user consented to, NULL for the tokens of login
+ALTER TABLE refresh_tokens ADD COLUMN client_id TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN scope TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,366 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoMigration is one schema change of the MongoDB database. Down is
+// optional, without it the migration cannot be reverted.
+type mongoMigration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, database *mongo.Database) error
+	Down    func(ctx context.Context, database *mongo.Database) error
+}
+
+// mongoMigrations must stay ordered by version, applied migrations are
+// never edited: fix them with a new one
+var mongoMigrations = []mongoMigration{
+	{
+		Version: 1,
+		Name:    "create_indexes",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			indexes := map[string][]mongo.IndexModel{
+				"user": {
+					{Keys: bson.M{"email": 1}, Options: options.Index().SetUnique(true)},
+				},
+				"refreshToken": {
+					{Keys: bson.M{"tokenId": 1}, Options: options.Index().SetUnique(true)},
+				},
+				"upload": {
+					{Keys: bson.M{"uploadId": 1}, Options: options.Index().SetUnique(true)},
+					{Keys: bson.M{"expiresAt": 1}},
+				},
+			}
+			for collection, models := range indexes {
+				if _, err := database.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+					return fmt.Errorf("%s: %w", collection, err)
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			indexes := map[string][]string{
+				"user":         {"email_1"},
+				"refreshToken": {"tokenId_1"},
+				"upload":       {"uploadId_1", "expiresAt_1"},
+			}
+			for collection, names := range indexes {
+				for _, name := range names {
+					if _, err := database.Collection(collection).Indexes().DropOne(ctx, name); err != nil {
+						return fmt.Errorf("%s: %w", collection, err)
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 2,
+		Name:    "rename_activation_code",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return renameField(ctx, database.Collection("user"), "actovationCode", "activationCode")
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return renameField(ctx, database.Collection("user"), "activationCode", "actovationCode")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_oauth_indexes",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			_, err := database.Collection("client").Indexes().CreateOne(ctx,
+				mongo.IndexModel{Keys: bson.M{"clientId": 1}, Options: options.Index().SetUnique(true)})
+			if err != nil {
+				return fmt.Errorf("client: %w", err)
+			}
+			// revoked tokens are removed once they expired
+			_, err = database.Collection("revokedToken").Indexes().CreateOne(ctx,
+				mongo.IndexModel{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)})
+			if err != nil {
+				return fmt.Errorf("revokedToken: %w", err)
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			if _, err := database.Collection("client").Indexes().DropOne(ctx, "clientId_1"); err != nil {
+				return fmt.Errorf("client: %w", err)
+			}
+			if _, err := database.Collection("revokedToken").Indexes().DropOne(ctx, "expiresAt_1"); err != nil {
+				return fmt.Errorf("revokedToken: %w", err)
+			}
+			return nil
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_authorization_code_index",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			// authorization codes are removed once they expired
+			_, err := database.Collection("authorizationCode").Indexes().CreateOne(ctx,
+				mongo.IndexModel{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)})
+			return err
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			_, err := database.Collection("authorizationCode").Indexes().DropOne(ctx, "expiresAt_1")
+			return err
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create_device_authorization_indexes",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			// the user codes are typed in by the users, two pending requests cannot share one
+			_, err := database.Collection("deviceAuthorization").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.M{"userCode": 1}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			for _, index := range []string{"userCode_1", "expiresAt_1"} {
+				if _, err := database.Collection("deviceAuthorization").Indexes().DropOne(ctx, index); err != nil {
+					return fmt.Errorf("deviceAuthorization: %w", err)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_tenant_indexes",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			_, err := database.Collection("tenant").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.M{"tenantId": 1}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.M{"tokenHash": 1}, Options: options.Index().SetUnique(true)},
+			})
+			if err != nil {
+				return fmt.Errorf("tenant: %w", err)
+			}
+			// the SCIM endpoints list the users of one tenant
+			_, err = database.Collection("user").Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.M{"tenantId": 1}})
+			if err != nil {
+				return fmt.Errorf("user: %w", err)
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			for _, index := range []string{"tenantId_1", "tokenHash_1"} {
+				if _, err := database.Collection("tenant").Indexes().DropOne(ctx, index); err != nil {
+					return fmt.Errorf("tenant: %w", err)
+				}
+			}
+			if _, err := database.Collection("user").Indexes().DropOne(ctx, "tenantId_1"); err != nil {
+				return fmt.Errorf("user: %w", err)
+			}
+			return nil
+		},
+	},
+}
+
+func renameField(ctx context.Context, collection *mongo.Collection, from, to string) error {
+	filter := bson.M{from: bson.M{"$exists": true}}
+	update := bson.M{"$rename": bson.M{from: to}}
+	_, err := collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// mongoMigrationRecord is stored in the _migrations collection for every applied migration
+type mongoMigrationRecord struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// mongoMigrationLockId is the _id of the lock document in _migrations
+const mongoMigrationLockId = "lock"
+
+// a crashed replica cannot hold the lock forever, it expires after mongoMigrationLockTTL
+const mongoMigrationLockTTL = 5 * time.Minute
+
+// the holder extends the lock every mongoMigrationLockRenewal, so that a
+// migration running longer than the TTL keeps it
+const mongoMigrationLockRenewal = mongoMigrationLockTTL / 3
+
+type mongoMigrator struct {
+	database   *mongo.Database
+	collection *mongo.Collection
+	logger     *slog.Logger
+}
+
+func NewMongoMigrator(client *mongo.Client, configs *providers.Config, logger *slog.Logger) Migrator {
+	database := client.Database(configs.DatabaseName)
+	return &mongoMigrator{
+		database:   database,
+		collection: database.Collection("_migrations"),
+		logger:     logger,
+	}
+}
+
+func (migrator *mongoMigrator) Up(ctx context.Context) error {
+	return migrator.locked(ctx, func(ctx context.Context, applied map[int]time.Time) error {
+		for _, migration := range mongoMigrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := migration.Up(ctx, migrator.database); err != nil {
+				return fmt.Errorf("%d_%s: %w", migration.Version, migration.Name, err)
+			}
+			record := mongoMigrationRecord{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+			if _, err := migrator.collection.InsertOne(ctx, record); err != nil {
+				return err
+			}
+			migrator.logger.Info("Applied migration", slog.Int("version", migration.Version), slog.String("migration", migration.Name))
+		}
+		return nil
+	})
+}
+
+func (migrator *mongoMigrator) Down(ctx context.Context, steps int) error {
+	return migrator.locked(ctx, func(ctx context.Context, applied map[int]time.Time) error {
+		for i := len(mongoMigrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := mongoMigrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == nil {
+				return fmt.Errorf("%d_%s: %w", migration.Version, migration.Name, ErrIrreversible)
+			}
+			if err := migration.Down(ctx, migrator.database); err != nil {
+				return fmt.Errorf("%d_%s: %w", migration.Version, migration.Name, err)
+			}
+			if _, err := migrator.collection.DeleteOne(ctx, bson.M{"_id": migration.Version}); err != nil {
+				return err
+			}
+			migrator.logger.Info("Reverted migration", slog.Int("version", migration.Version), slog.String("migration", migration.Name))
+			steps--
+		}
+		return nil
+	})
+}
+
+func (migrator *mongoMigrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := migrator.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(mongoMigrations))
+	for _, migration := range mongoMigrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// applied returns when each applied migration ran, by version
+func (migrator *mongoMigrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	// the lock document has a string _id, records have numeric ones
+	cursor, err := migrator.collection.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, err
+	}
+	records := []mongoMigrationRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]time.Time, len(records))
+	for _, record := range records {
+		applied[record.Version] = record.AppliedAt
+	}
+	return applied, nil
+}
+
+// locked calls apply with the applied migrations while holding the lock
+// document, waiting for other replicas to release it. The context given to
+// apply is canceled if the lock is lost.
+func (migrator *mongoMigrator) locked(ctx context.Context, apply func(ctx context.Context, applied map[int]time.Time) error) error {
+	owner := uuid.NewString()
+	if host, err := os.Hostname(); err == nil {
+		owner = host + "/" + owner
+	}
+
+	for {
+		acquired, err := migrator.lock(ctx, owner)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			break
+		}
+		migrator.logger.Info("Waiting for the migration lock")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+	defer migrator.collection.DeleteOne(context.Background(), bson.M{"_id": mongoMigrationLockId, "owner": owner})
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go migrator.renew(ctx, owner, cancel)
+
+	applied, err := migrator.applied(ctx)
+	if err != nil {
+		return err
+	}
+	if err := apply(ctx, applied); err != nil {
+		if cause := context.Cause(ctx); cause != nil && cause != ctx.Err() {
+			return fmt.Errorf("%w: %w", err, cause)
+		}
+		return err
+	}
+	return nil
+}
+
+// renew extends the lock of owner until ctx is done, and cancels it when the
+// lock could not be kept
+func (migrator *mongoMigrator) renew(ctx context.Context, owner string, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(mongoMigrationLockRenewal)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		filter := bson.M{"_id": mongoMigrationLockId, "owner": owner}
+		update := bson.M{"$set": bson.M{"expiresAt": time.Now().Add(mongoMigrationLockTTL)}}
+		result, err := migrator.collection.UpdateOne(ctx, filter, update)
+		if err == nil && result.MatchedCount == 0 {
+			err = errors.New("another replica took it over")
+		}
+		if err != nil && ctx.Err() == nil {
+			migrator.logger.Error("Migration lock lost", slog.Any("error", err))
+			cancel(fmt.Errorf("migration lock lost: %w", err))
+			return
+		}
+	}
+}
+
+// lock takes the lock document unless another owner holds an unexpired one
+func (migrator *mongoMigrator) lock(ctx context.Context, owner string) (bool, error) {
+	now := time.Now()
+	filter := bson.M{"_id": mongoMigrationLockId, "expiresAt": bson.M{"$lt": now}}
+	update := bson.M{"$set": bson.M{"owner": owner, "expiresAt": now.Add(mongoMigrationLockTTL)}}
+	_, err := migrator.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// the upsert collided with a lock that has not expired
+		return false, nil
+	}
+	return err == nil, err
+}
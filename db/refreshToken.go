@@ -3,101 +3,169 @@ package db
 import (
 	"GoApp/providers"
 	"context"
-	"fmt"
-	"os"
 	"time"
 
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// RefreshToken is handed out at login, or to a registered client along with
+// the scope its user consented to. ClientId is empty for the first ones.
 type RefreshToken struct {
+	ID        string
+	UserId    string
+	TokenId   string
+	ClientId  string
+	Scope     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// RefreshTokenService stores the refresh tokens handed out at login and to
+// the registered clients. Looking up an unknown token returns ErrNotFound.
+type RefreshTokenService interface {
+	CreateRefreshToken(ctx context.Context, userId string) (string, error)
+	CreateClientRefreshToken(ctx context.Context, userId string, clientId string, scope string) (string, error)
+	// FindUserIdbyRefreshToken only finds the tokens handed out at login, the
+	// tokens of the registered clients return ErrNotFound
+	FindUserIdbyRefreshToken(ctx context.Context, tokenId string) (string, error)
+	FindRefreshToken(ctx context.Context, tokenId string) (*RefreshToken, error)
+	RemoveRefreshToken(ctx context.Context, tokenId string) error
+	// RemoveUserRefreshTokens ends every session of the user, returning how many there were
+	RemoveUserRefreshTokens(ctx context.Context, userId string) (int64, error)
+	CountRefreshTokens(ctx context.Context) (int64, error)
+}
+
+// refreshTokenDocument is how a refresh token is stored in MongoDB
+type refreshTokenDocument struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty"`
 	UserId    primitive.ObjectID `bson:"userId,omitempty"`
 	TokenId   string             `bson:"tokenId,omitempty"`
+	ClientId  string             `bson:"clientId,omitempty"`
+	Scope     string             `bson:"scope,omitempty"`
 	CreatedAt time.Time          `bson:"createdAt,omitempty"`
 	UpdatedAt time.Time          `bson:"updatedAt,omitempty"`
 }
 
-type RefreshTokenService interface {
-	CreateRefreshToken(userId primitive.ObjectID) (string, error)
-	FindUserIdbyRefreshToken(tokenId string) (primitive.ObjectID, error)
-	RemoveRefreshToken(tokenId string) error
-}
 type refreshTokenService struct {
 	collection *mongo.Collection
+	timeout    time.Duration
 }
 
+// NewRefreshTokenService expects the indexes of the "refreshToken" collection, which the
+// Mongo migrations create
 func NewRefreshTokenService(client *mongo.Client, configs *providers.Config) RefreshTokenService {
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-	defer cancel()
-
-	collection := OpenCollection(client, "refreshToken", configs.DatabaseName)
-	mod := mongo.IndexModel{
-		Keys: bson.M{
-			"tokenId": 1, // index in ascending order
-		},
-		Options: options.Index().SetUnique(true),
-	}
-	_, err := collection.Indexes().CreateOne(ctx, mod)
-
-	// Check if the CreateOne() method returned any errors
-	if err != nil {
-		fmt.Println("RefreshToken Indexes().CreateOne() ERROR:", err)
-		os.Exit(1) // exit in case of error
-	}
 	return &refreshTokenService{
-		collection: collection,
+		collection: OpenCollection(client, "refreshToken", configs.DatabaseName),
+		timeout:    configs.DbTimeout,
 	}
 }
 
-func (service *refreshTokenService) CreateRefreshToken(userId primitive.ObjectID) (string, error) {
+func (service *refreshTokenService) CreateRefreshToken(ctx context.Context, userId string) (string, error) {
+	return service.CreateClientRefreshToken(ctx, userId, "", "")
+}
+
+func (service *refreshTokenService) CreateClientRefreshToken(ctx context.Context, userId string, clientId string, scope string) (string, error) {
 	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
 	defer cancel()
 
+	userObjectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return "", ErrNotFound
+	}
 	ID := primitive.NewObjectID()
 	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	refreshToken := RefreshToken{
+	refreshToken := refreshTokenDocument{
 		ID:        ID,
-		UserId:    userId,
+		UserId:    userObjectId,
 		TokenId:   uuid.NewString(),
+		ClientId:  clientId,
+		Scope:     scope,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 
-	_, err := service.collection.InsertOne(ctx, refreshToken)
+	_, err = service.collection.InsertOne(ctx, refreshToken)
 	if err != nil {
-		return "", err
+		return "", mongoError(err)
 	}
 
 	return refreshToken.TokenId, nil
 }
 
-func (service *refreshTokenService) FindUserIdbyRefreshToken(tokenId string) (primitive.ObjectID, error) {
+func (service *refreshTokenService) FindUserIdbyRefreshToken(ctx context.Context, tokenId string) (string, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var refreshToken refreshTokenDocument
+	filter := bson.M{"tokenId": tokenId, "clientId": bson.M{"$exists": false}}
+	err := service.collection.FindOne(ctx, filter).Decode(&refreshToken)
+	if err != nil {
+		return "", mongoError(err)
+	}
+
+	return refreshToken.UserId.Hex(), nil
+}
+
+func (service *refreshTokenService) FindRefreshToken(ctx context.Context, tokenId string) (*RefreshToken, error) {
 	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
 	defer cancel()
 
-	var refreshToken RefreshToken
+	var refreshToken refreshTokenDocument
 	filter := bson.M{"tokenId": tokenId}
 	err := service.collection.FindOne(ctx, filter).Decode(&refreshToken)
 	if err != nil {
-		return primitive.NilObjectID, err
+		return nil, mongoError(err)
 	}
 
-	return refreshToken.UserId, nil
+	return &RefreshToken{
+		ID:        refreshToken.ID.Hex(),
+		UserId:    refreshToken.UserId.Hex(),
+		TokenId:   refreshToken.TokenId,
+		ClientId:  refreshToken.ClientId,
+		Scope:     refreshToken.Scope,
+		CreatedAt: refreshToken.CreatedAt,
+		UpdatedAt: refreshToken.UpdatedAt,
+	}, nil
 }
 
-func (service *refreshTokenService) RemoveRefreshToken(tokenId string) error {
+func (service *refreshTokenService) RemoveRefreshToken(ctx context.Context, tokenId string) error {
 	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
 	defer cancel()
 
 	filter := bson.M{"tokenId": tokenId}
 	_, err := service.collection.DeleteOne(ctx, filter)
-	return err
+	return mongoError(err)
+}
+
+func (service *refreshTokenService) RemoveUserRefreshTokens(ctx context.Context, userId string) (int64, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		// no token can belong to a malformed id
+		return 0, nil
+	}
+	filter := bson.M{"userId": objectId}
+	res, err := service.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, mongoError(err)
+	}
+	return res.DeletedCount, nil
+}
+
+func (service *refreshTokenService) CountRefreshTokens(ctx context.Context) (int64, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	return service.collection.EstimatedDocumentCount(ctx)
 }
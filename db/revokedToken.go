@@ -0,0 +1,77 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RevokedTokenService is the denylist of the access tokens revoked before
+// they expire, by jti. Entries are only needed until the token expires.
+type RevokedTokenService interface {
+	// RevokeToken may be called again for the same jti
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	RemoveExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error)
+}
+
+// revokedTokenDocument is how a revoked jti is stored in MongoDB, a TTL
+// index on expiresAt removes it once the token expired
+type revokedTokenDocument struct {
+	Jti       string    `bson:"_id"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+type revokedTokenService struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewRevokedTokenService expects the TTL index of the "revokedToken"
+// collection, which the Mongo migrations create
+func NewRevokedTokenService(client *mongo.Client, configs *providers.Config) RevokedTokenService {
+	return &revokedTokenService{
+		collection: OpenCollection(client, "revokedToken", configs.DatabaseName),
+		timeout:    configs.DbTimeout,
+	}
+}
+
+func (service *revokedTokenService) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	document := revokedTokenDocument{Jti: jti, ExpiresAt: expiresAt, CreatedAt: time.Now()}
+	_, err := service.collection.ReplaceOne(ctx, bson.M{"_id": jti}, document, options.Replace().SetUpsert(true))
+	return mongoError(err)
+}
+
+func (service *revokedTokenService) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	count, err := service.collection.CountDocuments(ctx, bson.M{"_id": jti}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, mongoError(err)
+	}
+	return count > 0, nil
+}
+
+func (service *revokedTokenService) RemoveExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	// the TTL index does it too, but only once a minute
+	res, err := service.collection.DeleteMany(ctx, bson.M{"expiresAt": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, mongoError(err)
+	}
+	return res.DeletedCount, nil
+}
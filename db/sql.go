@@ -0,0 +1,90 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// The SQL services work on Postgres and on SQLite. Queries stick to the
+// syntax both understand: $1 placeholders, RETURNING and TEXT columns
+// holding JSON for lists and maps.
+
+// sqlDrivers maps DatabaseDriver to the name the database/sql driver registered
+var sqlDrivers = map[string]string{
+	"postgres": "postgres",
+	"sqlite":   "sqlite",
+}
+
+// OpenSQL connects to the Postgres or SQLite database of the config
+func OpenSQL(configs *providers.Config, logger *slog.Logger) *sql.DB {
+	sqlDB, err := sql.Open(sqlDrivers[configs.DatabaseDriver], configs.DatabaseUrl)
+	if err != nil {
+		if configs.DatabaseDriver == "sqlite" {
+			err = fmt.Errorf("%w, SQLite support needs a build with -tags sqlite", err)
+		}
+		logger.Error("SQL open", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if configs.DatabaseDriver == "sqlite" {
+		// SQLite allows a single writer, queue the queries instead of failing with SQLITE_BUSY
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		logger.Error("SQL connect", slog.Any("error", err))
+		os.Exit(1)
+	}
+	logger.Info("Connected to " + configs.DatabaseDriver + "!")
+
+	return sqlDB
+}
+
+// sqlQuerier is implemented by both *sql.DB and *sql.Tx
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sqlScanner is implemented by both *sql.Row and *sql.Rows
+type sqlScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// sqlError translates driver errors into the errors of this package
+func sqlError(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case isUniqueViolation(err):
+		return ErrDuplicate
+	default:
+		return err
+	}
+}
+
+// isUniqueViolation recognizes unique constraint errors of lib/pq and of
+// modernc.org/sqlite without importing the latter, which is optional
+func isUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == "23505"
+	}
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		// SQLITE_CONSTRAINT_PRIMARYKEY and SQLITE_CONSTRAINT_UNIQUE
+		return sqliteErr.Code() == 1555 || sqliteErr.Code() == 2067
+	}
+	return false
+}
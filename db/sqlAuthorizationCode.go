@@ -0,0 +1,68 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlAuthorizationCodeService struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSQLAuthorizationCodeService(sqlDB *sql.DB, configs *providers.Config) AuthorizationCodeService {
+	return &sqlAuthorizationCodeService{
+		db:      sqlDB,
+		timeout: configs.DbTimeout,
+	}
+}
+
+const sqlAuthorizationCodeColumns = `code, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at, created_at`
+
+func (service *sqlAuthorizationCodeService) CreateAuthorizationCode(ctx context.Context, authorization AuthorizationCode) (string, error) {
+	code := newAuthorizationCode(authorization)
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	_, err := service.db.ExecContext(ctx, `INSERT INTO authorization_codes (`+sqlAuthorizationCodeColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		code.Code, code.ClientId, code.UserId, code.RedirectURI, code.Scope, code.Nonce, code.CodeChallenge, code.ExpiresAt.UTC(), code.CreatedAt.UTC())
+	if err != nil {
+		return "", sqlError(err)
+	}
+	return code.Code, nil
+}
+
+func (service *sqlAuthorizationCodeService) ConsumeAuthorizationCode(ctx context.Context, code string, now time.Time) (*AuthorizationCode, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	// removed as it is read, so that only one exchange gets it
+	var authorization AuthorizationCode
+	err := service.db.QueryRowContext(ctx, `DELETE FROM authorization_codes WHERE code = $1 RETURNING `+sqlAuthorizationCodeColumns, code).Scan(
+		&authorization.Code, &authorization.ClientId, &authorization.UserId, &authorization.RedirectURI, &authorization.Scope,
+		&authorization.Nonce, &authorization.CodeChallenge, &authorization.ExpiresAt, &authorization.CreatedAt)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	if !authorization.ExpiresAt.After(now) {
+		return nil, ErrNotFound
+	}
+	return &authorization, nil
+}
+
+func (service *sqlAuthorizationCodeService) RemoveExpiredAuthorizationCodes(ctx context.Context, now time.Time) (int64, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.db.ExecContext(ctx, `DELETE FROM authorization_codes WHERE expires_at <= $1`, now.UTC())
+	if err != nil {
+		return 0, sqlError(err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type sqlClientService struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSQLClientService(sqlDB *sql.DB, configs *providers.Config) ClientService {
+	return &sqlClientService{
+		db:      sqlDB,
+		timeout: configs.DbTimeout,
+	}
+}
+
+const sqlClientColumns = `client_id, name, secret_hash, redirect_uris, scopes, created_at, updated_at`
+
+func scanClient(row sqlScanner) (*Client, error) {
+	var client Client
+	var redirectURIs, scopes string
+	err := row.Scan(&client.ClientId, &client.Name, &client.SecretHash, &redirectURIs, &scopes, &client.CreatedAt, &client.UpdatedAt)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	// space separated, like the lists of OAuth, URIs have no spaces
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	client.Scopes = strings.Fields(scopes)
+	return &client, nil
+}
+
+func (service *sqlClientService) CreateClient(ctx context.Context, name string, secret string, redirectURIs []string, scopes []string) (*Client, error) {
+	client := newClient(name, secret, redirectURIs, scopes)
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	_, err := service.db.ExecContext(ctx, `INSERT INTO clients (`+sqlClientColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		client.ClientId, client.Name, client.SecretHash, strings.Join(client.RedirectURIs, " "), strings.Join(client.Scopes, " "), client.CreatedAt.UTC(), client.UpdatedAt.UTC())
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	return client, nil
+}
+
+func (service *sqlClientService) FindClient(ctx context.Context, clientId string) (*Client, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	return scanClient(service.db.QueryRowContext(ctx, `SELECT `+sqlClientColumns+` FROM clients WHERE client_id = $1`, clientId))
+}
+
+func (service *sqlClientService) ListClients(ctx context.Context) ([]Client, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	rows, err := service.db.QueryContext(ctx, `SELECT `+sqlClientColumns+` FROM clients ORDER BY created_at, client_id`)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	defer rows.Close()
+
+	clients := []Client{}
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, sqlError(rows.Err())
+}
+
+func (service *sqlClientService) RemoveClient(ctx context.Context, clientId string) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.db.ExecContext(ctx, `DELETE FROM clients WHERE client_id = $1`, clientId)
+	if err != nil {
+		return sqlError(err)
+	}
+	if removed, err := res.RowsAffected(); err == nil && removed == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
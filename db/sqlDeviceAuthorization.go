@@ -0,0 +1,157 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlDeviceAuthorizationService struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSQLDeviceAuthorizationService(sqlDB *sql.DB, configs *providers.Config) DeviceAuthorizationService {
+	return &sqlDeviceAuthorizationService{
+		db:      sqlDB,
+		timeout: configs.DbTimeout,
+	}
+}
+
+const sqlDeviceAuthorizationColumns = `device_code, user_code, client_id, scope, status, user_id, interval_seconds, last_polled_at, expires_at, created_at`
+
+func scanDeviceAuthorization(row sqlScanner) (*DeviceAuthorization, error) {
+	var authorization DeviceAuthorization
+	var userId sql.NullString
+	var interval int64
+	var lastPolledAt sql.NullTime
+	err := row.Scan(&authorization.DeviceCode, &authorization.UserCode, &authorization.ClientId, &authorization.Scope, &authorization.Status,
+		&userId, &interval, &lastPolledAt, &authorization.ExpiresAt, &authorization.CreatedAt)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	authorization.UserId = userId.String
+	authorization.Interval = time.Duration(interval) * time.Second
+	authorization.LastPolledAt = lastPolledAt.Time
+	return &authorization, nil
+}
+
+func (service *sqlDeviceAuthorizationService) CreateDeviceAuthorization(ctx context.Context, authorization DeviceAuthorization) (*DeviceAuthorization, error) {
+	created := newDeviceAuthorization(authorization)
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	_, err := service.db.ExecContext(ctx, `INSERT INTO device_authorizations (`+sqlDeviceAuthorizationColumns+`)
+		VALUES ($1, $2, $3, $4, $5, NULL, $6, NULL, $7, $8)`,
+		created.DeviceCode, created.UserCode, created.ClientId, created.Scope, created.Status,
+		int64(created.Interval/time.Second), created.ExpiresAt.UTC(), created.CreatedAt.UTC())
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	return created, nil
+}
+
+func (service *sqlDeviceAuthorizationService) FindDeviceAuthorization(ctx context.Context, userCode string, now time.Time) (*DeviceAuthorization, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	return scanDeviceAuthorization(service.db.QueryRowContext(ctx, `SELECT `+sqlDeviceAuthorizationColumns+` FROM device_authorizations
+		WHERE user_code = $1 AND status = $2 AND expires_at > $3`, userCode, DeviceAuthorizationPending, now.UTC()))
+}
+
+func (service *sqlDeviceAuthorizationService) ApproveDeviceAuthorization(ctx context.Context, userCode string, userId string, now time.Time) error {
+	return service.decide(ctx, userCode, DeviceAuthorizationApproved, sql.NullString{String: userId, Valid: true}, now)
+}
+
+func (service *sqlDeviceAuthorizationService) DenyDeviceAuthorization(ctx context.Context, userCode string, now time.Time) error {
+	return service.decide(ctx, userCode, DeviceAuthorizationDenied, sql.NullString{}, now)
+}
+
+func (service *sqlDeviceAuthorizationService) decide(ctx context.Context, userCode string, status string, userId sql.NullString, now time.Time) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.db.ExecContext(ctx, `UPDATE device_authorizations SET status = $1, user_id = $2
+		WHERE user_code = $3 AND status = $4 AND expires_at > $5`, status, userId, userCode, DeviceAuthorizationPending, now.UTC())
+	if err != nil {
+		return sqlError(err)
+	}
+	if updated, err := res.RowsAffected(); err == nil && updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (service *sqlDeviceAuthorizationService) PollDeviceAuthorization(ctx context.Context, deviceCode string, now time.Time) (*DeviceAuthorization, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	tx, err := service.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	authorization, err := scanDeviceAuthorization(tx.QueryRowContext(ctx, `SELECT `+sqlDeviceAuthorizationColumns+` FROM device_authorizations
+		WHERE device_code = $1`, deviceCode))
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE device_authorizations SET last_polled_at = $1 WHERE device_code = $2`, now.UTC(), deviceCode)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return authorization, nil
+}
+
+func (service *sqlDeviceAuthorizationService) SlowDownDeviceAuthorization(ctx context.Context, deviceCode string, interval time.Duration) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.db.ExecContext(ctx, `UPDATE device_authorizations SET interval_seconds = $1 WHERE device_code = $2`,
+		int64(interval/time.Second), deviceCode)
+	if err != nil {
+		return sqlError(err)
+	}
+	if updated, err := res.RowsAffected(); err == nil && updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (service *sqlDeviceAuthorizationService) RemoveDeviceAuthorization(ctx context.Context, deviceCode string) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.db.ExecContext(ctx, `DELETE FROM device_authorizations WHERE device_code = $1`, deviceCode)
+	if err != nil {
+		return sqlError(err)
+	}
+	if removed, err := res.RowsAffected(); err == nil && removed == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (service *sqlDeviceAuthorizationService) RemoveExpiredDeviceAuthorizations(ctx context.Context, now time.Time) (int64, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.db.ExecContext(ctx, `DELETE FROM device_authorizations WHERE expires_at <= $1`, now.UTC())
+	if err != nil {
+		return 0, sqlError(err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,251 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The SQL migrations are the files in migrations/, named
+// <version>_<description>.sql. A <version>_<description>.down.sql file next
+// to one makes it revertible.
+
+//go:embed migrations/*.sql
+var sqlMigrations embed.FS
+
+// sqlMigrationLock is the Postgres advisory lock held while migrating, so
+// that replicas starting at the same time do not race each other
+const sqlMigrationLock = 4_620_318_551
+
+type sqlMigration struct {
+	version int
+	name    string
+	// down is the name of the down script, empty when there is none
+	down string
+}
+
+type sqlMigrator struct {
+	db     *sql.DB
+	driver string
+	logger *slog.Logger
+}
+
+func NewSQLMigrator(sqlDB *sql.DB, driver string, logger *slog.Logger) Migrator {
+	return &sqlMigrator{
+		db:     sqlDB,
+		driver: driver,
+		logger: logger,
+	}
+}
+
+func (migrator *sqlMigrator) Up(ctx context.Context) error {
+	return migrator.locked(ctx, func(conn *sql.Conn, migrations []sqlMigration, applied map[int]time.Time) error {
+		for _, migration := range migrations {
+			if _, ok := applied[migration.version]; ok {
+				continue
+			}
+			err := migrator.run(ctx, conn, migration.name,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+				migration.version, migration.name, time.Now().UTC())
+			if err != nil {
+				return err
+			}
+			migrator.logger.Info("Applied migration", slog.String("migration", migration.name))
+		}
+		return nil
+	})
+}
+
+func (migrator *sqlMigrator) Down(ctx context.Context, steps int) error {
+	return migrator.locked(ctx, func(conn *sql.Conn, migrations []sqlMigration, applied map[int]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.version]; !ok {
+				continue
+			}
+			if migration.down == "" {
+				return fmt.Errorf("%s: %w", migration.name, ErrIrreversible)
+			}
+			err := migrator.run(ctx, conn, migration.down, "DELETE FROM schema_migrations WHERE version = $1", migration.version)
+			if err != nil {
+				return err
+			}
+			migrator.logger.Info("Reverted migration", slog.String("migration", migration.name))
+			steps--
+		}
+		return nil
+	})
+}
+
+// Status reads schema_migrations without the lock, so it neither waits for
+// a replica migrating nor creates the table: a missing one means nothing is applied
+func (migrator *sqlMigrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := listSQLMigrations()
+	if err != nil {
+		return nil, err
+	}
+	exists, err := migrator.tableExists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int]time.Time{}
+	if exists {
+		if applied, err = appliedSQLMigrations(ctx, migrator.db); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.version, Name: migration.name}
+		if appliedAt, ok := applied[migration.version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// tableExists tells whether schema_migrations was created
+func (migrator *sqlMigrator) tableExists(ctx context.Context) (bool, error) {
+	query := "SELECT to_regclass('schema_migrations') IS NOT NULL"
+	if migrator.driver == "sqlite" {
+		query = "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')"
+	}
+	var exists bool
+	err := migrator.db.QueryRowContext(ctx, query).Scan(&exists)
+	return exists, err
+}
+
+// locked calls apply while holding the migration lock, with the known
+// migrations and the versions already applied
+func (migrator *sqlMigrator) locked(ctx context.Context, apply func(conn *sql.Conn, migrations []sqlMigration, applied map[int]time.Time) error) error {
+	migrations, err := listSQLMigrations()
+	if err != nil {
+		return err
+	}
+
+	// a single connection, advisory locks belong to the session
+	conn, err := migrator.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if migrator.driver == "postgres" {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", sqlMigrationLock); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", sqlMigrationLock)
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedSQLMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return apply(conn, migrations, applied)
+}
+
+// appliedSQLMigrations returns when each applied migration ran, by version
+func appliedSQLMigrations(ctx context.Context, querier sqlQuerier) (map[int]time.Time, error) {
+	rows, err := querier.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// run executes the script and records the change in a single transaction
+func (migrator *sqlMigrator) run(ctx context.Context, conn *sql.Conn, script string, record string, args ...interface{}) error {
+	content, err := sqlMigrations.ReadFile(path.Join("migrations", script))
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, string(content)); err != nil {
+		return fmt.Errorf("%s: %w", script, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("%s: %w", script, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", script, err)
+	}
+	return nil
+}
+
+// listSQLMigrations returns the embedded migrations ordered by version
+func listSQLMigrations() ([]sqlMigration, error) {
+	entries, err := fs.ReadDir(sqlMigrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+
+	migrations := make([]sqlMigration, 0, len(entries))
+	seen := map[int]string{}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".down.sql") {
+			if !names[strings.TrimSuffix(entry.Name(), ".down.sql")+".sql"] {
+				return nil, fmt.Errorf("migration %s: no up migration", entry.Name())
+			}
+			continue
+		}
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: name must start with a version number", entry.Name())
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, entry.Name(), version)
+		}
+		seen[version] = entry.Name()
+
+		migration := sqlMigration{version: version, name: entry.Name()}
+		if down := strings.TrimSuffix(entry.Name(), ".sql") + ".down.sql"; names[down] {
+			migration.down = down
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
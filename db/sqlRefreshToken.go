@@ -0,0 +1,117 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type sqlRefreshTokenService struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSQLRefreshTokenService(sqlDB *sql.DB, configs *providers.Config) RefreshTokenService {
+	return &sqlRefreshTokenService{
+		db:      sqlDB,
+		timeout: configs.DbTimeout,
+	}
+}
+
+func (service *sqlRefreshTokenService) CreateRefreshToken(ctx context.Context, userId string) (string, error) {
+	return service.CreateClientRefreshToken(ctx, userId, "", "")
+}
+
+func (service *sqlRefreshTokenService) CreateClientRefreshToken(ctx context.Context, userId string, clientId string, scope string) (string, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	refreshToken := RefreshToken{
+		ID:        uuid.NewString(),
+		UserId:    userId,
+		TokenId:   uuid.NewString(),
+		ClientId:  clientId,
+		Scope:     scope,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// the tokens handed out at login have a NULL client_id
+	_, err := service.db.ExecContext(ctx, `INSERT INTO refresh_tokens (id, user_id, token_id, client_id, scope, created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)`,
+		refreshToken.ID, refreshToken.UserId, refreshToken.TokenId, refreshToken.ClientId, refreshToken.Scope,
+		refreshToken.CreatedAt.UTC(), refreshToken.UpdatedAt.UTC())
+	if err != nil {
+		return "", sqlError(err)
+	}
+	return refreshToken.TokenId, nil
+}
+
+func (service *sqlRefreshTokenService) FindUserIdbyRefreshToken(ctx context.Context, tokenId string) (string, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var userId string
+	err := service.db.QueryRowContext(ctx, `SELECT user_id FROM refresh_tokens WHERE token_id = $1 AND client_id IS NULL`, tokenId).Scan(&userId)
+	if err != nil {
+		return "", sqlError(err)
+	}
+	return userId, nil
+}
+
+func (service *sqlRefreshTokenService) FindRefreshToken(ctx context.Context, tokenId string) (*RefreshToken, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var refreshToken RefreshToken
+	var clientId sql.NullString
+	err := service.db.QueryRowContext(ctx, `SELECT id, user_id, token_id, client_id, scope, created_at, updated_at
+		FROM refresh_tokens WHERE token_id = $1`, tokenId).Scan(
+		&refreshToken.ID, &refreshToken.UserId, &refreshToken.TokenId, &clientId, &refreshToken.Scope, &refreshToken.CreatedAt, &refreshToken.UpdatedAt)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	refreshToken.ClientId = clientId.String
+	return &refreshToken, nil
+}
+
+func (service *sqlRefreshTokenService) RemoveRefreshToken(ctx context.Context, tokenId string) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	_, err := service.db.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE token_id = $1`, tokenId)
+	return sqlError(err)
+}
+
+func (service *sqlRefreshTokenService) RemoveUserRefreshTokens(ctx context.Context, userId string) (int64, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.db.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE user_id = $1`, userId)
+	if err != nil {
+		return 0, sqlError(err)
+	}
+	return res.RowsAffected()
+}
+
+func (service *sqlRefreshTokenService) CountRefreshTokens(ctx context.Context) (int64, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var count int64
+	err := service.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM refresh_tokens`).Scan(&count)
+	if err != nil {
+		return 0, sqlError(err)
+	}
+	return count, nil
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlRevokedTokenService struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSQLRevokedTokenService(sqlDB *sql.DB, configs *providers.Config) RevokedTokenService {
+	return &sqlRevokedTokenService{
+		db:      sqlDB,
+		timeout: configs.DbTimeout,
+	}
+}
+
+func (service *sqlRevokedTokenService) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	_, err := service.db.ExecContext(ctx, `INSERT INTO revoked_tokens (jti, expires_at, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING`, jti, expiresAt.UTC(), time.Now().UTC())
+	return sqlError(err)
+}
+
+func (service *sqlRevokedTokenService) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var count int64
+	err := service.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM revoked_tokens WHERE jti = $1`, jti).Scan(&count)
+	if err != nil {
+		return false, sqlError(err)
+	}
+	return count > 0, nil
+}
+
+func (service *sqlRevokedTokenService) RemoveExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= $1`, now.UTC())
+	if err != nil {
+		return 0, sqlError(err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlTenantService struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSQLTenantService(sqlDB *sql.DB, configs *providers.Config) TenantService {
+	return &sqlTenantService{
+		db:      sqlDB,
+		timeout: configs.DbTimeout,
+	}
+}
+
+const sqlTenantColumns = `tenant_id, name, token_hash, created_at`
+
+func scanTenant(row sqlScanner) (*Tenant, error) {
+	var tenant Tenant
+	err := row.Scan(&tenant.TenantId, &tenant.Name, &tenant.TokenHash, &tenant.CreatedAt)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	return &tenant, nil
+}
+
+func (service *sqlTenantService) CreateTenant(ctx context.Context, name string, token string) (*Tenant, error) {
+	tenant := newTenant(name, token)
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	_, err := service.db.ExecContext(ctx, `INSERT INTO tenants (`+sqlTenantColumns+`) VALUES ($1, $2, $3, $4)`,
+		tenant.TenantId, tenant.Name, tenant.TokenHash, tenant.CreatedAt.UTC())
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	return tenant, nil
+}
+
+func (service *sqlTenantService) FindTenantByToken(ctx context.Context, token string) (*Tenant, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	return scanTenant(service.db.QueryRowContext(ctx, `SELECT `+sqlTenantColumns+` FROM tenants WHERE token_hash = $1`, hashSecret(token)))
+}
+
+func (service *sqlTenantService) ListTenants(ctx context.Context) ([]Tenant, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	rows, err := service.db.QueryContext(ctx, `SELECT `+sqlTenantColumns+` FROM tenants ORDER BY created_at, tenant_id`)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	defer rows.Close()
+
+	tenants := []Tenant{}
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, *tenant)
+	}
+	return tenants, sqlError(rows.Err())
+}
+
+func (service *sqlTenantService) RemoveTenant(ctx context.Context, tenantId string) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.db.ExecContext(ctx, `DELETE FROM tenants WHERE tenant_id = $1`, tenantId)
+	if err != nil {
+		return sqlError(err)
+	}
+	if removed, err := res.RowsAffected(); err == nil && removed == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const sqlUploadColumns = `upload_id, user_id, purpose, length, upload_offset, metadata, expires_at, created_at, updated_at`
+
+type sqlUploadService struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSQLUploadService(sqlDB *sql.DB, configs *providers.Config) UploadService {
+	return &sqlUploadService{
+		db:      sqlDB,
+		timeout: configs.DbTimeout,
+	}
+}
+
+// scanUpload reads a row selected with sqlUploadColumns, without its parts
+func scanUpload(row sqlScanner) (*Upload, error) {
+	var upload Upload
+	var metadata sql.NullString
+	err := row.Scan(&upload.UploadId, &upload.UserId, &upload.Purpose, &upload.Length, &upload.Offset, &metadata,
+		&upload.ExpiresAt, &upload.CreatedAt, &upload.UpdatedAt)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	if metadata.Valid {
+		if err := json.Unmarshal([]byte(metadata.String), &upload.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	return &upload, nil
+}
+
+// loadParts fills in the received chunks of upload
+func loadParts(ctx context.Context, querier sqlQuerier, upload *Upload) error {
+	rows, err := querier.QueryContext(ctx, `SELECT part FROM upload_parts WHERE upload_id = $1 ORDER BY part_offset`, upload.UploadId)
+	if err != nil {
+		return sqlError(err)
+	}
+	defer rows.Close()
+
+	upload.Parts = []string{}
+	for rows.Next() {
+		var part string
+		if err := rows.Scan(&part); err != nil {
+			return err
+		}
+		upload.Parts = append(upload.Parts, part)
+	}
+	return rows.Err()
+}
+
+func findSQLUpload(ctx context.Context, querier sqlQuerier, uploadId string) (*Upload, error) {
+	upload, err := scanUpload(querier.QueryRowContext(ctx, `SELECT `+sqlUploadColumns+` FROM uploads WHERE upload_id = $1`, uploadId))
+	if err != nil {
+		return nil, err
+	}
+	if err := loadParts(ctx, querier, upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+func (service *sqlUploadService) CreateUpload(ctx context.Context, userId string, purpose string, length int64, metadata map[string]string, expiresAt time.Time) (*Upload, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	upload := Upload{
+		UploadId:  uuid.NewString(),
+		UserId:    userId,
+		Purpose:   purpose,
+		Length:    length,
+		Offset:    0,
+		Parts:     []string{},
+		Metadata:  metadata,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	encodedMetadata, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = service.db.ExecContext(ctx, `INSERT INTO uploads (upload_id, user_id, purpose, length, upload_offset, metadata, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		upload.UploadId, upload.UserId, upload.Purpose, upload.Length, upload.Offset, string(encodedMetadata),
+		upload.ExpiresAt.UTC(), upload.CreatedAt.UTC(), upload.UpdatedAt.UTC())
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	return &upload, nil
+}
+
+func (service *sqlUploadService) FindUpload(ctx context.Context, uploadId string) (*Upload, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	return findSQLUpload(ctx, service.db, uploadId)
+}
+
+// AppendPart records a stored chunk, but only if the upload is still at the
+// given offset. It returns ErrConflict when another request already moved the offset.
+func (service *sqlUploadService) AppendPart(ctx context.Context, uploadId string, offset, size int64, part string) (*Upload, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	tx, err := service.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE uploads SET upload_offset = upload_offset + $3, updated_at = $4
+		WHERE upload_id = $1 AND upload_offset = $2`, uploadId, offset, size, time.Now().UTC())
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		// tell a missing upload apart from one at another offset
+		if _, err := findSQLUpload(ctx, tx, uploadId); err != nil {
+			return nil, err
+		}
+		return nil, ErrConflict
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO upload_parts (upload_id, part_offset, part) VALUES ($1, $2, $3)`, uploadId, offset, part)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	upload, err := findSQLUpload(ctx, tx, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+func (service *sqlUploadService) RemoveUpload(ctx context.Context, uploadId string) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	tx, err := service.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// SQLite only cascades with the foreign_keys pragma, delete the parts explicitly
+	if _, err := tx.ExecContext(ctx, `DELETE FROM upload_parts WHERE upload_id = $1`, uploadId); err != nil {
+		return sqlError(err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM uploads WHERE upload_id = $1`, uploadId); err != nil {
+		return sqlError(err)
+	}
+	return tx.Commit()
+}
+
+func (service *sqlUploadService) FindExpiredUploads(ctx context.Context, now time.Time) ([]Upload, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	rows, err := service.db.QueryContext(ctx, `SELECT `+sqlUploadColumns+` FROM uploads
+		WHERE expires_at < $1 ORDER BY expires_at LIMIT 100`, now.UTC())
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	uploads := []Upload{}
+	for rows.Next() {
+		upload, err := scanUpload(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		uploads = append(uploads, *upload)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the parts are loaded once the rows are closed, SQLite has a single connection
+	for i := range uploads {
+		if err := loadParts(ctx, service.db, &uploads[i]); err != nil {
+			return nil, err
+		}
+	}
+	return uploads, nil
+}
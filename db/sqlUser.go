@@ -0,0 +1,274 @@
+package db
+
+import (
+	dto "GoApp/dto/auth"
+	"GoApp/providers"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const sqlUserColumns = `id, email, password, firstname, lastname, activation_code, activated, admin, profile, profile_sizes, tenant_id, created_at, updated_at`
+
+type sqlUserService struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSQLUserService(sqlDB *sql.DB, configs *providers.Config) UserService {
+	return &sqlUserService{
+		db:      sqlDB,
+		timeout: configs.DbTimeout,
+	}
+}
+
+// scanUser reads a row selected with sqlUserColumns
+func scanUser(row sqlScanner) (*User, error) {
+	var user User
+	var profileSizes, tenantId sql.NullString
+	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.Firstname, &user.Lastname, &user.ActivationCode,
+		&user.Activated, &user.Admin, &user.Profile, &profileSizes, &tenantId, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	user.TenantId = tenantId.String
+	if profileSizes.Valid {
+		if err := json.Unmarshal([]byte(profileSizes.String), &user.ProfileSizes); err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (service *sqlUserService) CreateUser(ctx context.Context, dto dto.RegisterCredentials) (*User, error) {
+	user, err := newUser(uuid.NewString(), dto)
+	if err != nil {
+		return nil, err
+	}
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	_, err = service.db.ExecContext(ctx, `INSERT INTO users (id, email, password, firstname, lastname, activation_code, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		user.ID, user.Email, user.Password, user.Firstname, user.Lastname, user.ActivationCode, user.CreatedAt.UTC(), user.UpdatedAt.UTC())
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	return user, nil
+}
+
+func (service *sqlUserService) FindUser(ctx context.Context, email string) (*User, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	return scanUser(service.db.QueryRowContext(ctx, `SELECT `+sqlUserColumns+` FROM users WHERE email = $1`, email))
+}
+
+func (service *sqlUserService) FindById(ctx context.Context, id string) (*User, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	return scanUser(service.db.QueryRowContext(ctx, `SELECT `+sqlUserColumns+` FROM users WHERE id = $1`, id))
+}
+
+func (service *sqlUserService) UserExists(ctx context.Context, email string) (bool, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var exists bool
+	err := service.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, email).Scan(&exists)
+	if err != nil {
+		return false, sqlError(err)
+	}
+	return exists, nil
+}
+
+func (service *sqlUserService) ActivateUser(ctx context.Context, email, code, password string) (*User, error) {
+	var hash *string
+	if password != "" {
+		hashed, err := hashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		hash = &hashed
+	}
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	return scanUser(service.db.QueryRowContext(ctx, `UPDATE users SET activated = TRUE, password = COALESCE($3, password)
+		WHERE email = $1 AND activation_code = $2 RETURNING `+sqlUserColumns, email, code, hash))
+}
+
+func (service *sqlUserService) UpdateActivationCode(ctx context.Context, email string) (*User, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	return scanUser(service.db.QueryRowContext(ctx, `UPDATE users SET activation_code = $2
+		WHERE email = $1 RETURNING `+sqlUserColumns, email, uuid.NewString()))
+}
+
+func (service *sqlUserService) UpdatePassword(ctx context.Context, id string, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return service.update(ctx, `UPDATE users SET password = $2 WHERE id = $1`, id, hash)
+}
+
+func (service *sqlUserService) UpdateProfile(ctx context.Context, id string, profile string, sizes []int) error {
+	profileSizes, err := json.Marshal(sizes)
+	if err != nil {
+		return err
+	}
+	return service.update(ctx, `UPDATE users SET profile = $2, profile_sizes = $3 WHERE id = $1`, id, profile, string(profileSizes))
+}
+
+func (service *sqlUserService) UpdateDetail(ctx context.Context, userId, firstname, lastname string) error {
+	return service.update(ctx, `UPDATE users SET firstname = $2, lastname = $3 WHERE id = $1`, userId, firstname, lastname)
+}
+
+func (service *sqlUserService) UpdateAdmin(ctx context.Context, id string, admin bool) error {
+	return service.update(ctx, `UPDATE users SET admin = $2 WHERE id = $1`, id, admin)
+}
+
+// update runs an UPDATE of a single user, returning ErrNotFound when it matched none
+func (service *sqlUserService) update(ctx context.Context, query string, args ...interface{}) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return sqlError(err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (service *sqlUserService) ProvisionUser(ctx context.Context, provisioned ProvisionedUser) (*User, error) {
+	user, err := newProvisionedUser(uuid.NewString(), provisioned)
+	if err != nil {
+		return nil, err
+	}
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	_, err = service.db.ExecContext(ctx, `INSERT INTO users (id, email, password, firstname, lastname, activation_code, activated, tenant_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		user.ID, user.Email, user.Password, user.Firstname, user.Lastname, user.ActivationCode, user.Activated, user.TenantId,
+		user.CreatedAt.UTC(), user.UpdatedAt.UTC())
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	return user, nil
+}
+
+func (service *sqlUserService) UpdateProvisionedUser(ctx context.Context, id string, provisioned ProvisionedUser) (*User, error) {
+	var hash, activationCode *string
+	if provisioned.Password != "" {
+		hashed, err := hashPassword(provisioned.Password)
+		if err != nil {
+			return nil, err
+		}
+		hash = &hashed
+	}
+	if !provisioned.Active {
+		code := uuid.NewString()
+		activationCode = &code
+	}
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	return scanUser(service.db.QueryRowContext(ctx, `UPDATE users SET email = $2, firstname = $3, lastname = $4, activated = $5,
+		password = COALESCE($6, password), activation_code = COALESCE($7, activation_code), updated_at = $8
+		WHERE id = $1 RETURNING `+sqlUserColumns,
+		id, provisioned.Email, provisioned.Firstname, provisioned.Lastname, provisioned.Active, hash, activationCode, now.UTC()))
+}
+
+func (service *sqlUserService) ListUsers(ctx context.Context, filter UserFilter) ([]User, int64, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	where := ` FROM users WHERE ($1 = '' OR tenant_id = $1) AND ($2 = '' OR email = $2)`
+	var total int64
+	err := service.db.QueryRowContext(ctx, `SELECT COUNT(*)`+where, filter.TenantId, filter.Email).Scan(&total)
+	if err != nil {
+		return nil, 0, sqlError(err)
+	}
+	users := []User{}
+	if filter.Limit == 0 {
+		return users, total, nil
+	}
+
+	rows, err := service.db.QueryContext(ctx, `SELECT `+sqlUserColumns+where+` ORDER BY created_at, id LIMIT $3 OFFSET $4`,
+		filter.TenantId, filter.Email, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, sqlError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *user)
+	}
+	return users, total, sqlError(rows.Err())
+}
+
+func (service *sqlUserService) RemoveUser(ctx context.Context, id string) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	tx, err := service.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// SQLite only cascades with the foreign_keys pragma, delete what refers to the user explicitly
+	for _, query := range []string{
+		`DELETE FROM upload_parts WHERE upload_id IN (SELECT upload_id FROM uploads WHERE user_id = $1)`,
+		`DELETE FROM uploads WHERE user_id = $1`,
+		`DELETE FROM refresh_tokens WHERE user_id = $1`,
+		`DELETE FROM authorization_codes WHERE user_id = $1`,
+		`DELETE FROM device_authorizations WHERE user_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return sqlError(err)
+		}
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return sqlError(err)
+	}
+	if removed, err := res.RowsAffected(); err == nil && removed == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package db
+
+// The SQLite driver is pure Go but large, it is only linked into builds made
+// with -tags sqlite, e.g. to run the API and its checks in CI without Postgres.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,74 @@
+//go:build sqlite
+
+package db_test
+
+import (
+	"GoApp/db"
+	"GoApp/db/dbtest"
+	"GoApp/providers"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteServices(t *testing.T) {
+	ctx := context.Background()
+	configs := &providers.Config{DatabaseDriver: "sqlite", DatabaseUrl: filepath.Join(t.TempDir(), "test.db"), DbTimeout: 10 * time.Second}
+	sqlDB := db.OpenSQL(configs, logger)
+	defer sqlDB.Close()
+
+	// every down step must leave a schema the up steps apply to again
+	migrator := db.NewSQLMigrator(sqlDB, configs.DatabaseDriver, logger)
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Down(ctx, len(statuses)); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbtest.TestServices(ctx, sqlServices(sqlDB, configs)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteMigrationStatus(t *testing.T) {
+	ctx := context.Background()
+	configs := &providers.Config{DatabaseDriver: "sqlite", DatabaseUrl: filepath.Join(t.TempDir(), "test.db"), DbTimeout: 10 * time.Second}
+	sqlDB := db.OpenSQL(configs, logger)
+	defer sqlDB.Close()
+	migrator := db.NewSQLMigrator(sqlDB, configs.DatabaseDriver, logger)
+
+	// a database never migrated has every migration pending, and is left untouched
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			t.Fatalf("%s is applied", status.Name)
+		}
+	}
+	var tables int
+	if err := sqlDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'").Scan(&tables); err != nil || tables != 0 {
+		t.Fatalf("got %d tables, %v", tables, err)
+	}
+
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if statuses, err = migrator.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Fatalf("%s is pending", status.Name)
+		}
+	}
+}
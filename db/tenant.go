@@ -0,0 +1,144 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Tenant is a customer organization provisioning its users from its own
+// identity provider through SCIM. Like the secrets of the clients, only the
+// SHA-256 of its bearer token is stored.
+type Tenant struct {
+	TenantId  string
+	Name      string
+	TokenHash string
+	CreatedAt time.Time
+}
+
+// TenantService stores the SCIM tenants. Looking up or removing an unknown
+// tenant returns ErrNotFound.
+type TenantService interface {
+	CreateTenant(ctx context.Context, name string, token string) (*Tenant, error)
+	// FindTenantByToken returns the tenant authenticated by a bearer token
+	FindTenantByToken(ctx context.Context, token string) (*Tenant, error)
+	ListTenants(ctx context.Context) ([]Tenant, error)
+	// RemoveTenant leaves the provisioned users, who keep their accounts
+	RemoveTenant(ctx context.Context, tenantId string) error
+}
+
+func newTenant(name string, token string) *Tenant {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return &Tenant{
+		TenantId:  uuid.NewString(),
+		Name:      name,
+		TokenHash: hashSecret(token),
+		CreatedAt: now,
+	}
+}
+
+// tenantDocument is how a tenant is stored in MongoDB
+type tenantDocument struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	TenantId  string             `bson:"tenantId,omitempty"`
+	Name      string             `bson:"name,omitempty"`
+	TokenHash string             `bson:"tokenHash,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt,omitempty"`
+}
+
+func (document *tenantDocument) tenant() *Tenant {
+	return &Tenant{
+		TenantId:  document.TenantId,
+		Name:      document.Name,
+		TokenHash: document.TokenHash,
+		CreatedAt: document.CreatedAt,
+	}
+}
+
+type tenantService struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewTenantService expects the indexes of the "tenant" collection, which the
+// Mongo migrations create
+func NewTenantService(client *mongo.Client, configs *providers.Config) TenantService {
+	return &tenantService{
+		collection: OpenCollection(client, "tenant", configs.DatabaseName),
+		timeout:    configs.DbTimeout,
+	}
+}
+
+func (service *tenantService) CreateTenant(ctx context.Context, name string, token string) (*Tenant, error) {
+	tenant := newTenant(name, token)
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	_, err := service.collection.InsertOne(ctx, tenantDocument{
+		ID:        primitive.NewObjectID(),
+		TenantId:  tenant.TenantId,
+		Name:      tenant.Name,
+		TokenHash: tenant.TokenHash,
+		CreatedAt: tenant.CreatedAt,
+	})
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return tenant, nil
+}
+
+func (service *tenantService) FindTenantByToken(ctx context.Context, token string) (*Tenant, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var document tenantDocument
+	err := service.collection.FindOne(ctx, bson.M{"tokenHash": hashSecret(token)}).Decode(&document)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return document.tenant(), nil
+}
+
+func (service *tenantService) ListTenants(ctx context.Context) ([]Tenant, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	cursor, err := service.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	var documents []tenantDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, mongoError(err)
+	}
+	tenants := make([]Tenant, 0, len(documents))
+	for i := range documents {
+		tenants = append(tenants, *documents[i].tenant())
+	}
+	return tenants, nil
+}
+
+func (service *tenantService) RemoveTenant(ctx context.Context, tenantId string) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	res, err := service.collection.DeleteOne(ctx, bson.M{"tenantId": tenantId})
+	if err != nil {
+		return mongoError(err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"GoApp/providers"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Upload tracks a resumable upload session. The received bytes are kept in
+// blob storage, one object per accepted chunk, listed in Parts.
+type Upload struct {
+	UploadId  string
+	UserId    string
+	Purpose   string
+	Length    int64
+	Offset    int64
+	Parts     []string
+	Metadata  map[string]string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// UploadService stores the resumable upload sessions. Looking up an unknown
+// upload returns ErrNotFound.
+type UploadService interface {
+	CreateUpload(ctx context.Context, userId string, purpose string, length int64, metadata map[string]string, expiresAt time.Time) (*Upload, error)
+	FindUpload(ctx context.Context, uploadId string) (*Upload, error)
+	AppendPart(ctx context.Context, uploadId string, offset, size int64, part string) (*Upload, error)
+	RemoveUpload(ctx context.Context, uploadId string) error
+	FindExpiredUploads(ctx context.Context, now time.Time) ([]Upload, error)
+}
+
+// uploadDocument is how an upload session is stored in MongoDB
+type uploadDocument struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UploadId  string             `bson:"uploadId,omitempty"`
+	UserId    primitive.ObjectID `bson:"userId,omitempty"`
+	Purpose   string             `bson:"purpose,omitempty"`
+	Length    int64              `bson:"length"`
+	Offset    int64              `bson:"offset"`
+	Parts     []string           `bson:"parts"`
+	Metadata  map[string]string  `bson:"metadata,omitempty"`
+	ExpiresAt time.Time          `bson:"expiresAt,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt,omitempty"`
+	UpdatedAt time.Time          `bson:"updatedAt,omitempty"`
+}
+
+func (document *uploadDocument) upload() *Upload {
+	return &Upload{
+		UploadId:  document.UploadId,
+		UserId:    document.UserId.Hex(),
+		Purpose:   document.Purpose,
+		Length:    document.Length,
+		Offset:    document.Offset,
+		Parts:     document.Parts,
+		Metadata:  document.Metadata,
+		ExpiresAt: document.ExpiresAt,
+		CreatedAt: document.CreatedAt,
+		UpdatedAt: document.UpdatedAt,
+	}
+}
+
+type uploadService struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewUploadService expects the indexes of the "upload" collection, which the
+// Mongo migrations create
+func NewUploadService(client *mongo.Client, configs *providers.Config) UploadService {
+	return &uploadService{
+		collection: OpenCollection(client, "upload", configs.DatabaseName),
+		timeout:    configs.DbTimeout,
+	}
+}
+
+func (service *uploadService) CreateUpload(ctx context.Context, userId string, purpose string, length int64, metadata map[string]string, expiresAt time.Time) (*Upload, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	userObjectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	document := uploadDocument{
+		ID:        primitive.NewObjectID(),
+		UploadId:  uuid.NewString(),
+		UserId:    userObjectId,
+		Purpose:   purpose,
+		Length:    length,
+		Offset:    0,
+		Parts:     []string{},
+		Metadata:  metadata,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err = service.collection.InsertOne(ctx, document)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return document.upload(), nil
+}
+
+func (service *uploadService) FindUpload(ctx context.Context, uploadId string) (*Upload, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var document uploadDocument
+	filter := bson.M{"uploadId": uploadId}
+	err := service.collection.FindOne(ctx, filter).Decode(&document)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return document.upload(), nil
+}
+
+// AppendPart records a stored chunk, but only if the upload is still at the
+// given offset. It returns ErrConflict when another request already moved the offset.
+func (service *uploadService) AppendPart(ctx context.Context, uploadId string, offset, size int64, part string) (*Upload, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var document uploadDocument
+	filter := bson.M{"uploadId": uploadId, "offset": offset}
+	update := bson.M{
+		"$inc":  bson.M{"offset": size},
+		"$push": bson.M{"parts": part},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := service.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		// tell a missing upload apart from one at another offset
+		count, err := service.collection.CountDocuments(ctx, bson.M{"uploadId": uploadId})
+		if err != nil {
+			return nil, mongoError(err)
+		}
+		if count == 0 {
+			return nil, ErrNotFound
+		}
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return document.upload(), nil
+}
+
+func (service *uploadService) RemoveUpload(ctx context.Context, uploadId string) error {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	filter := bson.M{"uploadId": uploadId}
+	_, err := service.collection.DeleteOne(ctx, filter)
+	return mongoError(err)
+}
+
+func (service *uploadService) FindExpiredUploads(ctx context.Context, now time.Time) ([]Upload, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	filter := bson.M{"expiresAt": bson.M{"$lt": now}}
+	cursor, err := service.collection.Find(ctx, filter, options.Find().SetLimit(100))
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	documents := []uploadDocument{}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, mongoError(err)
+	}
+	uploads := make([]Upload, len(documents))
+	for i := range documents {
+		uploads[i] = *documents[i].upload()
+	}
+	return uploads, nil
+}
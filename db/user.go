@@ -4,7 +4,6 @@ import (
 	dto "GoApp/dto/auth"
 	"GoApp/providers"
 	"context"
-	"errors"
 	"fmt"
 	"time"
 
@@ -12,236 +11,473 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
+	ID             string
+	Email          *string
+	Password       *string
+	Firstname      *string
+	Lastname       *string
+	ActivationCode string
+	Activated      bool
+	Admin          bool
+	Profile        string
+	ProfileSizes   []int
+	TenantId       string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Deprovisioned reports whether the identity provider of the SCIM tenant
+// which provisioned the user deactivated it. The users who registered have
+// no TenantId. A deprovisioned user must not reactivate the account by email.
+func (user *User) Deprovisioned() bool {
+	return user.TenantId != "" && !user.Activated
+}
+
+// ProfileKey returns the blob storage key of a profile picture uploaded
+// before resized variants were generated
+func ProfileKey(profile string) string {
+	return "profile/" + profile
+}
+
+// ProfileSizeKey returns the blob storage key of one resized profile picture variant
+func ProfileSizeKey(profile string, size int) string {
+	return fmt.Sprintf("profile/%s/%d.jpg", profile, size)
+}
+
+// UserService stores the users. Lookups of a missing user return ErrNotFound
+// and creating a user with an email already in use returns ErrDuplicate.
+type UserService interface {
+	CreateUser(ctx context.Context, user dto.RegisterCredentials) (*User, error)
+	FindUser(ctx context.Context, email string) (*User, error)
+	FindById(ctx context.Context, id string) (*User, error)
+	UserExists(ctx context.Context, email string) (bool, error)
+	ActivateUser(ctx context.Context, email, code, password string) (*User, error)
+	UpdateActivationCode(ctx context.Context, email string) (*User, error)
+	UpdatePassword(ctx context.Context, id string, password string) error
+	UpdateProfile(ctx context.Context, id string, profile string, sizes []int) error
+	UpdateDetail(ctx context.Context, userId, firstname, lastname string) error
+	UpdateAdmin(ctx context.Context, id string, admin bool) error
+	// ProvisionUser creates the user of a tenant, already activated when
+	// user.Active
+	ProvisionUser(ctx context.Context, user ProvisionedUser) (*User, error)
+	// UpdateProvisionedUser replaces the details of a user, deactivating it
+	// renews its activation code so that the links already sent stop working
+	UpdateProvisionedUser(ctx context.Context, id string, user ProvisionedUser) (*User, error)
+	// ListUsers returns a page of the users matching filter, oldest first,
+	// and how many match in all
+	ListUsers(ctx context.Context, filter UserFilter) ([]User, int64, error)
+	// RemoveUser removes a user, the callers revoke its refresh tokens first:
+	// only the SQL databases remove what refers to the user along
+	RemoveUser(ctx context.Context, id string) error
+}
+
+// ProvisionedUser is a user as the identity provider of a tenant describes it
+type ProvisionedUser struct {
+	TenantId  string
+	Email     string
+	Firstname string
+	Lastname  string
+	Active    bool
+	// Password is empty unless the identity provider sets one, the users
+	// created without one choose theirs with the forgot password email
+	Password string
+}
+
+// UserFilter selects the users of ListUsers, its empty fields match every user
+type UserFilter struct {
+	TenantId string
+	Email    string
+	Offset   int
+	// Limit is the most users returned, with 0 only the count is
+	Limit int
+}
+
+// newUser builds a not yet activated user from the registration form
+func newUser(id string, credentials dto.RegisterCredentials) (*User, error) {
+	password, err := hashPassword(*credentials.Password)
+	if err != nil {
+		return nil, err
+	}
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return &User{
+		ID:             id,
+		Email:          credentials.Email,
+		Password:       &password,
+		Firstname:      credentials.Firstname,
+		Lastname:       credentials.Lastname,
+		ActivationCode: uuid.NewString(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}, nil
+}
+
+// newProvisionedUser builds the user of a tenant, with a random password
+// nobody knows unless the identity provider sent one
+func newProvisionedUser(id string, provisioned ProvisionedUser) (*User, error) {
+	password := provisioned.Password
+	if password == "" {
+		password = uuid.NewString()
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return &User{
+		ID:             id,
+		Email:          &provisioned.Email,
+		Password:       &hash,
+		Firstname:      &provisioned.Firstname,
+		Lastname:       &provisioned.Lastname,
+		ActivationCode: uuid.NewString(),
+		Activated:      provisioned.Active,
+		TenantId:       provisioned.TenantId,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}, nil
+}
+
+func hashPassword(password string) (string, error) {
+	passwordArr, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return "", err
+	}
+	return string(passwordArr[:]), nil
+}
+
+// userDocument is how a user is stored in MongoDB
+type userDocument struct {
 	ID             primitive.ObjectID `bson:"_id,omitempty"`
 	Email          *string            `bson:"email,omitempty"`
 	Password       *string            `bson:"password,omitempty"`
 	Firstname      *string            `bson:"firstname,omitempty"`
 	Lastname       *string            `bson:"lastname,omitempty"`
-	ActivationCode string             `bson:"actovationCode,omitempty"`
+	ActivationCode string             `bson:"activationCode,omitempty"`
 	Activated      bool               `bson:"activated,omitempty"`
+	Admin          bool               `bson:"admin,omitempty"`
 	Profile        string             `bson:"profile,omitempty"`
+	ProfileSizes   []int              `bson:"profileSizes,omitempty"`
+	TenantId       string             `bson:"tenantId,omitempty"`
 	CreatedAt      time.Time          `bson:"createdAt,omitempty"`
 	UpdatedAt      time.Time          `bson:"updatedAt,omitempty"`
 }
 
-type UserService interface {
-	CreateUser(user dto.RegisterCredentials) (*User, error)
-	FindUser(email string) (*User, error)
-	FindById(id string) (*User, error)
-	UserExists(email string) (bool, error)
-	ActivateUser(email, code, password string) (*User, error)
-	UpdateActivationCode(email string) (*User, error)
-	UpdatePassword(id primitive.ObjectID, password string) error
-	UpdateProfile(id primitive.ObjectID, profile string) error
-	UpdateDetail(userId, firstname, lastname string) error
+func (document *userDocument) user() *User {
+	return &User{
+		ID:             document.ID.Hex(),
+		Email:          document.Email,
+		Password:       document.Password,
+		Firstname:      document.Firstname,
+		Lastname:       document.Lastname,
+		ActivationCode: document.ActivationCode,
+		Activated:      document.Activated,
+		Admin:          document.Admin,
+		Profile:        document.Profile,
+		ProfileSizes:   document.ProfileSizes,
+		TenantId:       document.TenantId,
+		CreatedAt:      document.CreatedAt,
+		UpdatedAt:      document.UpdatedAt,
+	}
 }
+
 type userService struct {
 	collection *mongo.Collection
+	timeout    time.Duration
 }
 
+// NewUserService expects the indexes of the "user" collection, which the
+// Mongo migrations create
 func NewUserService(client *mongo.Client, configs *providers.Config) UserService {
 	return &userService{
 		collection: OpenCollection(client, "user", configs.DatabaseName),
+		timeout:    configs.DbTimeout,
 	}
 }
 
-func (service *userService) CreateUser(dto dto.RegisterCredentials) (*User, error) {
-	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-	defer cancel()
-
+func (service *userService) CreateUser(ctx context.Context, dto dto.RegisterCredentials) (*User, error) {
 	ID := primitive.NewObjectID()
-	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	passwordArr, err := bcrypt.GenerateFromPassword([]byte(*dto.Password), 10)
+	user, err := newUser(ID.Hex(), dto)
 	if err != nil {
 		return nil, err
 	}
-	password := string(passwordArr[:])
-	user := User{
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	document := userDocument{
 		ID:             ID,
-		Email:          dto.Email,
-		Password:       &password,
-		Firstname:      dto.Firstname,
-		Lastname:       dto.Lastname,
-		ActivationCode: uuid.NewString(),
-		CreatedAt:      now,
-		UpdatedAt:      now,
+		Email:          user.Email,
+		Password:       user.Password,
+		Firstname:      user.Firstname,
+		Lastname:       user.Lastname,
+		ActivationCode: user.ActivationCode,
+		CreatedAt:      user.CreatedAt,
+		UpdatedAt:      user.UpdatedAt,
 	}
-
-	_, err = service.collection.InsertOne(ctx, user)
+	_, err = service.collection.InsertOne(ctx, document)
 	if err != nil {
-		return nil, err
+		return nil, mongoError(err)
 	}
-	return &user, nil
+	return user, nil
 }
 
-func (service *userService) FindById(id string) (*User, error) {
+func (service *userService) FindById(ctx context.Context, id string) (*User, error) {
 	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
 	defer cancel()
 
-	var user User
-
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid id")
-	}
-	filter := bson.M{"_id": objectId}
-	err = service.collection.FindOne(ctx, filter).Decode(&user)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
-		return nil, err
+		return nil, ErrNotFound
 	}
-	return &user, nil
+	return service.findOne(ctx, bson.M{"_id": objectId})
 }
 
-func (service *userService) FindUser(email string) (*User, error) {
+func (service *userService) FindUser(ctx context.Context, email string) (*User, error) {
 	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
 	defer cancel()
 
-	var user User
-	filter := bson.M{"email": email}
-	err := service.collection.FindOne(ctx, filter).Decode(&user)
+	return service.findOne(ctx, bson.M{"email": email})
+}
+
+func (service *userService) findOne(ctx context.Context, filter bson.M) (*User, error) {
+	var document userDocument
+	err := service.collection.FindOne(ctx, filter).Decode(&document)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
-		return nil, err
+		return nil, mongoError(err)
 	}
-	return &user, nil
+	return document.user(), nil
 }
 
-func (service *userService) ActivateUser(email, code, password string) (*User, error) {
-	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-	defer cancel()
-
-	var user User
-	filter := bson.M{"email": email, "actovationCode": code}
+func (service *userService) ActivateUser(ctx context.Context, email, code, password string) (*User, error) {
 	updateSetter := bson.M{"activated": true}
 	if password != "" {
-		passwordArr, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+		hash, err := hashPassword(password)
 		if err != nil {
 			return nil, err
 		}
-		updateSetter["password"] = string(passwordArr[:])
+		updateSetter["password"] = hash
 	}
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var document userDocument
+	filter := bson.M{"email": email, "activationCode": code}
 	update := bson.M{"$set": updateSetter}
-	err := service.collection.FindOneAndUpdate(ctx, filter, update).Decode(&user)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := service.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&document)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
-		return nil, err
+		return nil, mongoError(err)
 	}
-	return &user, nil
+	return document.user(), nil
 }
 
-func (service *userService) UpdatePassword(id primitive.ObjectID, password string) error {
+func (service *userService) UpdatePassword(ctx context.Context, id string, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return service.updateOne(ctx, id, bson.M{"password": hash})
+}
+
+func (service *userService) UpdateProfile(ctx context.Context, id string, profile string, sizes []int) error {
+	return service.updateOne(ctx, id, bson.M{"profile": profile, "profileSizes": sizes})
+}
+
+func (service *userService) UpdateDetail(ctx context.Context, userId, firstname, lastname string) error {
+	return service.updateOne(ctx, userId, bson.M{
+		"firstname": firstname,
+		"lastname":  lastname,
+	})
+}
+
+func (service *userService) UpdateAdmin(ctx context.Context, id string, admin bool) error {
+	return service.updateOne(ctx, id, bson.M{"admin": admin})
+}
+
+// updateOne sets fields on the user with the given id
+func (service *userService) updateOne(ctx context.Context, id string, fields bson.M) error {
 	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
 	defer cancel()
 
-	filter := bson.M{"_id": id}
-
-	passwordArr, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return err
+		return ErrNotFound
 	}
-	update := bson.M{"$set": bson.M{"password": string(passwordArr[:])}}
+	filter := bson.M{"_id": objectId}
+
+	update := bson.M{"$set": fields}
 	res, err := service.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return err
+		return mongoError(err)
 	}
 	if res.MatchedCount != 1 {
-		return errors.New("user not found")
+		return ErrNotFound
 	}
 	return nil
 }
 
-func (service *userService) UpdateProfile(id primitive.ObjectID, profile string) error {
+func (service *userService) UpdateActivationCode(ctx context.Context, email string) (*User, error) {
 	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
 	defer cancel()
 
-	filter := bson.M{"_id": id}
-
-	update := bson.M{"$set": bson.M{"profile": profile}}
-	res, err := service.collection.UpdateOne(ctx, filter, update)
+	var document userDocument
+	filter := bson.M{"email": email}
+	update := bson.M{"$set": bson.M{"activationCode": uuid.NewString()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := service.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&document)
 	if err != nil {
-		return err
+		return nil, mongoError(err)
 	}
-	if res.MatchedCount != 1 {
-		return errors.New("user not found")
+	return document.user(), nil
+}
+
+func (service *userService) UserExists(ctx context.Context, email string) (bool, error) {
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	filter := bson.M{"email": email}
+	count, err := service.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return false, mongoError(err)
 	}
-	return nil
+	return count > 0, nil
 }
 
-func (service *userService) UpdateDetail(userId, firstname, lastname string) error {
+func (service *userService) ProvisionUser(ctx context.Context, provisioned ProvisionedUser) (*User, error) {
+	ID := primitive.NewObjectID()
+	user, err := newProvisionedUser(ID.Hex(), provisioned)
+	if err != nil {
+		return nil, err
+	}
+
 	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
 	defer cancel()
 
-	objectId, err := primitive.ObjectIDFromHex(userId)
+	document := userDocument{
+		ID:             ID,
+		Email:          user.Email,
+		Password:       user.Password,
+		Firstname:      user.Firstname,
+		Lastname:       user.Lastname,
+		ActivationCode: user.ActivationCode,
+		Activated:      user.Activated,
+		TenantId:       user.TenantId,
+		CreatedAt:      user.CreatedAt,
+		UpdatedAt:      user.UpdatedAt,
+	}
+	_, err = service.collection.InsertOne(ctx, document)
 	if err != nil {
-		return fmt.Errorf("invalid id")
+		return nil, mongoError(err)
 	}
-	filter := bson.M{"_id": objectId}
+	return user, nil
+}
 
-	update := bson.M{"$set": bson.M{
-		"firstname": firstname,
-		"lastname":  lastname,
-	}}
-	res, err := service.collection.UpdateOne(ctx, filter, update)
+func (service *userService) UpdateProvisionedUser(ctx context.Context, id string, provisioned ProvisionedUser) (*User, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateSetter := bson.M{
+		"email":     provisioned.Email,
+		"firstname": provisioned.Firstname,
+		"lastname":  provisioned.Lastname,
+		"activated": provisioned.Active,
+		"updatedAt": now,
+	}
+	if !provisioned.Active {
+		updateSetter["activationCode"] = uuid.NewString()
+	}
+	if provisioned.Password != "" {
+		hash, err := hashPassword(provisioned.Password)
+		if err != nil {
+			return nil, err
+		}
+		updateSetter["password"] = hash
+	}
+
+	//this is used to determine how long the API call should last
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return err
+		return nil, ErrNotFound
 	}
-	if res.MatchedCount != 1 {
-		return errors.New("user not found")
+	var document userDocument
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = service.collection.FindOneAndUpdate(ctx, bson.M{"_id": objectId}, bson.M{"$set": updateSetter}, opts).Decode(&document)
+	if err != nil {
+		return nil, mongoError(err)
 	}
-	return nil
+	return document.user(), nil
 }
 
-func (service *userService) UpdateActivationCode(email string) (*User, error) {
+func (service *userService) ListUsers(ctx context.Context, filter UserFilter) ([]User, int64, error) {
 	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
 	defer cancel()
 
-	actovationCode := uuid.NewString()
+	query := bson.M{}
+	if filter.TenantId != "" {
+		query["tenantId"] = filter.TenantId
+	}
+	if filter.Email != "" {
+		query["email"] = filter.Email
+	}
+	total, err := service.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, mongoError(err)
+	}
+	users := []User{}
+	// a limit of 0 means none to MongoDB
+	if filter.Limit == 0 {
+		return users, total, nil
+	}
 
-	var user User
-	filter := bson.M{"email": email}
-	update := bson.M{"$set": bson.M{"actovationCode": actovationCode}}
-	err := service.collection.FindOneAndUpdate(ctx, filter, update).Decode(&user)
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(filter.Offset)).
+		SetLimit(int64(filter.Limit))
+	cursor, err := service.collection.Find(ctx, query, opts)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
-		return nil, err
+		return nil, 0, mongoError(err)
+	}
+	var documents []userDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, 0, mongoError(err)
+	}
+	for i := range documents {
+		users = append(users, *documents[i].user())
 	}
-	user.ActivationCode = actovationCode
-	return &user, nil
+	return users, total, nil
 }
 
-func (service *userService) UserExists(email string) (bool, error) {
+func (service *userService) RemoveUser(ctx context.Context, id string) error {
 	//this is used to determine how long the API call should last
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
 	defer cancel()
 
-	filter := bson.M{"email": email}
-	count, err := service.collection.CountDocuments(ctx, filter)
+	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return false, nil
-		}
-		return false, err
+		return ErrNotFound
 	}
-	return count > 0, nil
+	res, err := service.collection.DeleteOne(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return mongoError(err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
@@ -0,0 +1,6 @@
+package dto
+
+type DecideDevice struct {
+	UserCode string `json:"userCode" validate:"required,max=20"`
+	Action   string `json:"action" validate:"required,oneof=allow deny"`
+}
@@ -14,6 +14,8 @@ const UserExists = "UserExists"
 const TokenExpired = "TokenExpired"
 const TokenNotFound = "TokenNotFound"
 const IncorrectOldPassword = "IncorrectOldPassword"
+const InvalidImage = "InvalidImage"
+const ImageTooLarge = "ImageTooLarge"
 
 func JsonResponse(c *gin.Context, data interface{}) {
 	if data != nil {
@@ -27,16 +29,3 @@ func JsonResponse(c *gin.Context, data interface{}) {
 		})
 	}
 }
-
-func ErrorResponse(c *gin.Context, httpStatus int, err string) {
-	if err == "" {
-		c.AbortWithStatusJSON(httpStatus, gin.H{
-			"status": "Failed",
-		})
-	} else {
-		c.AbortWithStatusJSON(httpStatus, gin.H{
-			"status": "Failed",
-			"error":  err,
-		})
-	}
-}
@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the multipart parts kept in memory, the rest goes to temporary files like gin does
+const defaultMultipartMemory = 32 << 20
+
+// Bind decodes the JSON body of the request into a T and validates it. Unknown
+// fields and trailing data are rejected, the size is bounded by the routes
+// with BodyLimitMiddleware. Form-urlencoded and multipart bodies are accepted
+// too, their fields are named like the JSON ones and decoded as JSON strings,
+// so a T bound from forms must only have string fields. On failure it
+// responds and returns false:
+//
+//	dto, ok := lib.Bind[dto.LoginCredentials](c)
+//	if !ok {
+//		return
+//	}
+func Bind[T any](c *gin.Context) (*T, bool) {
+	value := new(T)
+	if err := decodeBody(c, value); err != nil {
+		AbortWithError(c, err)
+		return nil, false
+	}
+	if err := Validate(value); err != nil {
+		AbortWithError(c, RequestError(err))
+		return nil, false
+	}
+	return value, true
+}
+
+func decodeBody(c *gin.Context, value interface{}) error {
+	form, err := ParseForm(c)
+	if err != nil {
+		return err
+	}
+	if !form {
+		return decodeJSON(c.Request.Body, value)
+	}
+
+	// the same rules as a JSON body, every field holds a string
+	fields := map[string]string{}
+	for name := range c.Request.PostForm {
+		fields[name] = c.Request.PostForm.Get(name)
+	}
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return decodeJSON(bytes.NewReader(body), value)
+}
+
+// ParseForm parses a form-urlencoded or multipart body into
+// c.Request.PostForm. It reports whether the body is a form, JSON bodies and
+// requests without a Content-Type are left to read.
+func ParseForm(c *gin.Context) (bool, error) {
+	contentType := c.GetHeader("Content-Type")
+	if contentType == "" {
+		return false, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false, ErrUnsupportedMediaType
+	}
+	switch mediaType {
+	case gin.MIMEJSON:
+		return false, nil
+	case gin.MIMEPOSTForm:
+		err = c.Request.ParseForm()
+	case gin.MIMEMultipartPOSTForm:
+		err = c.Request.ParseMultipartForm(defaultMultipartMemory)
+	default:
+		return false, ErrUnsupportedMediaType
+	}
+	if err != nil {
+		return false, RequestError(err)
+	}
+	return true, nil
+}
+
+func decodeJSON(reader io.Reader, value interface{}) error {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return RequestError(err)
+	}
+	// a single object, {"email":"..."}{"email":"..."} is not a request
+	if err := decoder.Decode(&json.RawMessage{}); !errors.Is(err, io.EOF) {
+		if err == nil {
+			return NewError(http.StatusBadRequest, InvalidRequest, "The request body must hold a single JSON value")
+		}
+		return RequestError(err)
+	}
+	return nil
+}
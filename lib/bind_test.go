@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type testCredentials struct {
+	Email    *string `json:"email" validate:"required,emailaddress"`
+	Password *string `json:"password" validate:"required,password"`
+}
+
+// bind runs Bind on a request, returning what it bound and the response
+func bind(request *http.Request) (*testCredentials, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = request
+	value, _ := Bind[testCredentials](c)
+	return value, recorder
+}
+
+func jsonRequest(body string) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	return request
+}
+
+// responseError decodes the error envelope of a failed response
+func responseError(t *testing.T, recorder *httptest.ResponseRecorder) errorBody {
+	t.Helper()
+	var body errorBody
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%v: %s", err, recorder.Body)
+	}
+	return body
+}
+
+type errorBody struct {
+	Error   string       `json:"error"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields"`
+}
+
+func TestBindJSON(t *testing.T) {
+	value, recorder := bind(jsonRequest(`{"email":"ada@example.com","password":"Secret123"}`))
+	if value == nil || *value.Email != "ada@example.com" || *value.Password != "Secret123" {
+		t.Fatalf("got %+v: %s", value, recorder.Body)
+	}
+
+	// without a Content-Type the body is read as JSON
+	request := jsonRequest(`{"email":"ada@example.com","password":"Secret123"}`)
+	request.Header.Del("Content-Type")
+	if value, recorder := bind(request); value == nil {
+		t.Fatalf("without Content-Type: %s", recorder.Body)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		body, contentType string
+		status            int
+		message, field    string
+	}{
+		"empty body":     {"", "application/json", http.StatusBadRequest, "The request body is empty", ""},
+		"invalid JSON":   {`{"email":`, "application/json", http.StatusBadRequest, "The request body is not valid JSON", ""},
+		"unknown field":  {`{"email":"ada@example.com","password":"Secret123","admin":true}`, "application/json", http.StatusBadRequest, "The request has invalid fields", "admin"},
+		"trailing value": {`{"email":"ada@example.com","password":"Secret123"}{}`, "application/json", http.StatusBadRequest, "The request body must hold a single JSON value", ""},
+		"trailing junk":  {`{"email":"ada@example.com","password":"Secret123"} x`, "application/json", http.StatusBadRequest, "The request body is not valid JSON", ""},
+		"wrong type":     {`{"email":1,"password":"Secret123"}`, "application/json", http.StatusBadRequest, "The request has invalid fields", "email"},
+		"invalid field":  {`{"email":"ada","password":"Secret123"}`, "application/json", http.StatusBadRequest, "The request has invalid fields", "email"},
+		"missing field":  {`{"email":"ada@example.com"}`, "application/json", http.StatusBadRequest, "The request has invalid fields", "password"},
+		"media type":     {`<credentials/>`, "application/xml", http.StatusUnsupportedMediaType, ErrUnsupportedMediaType.Message, ""},
+	} {
+		request := jsonRequest(test.body)
+		request.Header.Set("Content-Type", test.contentType)
+		value, recorder := bind(request)
+		if value != nil || recorder.Code != test.status {
+			t.Errorf("%s: got %d %s", name, recorder.Code, recorder.Body)
+			continue
+		}
+		body := responseError(t, recorder)
+		if body.Message != test.message {
+			t.Errorf("%s: got message %q, want %q", name, body.Message, test.message)
+		}
+		if test.field != "" && (len(body.Fields) != 1 || body.Fields[0].Field != test.field) {
+			t.Errorf("%s: got fields %+v, want %s", name, body.Fields, test.field)
+		}
+	}
+}
+
+func TestBindTooLarge(t *testing.T) {
+	// what BodyLimitMiddleware does to bodies of unknown length
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = jsonRequest(`{"email":"ada@example.com","password":"` + strings.Repeat("a", 100) + `1"}`)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 32)
+	if _, ok := Bind[testCredentials](c); ok || recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+	if body := responseError(t, recorder); body.Error != RequestTooLarge {
+		t.Fatalf("got %+v", body)
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("email=ada%40example.com&password=Secret123&password=ignored"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	value, recorder := bind(request)
+	if value == nil || *value.Email != "ada@example.com" || *value.Password != "Secret123" {
+		t.Fatalf("got %+v: %s", value, recorder.Body)
+	}
+
+	// the same rules as JSON
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("email=ada%40example.com&password=Secret123&admin=true"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if value, recorder := bind(request); value != nil || recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unknown form field: got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestBindMultipart(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("email", "ada@example.com")
+	writer.WriteField("password", "Secret123")
+	writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	value, recorder := bind(request)
+	if value == nil || *value.Email != "ada@example.com" || *value.Password != "Secret123" {
+		t.Fatalf("got %+v: %s", value, recorder.Body)
+	}
+
+	// a multipart Content-Type without its boundary
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("email=ada"))
+	request.Header.Set("Content-Type", "multipart/form-data")
+	if value, recorder := bind(request); value != nil || recorder.Code != http.StatusBadRequest {
+		t.Fatalf("without boundary: got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	if err := RequestError(&http.MaxBytesError{Limit: 10}); err != ErrRequestTooLarge {
+		t.Errorf("MaxBytesError: got %v", err)
+	}
+	// the internals of the decoder are not shown
+	err := RequestError(errors.New("multipart: NextPart: bufio: buffer full"))
+	if err.Status != http.StatusBadRequest || strings.Contains(err.Message, "bufio") {
+		t.Errorf("unknown error: got %+v", err)
+	}
+}
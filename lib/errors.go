@@ -0,0 +1,265 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+const InvalidRequest = "InvalidRequest"
+const InvalidParameter = "InvalidParameter"
+const InvalidAuthKey = "InvalidAuthKey"
+const InvalidToken = "InvalidToken"
+const UserRequired = "UserRequired"
+const FirstPartyTokenRequired = "FirstPartyTokenRequired"
+const UserDeactivated = "UserDeactivated"
+const RecaptchaFailed = "RecaptchaFailed"
+const RequestTooLarge = "RequestTooLarge"
+const CSRFCheckFailed = "CSRFCheckFailed"
+const UnsupportedMediaType = "UnsupportedMediaType"
+const UnsupportedTusVersion = "UnsupportedTusVersion"
+const UploadNotFound = "UploadNotFound"
+const UploadOffsetConflict = "UploadOffsetConflict"
+const AvatarNotFound = "AvatarNotFound"
+const InternalError = "InternalError"
+
+const ProblemContentType = "application/problem+json"
+
+// Error is an error response of the API. Code is stable and meant for
+// programs, Message is meant for people and may change. Err is the cause,
+// it is logged with the request and never sent to the client.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// FieldError is a field of the request which failed validation, Code is the
+// failed rule such as required or min
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func NewError(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (err *Error) Error() string {
+	if err.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", err.Code, err.Message, err.Err)
+	}
+	return err.Code + ": " + err.Message
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// Wrap returns a copy of err caused by cause
+func (err *Error) Wrap(cause error) *Error {
+	wrapped := *err
+	wrapped.Err = cause
+	return &wrapped
+}
+
+var (
+	ErrIncorrectUserNameOrPassword = NewError(http.StatusUnprocessableEntity, IncorrectUserNameOrPassword, "The email or password is incorrect")
+	ErrUserNotVerified             = NewError(http.StatusUnprocessableEntity, UserNotVerified, "The email address has not been verified yet")
+	ErrUserNotFound                = NewError(http.StatusUnprocessableEntity, UserNotFound, "No user has this email address")
+	ErrUserAlreadyActivated        = NewError(http.StatusUnprocessableEntity, UserAlreadyActivated, "The user is already activated")
+	ErrUserExists                  = NewError(http.StatusUnprocessableEntity, UserExists, "A user with this email address already exists")
+	ErrTokenExpired                = NewError(http.StatusUnprocessableEntity, TokenExpired, "The code is incorrect or has expired")
+	ErrTokenNotFound               = NewError(http.StatusUnprocessableEntity, TokenNotFound, "The refresh token does not exist or has been revoked")
+	ErrIncorrectOldPassword        = NewError(http.StatusUnprocessableEntity, IncorrectOldPassword, "The current password is incorrect")
+	ErrInvalidImage                = NewError(http.StatusUnprocessableEntity, InvalidImage, "The file is not a supported image")
+	ErrImageTooLarge               = NewError(http.StatusRequestEntityTooLarge, ImageTooLarge, "The image is too large")
+	ErrInvalidAuthKey              = NewError(http.StatusUnauthorized, InvalidAuthKey, "Invalid auth key or secret")
+	ErrInvalidToken                = NewError(http.StatusUnauthorized, InvalidToken, "The access token is invalid or has expired")
+	ErrUserRequired                = NewError(http.StatusForbidden, UserRequired, "The access token of a service account cannot be used on behalf of a user")
+	ErrFirstPartyTokenRequired     = NewError(http.StatusForbidden, FirstPartyTokenRequired, "The access token of a registered client only gives access to what its user consented to")
+	ErrUserDeactivated             = NewError(http.StatusForbidden, UserDeactivated, "The account was deactivated by the identity provider of its organization")
+	ErrRecaptchaFailed             = NewError(http.StatusUnauthorized, RecaptchaFailed, "The reCAPTCHA check failed")
+	ErrRequestTooLarge             = NewError(http.StatusRequestEntityTooLarge, RequestTooLarge, "The request body is too large")
+	ErrUnsupportedMediaType        = NewError(http.StatusUnsupportedMediaType, UnsupportedMediaType, "The request body must be JSON or a form")
+	ErrUnsupportedTusVersion       = NewError(http.StatusPreconditionFailed, UnsupportedTusVersion, "The Tus-Resumable version is not supported, see Tus-Version")
+	ErrUploadNotFound              = NewError(http.StatusNotFound, UploadNotFound, "The upload does not exist or has expired")
+	ErrUploadOffsetConflict        = NewError(http.StatusConflict, UploadOffsetConflict, "The Upload-Offset does not match the bytes received so far")
+	ErrAvatarNotFound              = NewError(http.StatusNotFound, AvatarNotFound, "No avatar exists for this file")
+	ErrCSRF                        = NewError(http.StatusForbidden, CSRFCheckFailed, "The X-CSRF-Token header or the Origin of the request is wrong")
+	ErrInternal                    = NewError(http.StatusInternalServerError, InternalError, "An unexpected error occurred, quote the request id when reporting it")
+)
+
+// RequestError describes why binding or validating the request failed,
+// without the internals of the decoder
+func RequestError(err error) *Error {
+	var validationErrors validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return ErrRequestTooLarge
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no type for it, the field is quoted in the message
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		invalid := NewError(http.StatusBadRequest, InvalidRequest, "The request has invalid fields")
+		invalid.Fields = []FieldError{{Field: field, Code: "unknown", Message: "is not a known field"}}
+		return invalid
+	case errors.As(err, &validationErrors):
+		invalid := NewError(http.StatusBadRequest, InvalidRequest, "The request has invalid fields")
+		for _, fieldErr := range validationErrors {
+			invalid.Fields = append(invalid.Fields, FieldError{
+				Field:   fieldPath(fieldErr),
+				Code:    fieldErr.Tag(),
+				Message: fieldMessage(fieldErr),
+			})
+		}
+		return invalid
+	case errors.As(err, &typeErr):
+		invalid := NewError(http.StatusBadRequest, InvalidRequest, "The request has invalid fields")
+		invalid.Fields = []FieldError{{Field: typeErr.Field, Code: "type", Message: "must be " + jsonType(typeErr.Type)}}
+		return invalid
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return NewError(http.StatusBadRequest, InvalidRequest, "The request body is not valid JSON")
+	case errors.Is(err, io.EOF):
+		return NewError(http.StatusBadRequest, InvalidRequest, "The request body is empty")
+	default:
+		return NewError(http.StatusBadRequest, InvalidRequest, "The request could not be read")
+	}
+}
+
+// fieldPath drops the struct name from the namespace, User.address.city
+// becomes address.city
+func fieldPath(fieldErr validator.FieldError) string {
+	if _, path, found := strings.Cut(fieldErr.Namespace(), "."); found {
+		return path
+	}
+	return fieldErr.Field()
+}
+
+func fieldMessage(fieldErr validator.FieldError) string {
+	unit := ""
+	if fieldErr.Kind() == reflect.String {
+		unit = " characters"
+	}
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email", "emailaddress":
+		return "must be a valid email address"
+	case "password":
+		return fmt.Sprintf("must be %d to %d characters with a letter and a digit", PasswordMinLength, PasswordMaxLength)
+	case "personname":
+		return "must only contain letters, spaces, hyphens, apostrophes and periods"
+	case "min":
+		return "must be at least " + fieldErr.Param() + unit
+	case "max":
+		return "must be at most " + fieldErr.Param() + unit
+	case "len":
+		return "must be exactly " + fieldErr.Param() + unit
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fieldErr.Param()), ", ")
+	case "eqfield":
+		return "must match " + fieldErr.Param()
+	default:
+		return "failed the " + fieldErr.Tag() + " rule"
+	}
+}
+
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// problem is an RFC 7807 problem document with the code, request id and
+// invalid fields as extension members
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code,omitempty"`
+	RequestId string       `json:"requestId,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
+}
+
+// envelope is the failed response of AbortWithError, kept for the clients
+// which do not ask for problem documents
+type envelope struct {
+	Status    string       `json:"status"`
+	Error     string       `json:"error,omitempty"`
+	Message   string       `json:"message,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestId string       `json:"requestId,omitempty"`
+}
+
+// AbortWithError responds with err, as a problem document when the client
+// accepts application/problem+json and in the usual envelope otherwise.
+// Errors other than *Error are internal, they are logged with the request id
+// and the client only gets that id to quote.
+func AbortWithError(c *gin.Context, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = ErrInternal.Wrap(err)
+	}
+	if apiErr.Err != nil {
+		// logged by LoggerMiddleware along with the request
+		c.Error(apiErr.Err)
+	}
+	requestId := c.GetString("requestId")
+
+	if c.NegotiateFormat(gin.MIMEJSON, ProblemContentType) == ProblemContentType {
+		document := problem{
+			Type:      "about:blank",
+			Title:     http.StatusText(apiErr.Status),
+			Status:    apiErr.Status,
+			Detail:    apiErr.Message,
+			Instance:  c.Request.URL.Path,
+			Code:      apiErr.Code,
+			RequestId: requestId,
+			Fields:    apiErr.Fields,
+		}
+		if apiErr.Code != "" {
+			document.Type = "urn:problem-type:" + apiErr.Code
+		}
+		c.Header("Content-Type", ProblemContentType)
+		c.AbortWithStatusJSON(apiErr.Status, document)
+		return
+	}
+
+	c.AbortWithStatusJSON(apiErr.Status, envelope{
+		Status:    "Failed",
+		Error:     apiErr.Code,
+		Message:   apiErr.Message,
+		Fields:    apiErr.Fields,
+		RequestId: requestId,
+	})
+}
@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OAuth error codes of RFC 6749 sections 4.1.2.1 and 5.2, the revocation
+// extension, OpenID Connect and the device authorization grant
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthUnsupportedTokenType    = "unsupported_token_type"
+	OAuthAccessDenied            = "access_denied"
+	OAuthServerError             = "server_error"
+	OAuthLoginRequired           = "login_required"
+	OAuthConsentRequired         = "consent_required"
+	OAuthAuthorizationPending    = "authorization_pending"
+	OAuthSlowDown                = "slow_down"
+	OAuthExpiredToken            = "expired_token"
+)
+
+// oauthError is the error response of the /oauth endpoints, whose clients
+// expect the format of RFC 6749 rather than the envelope of the API
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuthError responds with an RFC 6749 error. invalid_client is sent with
+// 401 and a Basic challenge, as the client authenticated with HTTP Basic.
+func OAuthError(c *gin.Context, status int, code string, description string) {
+	if code == OAuthInvalidClient {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.AbortWithStatusJSON(status, oauthError{Error: code, ErrorDescription: description})
+}
+
+// OAuthInternalError logs err with the request and responds with server_error
+func OAuthInternalError(c *gin.Context, err error) {
+	// logged by LoggerMiddleware along with the request
+	c.Error(err)
+	OAuthError(c, http.StatusInternalServerError, OAuthServerError, "request "+c.GetString("requestId")+" failed")
+}
+
+// OAuthResponse responds with a successful OAuth document, which must not be
+// cached since it carries or describes tokens
+func OAuthResponse(c *gin.Context, data interface{}) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, data)
+}
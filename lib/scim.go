@@ -0,0 +1,59 @@
+package lib
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMContentType is the media type of the SCIM requests and responses
+const SCIMContentType = "application/scim+json"
+
+// SCIM error types of RFC 7644 section 3.12
+const (
+	SCIMInvalidFilter = "invalidFilter"
+	SCIMTooMany       = "tooMany"
+	SCIMUniqueness    = "uniqueness"
+	SCIMMutability    = "mutability"
+	SCIMInvalidSyntax = "invalidSyntax"
+	SCIMInvalidPath   = "invalidPath"
+	SCIMNoTarget      = "noTarget"
+	SCIMInvalidValue  = "invalidValue"
+)
+
+// SCIMErrorSchema is the schema of the SCIM error responses
+const SCIMErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+// scimError is the error response of the /scim endpoints, whose identity
+// providers expect the format of RFC 7644 rather than the envelope of the API
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// SCIMError responds with an RFC 7644 error, scimType may be empty
+func SCIMError(c *gin.Context, status int, scimType string, detail string) {
+	c.Header("Content-Type", SCIMContentType)
+	c.AbortWithStatusJSON(status, scimError{
+		Schemas:  []string{SCIMErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+// SCIMInternalError logs err with the request and responds with a 500
+func SCIMInternalError(c *gin.Context, err error) {
+	// logged by LoggerMiddleware along with the request
+	c.Error(err)
+	SCIMError(c, http.StatusInternalServerError, "", "request "+c.GetString("requestId")+" failed")
+}
+
+// SCIMResponse responds with a SCIM resource or list
+func SCIMResponse(c *gin.Context, status int, data interface{}) {
+	c.Header("Content-Type", SCIMContentType)
+	c.JSON(status, data)
+}
@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"net/mail"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// validate is shared by every request, it caches what it learns of the types
+var validate = NewValidator()
+
+// Validate checks value against its validate tags, including the rules below
+func Validate(value interface{}) error {
+	return validate.Struct(value)
+}
+
+// NewValidator returns a validator reporting fields by their json name, with
+// the emailaddress, password and personname rules
+func NewValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	validate.RegisterValidation("emailaddress", isEmailAddress)
+	validate.RegisterValidation("password", isPassword)
+	validate.RegisterValidation("personname", isPersonName)
+	return validate
+}
+
+// PasswordMinLength and PasswordMaxLength bound new passwords, bcrypt only
+// reads the first 72 bytes
+const PasswordMinLength = 8
+const PasswordMaxLength = 72
+
+// isEmailAddress accepts a bare address whose domain has a dot, the built in
+// email rule lets through addresses mail servers would not deliver to
+func isEmailAddress(field validator.FieldLevel) bool {
+	value := field.Field().String()
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value || address.Name != "" {
+		return false
+	}
+	local, domain, _ := strings.Cut(value, "@")
+	return len(local) <= 64 && len(value) <= 254 &&
+		strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
+
+// isPassword is the password policy: 8 to 72 bytes with a letter and a digit
+func isPassword(field validator.FieldLevel) bool {
+	value := field.Field().String()
+	if len(value) < PasswordMinLength || len(value) > PasswordMaxLength {
+		return false
+	}
+	hasLetter, hasDigit := false, false
+	for _, r := range value {
+		hasLetter = hasLetter || unicode.IsLetter(r)
+		hasDigit = hasDigit || unicode.IsDigit(r)
+	}
+	return hasLetter && hasDigit
+}
+
+// isPersonName accepts letters of any script separated by single spaces,
+// hyphens, apostrophes or periods
+func isPersonName(field validator.FieldLevel) bool {
+	value := field.Field().String()
+	if value == "" || value != strings.TrimSpace(value) {
+		return false
+	}
+	previous := ' '
+	for _, r := range value {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsMark(r):
+		case r == ' ' || r == '-' || r == '\'' || r == '’' || r == '.':
+			if r != '.' && !unicode.IsLetter(previous) && previous != '.' {
+				return false
+			}
+		default:
+			return false
+		}
+		previous = r
+	}
+	return true
+}
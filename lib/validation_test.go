@@ -0,0 +1,74 @@
+package lib
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestValidationRules(t *testing.T) {
+	type request struct {
+		Email    string `json:"email" validate:"omitempty,emailaddress"`
+		Password string `json:"password" validate:"omitempty,password"`
+		Name     string `json:"name" validate:"omitempty,personname"`
+	}
+	for name, test := range map[string]struct {
+		value request
+		field string
+	}{
+		"valid":                       {request{"ada@example.com", "Secret123", "Ada Lovelace"}, ""},
+		"subdomain":                   {request{Email: "ada.l+tag@mail.example.co.uk"}, ""},
+		"email without domain dot":    {request{Email: "ada@localhost"}, "email"},
+		"email with a display name":   {request{Email: "Ada <ada@example.com>"}, "email"},
+		"email with a trailing dot":   {request{Email: "ada@example.com."}, "email"},
+		"email with a long local":     {request{Email: strings.Repeat("a", 65) + "@example.com"}, "email"},
+		"email without at":            {request{Email: "example.com"}, "email"},
+		"password too short":          {request{Password: "Secre12"}, "password"},
+		"password too long":           {request{Password: strings.Repeat("a", 72) + "1"}, "password"},
+		"password without digit":      {request{Password: "SecretSecret"}, "password"},
+		"password without letter":     {request{Password: "12345678"}, "password"},
+		"password of other scripts":   {request{Password: "пароль123"}, ""},
+		"name with hyphen":            {request{Name: "Jean-Luc O'Brien"}, ""},
+		"name with initial":           {request{Name: "J. R. R. Tolkien"}, ""},
+		"name of other scripts":       {request{Name: "Zoë Łukasz 李"}, ""},
+		"name with digit":             {request{Name: "Ada 2"}, "name"},
+		"name with double space":      {request{Name: "Ada  Lovelace"}, "name"},
+		"name with leading space":     {request{Name: " Ada"}, "name"},
+		"name starting with a hyphen": {request{Name: "-Ada"}, "name"},
+		"name with markup":            {request{Name: "<b>Ada</b>"}, "name"},
+	} {
+		err := Validate(&test.value)
+		if test.field == "" {
+			if err != nil {
+				t.Errorf("%s: got %v", name, err)
+			}
+			continue
+		}
+		var validationErrors validator.ValidationErrors
+		if !errors.As(err, &validationErrors) || len(validationErrors) != 1 || validationErrors[0].Field() != test.field {
+			t.Errorf("%s: got %v, want an error on %s", name, err, test.field)
+		}
+	}
+}
+
+func TestValidationFieldErrors(t *testing.T) {
+	type address struct {
+		City string `json:"city" validate:"required"`
+	}
+	type request struct {
+		Name    string  `json:"name" validate:"required,max=3"`
+		Address address `json:"address"`
+	}
+	err := RequestError(Validate(&request{Name: "Ada Lovelace"}))
+	want := map[string]string{"name": "must be at most 3 characters", "address.city": "is required"}
+	if len(err.Fields) != len(want) {
+		t.Fatalf("got %+v", err.Fields)
+	}
+	for _, field := range err.Fields {
+		if want[field.Field] != field.Message {
+			t.Errorf("%s: got %q, want %q", field.Field, field.Message, want[field.Field])
+		}
+	}
+}
@@ -1,7 +1,38 @@
 package main
 
-import "GoApp/server"
+import (
+	"GoApp/providers"
+	"GoApp/server"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
 
 func main() {
-	server.Init()
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	printConfig := flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	flag.Parse()
+
+	configs, err := providers.LoadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		if err := providers.PrintConfig(os.Stdout, configs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := server.Run(configs, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, server.ErrUsage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
 }
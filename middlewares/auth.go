@@ -2,7 +2,6 @@ package middlewares
 
 import (
 	"GoApp/lib"
-	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,7 +11,7 @@ func AuthMiddleware(key string) gin.HandlerFunc {
 		reqKey := c.Request.Header.Get("X-Auth-Key")
 
 		if key != reqKey {
-			lib.ErrorResponse(c, http.StatusUnauthorized, "Invalid auth key or secret")
+			lib.AbortWithError(c, lib.ErrInvalidAuthKey)
 			return
 		}
 		c.Next()
@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"GoApp/lib"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyLimitMiddleware bounds the size of request bodies, reading past
+// maxBytes fails and lib.Bind responds with a 413
+func BodyLimitMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			lib.AbortWithError(c, lib.ErrRequestTooLarge)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"GoApp/lib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	type request struct {
+		Name string `json:"name"`
+	}
+	router := gin.New()
+	router.POST("/", BodyLimitMiddleware(32), func(c *gin.Context) {
+		if _, ok := lib.Bind[request](c); ok {
+			c.Status(http.StatusOK)
+		}
+	})
+
+	for name, test := range map[string]struct {
+		body   string
+		length int64
+		status int
+	}{
+		"within the limit":     {`{"name":"Ada"}`, 14, http.StatusOK},
+		"Content-Length over":  {`{"name":"` + strings.Repeat("a", 32) + `"}`, 43, http.StatusRequestEntityTooLarge},
+		"unknown length over":  {`{"name":"` + strings.Repeat("a", 32) + `"}`, -1, http.StatusRequestEntityTooLarge},
+		"unknown length under": {`{"name":"Ada"}`, -1, http.StatusOK},
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader(test.body)))
+		request.Header.Set("Content-Type", "application/json")
+		request.ContentLength = test.length
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != test.status {
+			t.Errorf("%s: got %d %s", name, recorder.Code, recorder.Body)
+		}
+	}
+}
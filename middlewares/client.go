@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"GoApp/db"
+	"GoApp/lib"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthenticateClient authenticates registered OAuth clients by HTTP Basic or
+// by the client_id and client_secret form parameters, RFC 6749 section 2.3.1.
+// With allowPublic, public clients identify themselves by client_id alone.
+// The client is set as "client" and its id as "clientId".
+func AuthenticateClient(clientService db.ClientService, allowPublic bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientId, secret, basic := c.Request.BasicAuth()
+		if basic {
+			// form-encoded before being put in the header
+			var err error
+			if clientId, err = url.QueryUnescape(clientId); err != nil {
+				lib.OAuthError(c, http.StatusUnauthorized, lib.OAuthInvalidClient, "malformed credentials")
+				return
+			}
+			if secret, err = url.QueryUnescape(secret); err != nil {
+				lib.OAuthError(c, http.StatusUnauthorized, lib.OAuthInvalidClient, "malformed credentials")
+				return
+			}
+		}
+		formId, formSecret := c.PostForm("client_id"), c.PostForm("client_secret")
+		if basic && formSecret != "" {
+			lib.OAuthError(c, http.StatusBadRequest, lib.OAuthInvalidRequest, "more than one client authentication method")
+			return
+		}
+		if !basic {
+			clientId, secret = formId, formSecret
+		}
+		if clientId == "" || (secret == "" && !allowPublic) {
+			lib.OAuthError(c, http.StatusUnauthorized, lib.OAuthInvalidClient, "client authentication required")
+			return
+		}
+
+		client, err := clientService.FindClient(c.Request.Context(), clientId)
+		if errors.Is(err, db.ErrNotFound) {
+			lib.OAuthError(c, http.StatusUnauthorized, lib.OAuthInvalidClient, "client authentication failed")
+			return
+		}
+		if err != nil {
+			lib.OAuthInternalError(c, err)
+			return
+		}
+		authenticated := client.CheckSecret(secret)
+		if client.Public() {
+			authenticated = allowPublic && secret == ""
+		}
+		if !authenticated {
+			lib.OAuthError(c, http.StatusUnauthorized, lib.OAuthInvalidClient, "client authentication failed")
+			return
+		}
+		c.Set("client", client)
+		c.Set("clientId", client.ClientId)
+		c.Next()
+	}
+}
@@ -1,49 +1,107 @@
 package middlewares
 
 import (
+	"GoApp/db"
 	"GoApp/lib"
 	"GoApp/providers"
-	"net/http"
+	"log/slog"
 	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-func AuthorizeJWT(jwtService providers.JWTService) gin.HandlerFunc {
+// AuthorizeJWT accepts the access token of the Authorization header or, for
+// cookie sessions, of the access token cookie along with a csrf check.
+// Tokens revoked through /oauth/revoke are refused until they expire, and so
+// are the tokens of the service accounts, which are not users. The tokens
+// issued to the registered clients are refused as well, they only give
+// access to what their user consented to.
+func AuthorizeJWT(jwtService providers.JWTService, sessionCookies providers.SessionCookieService, revokedTokenService db.RevokedTokenService) gin.HandlerFunc {
+	return authorizeUser(jwtService, sessionCookies, revokedTokenService, false)
+}
+
+// AuthorizeClientJWT only accepts the bearer access tokens issued to the
+// registered clients for their users, such as for /oauth/userinfo. The
+// client is set as "clientId" and the scope its user consented to as "scope".
+func AuthorizeClientJWT(jwtService providers.JWTService, revokedTokenService db.RevokedTokenService) gin.HandlerFunc {
+	return authorizeUser(jwtService, nil, revokedTokenService, true)
+}
+
+// authorizeUser reads the cookie sessions unless sessionCookies is nil
+func authorizeUser(jwtService providers.JWTService, sessionCookies providers.SessionCookieService, revokedTokenService db.RevokedTokenService, forClient bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		const BEARER_SCHEMA = "Bearer "
 		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			lib.ErrorResponse(c, http.StatusUnauthorized, "")
-			return
+		var tokenString string
+		switch {
+		case authHeader != "":
+			if isBearer := strings.HasPrefix(authHeader, BEARER_SCHEMA); !isBearer {
+				lib.AbortWithError(c, lib.ErrInvalidToken)
+				return
+			}
+			tokenString = authHeader[len(BEARER_SCHEMA):]
+		case sessionCookies != nil && sessionCookies.AccessToken(c) != "":
+			if err := sessionCookies.CheckCSRF(c); err != nil {
+				lib.AbortWithError(c, lib.ErrCSRF)
+				return
+			}
+			tokenString = sessionCookies.AccessToken(c)
 		}
-		if isBearer := strings.HasPrefix(authHeader, BEARER_SCHEMA); !isBearer {
-
-			lib.ErrorResponse(c, http.StatusUnauthorized, "")
-			return
-		}
-		tokenString := authHeader[len(BEARER_SCHEMA):]
 		if tokenString == "" {
-
-			lib.ErrorResponse(c, http.StatusUnauthorized, "")
+			lib.AbortWithError(c, lib.ErrInvalidToken)
 			return
 		}
 		token, err := jwtService.ValidateToken(tokenString)
 		if err != nil {
-			lib.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+			lib.AbortWithError(c, lib.ErrInvalidToken.Wrap(err))
+			return
 		}
 		if !token.Valid {
-
-			lib.ErrorResponse(c, http.StatusUnauthorized, "")
+			lib.AbortWithError(c, lib.ErrInvalidToken)
 			return
 		}
-		claims := token.Claims.(jwt.MapClaims)
-		if !(len(claims["sub"].(string)) > 0) {
-
-			lib.ErrorResponse(c, http.StatusUnauthorized, "")
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			lib.AbortWithError(c, lib.ErrInvalidToken)
+			return
+		}
+		// a token signed with our secret may still lack a sub
+		sub, _ := claims["sub"].(string)
+		if sub == "" {
+			lib.AbortWithError(c, lib.ErrInvalidToken)
 			return
 		}
-		c.Set("userId", claims["sub"])
+		if isUser, _ := claims["user"].(bool); !isUser {
+			lib.AbortWithError(c, lib.ErrUserRequired)
+			return
+		}
+		clientId, _ := claims["aud"].(string)
+		if clientId != "" && !forClient {
+			lib.AbortWithError(c, lib.ErrFirstPartyTokenRequired)
+			return
+		}
+		if clientId == "" && forClient {
+			lib.AbortWithError(c, lib.ErrInvalidToken)
+			return
+		}
+		if jti, ok := claims["jti"].(string); ok {
+			revoked, err := revokedTokenService.IsTokenRevoked(c.Request.Context(), jti)
+			if err != nil {
+				lib.AbortWithError(c, err)
+				return
+			}
+			if revoked {
+				lib.AbortWithError(c, lib.ErrInvalidToken)
+				return
+			}
+		}
+		c.Set("userId", sub)
+		if forClient {
+			scope, _ := claims["scope"].(string)
+			c.Set("clientId", clientId)
+			c.Set("scope", scope)
+		}
+		providers.WithLogAttrs(c.Request.Context(), slog.String("user_id", sub))
 	}
 }
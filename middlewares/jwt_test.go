@@ -0,0 +1,106 @@
+package middlewares
+
+import (
+	"GoApp/db"
+	"GoApp/lib"
+	"GoApp/providers"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+const testSecret = "secret"
+
+// signed signs claims with the secret of the service, as a token issued
+// before the key ids, or with another secret
+func signed(t *testing.T, claims jwt.MapClaims, secret string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAuthorizeJWT(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtService := providers.NewJWTService(&providers.Config{JwtSecret: testSecret, AppName: "GoApp"})
+	revokedTokenService := db.NewMemoryRevokedTokenService()
+	router := gin.New()
+	respond := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"userId": c.GetString("userId"), "clientId": c.GetString("clientId"), "scope": c.GetString("scope")})
+	}
+	router.GET("/user", AuthorizeJWT(jwtService, nil, revokedTokenService), respond)
+	router.GET("/userinfo", AuthorizeClientJWT(jwtService, revokedTokenService), respond)
+
+	expiry := time.Now().Add(time.Minute).Unix()
+	revoked := jwt.MapClaims{"sub": "user-id", "user": true, "exp": expiry, "jti": "revoked"}
+	if err := revokedTokenService.RevokeToken(context.Background(), "revoked", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	login := jwtService.GenerateToken("user-id", true, time.Minute)
+	client := jwtService.GenerateClientToken("user-id", "client-id", "openid email", time.Minute)
+
+	for name, test := range map[string]struct {
+		path, authorization string
+		status              int
+		code                string
+	}{
+		"login token":            {"/user", "Bearer " + login, http.StatusOK, ""},
+		"without kid":            {"/user", "Bearer " + signed(t, jwt.MapClaims{"sub": "user-id", "user": true, "exp": expiry}, testSecret), http.StatusOK, ""},
+		"no token":               {"/user", "", http.StatusUnauthorized, lib.InvalidToken},
+		"not bearer":             {"/user", "Basic " + login, http.StatusUnauthorized, lib.InvalidToken},
+		"garbage":                {"/user", "Bearer garbage", http.StatusUnauthorized, lib.InvalidToken},
+		"other secret":           {"/user", "Bearer " + signed(t, jwt.MapClaims{"sub": "user-id", "user": true, "exp": expiry}, "other"), http.StatusUnauthorized, lib.InvalidToken},
+		"expired":                {"/user", "Bearer " + jwtService.GenerateToken("user-id", true, -time.Minute), http.StatusUnauthorized, lib.InvalidToken},
+		"missing sub":            {"/user", "Bearer " + signed(t, jwt.MapClaims{"user": true, "exp": expiry}, testSecret), http.StatusUnauthorized, lib.InvalidToken},
+		"empty sub":              {"/user", "Bearer " + signed(t, jwt.MapClaims{"sub": "", "user": true, "exp": expiry}, testSecret), http.StatusUnauthorized, lib.InvalidToken},
+		"numeric sub":            {"/user", "Bearer " + signed(t, jwt.MapClaims{"sub": 42, "user": true, "exp": expiry}, testSecret), http.StatusUnauthorized, lib.InvalidToken},
+		"object sub":             {"/user", "Bearer " + signed(t, jwt.MapClaims{"sub": map[string]string{"id": "user-id"}, "user": true, "exp": expiry}, testSecret), http.StatusUnauthorized, lib.InvalidToken},
+		"revoked":                {"/user", "Bearer " + signed(t, revoked, testSecret), http.StatusUnauthorized, lib.InvalidToken},
+		"service token":          {"/user", "Bearer " + jwtService.GenerateServiceToken("client-id", []string{"users"}, time.Minute), http.StatusForbidden, lib.UserRequired},
+		"without user claim":     {"/user", "Bearer " + signed(t, jwt.MapClaims{"sub": "user-id", "exp": expiry}, testSecret), http.StatusForbidden, lib.UserRequired},
+		"client token":           {"/user", "Bearer " + client, http.StatusForbidden, lib.FirstPartyTokenRequired},
+		"userinfo client token":  {"/userinfo", "Bearer " + client, http.StatusOK, ""},
+		"userinfo login token":   {"/userinfo", "Bearer " + login, http.StatusUnauthorized, lib.InvalidToken},
+		"userinfo service token": {"/userinfo", "Bearer " + jwtService.GenerateServiceToken("client-id", []string{"users"}, time.Minute), http.StatusForbidden, lib.UserRequired},
+	} {
+		request := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.authorization != "" {
+			request.Header.Set("Authorization", test.authorization)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != test.status {
+			t.Errorf("%s: got %d %s", name, recorder.Code, recorder.Body)
+			continue
+		}
+		var body map[string]string
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if test.code != "" && body["error"] != test.code {
+			t.Errorf("%s: got %s, want %s", name, body["error"], test.code)
+		}
+		if test.code == "" && body["userId"] != "user-id" {
+			t.Errorf("%s: got %v", name, body)
+		}
+	}
+
+	// the client and the consented scope are known to userinfo
+	request := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	request.Header.Set("Authorization", "Bearer "+client)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	var body map[string]string
+	json.Unmarshal(recorder.Body.Bytes(), &body)
+	if body["clientId"] != "client-id" || body["scope"] != "openid email" {
+		t.Fatalf("got %v", body)
+	}
+}
@@ -0,0 +1,78 @@
+package middlewares
+
+import (
+	"GoApp/lib"
+	"GoApp/providers"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const RequestIdHeader = "X-Request-ID"
+
+// incoming request ids are reused only when they look harmless
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestIdMiddleware accepts the caller's X-Request-ID or generates one,
+// echoes it back and attaches it to every log record of the request
+func RequestIdMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(RequestIdHeader)
+		if !validRequestId.MatchString(requestId) {
+			requestId = uuid.NewString()
+		}
+		c.Set("requestId", requestId)
+		c.Header(RequestIdHeader, requestId)
+
+		ctx := providers.WithLogAttrs(c.Request.Context(), slog.String("request_id", requestId))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// LoggerMiddleware writes one structured log record per request
+func LoggerMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			// the route template rather than the path, which may hold tokens
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("size", c.Writer.Size()),
+		}
+		if clientId := c.GetString("clientId"); clientId != "" {
+			attrs = append(attrs, slog.String("client_id", clientId))
+		}
+		if errors := c.Errors.ByType(gin.ErrorTypePrivate).String(); errors != "" {
+			attrs = append(attrs, slog.String("errors", errors))
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// RecoveryMiddleware logs panics and responds with a 500
+func RecoveryMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err interface{}) {
+		logger.ErrorContext(c.Request.Context(), "panic recovered", slog.Any("error", err), slog.String("stack", string(debug.Stack())))
+		lib.AbortWithError(c, lib.ErrInternal)
+	})
+}
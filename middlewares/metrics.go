@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"GoApp/providers"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsMiddleware records request counts, latency and in-flight requests,
+// labelled by route template so path parameters don't explode cardinality
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+
+		inFlight := providers.HttpRequestsInFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		c.Next()
+
+		status := strconv.Itoa(c.Writer.Status())
+		providers.HttpRequestsTotal.WithLabelValues(method, route, status).Inc()
+		providers.HttpRequestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -2,84 +2,70 @@ package middlewares
 
 import (
 	"GoApp/lib"
+	"GoApp/providers"
+	"bytes"
 	"encoding/json"
-	"errors"
-	"net/http"
-	"time"
+	"io"
 
 	"github.com/gin-gonic/gin"
 )
 
-const siteVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
-
-type SiteVerifyResponse struct {
-	Success     bool      `json:"success"`
-	Score       float64   `json:"score"`
-	Action      string    `json:"action"`
-	ChallengeTS time.Time `json:"challenge_ts"`
-	Hostname    string    `json:"hostname"`
-	ErrorCodes  []string  `json:"error-codes"`
-}
-
 type SiteVerifyRequest struct {
 	RecaptchaResponse string `json:"g-recaptcha-response"`
 }
 
-func checkRecaptcha(secret, response, action string) error {
-	req, err := http.NewRequest(http.MethodPost, siteVerifyURL, nil)
+// takeRecaptchaResponse removes the g-recaptcha-response field from the JSON
+// or form body and returns it, the handler binds the rest of the body
+func takeRecaptchaResponse(c *gin.Context) (string, error) {
+	form, err := lib.ParseForm(c)
 	if err != nil {
-		return err
+		return "", err
 	}
-
-	// Add necessary request parameters.
-	q := req.URL.Query()
-	q.Add("secret", secret)
-	q.Add("response", response)
-	req.URL.RawQuery = q.Encode()
-
-	// Make request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	if form {
+		response := c.Request.PostForm.Get("g-recaptcha-response")
+		c.Request.PostForm.Del("g-recaptcha-response")
+		c.Request.Form.Del("g-recaptcha-response")
+		return response, nil
 	}
-	defer resp.Body.Close()
 
-	// Decode response.
-	var body SiteVerifyResponse
-	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
-		return err
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", lib.RequestError(err)
 	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
 
-	// Check recaptcha verification success.
-	if !body.Success {
-		return errors.New("unsuccessful recaptcha verify request")
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		// left for the handler to report
+		return "", nil
 	}
-
-	// Check response score.
-	if body.Score < 0.5 {
-		return errors.New("lower received score than expected")
+	var dto SiteVerifyRequest
+	if err := json.Unmarshal(body, &dto); err != nil {
+		return "", lib.RequestError(err)
 	}
-
-	// Check response action.
-	if action != "" && body.Action != action {
-		return errors.New("mismatched recaptcha action")
+	if _, found := fields["g-recaptcha-response"]; found {
+		delete(fields, "g-recaptcha-response")
+		if body, err = json.Marshal(fields); err != nil {
+			return "", lib.RequestError(err)
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
 	}
-
-	return nil
+	return dto.RecaptchaResponse, nil
 }
 
+// RecaptchaMiddleware checks the g-recaptcha-response of the body when a
+// secret is configured. The field is removed either way, forms always send it.
 func RecaptchaMiddleware(secret, action string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if secret != "" {
-			var dto SiteVerifyRequest
-
-			if err := c.ShouldBind(&dto); err != nil {
-				lib.ErrorResponse(c, http.StatusUnauthorized, "")
-				return
-			}
+		response, err := takeRecaptchaResponse(c)
+		if err != nil {
+			lib.AbortWithError(c, err)
+			return
+		}
 
-			if err := checkRecaptcha(secret, dto.RecaptchaResponse, action); err != nil {
-				lib.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+		if secret != "" {
+			if err := providers.CheckRecaptcha(c.Request.Context(), secret, response, action); err != nil {
+				lib.AbortWithError(c, lib.ErrRecaptchaFailed.Wrap(err))
 				return
 			}
 		}
@@ -0,0 +1,40 @@
+package middlewares
+
+import (
+	"GoApp/db"
+	"GoApp/lib"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthenticateTenant authenticates the identity providers of the SCIM
+// tenants by the bearer token of their tenant. The tenant is set as "tenant"
+// and its id as "tenantId".
+func AuthenticateTenant(tenantService db.TenantService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, token, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+		token = strings.TrimSpace(token)
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			lib.SCIMError(c, http.StatusUnauthorized, "", "bearer token required")
+			return
+		}
+
+		tenant, err := tenantService.FindTenantByToken(c.Request.Context(), token)
+		if errors.Is(err, db.ErrNotFound) {
+			c.Header("WWW-Authenticate", `Bearer realm="scim", error="invalid_token"`)
+			lib.SCIMError(c, http.StatusUnauthorized, "", "invalid bearer token")
+			return
+		}
+		if err != nil {
+			lib.SCIMInternalError(c, err)
+			return
+		}
+		c.Set("tenant", tenant)
+		c.Set("tenantId", tenant.TenantId)
+		c.Next()
+	}
+}
@@ -3,33 +3,60 @@ package models
 import (
 	"GoApp/db"
 	"GoApp/providers"
+	"context"
 	"fmt"
+	"strconv"
 	"time"
 )
 
 type User struct {
-	Id          string    `json:"id"`
-	Email       *string   `json:"email"`
-	DisplayName string    `json:"displayName"`
-	Firstname   *string   `json:"firstname"`
-	Lastname    *string   `json:"lastname"`
-	Profile     string    `json:"profile"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
+	Id          string            `json:"id"`
+	Email       *string           `json:"email"`
+	DisplayName string            `json:"displayName"`
+	Firstname   *string           `json:"firstname"`
+	Lastname    *string           `json:"lastname"`
+	Profile     string            `json:"profile"`
+	Profiles    map[string]string `json:"profiles,omitempty"`
+	Admin       bool              `json:"admin,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
 }
 
-func GetUser(user *db.User, config *providers.Config) *User {
+func GetUser(ctx context.Context, user *db.User, blobStore providers.BlobStore, config *providers.Config) (*User, error) {
 	_user := User{
-		Id:          user.ID.Hex(),
+		Id:          user.ID,
 		Email:       user.Email,
 		DisplayName: fmt.Sprintf("%s %s", *user.Firstname, *user.Lastname),
 		Firstname:   user.Firstname,
 		Lastname:    user.Lastname,
+		Admin:       user.Admin,
 		CreatedAt:   user.CreatedAt,
 		UpdatedAt:   user.UpdatedAt,
 	}
-	if user.Profile != "" {
-		_user.Profile = config.Domain + "/public/profile/" + user.Profile
+	if user.Profile != "" && len(user.ProfileSizes) == 0 {
+		profile, err := blobStore.URL(ctx, db.ProfileKey(user.Profile))
+		if err != nil {
+			return nil, err
+		}
+		_user.Profile = profile
 	}
-	return &_user
+	if len(user.ProfileSizes) > 0 {
+		_user.Profiles = map[string]string{}
+		largest := 0
+		for _, size := range user.ProfileSizes {
+			profile, err := blobStore.URL(ctx, db.ProfileSizeKey(user.Profile, size))
+			if err != nil {
+				return nil, err
+			}
+			_user.Profiles[strconv.Itoa(size)] = profile
+			if size > largest {
+				largest = size
+				_user.Profile = profile
+			}
+		}
+	}
+	if _user.Profile == "" {
+		_user.Profile = config.Domain + "/public/avatar/" + _user.Id + ".svg"
+	}
+	return &_user, nil
 }
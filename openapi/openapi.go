@@ -0,0 +1,285 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Route documents one route of the router. Bodies and responses are Go
+// values whose types are described from their json and validate tags, or
+// ready made *Schema values.
+type Route struct {
+	Method string
+	// Path in gin syntax, e.g. /v1/uploads/:uploadId
+	Path        string
+	Tag         string
+	Summary     string
+	Description string
+	// Security lists the security schemes the route requires, all of them
+	Security []string
+	// AlternativeSecurity are other sets of schemes accepted instead of Security
+	AlternativeSecurity [][]string
+	Parameters          []Parameter
+	// Request is the body, sent as RequestType, application/json by default
+	Request     interface{}
+	RequestType string
+	// Status is the success status, 200 by default
+	Status int
+	// Response is the data of the lib.JsonResponse envelope, nil when the
+	// envelope carries none. With a ResponseType the body is sent as is.
+	Response        interface{}
+	ResponseType    string
+	ResponseHeaders map[string]string
+	// Empty success responses have no body, like every 204
+	Empty bool
+	// Errors are the statuses answered with lib.AbortWithError
+	Errors []int
+	// OAuthErrors are the statuses answered with lib.OAuthError
+	OAuthErrors []int
+	// SCIMErrors are the statuses answered with lib.SCIMError
+	SCIMErrors []int
+	// Hidden routes are registered on purpose but left out of the document
+	Hidden bool
+}
+
+// Build generates the document of the routes
+func Build(info Info, servers []Server, tags []Tag, securitySchemes map[string]*SecurityScheme, routes []Route) *Document {
+	builder := newSchemaBuilder()
+	builder.components["FieldError"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"field":   {Type: "string", Description: "json path of the field, such as email"},
+			"code":    {Type: "string", Description: "the failed validation rule, such as required or min"},
+			"message": {Type: "string"},
+		},
+		Required: []string{"field", "code", "message"},
+	}
+	fields := &Schema{Type: "array", Items: &Schema{Ref: "#/components/schemas/FieldError"}, Description: "the invalid fields of the request"}
+	requestId := &Schema{Type: "string", Description: "the X-Request-ID of the request, to quote when reporting an error"}
+	builder.components["ErrorResponse"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"status":    {Type: "string", Const: "Failed"},
+			"error":     {Type: "string", Description: "a stable error code such as UserExists"},
+			"message":   {Type: "string", Description: "a human readable description, which may change"},
+			"fields":    fields,
+			"requestId": requestId,
+		},
+		Required: []string{"status"},
+	}
+	builder.components["Problem"] = &Schema{
+		Type:        "object",
+		Description: "an RFC 7807 problem document, sent instead of ErrorResponse when the request accepts application/problem+json",
+		Properties: map[string]*Schema{
+			"type":      {Type: "string", Format: "uri", Description: "urn:problem-type: followed by the code, or about:blank"},
+			"title":     {Type: "string"},
+			"status":    {Type: "integer", Format: "int32"},
+			"detail":    {Type: "string"},
+			"instance":  {Type: "string"},
+			"code":      {Type: "string", Description: "the same code as the error of ErrorResponse"},
+			"requestId": requestId,
+			"fields":    fields,
+		},
+		Required: []string{"type", "title", "status"},
+	}
+
+	builder.components["OAuthError"] = &Schema{
+		Type:        "object",
+		Description: "an RFC 6749 error, sent by the /oauth routes",
+		Properties: map[string]*Schema{
+			"error":             {Type: "string", Description: "an error code such as invalid_client"},
+			"error_description": {Type: "string"},
+		},
+		Required: []string{"error"},
+	}
+	builder.components["SCIMError"] = &Schema{
+		Type:        "object",
+		Description: "an RFC 7644 error, sent by the /scim routes as application/scim+json",
+		Properties: map[string]*Schema{
+			"schemas":  {Type: "array", Items: &Schema{Type: "string", Const: "urn:ietf:params:scim:api:messages:2.0:Error"}},
+			"status":   {Type: "string", Description: "the HTTP status, as a string"},
+			"scimType": {Type: "string", Description: "an error type such as uniqueness or invalidFilter"},
+			"detail":   {Type: "string"},
+		},
+		Required: []string{"schemas", "status"},
+	}
+
+	document := &Document{
+		OpenAPI: "3.1.0",
+		Info:    info,
+		Servers: servers,
+		Tags:    tags,
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas:         builder.components,
+			SecuritySchemes: securitySchemes,
+		},
+	}
+	for _, route := range routes {
+		if route.Hidden {
+			continue
+		}
+		path := openAPIPath(route.Path)
+		item, ok := document.Paths[path]
+		if !ok {
+			item = &PathItem{}
+			document.Paths[path] = item
+		}
+		(*item)[strings.ToLower(route.Method)] = builder.operation(route)
+	}
+	return document
+}
+
+func (builder *schemaBuilder) operation(route Route) *Operation {
+	operation := &Operation{
+		Summary:     route.Summary,
+		Description: route.Description,
+		OperationId: operationId(route.Method, route.Path),
+		Parameters:  route.Parameters,
+		Responses:   map[string]*Response{},
+	}
+	if route.Tag != "" {
+		operation.Tags = []string{route.Tag}
+	}
+	if len(route.Security) > 0 {
+		requirement := map[string][]string{}
+		for _, scheme := range route.Security {
+			requirement[scheme] = []string{}
+		}
+		operation.Security = []map[string][]string{requirement}
+	}
+	for _, alternative := range route.AlternativeSecurity {
+		requirement := map[string][]string{}
+		for _, scheme := range alternative {
+			requirement[scheme] = []string{}
+		}
+		operation.Security = append(operation.Security, requirement)
+	}
+
+	for _, segment := range strings.Split(route.Path, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			operation.Parameters = append(operation.Parameters, Parameter{
+				Name:     segment[1:],
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+
+	if route.Request != nil {
+		requestType := route.RequestType
+		if requestType == "" {
+			requestType = "application/json"
+		}
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{requestType: {Schema: builder.of(route.Request)}},
+		}
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := &Response{Description: http.StatusText(status)}
+	switch {
+	case route.ResponseType != "":
+		response.Content = map[string]*MediaType{route.ResponseType: {Schema: builder.of(route.Response)}}
+	case !route.Empty && status != http.StatusNoContent:
+		envelope := &Schema{
+			Type:       "object",
+			Properties: map[string]*Schema{"status": {Type: "string", Const: "Success"}},
+			Required:   []string{"status"},
+		}
+		if route.Response != nil {
+			envelope.Properties["data"] = builder.of(route.Response)
+			envelope.Required = append(envelope.Required, "data")
+		}
+		response.Content = map[string]*MediaType{"application/json": {Schema: envelope}}
+	}
+	if len(route.ResponseHeaders) > 0 {
+		response.Headers = map[string]*Header{}
+		for name, description := range route.ResponseHeaders {
+			response.Headers[name] = &Header{Description: description, Schema: &Schema{Type: "string"}}
+		}
+	}
+	operation.Responses[strconv.Itoa(status)] = response
+
+	for _, status := range route.Errors {
+		operation.Responses[strconv.Itoa(status)] = &Response{
+			Description: http.StatusText(status),
+			Content: map[string]*MediaType{
+				"application/json":         {Schema: &Schema{Ref: "#/components/schemas/ErrorResponse"}},
+				"application/problem+json": {Schema: &Schema{Ref: "#/components/schemas/Problem"}},
+			},
+		}
+	}
+	for _, status := range route.OAuthErrors {
+		operation.Responses[strconv.Itoa(status)] = &Response{
+			Description: http.StatusText(status),
+			Content:     map[string]*MediaType{"application/json": {Schema: &Schema{Ref: "#/components/schemas/OAuthError"}}},
+		}
+	}
+	for _, status := range route.SCIMErrors {
+		operation.Responses[strconv.Itoa(status)] = &Response{
+			Description: http.StatusText(status),
+			Content:     map[string]*MediaType{"application/scim+json": {Schema: &Schema{Ref: "#/components/schemas/SCIMError"}}},
+		}
+	}
+	return operation
+}
+
+// openAPIPath turns gin parameters into OpenAPI ones, /v1/uploads/:uploadId
+// becomes /v1/uploads/{uploadId}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// operationId derives a stable id from the route, e.g. post_v1_auth_login
+func operationId(method, path string) string {
+	id := strings.ToLower(method)
+	for _, segment := range strings.Split(path, "/") {
+		segment = strings.Trim(segment, ":*")
+		segment = strings.NewReplacer("-", "_", ".", "_").Replace(segment)
+		if segment != "" {
+			id += "_" + segment
+		}
+	}
+	return id
+}
+
+// Check compares the documented routes with the ones registered on the
+// router, listing the undocumented routes and the documented ones that do
+// not exist
+func Check(routes []Route, registered gin.RoutesInfo) []string {
+	documented := map[string]bool{}
+	for _, route := range routes {
+		documented[route.Method+" "+route.Path] = true
+	}
+
+	problems := []string{}
+	for _, route := range registered {
+		key := route.Method + " " + route.Path
+		if !documented[key] {
+			problems = append(problems, fmt.Sprintf("%s is not documented", key))
+		}
+		delete(documented, key)
+	}
+	for key := range documented {
+		problems = append(problems, fmt.Sprintf("%s is documented but not registered", key))
+	}
+	sort.Strings(problems)
+	return problems
+}
@@ -0,0 +1,203 @@
+package openapi
+
+import (
+	"GoApp/lib"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schemaBuilder turns Go types into schemas, named structs become shared
+// components referenced with $ref
+type schemaBuilder struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{
+		components: map[string]*Schema{},
+		names:      map[reflect.Type]string{},
+	}
+}
+
+// of returns the schema of value, which is either a Go value whose type is
+// described or a ready made *Schema
+func (builder *schemaBuilder) of(value interface{}) *Schema {
+	if schema, ok := value.(*Schema); ok {
+		return schema
+	}
+	return builder.schema(reflect.TypeOf(value))
+}
+
+func (builder *schemaBuilder) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == reflect.TypeOf(time.Duration(0)):
+		return &Schema{Type: "integer", Format: "int64", Description: "nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: builder.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: builder.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return builder.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + builder.component(t)}
+	default:
+		// interface{} and anything else accept any value
+		return &Schema{}
+	}
+}
+
+// component registers the named struct t once and returns its component name
+func (builder *schemaBuilder) component(t reflect.Type) string {
+	if name, ok := builder.names[t]; ok {
+		return name
+	}
+	// unexported documentation types get the same casing as the others
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	if _, taken := builder.components[name]; taken {
+		// two packages define the same name, tell them apart by package
+		name = pkgName(t) + name
+	}
+	builder.names[t] = name
+	// reserve the name before describing the fields, structs may refer to themselves
+	builder.components[name] = &Schema{}
+	*builder.components[name] = *builder.object(t)
+	return name
+}
+
+func pkgName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+	if pkg == "" {
+		return ""
+	}
+	return strings.ToUpper(pkg[:1]) + pkg[1:]
+}
+
+// object describes the fields of a struct from their json, validate, format
+// and description tags
+func (builder *schemaBuilder) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			// embedded structs contribute their fields, like encoding/json does
+			embedded := builder.object(field.Type)
+			for property, propertySchema := range embedded.Properties {
+				schema.Properties[property] = propertySchema
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := builder.schema(field.Type)
+		if format := field.Tag.Get("format"); format != "" {
+			property.Format = format
+		}
+		if description := field.Tag.Get("description"); description != "" {
+			if property.Ref != "" {
+				// siblings of $ref are allowed since OpenAPI 3.1
+				property = &Schema{Ref: property.Ref}
+			}
+			property.Description = description
+		}
+		required := applyValidation(property, field.Tag.Get("validate"))
+		if required || (field.Type.Kind() != reflect.Pointer && !strings.Contains(options, "omitempty") && field.Tag.Get("validate") == "") {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+	return schema
+}
+
+// applyValidation maps the go-playground/validator rules to JSON Schema
+// keywords and reports whether the field is required
+func applyValidation(schema *Schema, rules string) bool {
+	required := false
+	for _, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "email", "emailaddress":
+			schema.Format = "email"
+		case "password":
+			setLimit(schema, "min", lib.PasswordMinLength)
+			setLimit(schema, "max", lib.PasswordMaxLength)
+			schema.Description = "with at least a letter and a digit"
+		case "personname":
+			schema.Description = "letters separated by single spaces, hyphens, apostrophes or periods"
+		case "url":
+			schema.Format = "uri"
+		case "uuid", "uuid4":
+			schema.Format = "uuid"
+		case "oneof":
+			schema.Enum = strings.Fields(param)
+		case "min", "max", "len":
+			limit, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			setLimit(schema, name, limit)
+		}
+	}
+	return required
+}
+
+func setLimit(schema *Schema, rule string, limit int) {
+	switch schema.Type {
+	case "string":
+		if rule == "min" || rule == "len" {
+			schema.MinLength = &limit
+		}
+		if rule == "max" || rule == "len" {
+			schema.MaxLength = &limit
+		}
+	case "integer", "number":
+		value := float64(limit)
+		if rule == "min" || rule == "len" {
+			schema.Minimum = &value
+		}
+		if rule == "max" || rule == "len" {
+			schema.Maximum = &value
+		}
+	}
+}
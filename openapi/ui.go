@@ -0,0 +1,47 @@
+package openapi
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// DocsHandler serves the embedded Swagger UI, loading the document from
+// specUrl. Register it on a wildcard route such as /docs/*filepath.
+func DocsHandler(specUrl string) gin.HandlerFunc {
+	initializer := fmt.Sprintf(`window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: %q,
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    persistAuthorization: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    layout: "StandaloneLayout"
+  });
+};
+`, specUrl)
+	files := http.FileServer(http.FS(swaggerFiles.FS))
+
+	return func(c *gin.Context) {
+		file := strings.TrimPrefix(c.Param("filepath"), "/")
+		switch file {
+		case "", "index.html":
+			// http.FileServer would redirect index.html to the directory
+			index, err := fs.ReadFile(swaggerFiles.FS, "index.html")
+			if err != nil {
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			c.Data(http.StatusOK, "text/html; charset=utf-8", index)
+		case "swagger-initializer.js":
+			c.Data(http.StatusOK, "application/javascript; charset=utf-8", []byte(initializer))
+		default:
+			c.Request.URL.Path = "/" + file
+			files.ServeHTTP(c.Writer, c.Request)
+		}
+	}
+}
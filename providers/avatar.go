@@ -0,0 +1,218 @@
+package providers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const AvatarStyleInitials = "initials"
+const AvatarStyleIdenticon = "identicon"
+
+const AvatarFormatSVG = "svg"
+const AvatarFormatPNG = "png"
+
+// background of identicons, the foreground comes from the palette
+var identiconBackground = color.RGBA{0xf0, 0xf0, 0xf0, 0xff}
+
+type AvatarOptions struct {
+	Seed      string
+	Firstname string
+	Lastname  string
+	Style     string
+	Format    string
+	Size      int
+}
+
+// avatar service interface
+type AvatarService interface {
+	Generate(options AvatarOptions) ([]byte, error)
+	Palette() []string
+}
+
+type avatarServices struct {
+	palette []string
+	colors  []color.RGBA
+	font    *opentype.Font
+}
+
+func NewAvatarService(configs *Config) AvatarService {
+	colors := make([]color.RGBA, len(configs.AvatarPalette))
+	for i, hex := range configs.AvatarPalette {
+		c, err := parseHexColor(hex)
+		if err != nil {
+			panic(err)
+		}
+		colors[i] = c
+	}
+	f, err := opentype.Parse(gomedium.TTF)
+	if err != nil {
+		panic(err)
+	}
+	return &avatarServices{
+		palette: configs.AvatarPalette,
+		colors:  colors,
+		font:    f,
+	}
+}
+
+func (service *avatarServices) Palette() []string {
+	return service.palette
+}
+
+// Generate deterministically renders an avatar for options.Seed, falling back
+// to an identicon when there are no initials to show
+func (service *avatarServices) Generate(options AvatarOptions) ([]byte, error) {
+	hash := sha256.Sum256([]byte(options.Seed))
+	// AVATAR_PALETTE holds at most 256 colours, one per value of the first byte
+	foreground := int(hash[0]) % len(service.colors)
+	initials := avatarInitials(options.Firstname, options.Lastname)
+
+	if options.Style == AvatarStyleIdenticon || initials == "" {
+		if options.Format == AvatarFormatPNG {
+			return service.identiconPNG(hash, service.colors[foreground], options.Size)
+		}
+		return service.identiconSVG(hash, service.palette[foreground], options.Size), nil
+	}
+	if options.Format == AvatarFormatPNG {
+		return service.initialsPNG(initials, service.colors[foreground], options.Size)
+	}
+	return service.initialsSVG(initials, service.palette[foreground], options.Size), nil
+}
+
+func (service *avatarServices) initialsSVG(initials, background string, size int) []byte {
+	return []byte(fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 100 100">`+
+			`<rect width="100" height="100" fill="%s"/>`+
+			`<text x="50" y="50" dy=".35em" text-anchor="middle" font-family="Helvetica, Arial, sans-serif" font-size="40" font-weight="500" fill="#ffffff">%s</text>`+
+			`</svg>`,
+		size, size, background, html.EscapeString(initials),
+	))
+}
+
+func (service *avatarServices) initialsPNG(initials string, background color.RGBA, size int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	face, err := opentype.NewFace(service.font, &opentype.FaceOptions{
+		Size:    float64(size) * 0.4,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	drawer := font.Drawer{
+		Dst:  img,
+		Src:  image.White,
+		Face: face,
+	}
+	// center the text box, using the cap height rather than the full line height
+	metrics := face.Metrics()
+	width := drawer.MeasureString(initials)
+	drawer.Dot = fixed.Point26_6{
+		X: (fixed.I(size) - width) / 2,
+		Y: (fixed.I(size) + metrics.CapHeight) / 2,
+	}
+	drawer.DrawString(initials)
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// identiconCells returns the filled cells of a 5x5 grid, mirrored around the middle column
+func identiconCells(hash [32]byte) [5][5]bool {
+	var cells [5][5]bool
+	for row := 0; row < 5; row++ {
+		for col := 0; col < 3; col++ {
+			bit := row*3 + col
+			filled := hash[1+bit/8]&(1<<(bit%8)) != 0
+			cells[row][col] = filled
+			cells[row][4-col] = filled
+		}
+	}
+	return cells
+}
+
+func (service *avatarServices) identiconSVG(hash [32]byte, foreground string, size int) []byte {
+	var body strings.Builder
+	fmt.Fprintf(&body, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 6 6" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&body, `<rect width="6" height="6" fill="#f0f0f0"/>`)
+	for row, cols := range identiconCells(hash) {
+		for col, filled := range cols {
+			if filled {
+				// the grid is inset by half a cell on every side
+				fmt.Fprintf(&body, `<rect x="%g" y="%g" width="1" height="1" fill="%s"/>`, float64(col)+0.5, float64(row)+0.5, foreground)
+			}
+		}
+	}
+	body.WriteString(`</svg>`)
+	return []byte(body.String())
+}
+
+func (service *avatarServices) identiconPNG(hash [32]byte, foreground color.RGBA, size int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(identiconBackground), image.Point{}, draw.Src)
+
+	cell := float64(size) / 6
+	for row, cols := range identiconCells(hash) {
+		for col, filled := range cols {
+			if filled {
+				rect := image.Rect(
+					int((float64(col)+0.5)*cell), int((float64(row)+0.5)*cell),
+					int((float64(col)+1.5)*cell), int((float64(row)+1.5)*cell),
+				)
+				draw.Draw(img, rect, image.NewUniform(foreground), image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// avatarInitials returns the upper-cased first letters of both names
+func avatarInitials(firstname, lastname string) string {
+	initials := ""
+	for _, name := range []string{firstname, lastname} {
+		for _, r := range strings.TrimSpace(name) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				initials += string(unicode.ToUpper(r))
+			}
+			break
+		}
+	}
+	return initials
+}
+
+// parseHexColor parses colors written as #rrggbb
+func parseHexColor(hex string) (color.RGBA, error) {
+	c := color.RGBA{A: 0xff}
+	if len(hex) != 7 || hex[0] != '#' {
+		return c, fmt.Errorf("invalid color: %q", hex)
+	}
+	if _, err := fmt.Sscanf(hex[1:], "%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+		return c, fmt.Errorf("invalid color: %q", hex)
+	}
+	return c, nil
+}
@@ -0,0 +1,20 @@
+package providers
+
+import (
+	"fmt"
+	"testing"
+)
+
+// a full palette of 256 colours used to be indexed modulo byte(256), which is 0
+func TestAvatarFullPalette(t *testing.T) {
+	palette := make([]string, 256)
+	for i := range palette {
+		palette[i] = fmt.Sprintf("#%02x%02x%02x", i, i, i)
+	}
+	service := NewAvatarService(&Config{AvatarPalette: palette})
+	for _, style := range []string{AvatarStyleInitials, AvatarStyleIdenticon} {
+		if _, err := service.Generate(AvatarOptions{Seed: "seed", Firstname: "Ada", Lastname: "Lovelace", Style: style, Size: 64}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -1,50 +1,258 @@
 package providers
 
-import "os"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is loaded from, in increasing order of precedence: the `default`
+// tags, a YAML config file, environment variables and finally secret files
+// named by <VAR>_FILE (e.g. JWT_SECRET_FILE=/run/secrets/jwt).
 type Config struct {
-	Port            string
-	Env             string
-	JwtSecret       string
-	AppName         string
-	MongoDbUrl      string
-	DatabaseName    string
-	SmtpSender      string
-	SmtpHost        string
-	SmtpPort        string
-	SmtpPassword    string
-	VerifyUrl       string
-	ResetPassUrl    string
-	RecaptchaSecret string
-	AllowOrigin     string
-	Domain          string
-	AuthKey         string
-}
-
-func GetConfig() *Config {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "3000"
-	}
-	env := os.Getenv("ENV")
-	if env == "" {
-		env = "local"
-	}
-	return &Config{
-		Port:            port,
-		Env:             env,
-		JwtSecret:       os.Getenv("JWT_SECRET"),
-		MongoDbUrl:      os.Getenv("MONGODB_URL"),
-		DatabaseName:    os.Getenv("DATABASE_NAME"),
-		SmtpSender:      os.Getenv("SMTP_SENDER"),
-		SmtpHost:        os.Getenv("SMTP_HOST"),
-		SmtpPort:        os.Getenv("SMTP_PORT"),
-		SmtpPassword:    os.Getenv("SMTP_PASSWORD"),
-		VerifyUrl:       os.Getenv("FE_VERIFY_URL"),
-		ResetPassUrl:    os.Getenv("FE_RESET_PASS_URL"),
-		RecaptchaSecret: os.Getenv("RECAPTCHA_SECRET"),
-		AllowOrigin:     os.Getenv("ALLOWED_ORIGIN"),
-		Domain:          os.Getenv("DOMAIN"),
-		AuthKey:         os.Getenv("AUTH_KEY"),
+	Port                  string        `yaml:"port" env:"PORT" default:"3000" validate:"required,numeric"`
+	Env                   string        `yaml:"env" env:"ENV" default:"local" validate:"required"`
+	JwtSecret             string        `yaml:"jwtSecret" env:"JWT_SECRET" secret:"true" validate:"required"`
+	JwtPreviousSecrets    []string      `yaml:"jwtPreviousSecrets" env:"JWT_PREVIOUS_SECRETS" secret:"true"`
+	AppName               string        `yaml:"appName" env:"APP_NAME" default:"GoApp" validate:"required"`
+	DatabaseDriver        string        `yaml:"databaseDriver" env:"DATABASE_DRIVER" default:"mongo" validate:"oneof=mongo postgres sqlite memory"`
+	DatabaseUrl           string        `yaml:"databaseUrl" env:"DATABASE_URL" secret:"true" validate:"required_if=DatabaseDriver postgres,required_if=DatabaseDriver sqlite"`
+	MongoDbUrl            string        `yaml:"mongoDbUrl" env:"MONGODB_URL" secret:"true" validate:"required_if=DatabaseDriver mongo"`
+	DatabaseName          string        `yaml:"databaseName" env:"DATABASE_NAME" validate:"required_if=DatabaseDriver mongo"`
+	DbTimeout             time.Duration `yaml:"dbTimeout" env:"DB_TIMEOUT" default:"10s" validate:"min=100ms"`
+	DatabaseMigrate       bool          `yaml:"databaseMigrate" env:"DATABASE_MIGRATE" default:"true"`
+	SmtpSender            string        `yaml:"smtpSender" env:"SMTP_SENDER" validate:"required,email"`
+	SmtpHost              string        `yaml:"smtpHost" env:"SMTP_HOST" validate:"required,hostname_rfc1123"`
+	SmtpPort              string        `yaml:"smtpPort" env:"SMTP_PORT" default:"587" validate:"required,numeric"`
+	SmtpPassword          string        `yaml:"smtpPassword" env:"SMTP_PASSWORD" secret:"true"`
+	VerifyUrl             string        `yaml:"verifyUrl" env:"FE_VERIFY_URL" validate:"required,url"`
+	ResetPassUrl          string        `yaml:"resetPassUrl" env:"FE_RESET_PASS_URL" validate:"required,url"`
+	DeviceUrl             string        `yaml:"deviceUrl" env:"FE_DEVICE_URL" validate:"omitempty,url"`
+	RecaptchaSecret       string        `yaml:"recaptchaSecret" env:"RECAPTCHA_SECRET" secret:"true"`
+	RecaptchaSiteKey      string        `yaml:"recaptchaSiteKey" env:"RECAPTCHA_SITE_KEY" validate:"required_with=RecaptchaSecret"`
+	AllowOrigin           string        `yaml:"allowOrigin" env:"ALLOWED_ORIGIN" validate:"omitempty,url"`
+	SessionCookies        bool          `yaml:"sessionCookies" env:"SESSION_COOKIES"`
+	CookieDomain          string        `yaml:"cookieDomain" env:"COOKIE_DOMAIN"`
+	CookieSecure          bool          `yaml:"cookieSecure" env:"COOKIE_SECURE" default:"true"`
+	CookieSameSite        string        `yaml:"cookieSameSite" env:"COOKIE_SAME_SITE" default:"strict" validate:"oneof=strict lax none"`
+	SessionMaxAge         time.Duration `yaml:"sessionMaxAge" env:"SESSION_MAX_AGE" default:"720h" validate:"min=1m"`
+	Domain                string        `yaml:"domain" env:"DOMAIN" validate:"required,url"`
+	AuthKey               string        `yaml:"authKey" env:"AUTH_KEY" secret:"true" validate:"required"`
+	OidcSigningKey        string        `yaml:"oidcSigningKey" env:"OIDC_SIGNING_KEY" secret:"true" validate:"required_unless=Env local"`
+	RequestMaxBytes       int64         `yaml:"requestMaxBytes" env:"REQUEST_MAX_BYTES" default:"65536" validate:"min=1"`
+	StorageDriver         string        `yaml:"storageDriver" env:"STORAGE_DRIVER" default:"local" validate:"oneof=local s3"`
+	StoragePath           string        `yaml:"storagePath" env:"STORAGE_PATH" default:"public" validate:"required_if=StorageDriver local"`
+	S3Endpoint            string        `yaml:"s3Endpoint" env:"S3_ENDPOINT" validate:"required_if=StorageDriver s3"`
+	S3Region              string        `yaml:"s3Region" env:"S3_REGION" default:"us-east-1"`
+	S3Bucket              string        `yaml:"s3Bucket" env:"S3_BUCKET" validate:"required_if=StorageDriver s3"`
+	S3AccessKey           string        `yaml:"s3AccessKey" env:"S3_ACCESS_KEY" validate:"required_if=StorageDriver s3"`
+	S3SecretKey           string        `yaml:"s3SecretKey" env:"S3_SECRET_KEY" secret:"true" validate:"required_if=StorageDriver s3"`
+	S3UseSSL              bool          `yaml:"s3UseSSL" env:"S3_USE_SSL" default:"true"`
+	S3PublicUrl           string        `yaml:"s3PublicUrl" env:"S3_PUBLIC_URL" validate:"omitempty,url"`
+	S3UrlExpiry           time.Duration `yaml:"s3UrlExpiry" env:"S3_URL_EXPIRY" default:"1h" validate:"min=1s,max=168h"`
+	ImageMaxBytes         int64         `yaml:"imageMaxBytes" env:"IMAGE_MAX_BYTES" default:"5242880" validate:"min=1"`
+	ImageMaxDimension     int           `yaml:"imageMaxDimension" env:"IMAGE_MAX_DIMENSION" default:"4096" validate:"min=1"`
+	ProfileSizes          []int         `yaml:"profileSizes" env:"PROFILE_SIZES" default:"64,256,512" validate:"min=1,dive,min=16,max=2048"`
+	UploadExpiry          time.Duration `yaml:"uploadExpiry" env:"UPLOAD_EXPIRY" default:"24h" validate:"min=1m"`
+	AvatarPalette         []string      `yaml:"avatarPalette" env:"AVATAR_PALETTE" default:"#1abc9c,#2ecc71,#3498db,#9b59b6,#34495e,#16a085,#27ae60,#2980b9,#8e44ad,#e67e22,#e74c3c,#d35400" validate:"min=1,max=256,dive,hexcolor,len=7"`
+	AvatarStyle           string        `yaml:"avatarStyle" env:"AVATAR_STYLE" default:"initials" validate:"oneof=initials identicon"`
+	AvatarSize            int           `yaml:"avatarSize" env:"AVATAR_SIZE" default:"128" validate:"min=16"`
+	AvatarMaxSize         int           `yaml:"avatarMaxSize" env:"AVATAR_MAX_SIZE" default:"512" validate:"gtefield=AvatarSize"`
+	AvatarMaxAge          time.Duration `yaml:"avatarMaxAge" env:"AVATAR_MAX_AGE" default:"24h"`
+	HttpReadTimeout       time.Duration `yaml:"httpReadTimeout" env:"HTTP_READ_TIMEOUT" default:"60s" validate:"min=1s"`
+	HttpReadHeaderTimeout time.Duration `yaml:"httpReadHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT" default:"10s" validate:"min=1s"`
+	HttpWriteTimeout      time.Duration `yaml:"httpWriteTimeout" env:"HTTP_WRITE_TIMEOUT" default:"60s" validate:"min=1s"`
+	HttpIdleTimeout       time.Duration `yaml:"httpIdleTimeout" env:"HTTP_IDLE_TIMEOUT" default:"120s" validate:"min=1s"`
+	HttpMaxHeaderBytes    int           `yaml:"httpMaxHeaderBytes" env:"HTTP_MAX_HEADER_BYTES" default:"1048576" validate:"min=4096"`
+	ShutdownTimeout       time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" default:"30s" validate:"min=1s"`
+	ShutdownDelay         time.Duration `yaml:"shutdownDelay" env:"SHUTDOWN_DELAY" default:"5s"`
+	SmtpHealthCheck       bool          `yaml:"smtpHealthCheck" env:"SMTP_HEALTH_CHECK" default:"true"`
+	SmtpHealthInterval    time.Duration `yaml:"smtpHealthInterval" env:"SMTP_HEALTH_INTERVAL" default:"1m"`
+	StorageHealthInterval time.Duration `yaml:"storageHealthInterval" env:"STORAGE_HEALTH_INTERVAL" default:"30s"`
+	TracingExporter       string        `yaml:"tracingExporter" env:"TRACING_EXPORTER" default:"none" validate:"oneof=none stdout otlp"`
+	TracingSampleRatio    float64       `yaml:"tracingSampleRatio" env:"TRACING_SAMPLE_RATIO" default:"1" validate:"min=0,max=1"`
+	LogLevel              string        `yaml:"logLevel" env:"LOG_LEVEL" default:"info" validate:"oneof=debug info warn error DEBUG INFO WARN ERROR"`
+	LogFormat             string        `yaml:"logFormat" env:"LOG_FORMAT" default:"json" validate:"oneof=json text"`
+}
+
+// ConfigError lists every missing or invalid setting found while loading the config
+type ConfigError struct {
+	Problems []string
+}
+
+func (err *ConfigError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(err.Problems, "\n  ")
+}
+
+// LoadConfig builds the config from its defaults, the YAML file at path
+// (skipped when path is empty), the environment and secret files, and
+// validates the result.
+func LoadConfig(path string) (*Config, error) {
+	configs := &Config{}
+	problems := []string{}
+
+	forEachConfigField(configs, func(field reflect.StructField, value reflect.Value) {
+		if def, ok := field.Tag.Lookup("default"); ok {
+			if err := setConfigField(value, def); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid default: %s", field.Name, err))
+			}
+		}
+	})
+
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		decoder := yaml.NewDecoder(file)
+		// reject misspelled keys rather than silently ignoring them
+		decoder.KnownFields(true)
+		if err := decoder.Decode(configs); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	forEachConfigField(configs, func(field reflect.StructField, value reflect.Value) {
+		name := field.Tag.Get("env")
+		// empty variables count as unset, compose files tend to pass them through
+		if raw := os.Getenv(name); raw != "" {
+			if err := setConfigField(value, raw); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s", name, err))
+			}
+		}
+		if file := os.Getenv(name + "_FILE"); file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s_FILE: %s", name, err))
+				return
+			}
+			if err := setConfigField(value, strings.TrimRight(string(data), "\r\n")); err != nil {
+				problems = append(problems, fmt.Sprintf("%s_FILE: %s", name, err))
+			}
+		}
+	})
+
+	if err := validator.New().Struct(configs); err != nil {
+		var validationErrors validator.ValidationErrors
+		if !errors.As(err, &validationErrors) {
+			return nil, err
+		}
+		for _, fieldErr := range validationErrors {
+			problems = append(problems, describeConfigError(fieldErr))
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+	return configs, nil
+}
+
+// PrintConfig writes the effective config as YAML with every secret redacted
+func PrintConfig(w io.Writer, configs *Config) error {
+	redacted := *configs
+	forEachConfigField(&redacted, func(field reflect.StructField, value reflect.Value) {
+		if field.Tag.Get("secret") == "true" && !value.IsZero() {
+			setConfigField(value, "[redacted]")
+		}
+	})
+	encoder := yaml.NewEncoder(w)
+	defer encoder.Close()
+	return encoder.Encode(&redacted)
+}
+
+func forEachConfigField(configs *Config, fn func(field reflect.StructField, value reflect.Value)) {
+	value := reflect.ValueOf(configs).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		fn(value.Type().Field(i), value.Field(i))
+	}
+}
+
+// setConfigField parses raw into the field, lists are comma separated
+func setConfigField(value reflect.Value, raw string) error {
+	if value.Type() == reflect.TypeOf(time.Duration(0)) {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		value.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		list := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setConfigField(list.Index(i), item); err != nil {
+				return err
+			}
+		}
+		value.Set(list)
+	default:
+		return fmt.Errorf("unsupported config type %s", value.Type())
+	}
+	return nil
+}
+
+// describeConfigError names the environment variable of the failing field
+func describeConfigError(fieldErr validator.FieldError) string {
+	name := fieldErr.StructField()
+	if field, ok := reflect.TypeOf(Config{}).FieldByName(strings.SplitN(name, "[", 2)[0]); ok {
+		name = field.Tag.Get("env") + strings.TrimPrefix(name, field.Name)
+	}
+	switch fieldErr.Tag() {
+	case "required", "required_if", "required_with":
+		return fmt.Sprintf("%s: is required", name)
+	case "required_unless":
+		condition := strings.Fields(fieldErr.Param())
+		other, _ := reflect.TypeOf(Config{}).FieldByName(condition[0])
+		return fmt.Sprintf("%s: is required unless %s is %s", name, other.Tag.Get("env"), strings.Join(condition[1:], " "))
+	case "oneof":
+		return fmt.Sprintf("%s: must be one of [%s]", name, fieldErr.Param())
+	case "gtefield":
+		other, _ := reflect.TypeOf(Config{}).FieldByName(fieldErr.Param())
+		return fmt.Sprintf("%s: must not be lower than %s", name, other.Tag.Get("env"))
+	case "email", "url", "numeric", "hexcolor", "hostname_rfc1123":
+		return fmt.Sprintf("%s: %q is not a valid %s", name, fieldErr.Value(), fieldErr.Tag())
+	default:
+		if fieldErr.Param() != "" {
+			return fmt.Sprintf("%s: failed %s=%s", name, fieldErr.Tag(), fieldErr.Param())
+		}
+		return fmt.Sprintf("%s: failed %s", name, fieldErr.Tag())
 	}
 }
@@ -0,0 +1,194 @@
+package providers
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setConfigEnv unsets every config variable of the environment, then sets env
+func setConfigEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	forEachConfigField(&Config{}, func(field reflect.StructField, value reflect.Value) {
+		// empty variables count as unset
+		t.Setenv(field.Tag.Get("env"), "")
+		t.Setenv(field.Tag.Get("env")+"_FILE", "")
+	})
+	required := map[string]string{
+		"DATABASE_DRIVER":   "memory",
+		"JWT_SECRET":        "secret",
+		"AUTH_KEY":          "auth-key",
+		"SMTP_SENDER":       "noreply@example.com",
+		"SMTP_HOST":         "localhost",
+		"FE_VERIFY_URL":     "http://localhost/verify",
+		"FE_RESET_PASS_URL": "http://localhost/reset",
+		"DOMAIN":            "http://localhost:3000",
+	}
+	for name, value := range env {
+		required[name] = value
+	}
+	for name, value := range required {
+		t.Setenv(name, value)
+	}
+}
+
+// writeFile writes content to a file of the test directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+port: "4000"
+appName: FromYaml
+dbTimeout: 30s
+profileSizes: [32, 96]
+avatarPalette: ["#000000", "#ffffff"]
+jwtSecret: yaml-secret
+`)
+	setConfigEnv(t, map[string]string{
+		"APP_NAME":                  "FromEnv",
+		"JWT_SECRET":                "env-secret",
+		"JWT_SECRET_FILE":           writeFile(t, "jwt", "file-secret\n"),
+		"JWT_PREVIOUS_SECRETS_FILE": writeFile(t, "previous", "old-1, old-2\r\n"),
+		"PROFILE_SIZES":             " 16, 48,,128 ",
+	})
+
+	configs, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, test := range map[string]struct {
+		got, want interface{}
+	}{
+		"default":             {configs.LogLevel, "info"},
+		"default duration":    {configs.SessionMaxAge, 720 * time.Hour},
+		"yaml over default":   {configs.Port, "4000"},
+		"yaml duration":       {configs.DbTimeout, 30 * time.Second},
+		"yaml list":           {configs.AvatarPalette, []string{"#000000", "#ffffff"}},
+		"env over yaml":       {configs.AppName, "FromEnv"},
+		"env list":            {configs.ProfileSizes, []int{16, 48, 128}},
+		"file over env":       {configs.JwtSecret, "file-secret"},
+		"file list":           {configs.JwtPreviousSecrets, []string{"old-1", "old-2"}},
+		"env over default":    {configs.DatabaseDriver, "memory"},
+		"default bool":        {configs.CookieSecure, true},
+		"default float":       {configs.TracingSampleRatio, 1.0},
+		"default int64":       {configs.RequestMaxBytes, int64(65536)},
+		"unset without value": {configs.SmtpPassword, ""},
+	} {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", name, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		env  map[string]string
+		yaml string
+		want []string
+	}{
+		"missing":          {map[string]string{"JWT_SECRET": "", "SMTP_HOST": ""}, "", []string{"JWT_SECRET: is required", "SMTP_HOST: is required"}},
+		"invalid number":   {map[string]string{"REQUEST_MAX_BYTES": "lots"}, "", []string{`REQUEST_MAX_BYTES: invalid number "lots"`}},
+		"invalid duration": {map[string]string{"DB_TIMEOUT": "10"}, "", []string{`DB_TIMEOUT: invalid duration "10"`}},
+		"invalid list":     {map[string]string{"PROFILE_SIZES": "64,large"}, "", []string{`PROFILE_SIZES: invalid number "large"`}},
+		"list item":        {map[string]string{"PROFILE_SIZES": "64,8"}, "", []string{"PROFILE_SIZES[1]: failed min=16"}},
+		"empty list":       {nil, "profileSizes: []", []string{"PROFILE_SIZES: failed min=1"}},
+		"missing file":     {map[string]string{"JWT_SECRET_FILE": "/nonexistent/jwt"}, "", []string{"JWT_SECRET_FILE: open /nonexistent/jwt"}},
+		"oneof":            {map[string]string{"DATABASE_DRIVER": "mysql"}, "", []string{"DATABASE_DRIVER: must be one of [mongo postgres sqlite memory]"}},
+		"required_if":      {map[string]string{"DATABASE_DRIVER": "postgres"}, "", []string{"DATABASE_URL: is required"}},
+		"required_unless":  {map[string]string{"ENV": "production"}, "", []string{"OIDC_SIGNING_KEY: is required unless ENV is local"}},
+		"gtefield":         {map[string]string{"AVATAR_MAX_SIZE": "64"}, "", []string{"AVATAR_MAX_SIZE: must not be lower than AVATAR_SIZE"}},
+		"invalid url":      {map[string]string{"DOMAIN": "localhost"}, "", []string{`DOMAIN: "localhost" is not a valid url`}},
+	} {
+		setConfigEnv(t, test.env)
+		path := ""
+		if test.yaml != "" {
+			path = writeFile(t, "config.yaml", test.yaml)
+		}
+		_, err := LoadConfig(path)
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) {
+			t.Errorf("%s: got %v", name, err)
+			continue
+		}
+		if len(configErr.Problems) != len(test.want) {
+			t.Errorf("%s: got %q", name, configErr.Problems)
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.HasPrefix(configErr.Problems[i], want) {
+				t.Errorf("%s: got %q, want %q", name, configErr.Problems[i], want)
+			}
+		}
+	}
+
+	// misspelled keys and unreadable files are not problems of a value, the
+	// whole file is refused
+	setConfigEnv(t, nil)
+	if _, err := LoadConfig(writeFile(t, "config.yaml", "jwtSecrets: secret")); err == nil || !strings.Contains(err.Error(), "jwtSecrets") {
+		t.Errorf("unknown key: got %v", err)
+	}
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: got %v", err)
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	setConfigEnv(t, map[string]string{
+		"JWT_SECRET":           "jwt-secret",
+		"JWT_PREVIOUS_SECRETS": "old-secret-1,old-secret-2",
+		"AUTH_KEY":             "auth-key-value",
+		"S3_SECRET_KEY":        "s3-secret-value",
+	})
+	configs, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	if err := PrintConfig(&output, configs); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"jwt-secret", "old-secret", "auth-key-value", "s3-secret-value"} {
+		if strings.Contains(output.String(), secret) {
+			t.Errorf("%s is printed:\n%s", secret, output.String())
+		}
+	}
+
+	// the output is a config file, with the secrets replaced and the rest kept
+	var printed Config
+	if err := yaml.Unmarshal(output.Bytes(), &printed); err != nil {
+		t.Fatal(err)
+	}
+	if printed.JwtSecret != "[redacted]" || printed.AuthKey != "[redacted]" || printed.S3SecretKey != "[redacted]" {
+		t.Errorf("got %+v", printed)
+	}
+	if !reflect.DeepEqual(printed.JwtPreviousSecrets, []string{"[redacted]"}) {
+		t.Errorf("got %q", printed.JwtPreviousSecrets)
+	}
+	// unset secrets are printed empty, so that they show as missing
+	if printed.SmtpPassword != "" || printed.RecaptchaSecret != "" {
+		t.Errorf("got %q %q", printed.SmtpPassword, printed.RecaptchaSecret)
+	}
+	if printed.AppName != configs.AppName || printed.DbTimeout != configs.DbTimeout || !reflect.DeepEqual(printed.ProfileSizes, configs.ProfileSizes) {
+		t.Errorf("got %+v", printed)
+	}
+
+	// the config in use keeps its secrets
+	if configs.JwtSecret != "jwt-secret" || !reflect.DeepEqual(configs.JwtPreviousSecrets, []string{"old-secret-1", "old-secret-2"}) {
+		t.Errorf("the config was redacted: %+v", configs)
+	}
+}
@@ -2,19 +2,28 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net"
 	"net/smtp"
 	"text/template"
 
 	"github.com/google/go-querystring/query"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type EmailService interface {
-	SendActivationEmail(email, name, code string) error
-	SendResetPassEmail(email, name, code string) error
+	SendActivationEmail(ctx context.Context, email, name, code string) error
+	SendResetPassEmail(ctx context.Context, email, name, code string) error
+	SendTestEmail(ctx context.Context, email string) error
+	Ping(ctx context.Context) error
 }
 
 type emailServices struct {
+	host                   string
 	address                string
 	from                   string
 	auth                   smtp.Auth
@@ -34,6 +43,7 @@ func NewEmailService(configs *Config) EmailService {
 		panic(err)
 	}
 	return &emailServices{
+		host:                   configs.SmtpHost,
 		address:                configs.SmtpHost + ":" + configs.SmtpPort,
 		from:                   configs.SmtpSender,
 		auth:                   smtp.PlainAuth("", configs.SmtpSender, configs.SmtpPassword, configs.SmtpHost),
@@ -44,7 +54,7 @@ func NewEmailService(configs *Config) EmailService {
 	}
 }
 
-func (service *emailServices) SendActivationEmail(email, name, code string) error {
+func (service *emailServices) SendActivationEmail(ctx context.Context, email, name, code string) error {
 	// Receiver email address.
 	to := []string{
 		email,
@@ -71,10 +81,10 @@ func (service *emailServices) SendActivationEmail(email, name, code string) erro
 		VerificationUrl: service.verifyUrl + "?" + v.Encode(),
 	})
 
-	return smtp.SendMail(service.address, service.auth, service.from, to, body.Bytes())
+	return service.send(ctx, "activation", to, body.Bytes())
 }
 
-func (service *emailServices) SendResetPassEmail(email, name, code string) error {
+func (service *emailServices) SendResetPassEmail(ctx context.Context, email, name, code string) error {
 	// Receiver email address.
 	to := []string{
 		email,
@@ -101,5 +111,59 @@ func (service *emailServices) SendResetPassEmail(email, name, code string) error
 		ResetPassUrl: service.resetPassUrl + "?" + v.Encode(),
 	})
 
-	return smtp.SendMail(service.address, service.auth, service.from, to, body.Bytes())
+	return service.send(ctx, "reset_password", to, body.Bytes())
+}
+
+// SendTestEmail sends a plain message, to check the SMTP settings end to end
+func (service *emailServices) SendTestEmail(ctx context.Context, email string) error {
+	to := []string{
+		email,
+	}
+
+	var body bytes.Buffer
+	body.Write([]byte("Subject: Test email\nMIME-version: 1.0;\nContent-Type: text/plain; charset=\"UTF-8\";\n\n"))
+	body.Write([]byte(fmt.Sprintf("The SMTP settings of this server work, it can send emails from %s.\n", service.from)))
+
+	return service.send(ctx, "test", to, body.Bytes())
+}
+
+// send delivers the message and counts the outcome per template
+func (service *emailServices) send(ctx context.Context, template string, to []string, message []byte) error {
+	_, span := Tracer.Start(ctx, "smtp.send", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("email.template", template),
+		semconv.NetPeerNameKey.String(service.host),
+	))
+	defer span.End()
+
+	err := smtp.SendMail(service.address, service.auth, service.from, to, message)
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	EmailsSentTotal.WithLabelValues(template, outcome).Inc()
+	return err
+}
+
+// Ping checks that the SMTP server accepts connections, without sending anything
+func (service *emailServices) Ping(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", service.address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, service.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if err := client.Hello("localhost"); err != nil {
+		return err
+	}
+	return client.Quit()
 }
@@ -0,0 +1,127 @@
+package providers
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var ErrUnsupportedImage = errors.New("unsupported image format")
+var ErrImageTooLarge = errors.New("image is too large")
+
+// sniffed content types that are accepted, mapped to the decoder name
+var allowedImageTypes = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+type ImageVariant struct {
+	Size        int
+	ContentType string
+	Data        []byte
+}
+
+// image service interface
+type ImageService interface {
+	Process(reader io.Reader) ([]ImageVariant, error)
+}
+
+type imageServices struct {
+	maxBytes     int64
+	maxDimension int
+	sizes        []int
+	quality      int
+}
+
+func NewImageService(configs *Config) ImageService {
+	return &imageServices{
+		maxBytes:     configs.ImageMaxBytes,
+		maxDimension: configs.ImageMaxDimension,
+		sizes:        configs.ProfileSizes,
+		quality:      85,
+	}
+}
+
+// Process validates an uploaded image and re-encodes it as square JPEGs in
+// every configured size. Re-encoding drops any EXIF or other metadata.
+func (service *imageServices) Process(reader io.Reader) ([]ImageVariant, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, service.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > service.maxBytes {
+		return nil, ErrImageTooLarge
+	}
+
+	// trust the content, not the client supplied filename or content type
+	format, ok := allowedImageTypes[http.DetectContentType(data)]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+
+	// check the dimensions before decoding so huge images are never expanded in memory
+	config, decodedFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decodedFormat != format {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width > service.maxDimension || config.Height > service.maxDimension {
+		return nil, ErrImageTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	src = cropSquare(src)
+
+	variants := make([]ImageVariant, 0, len(service.sizes))
+	for _, size := range service.sizes {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+		// JPEG has no alpha channel, flatten transparent images onto white
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+		var out bytes.Buffer
+		if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: service.quality}); err != nil {
+			return nil, err
+		}
+		variants = append(variants, ImageVariant{
+			Size:        size,
+			ContentType: "image/jpeg",
+			Data:        out.Bytes(),
+		})
+	}
+	return variants, nil
+}
+
+// cropSquare returns the largest centered square of img
+func cropSquare(img image.Image) image.Image {
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	rect := image.Rect(x, y, x+side, y+side)
+
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
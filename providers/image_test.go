@@ -0,0 +1,143 @@
+package providers
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func newTestImageService(maxBytes int64, maxDimension int, sizes ...int) ImageService {
+	return NewImageService(&Config{ImageMaxBytes: maxBytes, ImageMaxDimension: maxDimension, ProfileSizes: sizes})
+}
+
+// testImage is red on its left half and blue on its right half
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestImageContentType(t *testing.T) {
+	service := newTestImageService(1<<20, 1024, 32)
+	img := testImage(40, 40)
+
+	var jpegData, gifData bytes.Buffer
+	if err := jpeg.Encode(&jpegData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.Encode(&gifData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{"png": encodePNG(t, img), "jpeg": jpegData.Bytes(), "gif": gifData.Bytes()} {
+		if _, err := service.Process(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	pngData := encodePNG(t, img)
+	for name, data := range map[string][]byte{
+		"text":               []byte("hello, this is not an image"),
+		"svg":                []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`),
+		"html":               []byte("<html><body>hi</body></html>"),
+		"truncated png":      pngData[:len(pngData)/2],
+		"png signature only": pngData[:8],
+		"empty":              {},
+	} {
+		if _, err := service.Process(bytes.NewReader(data)); !errors.Is(err, ErrUnsupportedImage) {
+			t.Errorf("%s: got %v, want ErrUnsupportedImage", name, err)
+		}
+	}
+}
+
+func TestImageLimits(t *testing.T) {
+	data := encodePNG(t, testImage(64, 32))
+
+	if _, err := newTestImageService(int64(len(data)), 64, 16).Process(bytes.NewReader(data)); err != nil {
+		t.Fatalf("at the limits: %v", err)
+	}
+	if _, err := newTestImageService(int64(len(data))-1, 64, 16).Process(bytes.NewReader(data)); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("over the byte limit: got %v", err)
+	}
+	if _, err := newTestImageService(1<<20, 63, 16).Process(bytes.NewReader(data)); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("wider than the dimension limit: got %v", err)
+	}
+	tall := encodePNG(t, testImage(8, 100))
+	if _, err := newTestImageService(1<<20, 64, 16).Process(bytes.NewReader(tall)); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("taller than the dimension limit: got %v", err)
+	}
+}
+
+func TestImageVariants(t *testing.T) {
+	// 300x100 crops to the centered 100x100 square, half red and half blue
+	variants, err := newTestImageService(1<<20, 1024, 16, 64, 200).Process(bytes.NewReader(encodePNG(t, testImage(300, 100))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variants) != 3 {
+		t.Fatalf("got %d variants", len(variants))
+	}
+	for i, size := range []int{16, 64, 200} {
+		variant := variants[i]
+		if variant.Size != size || variant.ContentType != "image/jpeg" {
+			t.Errorf("variant %d: got size %d, %s", i, variant.Size, variant.ContentType)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(variant.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() != size || bounds.Dy() != size {
+			t.Errorf("variant %d: got %dx%d", i, bounds.Dx(), bounds.Dy())
+		}
+		left, right := img.At(size/8, size/2), img.At(size-1-size/8, size/2)
+		if !reddish(left) || !bluish(right) {
+			t.Errorf("variant %d: not cropped around the center, left %v right %v", i, left, right)
+		}
+	}
+}
+
+func TestImageTransparency(t *testing.T) {
+	// transparent pixels are flattened onto white, JPEG has no alpha
+	variants, err := newTestImageService(1<<20, 1024, 16).Process(bytes.NewReader(encodePNG(t, image.NewNRGBA(image.Rect(0, 0, 20, 20)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(variants[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := img.At(8, 8).RGBA(); r < 0xf000 || g < 0xf000 || b < 0xf000 {
+		t.Errorf("got %v, want white", img.At(8, 8))
+	}
+}
+
+func reddish(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xc000 && g < 0x4000 && b < 0x4000
+}
+
+func bluish(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return b > 0xc000 && r < 0x4000 && g < 0x4000
+}
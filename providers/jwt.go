@@ -1,48 +1,98 @@
 package providers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 )
 
+// AccessTokenExpiry is the lifetime of the access tokens of users
+const AccessTokenExpiry = 15 * time.Minute
+
+// ServiceTokenExpiry is the lifetime of the access tokens of the service
+// accounts, which get a new one with their secret instead of a refresh token
+const ServiceTokenExpiry = time.Hour
+
 //jwt service
 type JWTService interface {
 	GenerateToken(userId string, isUser bool, expiresIn time.Duration) string
+	// GenerateServiceToken issues a token of a service account, whose sub
+	// is the client id and whose user claim is false
+	GenerateServiceToken(clientId string, scopes []string, expiresIn time.Duration) string
+	// GenerateClientToken issues a token of a user to a registered client,
+	// whose aud is the client id and whose scope is what the user consented to
+	GenerateClientToken(userId string, clientId string, scope string, expiresIn time.Duration) string
 	ValidateToken(token string) (*jwt.Token, error)
 }
 type authCustomClaims struct {
 	UserId string `json:"sub"`
 	User   bool   `json:"user"`
+	// Scope is the space separated scopes of a service account, or of the
+	// consent of a user to a registered client
+	Scope string `json:"scope,omitempty"`
 	jwt.StandardClaims
 }
 
 type jwtServices struct {
 	secretKey string
-	issure    string
+	// keyId is sent in the kid header so that tokens signed with a
+	// previous secret keep validating while the secret is rotated
+	keyId  string
+	keys   map[string]string
+	issure string
 }
 
 //auth-jwt
 func NewJWTService(configs *Config) JWTService {
+	keys := map[string]string{}
+	for _, secret := range configs.JwtPreviousSecrets {
+		keys[JWTKeyId(secret)] = secret
+	}
+	keys[JWTKeyId(configs.JwtSecret)] = configs.JwtSecret
 	return &jwtServices{
 		secretKey: configs.JwtSecret,
+		keyId:     JWTKeyId(configs.JwtSecret),
+		keys:      keys,
 		issure:    configs.AppName,
 	}
 }
 
+// JWTKeyId identifies a signing secret without revealing it
+func JWTKeyId(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
 func (service *jwtServices) GenerateToken(userId string, isUser bool, expiresIn time.Duration) string {
+	return service.sign(&authCustomClaims{UserId: userId, User: isUser}, expiresIn)
+}
 
-	claims := &authCustomClaims{
-		userId,
-		isUser,
-		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(expiresIn).Unix(),
-			Issuer:    service.issure,
-			IssuedAt:  time.Now().Unix(),
-		},
+func (service *jwtServices) GenerateServiceToken(clientId string, scopes []string, expiresIn time.Duration) string {
+	return service.sign(&authCustomClaims{UserId: clientId, User: false, Scope: strings.Join(scopes, " ")}, expiresIn)
+}
+
+func (service *jwtServices) GenerateClientToken(userId string, clientId string, scope string, expiresIn time.Duration) string {
+	claims := &authCustomClaims{UserId: userId, User: true, Scope: scope}
+	claims.Audience = clientId
+	return service.sign(claims, expiresIn)
+}
+
+func (service *jwtServices) sign(claims *authCustomClaims, expiresIn time.Duration) string {
+	claims.StandardClaims = jwt.StandardClaims{
+		Audience:  claims.Audience,
+		ExpiresAt: time.Now().Add(expiresIn).Unix(),
+		Issuer:    service.issure,
+		IssuedAt:  time.Now().Unix(),
+		// the jti, to revoke the token before it expires
+		Id: uuid.NewString(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = service.keyId
 
 	//encoded string
 	t, err := token.SignedString([]byte(service.secretKey))
@@ -58,7 +108,16 @@ func (service *jwtServices) ValidateToken(encodedToken string) (*jwt.Token, erro
 			return nil, fmt.Errorf("invalid token: %s", token.Header["alg"])
 
 		}
-		return []byte(service.secretKey), nil
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			//tokens issued before key ids were introduced
+			return []byte(service.secretKey), nil
+		}
+		secret, ok := service.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("invalid token: unknown key %q", kid)
+		}
+		return []byte(secret), nil
 	})
 
 }
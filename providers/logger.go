@@ -0,0 +1,107 @@
+package providers
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// keys whose values never make it into the logs, compared case-insensitively
+var sensitiveLogKeys = map[string]bool{
+	"code":          true,
+	"authorization": true,
+	"cookie":        true,
+	"set-cookie":    true,
+	"x-auth-key":    true,
+	"tokenid":       true,
+}
+
+// any key containing one of these is redacted too, e.g. newPassword or refreshToken
+var sensitiveLogKeyParts = []string{"password", "secret", "token"}
+
+// NewLogger creates the application logger. Every record is enriched with the
+// request scoped attributes found in its context, see WithLogAttrs.
+func NewLogger(configs *Config) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(configs.LogLevel)); err != nil {
+		level = slog.LevelInfo
+	}
+	options := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactLogAttr,
+	}
+
+	var handler slog.Handler
+	if configs.LogFormat == "text" {
+		handler = slog.NewTextHandler(os.Stdout, options)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	}
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+func redactLogAttr(groups []string, attr slog.Attr) slog.Attr {
+	if isSensitiveLogKey(attr.Key) && attr.Value.Kind() != slog.KindGroup {
+		return slog.String(attr.Key, "[redacted]")
+	}
+	return attr
+}
+
+func isSensitiveLogKey(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveLogKeys[key] {
+		return true
+	}
+	for _, part := range sensitiveLogKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+type logAttrsKey struct{}
+
+// logAttrs are collected while a request is handled, later middlewares
+// (e.g. authentication) can add to them
+type logAttrs struct {
+	mutex sync.Mutex
+	attrs []slog.Attr
+}
+
+// WithLogAttrs returns a context whose log records carry attrs, in addition
+// to the attributes already attached to ctx
+func WithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	if existing, ok := ctx.Value(logAttrsKey{}).(*logAttrs); ok {
+		existing.mutex.Lock()
+		defer existing.mutex.Unlock()
+		existing.attrs = append(existing.attrs, attrs...)
+		return ctx
+	}
+	return context.WithValue(ctx, logAttrsKey{}, &logAttrs{attrs: attrs})
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (handler *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if attrs, ok := ctx.Value(logAttrsKey{}).(*logAttrs); ok {
+			attrs.mutex.Lock()
+			record.AddAttrs(attrs.attrs...)
+			attrs.mutex.Unlock()
+		}
+	}
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: handler.Handler.WithGroup(name)}
+}
@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus collectors, registered with the default registry and exposed on /metrics
+var (
+	HttpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by route template and status.",
+	}, []string{"method", "route", "status"})
+
+	HttpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route template and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	HttpRequestsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests currently being served by route template.",
+	}, []string{"method", "route"})
+
+	MongoOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongo_operation_duration_seconds",
+		Help:    "MongoDB command latency by collection, command and outcome.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"collection", "operation", "outcome"})
+
+	EmailsSentTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "emails_sent_total",
+		Help: "Number of emails sent by template and outcome.",
+	}, []string{"template", "outcome"})
+
+	LoginAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "login_attempts_total",
+		Help: "Number of login attempts by outcome and failure reason.",
+	}, []string{"outcome", "reason"})
+)
+
+// RegisterActiveRefreshTokens exposes the number of stored refresh tokens,
+// count is called on every scrape
+func RegisterActiveRefreshTokens(count func(ctx context.Context) (int64, error)) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "refresh_tokens_active",
+		Help: "Number of refresh tokens currently stored.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		n, err := count(ctx)
+		if err != nil {
+			return -1
+		}
+		return float64(n)
+	})
+}
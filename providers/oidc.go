@@ -0,0 +1,140 @@
+package providers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// IDTokenExpiry is the lifetime of the OpenID Connect ID tokens
+const IDTokenExpiry = time.Hour
+
+// IDTokenClaims are the claims of an ID token besides the ones
+// IDTokenService sets: iss, iat and exp
+type IDTokenClaims struct {
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+	jwt.StandardClaims
+}
+
+// JSONWebKey is the public part of a signing key, RFC 7517
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// IDTokenService signs the ID tokens with RS256, so that the relying
+// parties verify them with the public key of the JWKS instead of a secret
+type IDTokenService interface {
+	Issuer() string
+	GenerateIDToken(claims IDTokenClaims) (string, error)
+	JWKS() JSONWebKeySet
+}
+
+type idTokenService struct {
+	issuer string
+	key    *rsa.PrivateKey
+	keyId  string
+}
+
+// NewIDTokenService loads the PEM RSA key of OIDC_SIGNING_KEY, which the
+// config requires unless ENV is local. Without one a key is generated, the ID
+// tokens it signs are only valid until the restart and on this replica.
+func NewIDTokenService(configs *Config, logger *slog.Logger) (IDTokenService, error) {
+	var key *rsa.PrivateKey
+	if configs.OidcSigningKey != "" {
+		parsed, err := parseRSAPrivateKey(configs.OidcSigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("OIDC_SIGNING_KEY: %w", err)
+		}
+		key = parsed
+	} else {
+		logger.Warn("OIDC_SIGNING_KEY is not set, signing the ID tokens with a temporary key")
+		generated, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		key = generated
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	return &idTokenService{
+		issuer: strings.TrimRight(configs.Domain, "/"),
+		key:    key,
+		keyId:  hex.EncodeToString(sum[:8]),
+	}, nil
+}
+
+func parseRSAPrivateKey(encoded string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errors.New("not a PEM key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+	return key, nil
+}
+
+// Issuer is the issuer of the tokens, the public URL of the server
+func (service *idTokenService) Issuer() string {
+	return service.issuer
+}
+
+func (service *idTokenService) GenerateIDToken(claims IDTokenClaims) (string, error) {
+	now := time.Now()
+	claims.Issuer = service.issuer
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(IDTokenExpiry).Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = service.keyId
+	return token.SignedString(service.key)
+}
+
+func (service *idTokenService) JWKS() JSONWebKeySet {
+	return JSONWebKeySet{Keys: []JSONWebKey{{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: service.keyId,
+		N:   base64.RawURLEncoding.EncodeToString(service.key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(service.key.E)).Bytes()),
+	}}}
+}
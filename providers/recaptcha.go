@@ -0,0 +1,77 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const siteVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+
+// traced client, propagating the trace context to the verify endpoint
+var recaptchaClient = &http.Client{
+	Transport: otelhttp.NewTransport(http.DefaultTransport),
+	Timeout:   10 * time.Second,
+}
+
+type SiteVerifyResponse struct {
+	Success     bool      `json:"success"`
+	Score       float64   `json:"score"`
+	Action      string    `json:"action"`
+	ChallengeTS time.Time `json:"challenge_ts"`
+	Hostname    string    `json:"hostname"`
+	ErrorCodes  []string  `json:"error-codes"`
+}
+
+// CheckRecaptcha verifies the reCAPTCHA v3 response of a form, which must be
+// for action unless action is empty
+func CheckRecaptcha(ctx context.Context, secret, response, action string) error {
+	if response == "" {
+		// the script of the form did not run, no need to ask
+		return errors.New("missing recaptcha response")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, siteVerifyURL, nil)
+	if err != nil {
+		return err
+	}
+
+	// Add necessary request parameters.
+	q := req.URL.Query()
+	q.Add("secret", secret)
+	q.Add("response", response)
+	req.URL.RawQuery = q.Encode()
+
+	// Make request
+	resp, err := recaptchaClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Decode response.
+	var body SiteVerifyResponse
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+
+	// Check recaptcha verification success.
+	if !body.Success {
+		return errors.New("unsuccessful recaptcha verify request")
+	}
+
+	// Check response score.
+	if body.Score < 0.5 {
+		return errors.New("lower received score than expected")
+	}
+
+	// Check response action.
+	if action != "" && body.Action != action {
+		return errors.New("mismatched recaptcha action")
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package providers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const AccessTokenCookie = "access_token"
+const RefreshTokenCookie = "refresh_token"
+const CSRFCookie = "csrf_token"
+const CSRFHeader = "X-CSRF-Token"
+
+// the cookies of the sign in page of /authorize, where the users of the
+// OpenID Connect clients log in
+const SignInCookie = "sso_session"
+const SignInCSRFCookie = "sso_csrf"
+const signInPath = "/oauth/authorize"
+
+// SessionModeHeader is sent with login as "cookie" to get the tokens as
+// cookies instead of in the body
+const SessionModeHeader = "X-Session-Mode"
+
+// the paths the cookies are sent to, the refresh token only goes to the
+// refresh and logout routes
+const accessTokenPath = "/v1"
+const refreshTokenPath = "/v1/auth"
+
+var ErrCSRF = errors.New("csrf check failed")
+
+// SessionCookieService keeps the tokens of browser sessions in HttpOnly
+// cookies, out of reach of scripts. Requests authenticated by those cookies
+// must pass CheckCSRF.
+type SessionCookieService interface {
+	// Requested reports whether the client asked for a cookie session and
+	// the mode is enabled
+	Requested(c *gin.Context) bool
+	// SetSession sets the cookies of a new session and returns its csrf
+	// token, which scripts send back in the X-CSRF-Token header
+	SetSession(c *gin.Context, accessToken, refreshToken string) (string, error)
+	SetAccessToken(c *gin.Context, accessToken string)
+	ClearSession(c *gin.Context)
+	// AccessToken and RefreshToken return the token of the cookie, if any
+	AccessToken(c *gin.Context) string
+	RefreshToken(c *gin.Context) string
+	// CheckCSRF compares the X-CSRF-Token header with the csrf cookie and
+	// the Origin with the allowed origin, safe methods are not checked
+	CheckCSRF(c *gin.Context) error
+	// SetSignInSession keeps the refresh token of a user signed in at
+	// /authorize, whichever the session mode. The cookie is SameSite=Lax as
+	// the clients redirect their users there.
+	SetSignInSession(c *gin.Context, refreshToken string)
+	SignInSession(c *gin.Context) string
+	ClearSignInSession(c *gin.Context)
+	// SignInFormToken returns the csrf token to put in the forms of
+	// /authorize, which CheckSignInForm compares with its cookie
+	SignInFormToken(c *gin.Context) (string, error)
+	CheckSignInForm(c *gin.Context, token string) error
+}
+
+type sessionCookieService struct {
+	enabled       bool
+	domain        string
+	secure        bool
+	sameSite      http.SameSite
+	maxAge        time.Duration
+	accessMaxAge  time.Duration
+	allowedOrigin string
+}
+
+func NewSessionCookieService(configs *Config) SessionCookieService {
+	sameSite := map[string]http.SameSite{
+		"strict": http.SameSiteStrictMode,
+		"lax":    http.SameSiteLaxMode,
+		"none":   http.SameSiteNoneMode,
+	}[configs.CookieSameSite]
+	allowedOrigin := ""
+	if origin, err := url.Parse(configs.AllowOrigin); err == nil && configs.AllowOrigin != "" {
+		allowedOrigin = origin.Scheme + "://" + origin.Host
+	}
+	return &sessionCookieService{
+		enabled:       configs.SessionCookies,
+		domain:        configs.CookieDomain,
+		secure:        configs.CookieSecure,
+		sameSite:      sameSite,
+		maxAge:        configs.SessionMaxAge,
+		accessMaxAge:  AccessTokenExpiry,
+		allowedOrigin: allowedOrigin,
+	}
+}
+
+func (service *sessionCookieService) Requested(c *gin.Context) bool {
+	return service.enabled && strings.EqualFold(c.GetHeader(SessionModeHeader), "cookie")
+}
+
+func (service *sessionCookieService) setCookie(c *gin.Context, name, value, path string, maxAge time.Duration, httpOnly bool) {
+	service.setCookieSameSite(c, name, value, path, maxAge, httpOnly, service.sameSite)
+}
+
+func (service *sessionCookieService) setCookieSameSite(c *gin.Context, name, value, path string, maxAge time.Duration, httpOnly bool, sameSite http.SameSite) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   service.domain,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   service.secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	}
+	if value == "" {
+		// removed, Expires for the clients which ignore Max-Age
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(0, 0)
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+func newCSRFToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+func (service *sessionCookieService) SetSession(c *gin.Context, accessToken, refreshToken string) (string, error) {
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	service.setCookie(c, AccessTokenCookie, accessToken, accessTokenPath, service.accessMaxAge, true)
+	service.setCookie(c, RefreshTokenCookie, refreshToken, refreshTokenPath, service.maxAge, true)
+	// readable by scripts, which is the point of the double submit
+	service.setCookie(c, CSRFCookie, csrfToken, "/", service.maxAge, false)
+	return csrfToken, nil
+}
+
+func (service *sessionCookieService) SetAccessToken(c *gin.Context, accessToken string) {
+	service.setCookie(c, AccessTokenCookie, accessToken, accessTokenPath, service.accessMaxAge, true)
+}
+
+func (service *sessionCookieService) ClearSession(c *gin.Context) {
+	service.setCookie(c, AccessTokenCookie, "", accessTokenPath, 0, true)
+	service.setCookie(c, RefreshTokenCookie, "", refreshTokenPath, 0, true)
+	service.setCookie(c, CSRFCookie, "", "/", 0, false)
+}
+
+func (service *sessionCookieService) AccessToken(c *gin.Context) string {
+	return service.cookie(c, AccessTokenCookie)
+}
+
+func (service *sessionCookieService) RefreshToken(c *gin.Context) string {
+	return service.cookie(c, RefreshTokenCookie)
+}
+
+func (service *sessionCookieService) cookie(c *gin.Context, name string) string {
+	if !service.enabled {
+		return ""
+	}
+	value, err := c.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+func (service *sessionCookieService) CheckCSRF(c *gin.Context) error {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	if origin := c.GetHeader("Origin"); origin != "" && service.allowedOrigin != "" && origin != service.allowedOrigin {
+		return ErrCSRF
+	}
+	cookie, err := c.Cookie(CSRFCookie)
+	header := c.GetHeader(CSRFHeader)
+	if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+		return ErrCSRF
+	}
+	return nil
+}
+
+func (service *sessionCookieService) SetSignInSession(c *gin.Context, refreshToken string) {
+	service.setCookieSameSite(c, SignInCookie, refreshToken, signInPath, service.maxAge, true, http.SameSiteLaxMode)
+}
+
+func (service *sessionCookieService) SignInSession(c *gin.Context) string {
+	value, err := c.Cookie(SignInCookie)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+func (service *sessionCookieService) ClearSignInSession(c *gin.Context) {
+	service.setCookieSameSite(c, SignInCookie, "", signInPath, 0, true, http.SameSiteLaxMode)
+}
+
+func (service *sessionCookieService) SignInFormToken(c *gin.Context) (string, error) {
+	if token, err := c.Cookie(SignInCSRFCookie); err == nil && token != "" {
+		return token, nil
+	}
+	token, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+	// only sent back by the forms of the page, which are same site
+	service.setCookieSameSite(c, SignInCSRFCookie, token, signInPath, service.maxAge, true, http.SameSiteStrictMode)
+	return token, nil
+}
+
+func (service *sessionCookieService) CheckSignInForm(c *gin.Context, token string) error {
+	cookie, err := c.Cookie(SignInCSRFCookie)
+	if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(token)) != 1 {
+		return ErrCSRF
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package providers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	service := NewSessionCookieService(&Config{SessionCookies: true, AllowOrigin: "https://app.example.com/"})
+
+	for name, test := range map[string]struct {
+		method, origin, cookie, header string
+		ok                             bool
+	}{
+		"matching token":      {http.MethodPost, "", "token", "token", true},
+		"allowed origin":      {http.MethodPut, "https://app.example.com", "token", "token", true},
+		"missing header":      {http.MethodPost, "", "token", "", false},
+		"mismatched header":   {http.MethodPost, "", "token", "other", false},
+		"missing cookie":      {http.MethodPost, "", "", "token", false},
+		"missing both":        {http.MethodDelete, "", "", "", false},
+		"foreign origin":      {http.MethodPost, "https://attacker.example.com", "token", "token", false},
+		"origin of the port":  {http.MethodPost, "https://app.example.com:8443", "token", "token", false},
+		"GET is exempt":       {http.MethodGet, "https://attacker.example.com", "", "", true},
+		"HEAD is exempt":      {http.MethodHead, "", "", "", true},
+		"OPTIONS is exempt":   {http.MethodOptions, "", "", "", true},
+		"PATCH is not exempt": {http.MethodPatch, "", "token", "", false},
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(test.method, "/v1/user/details", nil)
+		if test.origin != "" {
+			c.Request.Header.Set("Origin", test.origin)
+		}
+		if test.cookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: CSRFCookie, Value: test.cookie})
+		}
+		if test.header != "" {
+			c.Request.Header.Set(CSRFHeader, test.header)
+		}
+		if err := service.CheckCSRF(c); (err == nil) != test.ok {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+}
+
+func TestCheckCSRFWithoutAllowedOrigin(t *testing.T) {
+	service := NewSessionCookieService(&Config{SessionCookies: true})
+
+	// only the token is checked
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/auth/refresh", nil)
+	c.Request.Header.Set("Origin", "https://elsewhere.example.com")
+	c.Request.AddCookie(&http.Cookie{Name: CSRFCookie, Value: "token"})
+	c.Request.Header.Set(CSRFHeader, "token")
+	if err := service.CheckCSRF(c); err != nil {
+		t.Fatal(err)
+	}
+}
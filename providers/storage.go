@@ -0,0 +1,125 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// blob storage interface
+type BlobStore interface {
+	Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(ctx context.Context, key string) (string, error)
+}
+
+func NewBlobStore(configs *Config) BlobStore {
+	switch configs.StorageDriver {
+	case "local":
+		return NewLocalBlobStore(configs.StoragePath, configs.Domain+"/public")
+	case "s3":
+		store, err := NewS3BlobStore(configs)
+		if err != nil {
+			panic(err)
+		}
+		return store
+	default:
+		panic(fmt.Errorf("unknown storage driver: %s", configs.StorageDriver))
+	}
+}
+
+type localBlobStore struct {
+	root    string
+	baseUrl string
+}
+
+// NewLocalBlobStore stores blobs under root and serves them from baseUrl,
+// which is expected to be mapped onto root by a static file handler.
+func NewLocalBlobStore(root, baseUrl string) BlobStore {
+	return &localBlobStore{
+		root:    root,
+		baseUrl: strings.TrimRight(baseUrl, "/"),
+	}
+}
+
+// path resolves key inside the root directory, rejecting keys that would escape it
+func (store *localBlobStore) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid key: %q", key)
+	}
+	return filepath.Join(store.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (store *localBlobStore) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	target, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so readers never see a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (store *localBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := store.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return file, err
+}
+
+func (store *localBlobStore) Delete(ctx context.Context, key string) error {
+	target, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (store *localBlobStore) URL(ctx context.Context, key string) (string, error) {
+	return store.baseUrl + "/" + strings.TrimLeft(key, "/"), nil
+}
+
+// CheckBlobStore verifies the store is writable by storing and removing a small probe blob
+func CheckBlobStore(ctx context.Context, store BlobStore) error {
+	key := "health/" + uuid.NewString()
+	if err := store.Put(ctx, key, strings.NewReader("ok"), 2, "text/plain"); err != nil {
+		return err
+	}
+	return store.Delete(ctx, key)
+}
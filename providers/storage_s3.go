@@ -0,0 +1,77 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type s3BlobStore struct {
+	client    *minio.Client
+	bucket    string
+	publicUrl string
+	urlExpiry time.Duration
+}
+
+// NewS3BlobStore talks to any S3-compatible endpoint (AWS, MinIO, ...).
+// When S3PublicUrl is set objects are assumed to be publicly readable under
+// that prefix, otherwise pre-signed download URLs are handed out.
+func NewS3BlobStore(configs *Config) (BlobStore, error) {
+	client, err := minio.New(configs.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(configs.S3AccessKey, configs.S3SecretKey, ""),
+		Secure: configs.S3UseSSL,
+		Region: configs.S3Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3BlobStore{
+		client:    client,
+		bucket:    configs.S3Bucket,
+		publicUrl: strings.TrimRight(configs.S3PublicUrl, "/"),
+		urlExpiry: configs.S3UrlExpiry,
+	}, nil
+}
+
+func (store *s3BlobStore) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	_, err := store.client.PutObject(ctx, store.bucket, key, reader, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+func (store *s3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := store.client.GetObject(ctx, store.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy, stat it so missing keys are reported here
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+func (store *s3BlobStore) Delete(ctx context.Context, key string) error {
+	return store.client.RemoveObject(ctx, store.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (store *s3BlobStore) URL(ctx context.Context, key string) (string, error) {
+	if store.publicUrl != "" {
+		return store.publicUrl + "/" + strings.TrimLeft(key, "/"), nil
+	}
+	url, err := store.client.PresignedGetObject(ctx, store.bucket, key, store.urlExpiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return url.String(), nil
+}
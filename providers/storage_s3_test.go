@@ -0,0 +1,178 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeS3Object struct {
+	body        []byte
+	contentType string
+}
+
+// fakeS3 answers the path style object requests of the S3 API, enough for s3BlobStore
+type fakeS3 struct {
+	mutex   sync.Mutex
+	objects map[string]fakeS3Object
+}
+
+func (fake *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// without TLS the body is signed chunk by chunk, see decodeAWSChunked
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			if body, err = decodeAWSChunked(body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		fake.objects[r.URL.Path] = fakeS3Object{body: body, contentType: r.Header.Get("Content-Type")}
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		object, ok := fake.objects[r.URL.Path]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			}
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Accept-Ranges", "bytes")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(object.body)))
+	case http.MethodDelete:
+		delete(fake.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeAWSChunked strips the "<hex size>;chunk-signature=<signature>\r\n" framing of a streaming upload
+func decodeAWSChunked(body []byte) ([]byte, error) {
+	var decoded []byte
+	for {
+		header, rest, ok := strings.Cut(string(body), "\r\n")
+		if !ok {
+			return nil, errors.New("truncated chunk header")
+		}
+		hexSize, _, _ := strings.Cut(header, ";")
+		size, err := strconv.ParseInt(hexSize, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return decoded, nil
+		}
+		if int64(len(rest)) < size+2 {
+			return nil, errors.New("truncated chunk")
+		}
+		decoded = append(decoded, rest[:size]...)
+		body = []byte(rest[size+2:])
+	}
+}
+
+func newTestS3BlobStore(t *testing.T, publicUrl string) (BlobStore, *fakeS3) {
+	fake := &fakeS3{objects: map[string]fakeS3Object{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3BlobStore(&Config{
+		S3Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		S3Region:    "us-east-1",
+		S3Bucket:    "bucket",
+		S3AccessKey: "access",
+		S3SecretKey: "secret",
+		S3PublicUrl: publicUrl,
+		S3UrlExpiry: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, fake
+}
+
+func TestS3BlobStore(t *testing.T) {
+	ctx := context.Background()
+	store, fake := newTestS3BlobStore(t, "")
+
+	if err := store.Put(ctx, "profile/1.png", strings.NewReader("image"), 5, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if object := fake.objects["/bucket/profile/1.png"]; string(object.body) != "image" || object.contentType != "image/png" {
+		t.Fatalf("stored %q as %q", object.body, object.contentType)
+	}
+
+	reader, err := store.Get(ctx, "profile/1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "image" {
+		t.Fatalf("Get returned %q", body)
+	}
+
+	if err := store.Delete(ctx, "profile/1.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "profile/1.png"); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("Get of a deleted blob returned %v, want ErrBlobNotFound", err)
+	}
+
+	if err := CheckBlobStore(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.objects) != 0 {
+		t.Fatalf("CheckBlobStore left %d objects behind", len(fake.objects))
+	}
+}
+
+func TestS3BlobStoreURL(t *testing.T) {
+	ctx := context.Background()
+
+	store, _ := newTestS3BlobStore(t, "")
+	presigned, err := store.URL(ctx, "profile/1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(presigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Path != "/bucket/profile/1.png" || parsed.Query().Get("X-Amz-Signature") == "" || parsed.Query().Get("X-Amz-Expires") != "3600" {
+		t.Fatalf("URL returned %s, want a pre-signed URL valid for an hour", presigned)
+	}
+
+	store, _ = newTestS3BlobStore(t, "https://cdn.example.com/")
+	public, err := store.URL(ctx, "/profile/1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public != "https://cdn.example.com/profile/1.png" {
+		t.Fatalf("URL returned %s, want https://cdn.example.com/profile/1.png", public)
+	}
+}
@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// Tracer creates the spans of this application that are not covered by an
+// instrumentation library. It delegates to whatever provider InitTracing installs.
+var Tracer = otel.Tracer("GoApp")
+
+// InitTracing installs the global W3C trace-context propagator and a tracer
+// provider exporting to stdout or OTLP/HTTP (configured through the standard
+// OTEL_EXPORTER_OTLP_* variables). The returned function flushes pending
+// spans and must be called on shutdown.
+func InitTracing(ctx context.Context, configs *Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch configs.TracingExporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		err = fmt.Errorf("unknown tracing exporter: %s", configs.TracingExporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(configs.TracingSampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(configs.AppName),
+			semconv.ServiceVersionKey.String(Version),
+			semconv.DeploymentEnvironmentKey.String(configs.Env),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,41 @@
+package providers
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// set at build time, e.g.
+// go build -ldflags "-X GoApp/providers.Version=1.2.0 -X GoApp/providers.Commit=$(git rev-parse HEAD)"
+var Version = "dev"
+var Commit = ""
+var BuildTime = ""
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// GetBuildInfo describes the running binary, falling back to the version
+// control details embedded by the go toolchain when no ldflags were given
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"GoApp/db"
+	"GoApp/providers"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// stringList is a flag which may be repeated
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, " ")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+func createClient(configs *providers.Config, args []string) error {
+	flags := flag.NewFlagSet("client create", flag.ContinueOnError)
+	name := flags.String("name", "", "name of the client, such as the service using it")
+	public := flags.Bool("public", false, "a client without secret, such as a mobile app, which must use PKCE")
+	var redirectURIs stringList
+	flags.Var(&redirectURIs, "redirect-uri", "where OpenID Connect sends the users back, may be repeated")
+	var scopes stringList
+	flags.Var(&scopes, "scope", "a scope the client may get for itself with the client_credentials grant, may be repeated; introspect and revoke let a resource server handle every token on /oauth/introspect and /oauth/revoke")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return usageError("client create needs a --name")
+	}
+	for _, redirectURI := range redirectURIs {
+		// compared as is, fragments are not allowed, RFC 6749 section 3.1.2
+		parsed, err := url.Parse(redirectURI)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" || strings.ContainsAny(redirectURI, " ") {
+			return usageError("invalid redirect URI %q", redirectURI)
+		}
+	}
+	for _, scope := range scopes {
+		// scope-token of RFC 6749 section 3.3
+		invalid := func(r rune) bool { return r < 0x21 || r > 0x7e || r == '"' || r == '\\' }
+		if scope == "" || strings.IndexFunc(scope, invalid) >= 0 {
+			return usageError("invalid scope %q", scope)
+		}
+	}
+	if *public && len(redirectURIs) == 0 {
+		return usageError("a public client needs a --redirect-uri")
+	}
+	if *public && len(scopes) > 0 {
+		return usageError("a public client cannot have a --scope, the client_credentials grant needs a secret")
+	}
+	secret := ""
+	if !*public {
+		secret = randomSecret(32)
+	}
+
+	return withDatabase(configs, func(ctx context.Context, database *database) error {
+		client, err := database.clientService.CreateClient(ctx, *name, secret, redirectURIs, scopes)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created client %s\n", client.Name)
+		fmt.Printf("client_id=%s\n", client.ClientId)
+		if secret != "" {
+			fmt.Printf("client_secret=%s\n", secret)
+			fmt.Fprintln(os.Stderr, "Store the secret now, only its hash is kept.")
+		}
+		return nil
+	})
+}
+
+func listClients(configs *providers.Config, args []string) error {
+	if _, err := parseFlags(flag.NewFlagSet("client list", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+
+	return withDatabase(configs, func(ctx context.Context, database *database) error {
+		clients, err := database.clientService.ListClients(ctx)
+		if err != nil {
+			return err
+		}
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "CLIENT ID\tNAME\tTYPE\tCREATED\tREDIRECT URIS\tSCOPES")
+		for _, client := range clients {
+			kind := "confidential"
+			switch {
+			case client.Public():
+				kind = "public"
+			case client.ServiceAccount():
+				kind = "service"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", client.ClientId, client.Name, kind, client.CreatedAt.Local().Format(time.RFC3339), strings.Join(client.RedirectURIs, " "), strings.Join(client.Scopes, " "))
+		}
+		return table.Flush()
+	})
+}
+
+func deleteClient(configs *providers.Config, args []string) error {
+	args, err := parseFlags(flag.NewFlagSet("client delete", flag.ContinueOnError), args, "<client-id>")
+	if err != nil {
+		return err
+	}
+
+	return withDatabase(configs, func(ctx context.Context, database *database) error {
+		err := database.clientService.RemoveClient(ctx, args[0])
+		if errors.Is(err, db.ErrNotFound) {
+			return fmt.Errorf("client %s: %w", args[0], err)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deleted client %s\n", args[0])
+		return nil
+	})
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"GoApp/providers"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const usage = `Usage: GoApp [--config file] [command]
+
+Commands:
+  serve                          start the API server, the default
+  migrate [up]                   apply every pending migration
+  migrate down [n]               revert the last n migrations, 1 by default
+  migrate status                 list the migrations and when they were applied
+  user create [flags]            create an activated user, --admin for an administrator
+  user activate <email>          activate a user without the activation email
+  user reset-password <email>    set a new password, generated unless --password is given
+  tokens revoke <email>          end every session of a user
+  client create --name <name>    register an OAuth client and print its id and secret,
+                                 --redirect-uri for OpenID Connect, --public for apps without secret,
+                                 --scope for a service account using the client_credentials grant
+  client list                    list the registered OAuth clients
+  client delete <client-id>      remove an OAuth client
+  tenant create --name <name>    add a SCIM tenant and print the token of its identity provider
+  tenant list                    list the SCIM tenants
+  tenant delete <tenant-id>      remove a SCIM tenant, its users keep their accounts
+  jwt rotate                     generate a new JWT secret and print the settings to deploy
+  seed [--file fixtures.json]    create the fixture users, skipping existing ones
+  email test <to>                send a test email with the SMTP settings
+`
+
+// ErrUsage is returned for unknown commands and malformed arguments, after
+// printing the usage
+var ErrUsage = errors.New("invalid command line")
+
+// Run starts the server or runs one of the admin commands
+func Run(configs *providers.Config, args []string) error {
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+
+	switch command, args := args[0], args[1:]; command {
+	case "serve":
+		if len(args) > 0 {
+			return usageError("serve takes no arguments")
+		}
+		Init(configs)
+		return nil
+	case "migrate":
+		return Migrate(configs, args)
+	case "user":
+		return subcommand("user", args, map[string]func(*providers.Config, []string) error{
+			"create":         createUser,
+			"activate":       activateUser,
+			"reset-password": resetPassword,
+		}, configs)
+	case "tokens":
+		return subcommand("tokens", args, map[string]func(*providers.Config, []string) error{
+			"revoke": revokeTokens,
+		}, configs)
+	case "client":
+		return subcommand("client", args, map[string]func(*providers.Config, []string) error{
+			"create": createClient,
+			"list":   listClients,
+			"delete": deleteClient,
+		}, configs)
+	case "tenant":
+		return subcommand("tenant", args, map[string]func(*providers.Config, []string) error{
+			"create": createTenant,
+			"list":   listTenants,
+			"delete": deleteTenant,
+		}, configs)
+	case "jwt":
+		return subcommand("jwt", args, map[string]func(*providers.Config, []string) error{
+			"rotate": rotateJWTSecret,
+		}, configs)
+	case "seed":
+		return seed(configs, args)
+	case "email":
+		return subcommand("email", args, map[string]func(*providers.Config, []string) error{
+			"test": testEmail,
+		}, configs)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		return usageError("unknown command %q", command)
+	}
+}
+
+func subcommand(name string, args []string, commands map[string]func(*providers.Config, []string) error, configs *providers.Config) error {
+	if len(args) == 0 {
+		return usageError("%s needs a subcommand", name)
+	}
+	run, ok := commands[args[0]]
+	if !ok {
+		return usageError("unknown command %q", name+" "+args[0])
+	}
+	return run(configs, args[1:])
+}
+
+func usageError(format string, args ...interface{}) error {
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), ErrUsage)
+}
+
+// parseFlags parses the flags of a command and checks the number of
+// remaining positional arguments
+func parseFlags(flags *flag.FlagSet, args []string, positional ...string) ([]string, error) {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil {
+		return nil, usageError("%s: %s", flags.Name(), err)
+	}
+	if flags.NArg() != len(positional) {
+		return nil, usageError("%s expects %s", flags.Name(), strings.Join(append([]string{"<flags>"}, positional...), " "))
+	}
+	return flags.Args(), nil
+}
+
+// commandContext is cancelled by Ctrl-C, so that commands stop waiting on the database
+func commandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// withDatabase opens the database the way the server does, migrations
+// included, and closes it once fn returns
+func withDatabase(configs *providers.Config, fn func(ctx context.Context, database *database) error) error {
+	if configs.DatabaseDriver == "memory" {
+		return errors.New("the memory database is not shared with the server, pick another DATABASE_DRIVER")
+	}
+	logger := providers.NewLogger(configs)
+	database := openDatabase(configs, logger)
+	defer database.close(context.Background())
+
+	ctx, stop := commandContext()
+	defer stop()
+	return fn(ctx, database)
+}
+
+// randomSecret returns n random bytes, URL safe encoded
+func randomSecret(n int) string {
+	secret := make([]byte, n)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(secret)
+}
+
+func rotateJWTSecret(configs *providers.Config, args []string) error {
+	if _, err := parseFlags(flag.NewFlagSet("jwt rotate", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+	secret := randomSecret(48)
+
+	// the current secret keeps validating the access tokens it signed
+	previous := append([]string{configs.JwtSecret}, configs.JwtPreviousSecrets...)
+	fmt.Printf("JWT_SECRET=%s\n", secret)
+	fmt.Printf("JWT_PREVIOUS_SECRETS=%s\n", strings.Join(previous, ","))
+	fmt.Fprintf(os.Stderr, "Deploy these settings to every replica. The new key id is %s, drop the previous secrets once the access tokens they signed have expired.\n", providers.JWTKeyId(secret))
+	return nil
+}
+
+func testEmail(configs *providers.Config, args []string) error {
+	args, err := parseFlags(flag.NewFlagSet("email test", flag.ContinueOnError), args, "<to>")
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	if err := providers.NewEmailService(configs).SendTestEmail(ctx, args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Sent a test email to %s\n", args[0])
+	return nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"GoApp/db"
+	"GoApp/providers"
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// database bundles the services of the configured database driver
+type database struct {
+	userService                db.UserService
+	refreshTokenService        db.RefreshTokenService
+	uploadService              db.UploadService
+	clientService              db.ClientService
+	revokedTokenService        db.RevokedTokenService
+	authorizationCodeService   db.AuthorizationCodeService
+	deviceAuthorizationService db.DeviceAuthorizationService
+	tenantService              db.TenantService
+	// migrator is nil for the in-memory database, which has no schema
+	migrator db.Migrator
+	// ping checks that the database is reachable
+	ping func(ctx context.Context) error
+	// close releases the connections once the server stopped
+	close func(ctx context.Context) error
+}
+
+// openDatabase connects to the configured database and, when
+// DatabaseMigrate is set, applies the pending migrations
+func openDatabase(configs *providers.Config, logger *slog.Logger) *database {
+	database := connectDatabase(configs, logger)
+	if configs.DatabaseMigrate && database.migrator != nil {
+		// replicas wait for each other on the migration lock, give them time
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		if err := database.migrator.Up(ctx); err != nil {
+			logger.Error("Database migrations", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+	return database
+}
+
+// connectDatabase builds the services of the configured driver without migrating
+func connectDatabase(configs *providers.Config, logger *slog.Logger) *database {
+	switch configs.DatabaseDriver {
+	case "memory":
+		logger.Warn("Using the in-memory database, nothing is persisted")
+		return &database{
+			userService:                db.NewMemoryUserService(),
+			refreshTokenService:        db.NewMemoryRefreshTokenService(),
+			uploadService:              db.NewMemoryUploadService(),
+			clientService:              db.NewMemoryClientService(),
+			revokedTokenService:        db.NewMemoryRevokedTokenService(),
+			authorizationCodeService:   db.NewMemoryAuthorizationCodeService(),
+			deviceAuthorizationService: db.NewMemoryDeviceAuthorizationService(),
+			tenantService:              db.NewMemoryTenantService(),
+			ping:                       func(ctx context.Context) error { return nil },
+			close:                      func(ctx context.Context) error { return nil },
+		}
+	case "postgres", "sqlite":
+		sqlDB := db.OpenSQL(configs, logger)
+		return &database{
+			userService:                db.NewSQLUserService(sqlDB, configs),
+			refreshTokenService:        db.NewSQLRefreshTokenService(sqlDB, configs),
+			uploadService:              db.NewSQLUploadService(sqlDB, configs),
+			clientService:              db.NewSQLClientService(sqlDB, configs),
+			revokedTokenService:        db.NewSQLRevokedTokenService(sqlDB, configs),
+			authorizationCodeService:   db.NewSQLAuthorizationCodeService(sqlDB, configs),
+			deviceAuthorizationService: db.NewSQLDeviceAuthorizationService(sqlDB, configs),
+			tenantService:              db.NewSQLTenantService(sqlDB, configs),
+			migrator:                   db.NewSQLMigrator(sqlDB, configs.DatabaseDriver, logger),
+			ping:                       sqlDB.PingContext,
+			close: func(ctx context.Context) error {
+				return sqlDB.Close()
+			},
+		}
+	default:
+		dbClient := db.GetClient(*configs, logger)
+		return &database{
+			userService:                db.NewUserService(dbClient, configs),
+			refreshTokenService:        db.NewRefreshTokenService(dbClient, configs),
+			uploadService:              db.NewUploadService(dbClient, configs),
+			clientService:              db.NewClientService(dbClient, configs),
+			revokedTokenService:        db.NewRevokedTokenService(dbClient, configs),
+			authorizationCodeService:   db.NewAuthorizationCodeService(dbClient, configs),
+			deviceAuthorizationService: db.NewDeviceAuthorizationService(dbClient, configs),
+			tenantService:              db.NewTenantService(dbClient, configs),
+			migrator:                   db.NewMongoMigrator(dbClient, configs, logger),
+			ping: func(ctx context.Context) error {
+				return db.Ping(ctx, dbClient)
+			},
+			close: dbClient.Disconnect,
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"GoApp/controllers"
+	"GoApp/db"
+	"GoApp/lib"
+	"GoApp/providers"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deviceCode starts a device authorization of client
+func deviceCode(t *testing.T, server *testServer, client *db.Client, secret string) controllers.DeviceCodeResponse {
+	t.Helper()
+	var response controllers.DeviceCodeResponse
+	decodeResponse(t, server.postForm("/oauth/device/code", url.Values{"scope": {"openid email"}}, client.ClientId, secret), http.StatusOK, &response)
+	return response
+}
+
+// pollDevice polls the token endpoint as the device
+func pollDevice(server *testServer, client *db.Client, secret, deviceCode string) *httptest.ResponseRecorder {
+	return server.postForm("/oauth/token", url.Values{"grant_type": {controllers.DeviceCodeGrantType}, "device_code": {deviceCode}}, client.ClientId, secret)
+}
+
+// decideDevice approves or denies a user code as the signed in user
+func decideDevice(t *testing.T, server *testServer, user *db.User, userCode, action string) {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, "/v1/user/device", strings.NewReader(`{"userCode":"`+userCode+`","action":"`+action+`"}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+server.jwt.GenerateToken(user.ID, true, providers.AccessTokenExpiry))
+	decodeResponse(t, server.do(request), http.StatusOK, nil)
+}
+
+// quickDevice creates a device authorization the device may poll at any rate
+func quickDevice(t *testing.T, server *testServer, client *db.Client, expiresAt time.Time) *db.DeviceAuthorization {
+	t.Helper()
+	authorization, err := server.database.deviceAuthorizationService.CreateDeviceAuthorization(context.Background(), db.DeviceAuthorization{
+		ClientId:  client.ClientId,
+		Scope:     "openid",
+		Interval:  time.Second,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authorization
+}
+
+func TestDeviceCodeGrant(t *testing.T) {
+	server := newTestServer(t, nil)
+	user := server.createUser(t, "user@example.com")
+	client := server.createClient(t, "tv-secret", nil, nil)
+	other := server.createClient(t, "other-secret", nil, nil)
+
+	expectError := func(t *testing.T, recorder *httptest.ResponseRecorder, code string) {
+		t.Helper()
+		if recorder.Code != http.StatusBadRequest || errorCode(t, recorder) != code {
+			t.Fatalf("got %d %s, want %s", recorder.Code, recorder.Body, code)
+		}
+	}
+
+	t.Run("slow down", func(t *testing.T) {
+		codes := deviceCode(t, server, client, "tv-secret")
+		if codes.Interval != int64(controllers.DevicePollInterval.Seconds()) || codes.VerificationUri != "http://localhost/device" {
+			t.Fatalf("got %+v", codes)
+		}
+		expectError(t, pollDevice(server, client, "tv-secret", codes.DeviceCode), lib.OAuthAuthorizationPending)
+		for _, interval := range []time.Duration{2 * controllers.DevicePollInterval, 3 * controllers.DevicePollInterval} {
+			expectError(t, pollDevice(server, client, "tv-secret", codes.DeviceCode), lib.OAuthSlowDown)
+			authorization, err := server.database.deviceAuthorizationService.FindDeviceAuthorization(context.Background(), strings.ReplaceAll(codes.UserCode, "-", ""), time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if authorization.Interval != interval {
+				t.Fatalf("got interval %s, want %s", authorization.Interval, interval)
+			}
+		}
+	})
+
+	t.Run("approved", func(t *testing.T) {
+		codes := deviceCode(t, server, client, "tv-secret")
+		decideDevice(t, server, user, strings.ToLower(codes.UserCode), "allow")
+
+		// only the client it was issued to redeems the code
+		expectError(t, pollDevice(server, other, "other-secret", codes.DeviceCode), lib.OAuthInvalidGrant)
+
+		var tokens controllers.TokenResponse
+		decodeResponse(t, pollDevice(server, client, "tv-secret", codes.DeviceCode), http.StatusOK, &tokens)
+		if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.Scope != "openid email" {
+			t.Fatalf("got %+v", tokens)
+		}
+		if response := introspect(t, server, client.ClientId, "tv-secret", tokens.AccessToken); response.Sub != user.ID {
+			t.Fatalf("the tokens are not of the user who approved: %+v", response)
+		}
+		// the tokens are issued once
+		expectError(t, pollDevice(server, client, "tv-secret", codes.DeviceCode), lib.OAuthInvalidGrant)
+	})
+
+	t.Run("pending then denied", func(t *testing.T) {
+		authorization := quickDevice(t, server, client, time.Now().Add(controllers.DeviceCodeExpiry))
+		expectError(t, pollDevice(server, client, "tv-secret", authorization.DeviceCode), lib.OAuthAuthorizationPending)
+		expectError(t, pollDevice(server, client, "tv-secret", authorization.DeviceCode), lib.OAuthAuthorizationPending)
+
+		decideDevice(t, server, user, authorization.UserCode, "deny")
+		expectError(t, pollDevice(server, client, "tv-secret", authorization.DeviceCode), lib.OAuthAccessDenied)
+		expectError(t, pollDevice(server, client, "tv-secret", authorization.DeviceCode), lib.OAuthInvalidGrant)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		authorization := quickDevice(t, server, client, time.Now().Add(-time.Second))
+		expectError(t, pollDevice(server, client, "tv-secret", authorization.DeviceCode), lib.OAuthExpiredToken)
+
+		// nor can the user approve it any more
+		request := httptest.NewRequest(http.MethodPost, "/v1/user/device", strings.NewReader(`{"userCode":"`+authorization.UserCode+`","action":"allow"}`))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Authorization", "Bearer "+server.jwt.GenerateToken(user.ID, true, providers.AccessTokenExpiry))
+		if recorder := server.do(request); errorCode(t, recorder) != lib.TokenExpired {
+			t.Fatalf("approving an expired code: got %d %s", recorder.Code, recorder.Body)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		expectError(t, pollDevice(server, client, "tv-secret", "unknown"), lib.OAuthInvalidGrant)
+		expectError(t, pollDevice(server, client, "tv-secret", ""), lib.OAuthInvalidRequest)
+	})
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"GoApp/providers"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Migrate runs the migrate command:
+//
+//	migrate [up]       apply every pending migration
+//	migrate down [n]   revert the last n migrations, 1 by default
+//	migrate status     list the migrations and when they were applied
+func Migrate(config *providers.Config, args []string) error {
+	var configs providers.Config = *config
+
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	steps := 1
+	switch {
+	case command == "down" && len(args) == 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return usageError("migrate down: %q is not a positive number of steps", args[0])
+		}
+		steps = n
+	case command != "up" && command != "down" && command != "status":
+		return usageError("unknown command %q", "migrate "+command)
+	case len(args) > 0:
+		return usageError("migrate %s: unexpected arguments %v", command, args)
+	}
+
+	logger := providers.NewLogger(&configs)
+	database := connectDatabase(&configs, logger)
+	defer database.close(context.Background())
+	if database.migrator == nil {
+		return errors.New("migrate: the " + configs.DatabaseDriver + " database has no migrations")
+	}
+
+	// Ctrl-C stops waiting for the lock instead of leaving a half applied migration behind
+	ctx, stop := commandContext()
+	defer stop()
+
+	switch command {
+	case "down":
+		return database.migrator.Down(ctx, steps)
+	case "status":
+		statuses, err := database.migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return database.migrator.Up(ctx)
+	}
+}
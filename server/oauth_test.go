@@ -0,0 +1,137 @@
+package server
+
+import (
+	"GoApp/controllers"
+	"GoApp/providers"
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// the tokens of a user: from login, issued to the relying party and to another client
+type testTokens struct {
+	loginAccess, loginRefresh   string
+	clientAccess, clientRefresh string
+	otherAccess, otherRefresh   string
+}
+
+func newTestTokens(t *testing.T, server *testServer, userId, clientId, otherClientId string) testTokens {
+	ctx := context.Background()
+	tokens := testTokens{
+		loginAccess:  server.jwt.GenerateToken(userId, true, providers.AccessTokenExpiry),
+		clientAccess: server.jwt.GenerateClientToken(userId, clientId, "openid", providers.AccessTokenExpiry),
+		otherAccess:  server.jwt.GenerateClientToken(userId, otherClientId, "openid", providers.AccessTokenExpiry),
+	}
+	var err error
+	if tokens.loginRefresh, err = server.database.refreshTokenService.CreateRefreshToken(ctx, userId); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.clientRefresh, err = server.database.refreshTokenService.CreateClientRefreshToken(ctx, userId, clientId, "openid"); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.otherRefresh, err = server.database.refreshTokenService.CreateClientRefreshToken(ctx, userId, otherClientId, "openid"); err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func introspect(t *testing.T, server *testServer, clientId, secret, token string) controllers.IntrospectionResponse {
+	t.Helper()
+	var response controllers.IntrospectionResponse
+	decodeResponse(t, server.postForm("/oauth/introspect", url.Values{"token": {token}}, clientId, secret), http.StatusOK, &response)
+	return response
+}
+
+func TestIntrospect(t *testing.T) {
+	server := newTestServer(t, nil)
+	user := server.createUser(t, "user@example.com")
+	relyingParty := server.createClient(t, "rp-secret", []string{"https://rp.example.com/callback"}, nil)
+	other := server.createClient(t, "other-secret", []string{"https://other.example.com/callback"}, nil)
+	resourceServer := server.createClient(t, "rs-secret", nil, []string{controllers.ScopeIntrospect})
+	tokens := newTestTokens(t, server, user.ID, relyingParty.ClientId, other.ClientId)
+
+	t.Run("relying party", func(t *testing.T) {
+		for name, token := range map[string]string{"access": tokens.clientAccess, "refresh": tokens.clientRefresh} {
+			response := introspect(t, server, relyingParty.ClientId, "rp-secret", token)
+			if !response.Active || response.Sub != user.ID || response.ClientId != relyingParty.ClientId || response.Scope != "openid" {
+				t.Errorf("own %s token: got %+v", name, response)
+			}
+		}
+		for name, token := range map[string]string{
+			"login access": tokens.loginAccess, "login refresh": tokens.loginRefresh,
+			"other access": tokens.otherAccess, "other refresh": tokens.otherRefresh,
+		} {
+			if response := introspect(t, server, relyingParty.ClientId, "rp-secret", token); response != (controllers.IntrospectionResponse{}) {
+				t.Errorf("%s token: got %+v, want only active false", name, response)
+			}
+		}
+	})
+
+	t.Run("resource server", func(t *testing.T) {
+		for name, test := range map[string]struct {
+			token, tokenType, clientId string
+		}{
+			"login access":  {tokens.loginAccess, "access_token", ""},
+			"login refresh": {tokens.loginRefresh, "refresh_token", ""},
+			"other access":  {tokens.otherAccess, "access_token", other.ClientId},
+			"other refresh": {tokens.otherRefresh, "refresh_token", other.ClientId},
+		} {
+			response := introspect(t, server, resourceServer.ClientId, "rs-secret", test.token)
+			if !response.Active || response.TokenType != test.tokenType || response.Sub != user.ID || response.ClientId != test.clientId {
+				t.Errorf("%s token: got %+v", name, response)
+			}
+		}
+		if response := introspect(t, server, resourceServer.ClientId, "rs-secret", "unknown"); response.Active {
+			t.Errorf("unknown token: got %+v", response)
+		}
+	})
+}
+
+func TestRevoke(t *testing.T) {
+	server := newTestServer(t, nil)
+	user := server.createUser(t, "user@example.com")
+	relyingParty := server.createClient(t, "rp-secret", []string{"https://rp.example.com/callback"}, nil)
+	other := server.createClient(t, "other-secret", []string{"https://other.example.com/callback"}, nil)
+	// introspect alone does not allow revoking
+	inspector := server.createClient(t, "inspector-secret", nil, []string{controllers.ScopeIntrospect})
+	resourceServer := server.createClient(t, "rs-secret", nil, []string{controllers.ScopeIntrospect, controllers.ScopeRevoke})
+	tokens := newTestTokens(t, server, user.ID, relyingParty.ClientId, other.ClientId)
+
+	revoke := func(clientId, secret, token string) {
+		t.Helper()
+		decodeResponse(t, server.postForm("/oauth/revoke", url.Values{"token": {token}}, clientId, secret), http.StatusOK, nil)
+	}
+	active := func(token string) bool {
+		t.Helper()
+		return introspect(t, server, resourceServer.ClientId, "rs-secret", token).Active
+	}
+
+	// the tokens of login and of other clients are left alone
+	for _, token := range []string{tokens.loginAccess, tokens.loginRefresh, tokens.otherAccess, tokens.otherRefresh} {
+		revoke(relyingParty.ClientId, "rp-secret", token)
+		revoke(inspector.ClientId, "inspector-secret", token)
+		if !active(token) {
+			t.Fatalf("token %s was revoked by a client it was not issued to", token)
+		}
+	}
+
+	revoke(relyingParty.ClientId, "rp-secret", tokens.clientAccess)
+	revoke(relyingParty.ClientId, "rp-secret", tokens.clientRefresh)
+	if active(tokens.clientAccess) || active(tokens.clientRefresh) {
+		t.Fatal("the relying party could not revoke its own tokens")
+	}
+
+	if recorder := server.get("/v1/user/details", tokens.loginAccess); recorder.Code != http.StatusOK {
+		t.Fatalf("login access token refused before revocation: %d %s", recorder.Code, recorder.Body)
+	}
+	for _, token := range []string{tokens.loginAccess, tokens.loginRefresh, tokens.otherAccess, tokens.otherRefresh} {
+		revoke(resourceServer.ClientId, "rs-secret", token)
+		if active(token) {
+			t.Fatalf("token %s was not revoked by the resource server", token)
+		}
+	}
+	if recorder := server.get("/v1/user/details", tokens.loginAccess); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked login access token: got %d, want 401", recorder.Code)
+	}
+}
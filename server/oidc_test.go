@@ -0,0 +1,374 @@
+package server
+
+import (
+	"GoApp/controllers"
+	"GoApp/db"
+	"GoApp/lib"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const testRedirectURI = "https://rp.example.com/callback"
+
+// browser signs in on the authorize pages, keeping their cookies
+type browser struct {
+	url    string
+	client *http.Client
+}
+
+// newBrowser serves the router over HTTP, the server must not set Secure cookies
+func newBrowser(t *testing.T, server *testServer) *browser {
+	httpServer := httptest.NewServer(server.router)
+	t.Cleanup(httpServer.Close)
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &browser{url: httpServer.URL, client: &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+func (browser *browser) get(t *testing.T, path string) (*http.Response, string) {
+	t.Helper()
+	response, err := browser.client.Get(browser.url + path)
+	return browser.read(t, response, err)
+}
+
+func (browser *browser) postForm(t *testing.T, path string, form url.Values) (*http.Response, string) {
+	t.Helper()
+	response, err := browser.client.PostForm(browser.url+path, form)
+	return browser.read(t, response, err)
+}
+
+func (browser *browser) read(t *testing.T, response *http.Response, err error) (*http.Response, string) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, string(body)
+}
+
+var csrfTokenInput = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// formToken returns the csrf token of the form of an authorize page
+func formToken(t *testing.T, page string) string {
+	t.Helper()
+	match := csrfTokenInput.FindStringSubmatch(page)
+	if match == nil {
+		t.Fatalf("no csrf_token in the page: %s", page)
+	}
+	return match[1]
+}
+
+// pkce returns a code verifier and its S256 challenge
+func pkce(verifier string) (string, string) {
+	verifier = verifier + strings.Repeat("v", 43-len(verifier))
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorizeParams is the authorization request of client for scope
+func authorizeParams(client *db.Client, scope, challenge string) url.Values {
+	return url.Values{
+		"client_id":             {client.ClientId},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {scope},
+		"state":                 {"state"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+// signIn submits the sign in form of the authorize page, returning the page it answers with
+func (browser *browser) signIn(t *testing.T, params url.Values, form url.Values) (*http.Response, string) {
+	t.Helper()
+	response, page := browser.get(t, "/oauth/authorize?"+params.Encode())
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("authorize: got status %d: %s", response.StatusCode, page)
+	}
+	for name, values := range params {
+		form[name] = values
+	}
+	form.Set("action", "login")
+	form.Set("csrf_token", formToken(t, page))
+	return browser.postForm(t, "/oauth/authorize", form)
+}
+
+// authorize signs user in and consents, returning the authorization code
+func authorize(t *testing.T, server *testServer, user *db.User, client *db.Client, scope, challenge string) string {
+	t.Helper()
+	browser := newBrowser(t, server)
+	params := authorizeParams(client, scope, challenge)
+	response, page := browser.signIn(t, params, url.Values{"email": {*user.Email}, "password": {testPassword}})
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("sign in: got status %d: %s", response.StatusCode, page)
+	}
+
+	form := url.Values{"action": {"allow"}, "csrf_token": {formToken(t, page)}}
+	for name, values := range params {
+		form[name] = values
+	}
+	response, page = browser.postForm(t, "/oauth/authorize", form)
+	if response.StatusCode != http.StatusSeeOther {
+		t.Fatalf("consent: got status %d: %s", response.StatusCode, page)
+	}
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURI+"?") || location.Query().Get("state") != "state" || location.Query().Get("code") == "" {
+		t.Fatalf("consent: redirected to %s", location)
+	}
+	return location.Query().Get("code")
+}
+
+// exchange redeems an authorization code at the token endpoint
+func exchange(server *testServer, client *db.Client, secret, code, redirectURI, verifier string) *httptest.ResponseRecorder {
+	return server.postForm("/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}, client.ClientId, secret)
+}
+
+func newOIDCTestServer(t *testing.T) *testServer {
+	return newTestServer(t, map[string]string{"COOKIE_SECURE": "false"})
+}
+
+func TestAuthorizationCodeGrant(t *testing.T) {
+	server := newOIDCTestServer(t)
+	user := server.createUser(t, "user@example.com")
+	client := server.createClient(t, "rp-secret", []string{testRedirectURI, "https://rp.example.com/other"}, nil)
+	other := server.createClient(t, "other-secret", []string{testRedirectURI}, nil)
+	verifier, challenge := pkce("verifier")
+
+	for name, test := range map[string]struct {
+		client      *db.Client
+		secret      string
+		redirectURI string
+		verifier    string
+	}{
+		"verifier mismatch":     {client, "rp-secret", testRedirectURI, "other" + verifier[5:]},
+		"missing verifier":      {client, "rp-secret", testRedirectURI, ""},
+		"redirect_uri mismatch": {client, "rp-secret", "https://rp.example.com/other", verifier},
+		"another client":        {other, "other-secret", testRedirectURI, verifier},
+	} {
+		t.Run(name, func(t *testing.T) {
+			code := authorize(t, server, user, client, "openid", challenge)
+			recorder := exchange(server, test.client, test.secret, code, test.redirectURI, test.verifier)
+			if recorder.Code == http.StatusOK {
+				t.Fatalf("got tokens: %s", recorder.Body)
+			}
+			switch errorCode(t, recorder) {
+			case lib.OAuthInvalidRequest:
+				// refused before the code was looked up
+				return
+			case lib.OAuthInvalidGrant:
+			default:
+				t.Fatalf("got %s", recorder.Body)
+			}
+			// the failed attempt used the code up
+			if recorder := exchange(server, client, "rp-secret", code, testRedirectURI, verifier); errorCode(t, recorder) != lib.OAuthInvalidGrant {
+				t.Fatalf("code still valid after a failed attempt: %d %s", recorder.Code, recorder.Body)
+			}
+		})
+	}
+
+	t.Run("code reuse", func(t *testing.T) {
+		code := authorize(t, server, user, client, "openid email", challenge)
+		var tokens controllers.TokenResponse
+		decodeResponse(t, exchange(server, client, "rp-secret", code, testRedirectURI, verifier), http.StatusOK, &tokens)
+		if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.IdToken == "" || tokens.Scope != "openid email" {
+			t.Fatalf("got %+v", tokens)
+		}
+		if recorder := exchange(server, client, "rp-secret", code, testRedirectURI, verifier); errorCode(t, recorder) != lib.OAuthInvalidGrant {
+			t.Fatalf("reused code: got %d %s", recorder.Code, recorder.Body)
+		}
+	})
+}
+
+func TestAuthorizeRequest(t *testing.T) {
+	server := newOIDCTestServer(t)
+	user := server.createUser(t, "user@example.com")
+	client := server.createClient(t, "rp-secret", []string{testRedirectURI}, nil)
+	_, challenge := pkce("verifier")
+	browser := newBrowser(t, server)
+
+	// nothing is sent to a redirect URI that is not registered
+	params := authorizeParams(client, "openid", challenge)
+	params.Set("redirect_uri", "https://attacker.example.com/callback")
+	if response, page := browser.get(t, "/oauth/authorize?"+params.Encode()); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("unregistered redirect_uri: got status %d: %s", response.StatusCode, page)
+	}
+
+	for name, test := range map[string]struct {
+		param, value, error string
+	}{
+		"without PKCE":   {"code_challenge", "", lib.OAuthInvalidRequest},
+		"plain PKCE":     {"code_challenge_method", "plain", lib.OAuthInvalidRequest},
+		"without openid": {"scope", "email", lib.OAuthInvalidScope},
+	} {
+		params := authorizeParams(client, "openid", challenge)
+		params.Set(test.param, test.value)
+		response, page := browser.get(t, "/oauth/authorize?"+params.Encode())
+		location, _ := url.Parse(response.Header.Get("Location"))
+		if response.StatusCode != http.StatusSeeOther || location.Query().Get("error") != test.error {
+			t.Errorf("%s: got status %d, redirected to %s: %s", name, response.StatusCode, location, page)
+		}
+	}
+
+	t.Run("form token", func(t *testing.T) {
+		params := authorizeParams(client, "openid", challenge)
+		browser.get(t, "/oauth/authorize?"+params.Encode())
+		form := url.Values{"action": {"login"}, "email": {*user.Email}, "password": {testPassword}, "csrf_token": {"forged"}}
+		for name, values := range params {
+			form[name] = values
+		}
+		if response, page := browser.postForm(t, "/oauth/authorize", form); response.StatusCode != http.StatusForbidden {
+			t.Fatalf("forged csrf_token: got status %d: %s", response.StatusCode, page)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		response, page := newBrowser(t, server).signIn(t, authorizeParams(client, "openid", challenge), url.Values{"email": {*user.Email}, "password": {"Wrong123!"}})
+		if response.StatusCode != http.StatusUnauthorized || !strings.Contains(page, "Incorrect email or password.") {
+			t.Fatalf("got status %d: %s", response.StatusCode, page)
+		}
+	})
+}
+
+func TestAuthorizeRecaptcha(t *testing.T) {
+	server := newTestServer(t, map[string]string{"COOKIE_SECURE": "false", "RECAPTCHA_SECRET": "secret", "RECAPTCHA_SITE_KEY": "site-key"})
+	user := server.createUser(t, "user@example.com")
+	client := server.createClient(t, "rp-secret", []string{testRedirectURI}, nil)
+	_, challenge := pkce("verifier")
+
+	// posting the form without running its script does not skip the check
+	browser := newBrowser(t, server)
+	response, page := browser.signIn(t, authorizeParams(client, "openid", challenge), url.Values{"email": {*user.Email}, "password": {testPassword}})
+	if response.StatusCode != http.StatusUnauthorized || !strings.Contains(page, "reCAPTCHA") {
+		t.Fatalf("got status %d: %s", response.StatusCode, page)
+	}
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == "sso_session" && cookie.Value != "" {
+			t.Fatal("signed in without passing the reCAPTCHA")
+		}
+	}
+}
+
+func TestRefreshTokenGrant(t *testing.T) {
+	server := newOIDCTestServer(t)
+	user := server.createUser(t, "user@example.com")
+	client := server.createClient(t, "rp-secret", []string{testRedirectURI}, nil)
+	other := server.createClient(t, "other-secret", []string{testRedirectURI}, nil)
+	verifier, challenge := pkce("verifier")
+
+	var tokens controllers.TokenResponse
+	code := authorize(t, server, user, client, "openid email", challenge)
+	decodeResponse(t, exchange(server, client, "rp-secret", code, testRedirectURI, verifier), http.StatusOK, &tokens)
+	loginRefresh, err := server.database.refreshTokenService.CreateRefreshToken(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refresh := func(client *db.Client, secret, token, scope string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token}}
+		if scope != "" {
+			form.Set("scope", scope)
+		}
+		return server.postForm("/oauth/token", form, client.ClientId, secret)
+	}
+
+	for name, test := range map[string]struct {
+		client        *db.Client
+		secret, token string
+		scope, error  string
+	}{
+		"another client": {other, "other-secret", tokens.RefreshToken, "", lib.OAuthInvalidGrant},
+		"login token":    {client, "rp-secret", loginRefresh, "", lib.OAuthInvalidGrant},
+		"widened scope":  {client, "rp-secret", tokens.RefreshToken, "openid email profile", lib.OAuthInvalidScope},
+		"unknown token":  {client, "rp-secret", "unknown", "", lib.OAuthInvalidGrant},
+	} {
+		if recorder := refresh(test.client, test.secret, test.token, test.scope); errorCode(t, recorder) != test.error {
+			t.Errorf("%s: got %d %s, want %s", name, recorder.Code, recorder.Body, test.error)
+		}
+	}
+
+	var narrowed controllers.TokenResponse
+	decodeResponse(t, refresh(client, "rp-secret", tokens.RefreshToken, "openid"), http.StatusOK, &narrowed)
+	if narrowed.Scope != "openid" || narrowed.AccessToken == "" {
+		t.Fatalf("narrowed scope: got %+v", narrowed)
+	}
+	var info controllers.UserInfoResponse
+	decodeResponse(t, server.get("/oauth/userinfo", narrowed.AccessToken), http.StatusOK, &info)
+	if info.Sub != user.ID || info.Email != "" {
+		t.Fatalf("narrowed scope userinfo: got %+v", info)
+	}
+}
+
+func TestClientTokenOnUserRoutes(t *testing.T) {
+	server := newOIDCTestServer(t)
+	user := server.createUser(t, "user@example.com")
+	client := server.createClient(t, "rp-secret", []string{testRedirectURI}, nil)
+	verifier, challenge := pkce("verifier")
+
+	var tokens controllers.TokenResponse
+	code := authorize(t, server, user, client, "openid email profile", challenge)
+	decodeResponse(t, exchange(server, client, "rp-secret", code, testRedirectURI, verifier), http.StatusOK, &tokens)
+
+	// the tokens of the relying parties only open the userinfo endpoint
+	recorder := server.get("/v1/user/details", tokens.AccessToken)
+	if recorder.Code != http.StatusForbidden || errorCode(t, recorder) != lib.FirstPartyTokenRequired {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+	decodeResponse(t, server.get("/oauth/userinfo", tokens.AccessToken), http.StatusOK, nil)
+}
+
+func TestUserInfoScopes(t *testing.T) {
+	server := newOIDCTestServer(t)
+	user := server.createUser(t, "user@example.com")
+	client := server.createClient(t, "rp-secret", []string{testRedirectURI}, nil)
+	verifier, challenge := pkce("verifier")
+
+	for _, scope := range []string{"openid", "openid email", "openid profile", "openid email profile"} {
+		var tokens controllers.TokenResponse
+		code := authorize(t, server, user, client, scope, challenge)
+		decodeResponse(t, exchange(server, client, "rp-secret", code, testRedirectURI, verifier), http.StatusOK, &tokens)
+
+		var info controllers.UserInfoResponse
+		decodeResponse(t, server.get("/oauth/userinfo", tokens.AccessToken), http.StatusOK, &info)
+		email := strings.Contains(scope, "email")
+		profile := strings.Contains(scope, "profile")
+		if info.Sub != user.ID ||
+			(info.Email != "") != email || (info.EmailVerified != nil) != email ||
+			(info.GivenName != "") != profile || (info.FamilyName != "") != profile || (info.UpdatedAt != 0) != profile {
+			t.Errorf("scope %q: got %+v", scope, info)
+		}
+		if email && (info.Email != *user.Email || !*info.EmailVerified) {
+			t.Errorf("scope %q: got %+v", scope, info)
+		}
+		if profile && (info.GivenName != "Ada" || info.FamilyName != "Lovelace") {
+			t.Errorf("scope %q: got %+v", scope, info)
+		}
+	}
+}
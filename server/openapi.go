@@ -0,0 +1,480 @@
+package server
+
+import (
+	"GoApp/controllers"
+	authDto "GoApp/dto/auth"
+	userDto "GoApp/dto/user"
+	"GoApp/lib"
+	"GoApp/models"
+	"GoApp/openapi"
+	"GoApp/providers"
+	"net/http"
+)
+
+// Every route registered in NewRouter is described here, go test fails when
+// one is missing (see openapi.Check).
+
+const sessionNote = "For the sessions opened with `X-Session-Mode: cookie`, the refresh token is read from its HttpOnly cookie."
+
+const recaptchaNote = "The body may also hold the `g-recaptcha-response` token of the action, which is required when reCAPTCHA is enabled."
+
+var (
+	authKey    = []string{"authKey"}
+	bearerAuth = []string{"authKey", "bearerAuth"}
+	// the access token cookie instead of the bearer token, see cookieAuth
+	cookieSession = [][]string{{"authKey", "cookieAuth"}}
+	clientAuth    = []string{"clientAuth"}
+	// the access token of /oauth/token, for the routes of the OpenID Connect clients
+	accessToken = []string{"clientToken"}
+	// public clients authenticate with client_id only
+	noAuth = [][]string{{}}
+	// the bearer token of a SCIM tenant
+	scimToken = []string{"scimToken"}
+)
+
+// the documented shapes of the gin.H responses
+
+type loginResponse struct {
+	AccessToken  string      `json:"accessToken,omitempty" description:"not sent to cookie sessions"`
+	RefreshToken string      `json:"refreshToken,omitempty" description:"not sent to cookie sessions"`
+	CsrfToken    string      `json:"csrfToken,omitempty" description:"cookie sessions only, to send in the X-CSRF-Token header"`
+	User         models.User `json:"user"`
+}
+
+type refreshResponse struct {
+	AccessToken string `json:"accessToken,omitempty" description:"not sent to cookie sessions, which get the access token cookie"`
+}
+
+type profileResponse struct {
+	Filepath string            `json:"filepath" description:"URL of the largest profile picture"`
+	Profiles map[string]string `json:"profiles,omitempty" description:"URL of the profile picture by size in pixels"`
+}
+
+type profileForm struct {
+	File []byte `json:"file" format:"binary" validate:"required" description:"JPEG, PNG, GIF or WebP image"`
+}
+
+type healthCheckResult struct {
+	Status string `json:"status" validate:"oneof=up down" description:"the errors of the checks are logged, not returned"`
+}
+
+type readinessResponse struct {
+	Draining bool                         `json:"draining"`
+	Checks   map[string]healthCheckResult `json:"checks"`
+	Build    providers.BuildInfo          `json:"build"`
+}
+
+func tusHeader(name, description string, required bool) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "header", Description: description, Required: required, Schema: &openapi.Schema{Type: "string"}}
+}
+
+var tusResumable = tusHeader("Tus-Resumable", "tus protocol version, 1.0.0", true)
+
+// tokenForm is the form of the revocation and introspection requests
+type tokenForm struct {
+	Token         string `json:"token" validate:"required"`
+	TokenTypeHint string `json:"token_type_hint,omitempty" validate:"omitempty,oneof=access_token refresh_token"`
+	ClientId      string `json:"client_id,omitempty" description:"with client_secret, instead of HTTP Basic"`
+	ClientSecret  string `json:"client_secret,omitempty"`
+}
+
+// authorizeForm are the forms of the sign in page of /oauth/authorize, which
+// send the query of the page back as well
+type authorizeForm struct {
+	Action    string `json:"action" validate:"required,oneof=login allow deny switch"`
+	CsrfToken string `json:"csrf_token" validate:"required"`
+	Email     string `json:"email,omitempty" description:"with the login action"`
+	Password  string `json:"password,omitempty" description:"with the login action"`
+	Recaptcha string `json:"g-recaptcha-response,omitempty" description:"with the login action, required when reCAPTCHA is enabled, the page gets it for the authorize action"`
+}
+
+// tokenRequest is the form of the token endpoint, by grant type
+type tokenRequest struct {
+	GrantType    string `json:"grant_type" validate:"required,oneof=authorization_code refresh_token client_credentials urn:ietf:params:oauth:grant-type:device_code"`
+	Code         string `json:"code,omitempty" description:"authorization_code grant"`
+	RedirectUri  string `json:"redirect_uri,omitempty" description:"authorization_code grant, the redirect_uri of the authorization request"`
+	CodeVerifier string `json:"code_verifier,omitempty" description:"authorization_code grant, the PKCE verifier of the code_challenge"`
+	RefreshToken string `json:"refresh_token,omitempty" description:"refresh_token grant, a refresh token issued to the client"`
+	Scope        string `json:"scope,omitempty" description:"client_credentials grant, space separated allowed scopes of the service account, all of them by default. refresh_token grant, part of the granted scope, all of it by default"`
+	DeviceCode   string `json:"device_code,omitempty" description:"device_code grant, the device_code of /oauth/device/code"`
+	ClientId     string `json:"client_id,omitempty" description:"with client_secret instead of HTTP Basic, alone for public clients"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// deviceCodeForm is the form of the device authorization endpoint
+type deviceCodeForm struct {
+	Scope        string `json:"scope,omitempty" description:"space separated scopes, the unsupported ones are ignored"`
+	ClientId     string `json:"client_id,omitempty" description:"with client_secret instead of HTTP Basic, alone for public clients"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// scimUserForm is a SCIM user as the identity providers send it
+type scimUserForm struct {
+	Schemas  []string              `json:"schemas,omitempty"`
+	UserName string                `json:"userName" validate:"required,emailaddress" description:"the email address of the user"`
+	Name     *controllers.SCIMName `json:"name,omitempty"`
+	Active   *bool                 `json:"active,omitempty" description:"true by default on creation, false deactivates the user and revokes its refresh tokens"`
+	Password string                `json:"password,omitempty" validate:"omitempty,password" description:"the users created without one choose theirs with the forgot password email"`
+}
+
+const scimNote = "The bodies may be sent as application/scim+json or application/json, the attributes which are not stored are ignored."
+
+func queryParameter(name, description string, required bool) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Required: required, Schema: &openapi.Schema{Type: "string"}}
+}
+
+var csrfToken = openapi.Parameter{
+	Name: providers.CSRFHeader, In: "header", Required: true, Schema: &openapi.Schema{Type: "string"},
+	Description: "The value of the csrf_token cookie, or the csrfToken of login",
+}
+
+var apiRoutes = []openapi.Route{
+	{Method: http.MethodGet, Path: "/", Tag: "health", Summary: "Check that the server answers"},
+	{Method: http.MethodGet, Path: "/healthz", Tag: "health", Summary: "Liveness probe"},
+	{
+		Method: http.MethodGet, Path: "/readyz", Tag: "health", Summary: "Readiness probe",
+		Description: "Runs the health checks of the dependencies, failing while the server drains.",
+		Response:    readinessResponse{}, Errors: []int{http.StatusServiceUnavailable},
+	},
+	{
+		Method: http.MethodGet, Path: "/metrics", Tag: "health", Summary: "Prometheus metrics",
+		ResponseType: "text/plain", Response: &openapi.Schema{Type: "string"},
+	},
+	{
+		Method: http.MethodGet, Path: "/public/avatar/:file", Tag: "user", Summary: "Generated avatar of a user",
+		Description: "`file` is the user id followed by `.svg` or `.png`.",
+		Parameters: []openapi.Parameter{
+			{Name: "size", In: "query", Description: "width and height in pixels", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "style", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []string{"initials", "identicon"}}},
+		},
+		ResponseType: "image/*", Response: &openapi.Schema{Type: "string", Format: "binary"},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	{
+		Method: http.MethodGet, Path: "/openapi.json", Tag: "docs", Summary: "This document",
+		ResponseType: "application/json", Response: &openapi.Schema{Type: "object"},
+	},
+	{Method: http.MethodGet, Path: "/docs/*filepath", Hidden: true},
+
+	{
+		Method: http.MethodGet, Path: "/.well-known/openid-configuration", Tag: "oidc", Summary: "OpenID Connect provider metadata",
+		ResponseType: "application/json", Response: &openapi.Schema{Type: "object"},
+	},
+	{
+		Method: http.MethodGet, Path: "/.well-known/jwks.json", Tag: "oidc", Summary: "Public keys verifying the ID tokens",
+		ResponseType: "application/json", Response: providers.JSONWebKeySet{},
+	},
+	{
+		Method: http.MethodGet, Path: "/oauth/authorize", Tag: "oidc", Summary: "Sign in and consent page",
+		Description: "Shows the sign in form, or the consent form once signed in. The user is then redirected with `303` to the " +
+			"redirect URI with a `code` or an `error`, along with `state` and `iss`. Errors about the client or the redirect URI are only shown on the page.",
+		Parameters: []openapi.Parameter{
+			queryParameter("client_id", "", true),
+			queryParameter("redirect_uri", "one of the registered redirect URIs, compared as is", true),
+			queryParameter("response_type", "code", true),
+			queryParameter("scope", "openid and optionally profile and email, space separated", true),
+			queryParameter("code_challenge", "the S256 PKCE challenge", true),
+			queryParameter("code_challenge_method", "S256", true),
+			queryParameter("state", "", false),
+			queryParameter("nonce", "copied to the ID token", false),
+			queryParameter("prompt", "none, login or consent", false),
+		},
+		ResponseType: "text/html", Response: &openapi.Schema{Type: "string"},
+	},
+	{
+		Method: http.MethodPost, Path: "/oauth/authorize", Tag: "oidc", Summary: "Sign in and consent forms",
+		Description: "Posted by the page of GET /oauth/authorize along with its query parameters, not meant for the clients.",
+		Request:     authorizeForm{}, RequestType: "application/x-www-form-urlencoded",
+		ResponseType: "text/html", Response: &openapi.Schema{Type: "string"},
+	},
+	{
+		Method: http.MethodPost, Path: "/oauth/token", Tag: "oidc", Summary: "Exchange a grant for tokens",
+		Description: "The authorization_code grant returns an ID token and a refresh token with the access token. " +
+			"The refresh_token grant keeps the refresh token, which only the client it was issued to may redeem, and returns the tokens of its scope. " +
+			"The client_credentials grant returns an access token of the service account itself, which the user routes refuse. " +
+			"The device_code grant answers authorization_pending until the user decides and slow_down when the device polls too often. " +
+			"The access tokens of the users have the client as aud and the granted scope, only /oauth/userinfo accepts them.",
+		Security: clientAuth, AlternativeSecurity: noAuth, Request: tokenRequest{}, RequestType: "application/x-www-form-urlencoded",
+		ResponseType: "application/json", Response: controllers.TokenResponse{},
+		OAuthErrors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge},
+	},
+	{
+		Method: http.MethodPost, Path: "/oauth/device/code", Tag: "oauth", Summary: "Start a device authorization",
+		Description: "RFC 8628, for the TVs and CLIs: the user enters the user code at the verification_uri while the device polls the token endpoint. " +
+			"Refused with unauthorized_client unless FE_DEVICE_URL is set.",
+		Security: clientAuth, AlternativeSecurity: noAuth, Request: deviceCodeForm{}, RequestType: "application/x-www-form-urlencoded",
+		ResponseType: "application/json", Response: controllers.DeviceCodeResponse{},
+		OAuthErrors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge},
+	},
+	{
+		Method: http.MethodGet, Path: "/oauth/userinfo", Tag: "oidc", Summary: "Claims of the signed in user",
+		Security: accessToken, ResponseType: "application/json", Response: controllers.UserInfoResponse{},
+		Errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		Method: http.MethodPost, Path: "/oauth/userinfo", Tag: "oidc", Summary: "Claims of the signed in user",
+		Security: accessToken, ResponseType: "application/json", Response: controllers.UserInfoResponse{},
+		Errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		Method: http.MethodPost, Path: "/oauth/revoke", Tag: "oauth", Summary: "Revoke an access or refresh token",
+		Description: "RFC 7009, for the tokens issued to the client, or every token for the clients allowed the `revoke` scope. " +
+			"Revoked access tokens are refused until they expire. Unknown tokens and those of other clients are answered with 200 as well, and left alone.",
+		Security: clientAuth, Request: tokenForm{}, RequestType: "application/x-www-form-urlencoded", Empty: true,
+		OAuthErrors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge},
+	},
+	{
+		Method: http.MethodPost, Path: "/oauth/introspect", Tag: "oauth", Summary: "Describe an access or refresh token",
+		Description: "RFC 7662, for the tokens issued to the client, or every token for the clients allowed the `introspect` scope. " +
+			"Only `active` is sent for expired, revoked or unknown tokens, and for those of other clients.",
+		Security: clientAuth, Request: tokenForm{}, RequestType: "application/x-www-form-urlencoded",
+		ResponseType: "application/json", Response: controllers.IntrospectionResponse{},
+		OAuthErrors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge},
+	},
+
+	{
+		Method: http.MethodGet, Path: "/scim/v2/ServiceProviderConfig", Tag: "scim", Summary: "Describe what the API supports of SCIM",
+		Description: "RFC 7643 section 5.", ResponseType: lib.SCIMContentType, Response: controllers.SCIMServiceProviderConfig{},
+	},
+	{
+		Method: http.MethodGet, Path: "/scim/v2/Schemas", Tag: "scim", Summary: "List the schemas of the resources",
+		Description: "RFC 7643 section 7, the User schema only.", ResponseType: lib.SCIMContentType, Response: controllers.SCIMSchemaList{},
+	},
+	{
+		Method: http.MethodGet, Path: "/scim/v2/Schemas/:id", Tag: "scim", Summary: "Describe a schema",
+		ResponseType: lib.SCIMContentType, Response: controllers.SCIMSchema{},
+		SCIMErrors: []int{http.StatusNotFound},
+	},
+	{
+		Method: http.MethodGet, Path: "/scim/v2/Users", Tag: "scim", Summary: "List the users of the tenant",
+		Description: "Oldest first, by pages of at most 100 users.", Security: scimToken,
+		Parameters: []openapi.Parameter{
+			queryParameter("filter", `userName eq "..." only, to find a user by email`, false),
+			queryParameter("startIndex", "1-based index of the first user, 1 by default", false),
+			queryParameter("count", "how many users to return, 100 at most and by default", false),
+		},
+		ResponseType: lib.SCIMContentType, Response: controllers.SCIMUserList{},
+		SCIMErrors: []int{http.StatusBadRequest, http.StatusUnauthorized},
+	},
+	{
+		Method: http.MethodPost, Path: "/scim/v2/Users", Tag: "scim", Summary: "Provision a user",
+		Description: scimNote, Security: scimToken, Request: scimUserForm{}, RequestType: lib.SCIMContentType,
+		Status: http.StatusCreated, ResponseType: lib.SCIMContentType, Response: controllers.SCIMUser{},
+		ResponseHeaders: map[string]string{"Location": "URL of the user"},
+		SCIMErrors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+	},
+	{
+		Method: http.MethodGet, Path: "/scim/v2/Users/:id", Tag: "scim", Summary: "Describe a user",
+		Security: scimToken, ResponseType: lib.SCIMContentType, Response: controllers.SCIMUser{},
+		SCIMErrors: []int{http.StatusUnauthorized, http.StatusNotFound},
+	},
+	{
+		Method: http.MethodPut, Path: "/scim/v2/Users/:id", Tag: "scim", Summary: "Replace the attributes of a user",
+		Description: scimNote + " The omitted active and password stay as they are.",
+		Security:    scimToken, Request: scimUserForm{}, RequestType: lib.SCIMContentType,
+		ResponseType: lib.SCIMContentType, Response: controllers.SCIMUser{},
+		SCIMErrors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+	},
+	{
+		Method: http.MethodPatch, Path: "/scim/v2/Users/:id", Tag: "scim", Summary: "Update the attributes of a user",
+		Description: "RFC 7644 section 3.5.2, with the paths userName, name, name.givenName, name.familyName, active and password. " + scimNote,
+		Security:    scimToken, Request: controllers.SCIMPatch{}, RequestType: lib.SCIMContentType,
+		ResponseType: lib.SCIMContentType, Response: controllers.SCIMUser{},
+		SCIMErrors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+	},
+	{
+		Method: http.MethodDelete, Path: "/scim/v2/Users/:id", Tag: "scim", Summary: "Remove a user and its refresh tokens",
+		Security: scimToken, Status: http.StatusNoContent,
+		SCIMErrors: []int{http.StatusUnauthorized, http.StatusNotFound},
+	},
+
+	{
+		Method: http.MethodPost, Path: "/v1/auth/login", Tag: "auth", Summary: "Log in with an email and a password",
+		Description: recaptchaNote, Security: authKey, Request: authDto.LoginCredentials{}, Response: loginResponse{},
+		Parameters: []openapi.Parameter{{
+			Name: providers.SessionModeHeader, In: "header", Schema: &openapi.Schema{Type: "string", Enum: []string{"cookie"}},
+			Description: "cookie opens a cookie session when they are enabled, the tokens are set as HttpOnly cookies instead of returned",
+		}},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/auth/register", Tag: "auth", Summary: "Register and send the activation email",
+		Description: recaptchaNote, Security: authKey, Request: authDto.RegisterCredentials{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/auth/verify", Tag: "auth", Summary: "Activate an account with the emailed code",
+		Description: recaptchaNote, Security: authKey, Request: authDto.VerifyEmail{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/auth/forgot-password", Tag: "auth", Summary: "Email a password reset code",
+		Description: recaptchaNote, Security: authKey, Request: authDto.ForgotPass{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/auth/resend-activation-email", Tag: "auth", Summary: "Send a new activation email",
+		Description: recaptchaNote, Security: authKey, Request: authDto.ResendActivationEmail{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/auth/reset-password", Tag: "auth", Summary: "Set a new password with the emailed code",
+		Description: recaptchaNote, Security: authKey, Request: authDto.ResetPassword{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodPut, Path: "/v1/auth/refresh/:tokenId", Tag: "auth", Summary: "Get a new access token",
+		Security: authKey, Response: refreshResponse{},
+		Errors: []int{http.StatusUnauthorized, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodPut, Path: "/v1/auth/logout/:tokenId", Tag: "auth", Summary: "Log out, revoking the refresh token",
+		Security: authKey, Errors: []int{http.StatusUnauthorized},
+	},
+	{
+		Method: http.MethodPut, Path: "/v1/auth/refresh", Tag: "auth", Summary: "Get a new access token cookie",
+		Description: sessionNote, Security: authKey, Parameters: []openapi.Parameter{csrfToken},
+		Errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodPut, Path: "/v1/auth/logout", Tag: "auth", Summary: "Log out of a cookie session",
+		Description: sessionNote, Security: authKey, Parameters: []openapi.Parameter{csrfToken},
+		Errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+
+	{
+		Method: http.MethodGet, Path: "/v1/user/details", Tag: "user", Summary: "The logged in user",
+		Security: bearerAuth, AlternativeSecurity: cookieSession, Response: models.User{}, Errors: []int{http.StatusUnauthorized, http.StatusForbidden},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/change-password", Tag: "user", Summary: "Change the password",
+		Security: bearerAuth, AlternativeSecurity: cookieSession, Request: userDto.ChangePassword{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/profile", Tag: "user", Summary: "Upload a profile picture",
+		Description: "The picture is stored in every configured size, use the tus uploads for large files.",
+		Security:    bearerAuth, AlternativeSecurity: cookieSession, Request: profileForm{}, RequestType: "multipart/form-data", Response: profileResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/details", Tag: "user", Summary: "Update the name of the user",
+		Security: bearerAuth, AlternativeSecurity: cookieSession, Request: userDto.UpdateUserDetails{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+	},
+	{
+		Method: http.MethodGet, Path: "/v1/user/device", Tag: "user", Summary: "Describe the device authorization of a user code",
+		Description: "For the page of FE_DEVICE_URL, the user code may be typed in lower case or without its dash.",
+		Security:    bearerAuth, AlternativeSecurity: cookieSession, Response: controllers.DeviceResponse{},
+		Parameters: []openapi.Parameter{queryParameter("userCode", "the code shown by the device", true)},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/user/device", Tag: "user", Summary: "Approve or deny a device authorization",
+		Description: "The device polling the token endpoint gets the tokens of the user once approved.",
+		Security:    bearerAuth, AlternativeSecurity: cookieSession, Request: userDto.DecideDevice{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	},
+
+	{
+		Method: http.MethodOptions, Path: "/v1/uploads", Tag: "uploads", Summary: "tus capabilities",
+		Security: bearerAuth, AlternativeSecurity: cookieSession, Status: http.StatusNoContent,
+		ResponseHeaders: map[string]string{
+			"Tus-Version":   "supported protocol versions",
+			"Tus-Extension": "supported extensions",
+			"Tus-Max-Size":  "largest accepted upload in bytes",
+		},
+	},
+	{
+		Method: http.MethodPost, Path: "/v1/uploads", Tag: "uploads", Summary: "Start a resumable upload",
+		Security: bearerAuth, AlternativeSecurity: cookieSession, Status: http.StatusCreated, Empty: true,
+		Parameters: []openapi.Parameter{
+			tusResumable,
+			tusHeader("Upload-Length", "size of the whole file in bytes", true),
+			tusHeader("Upload-Metadata", "comma separated key and base64 value pairs, purpose defaults to profile", false),
+		},
+		ResponseHeaders: map[string]string{
+			"Location":       "URL of the upload",
+			"Upload-Expires": "when the unfinished upload is discarded",
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusPreconditionFailed, http.StatusRequestEntityTooLarge},
+	},
+	{
+		Method: http.MethodHead, Path: "/v1/uploads/:uploadId", Tag: "uploads", Summary: "Offset of an upload",
+		Security: bearerAuth, AlternativeSecurity: cookieSession, Empty: true, Parameters: []openapi.Parameter{tusResumable},
+		ResponseHeaders: map[string]string{
+			"Upload-Offset":  "bytes received so far",
+			"Upload-Length":  "size of the whole file in bytes",
+			"Upload-Expires": "when the unfinished upload is discarded",
+		},
+		Errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusPreconditionFailed},
+	},
+	{
+		Method: http.MethodPatch, Path: "/v1/uploads/:uploadId", Tag: "uploads", Summary: "Append a chunk to an upload",
+		Description: "The file is processed once the last chunk is received.",
+		Security:    bearerAuth, AlternativeSecurity: cookieSession, Status: http.StatusNoContent,
+		Parameters: []openapi.Parameter{
+			tusResumable,
+			tusHeader("Upload-Offset", "offset of the chunk, the current offset of the upload", true),
+		},
+		Request: &openapi.Schema{Type: "string", Format: "binary"}, RequestType: "application/offset+octet-stream",
+		ResponseHeaders: map[string]string{"Upload-Offset": "bytes received so far"},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict,
+			http.StatusPreconditionFailed, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	},
+	{
+		Method: http.MethodDelete, Path: "/v1/uploads/:uploadId", Tag: "uploads", Summary: "Abort an upload",
+		Security: bearerAuth, AlternativeSecurity: cookieSession, Status: http.StatusNoContent, Parameters: []openapi.Parameter{tusResumable},
+		Errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusPreconditionFailed},
+	},
+}
+
+// apiDocument generates the OpenAPI document of apiRoutes
+func apiDocument(configs *providers.Config) *openapi.Document {
+	return openapi.Build(
+		openapi.Info{
+			Title:       configs.AppName,
+			Description: "Responses are wrapped in `{\"status\": \"Success\", \"data\": ...}`, errors in `{\"status\": \"Failed\", \"error\": ...}`.",
+			Version:     providers.GetBuildInfo().Version,
+		},
+		[]openapi.Server{{URL: configs.Domain}},
+		[]openapi.Tag{
+			{Name: "auth", Description: "Registration, login and sessions"},
+			{Name: "user", Description: "The logged in user"},
+			{Name: "uploads", Description: "Resumable uploads following the tus 1.0.0 protocol"},
+			{Name: "oauth", Description: "Token endpoints for the registered clients"},
+			{Name: "oidc", Description: "OpenID Connect provider, for the apps signing their users in with this one"},
+			{Name: "scim", Description: "SCIM 2.0 user provisioning, for the identity providers of the tenants"},
+			{Name: "health", Description: "Probes and metrics"},
+			{Name: "docs"},
+		},
+		map[string]*openapi.SecurityScheme{
+			"authKey": {
+				Type: "apiKey", In: "header", Name: "X-Auth-Key",
+				Description: "Key shared with the API clients, required on every /v1 route",
+			},
+			"cookieAuth": {
+				Type: "apiKey", In: "cookie", Name: providers.AccessTokenCookie,
+				Description: "HttpOnly cookie of the sessions opened with `X-Session-Mode: cookie`. " +
+					"Requests other than GET must send the csrf_token cookie in the X-CSRF-Token header.",
+			},
+			"clientAuth": {
+				Type: "http", Scheme: "basic",
+				Description: "Id and secret of a client registered with the `client create` command",
+			},
+			"bearerAuth": {
+				Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+				Description: "Access token returned by login and refresh, the tokens of the service accounts and of the registered clients are refused with 403",
+			},
+			"clientToken": {
+				Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+				Description: "Access token issued by /oauth/token to a registered client for its user",
+			},
+			"scimToken": {
+				Type: "http", Scheme: "bearer",
+				Description: "Token of a tenant, given once by the `tenant create` command",
+			},
+		},
+		apiRoutes,
+	)
+}
@@ -0,0 +1,14 @@
+package server
+
+import (
+	"GoApp/openapi"
+	"testing"
+)
+
+// TestAPIRoutes checks that apiRoutes documents every route of NewRouter, and nothing else
+func TestAPIRoutes(t *testing.T) {
+	server := newTestServer(t, nil)
+	for _, problem := range openapi.Check(apiRoutes, server.router.Routes()) {
+		t.Error(problem)
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"GoApp/lib"
+	"GoApp/providers"
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pngImage encodes a width by height PNG
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// uploadProfile posts file as the profile picture of the user of token
+func (server *testServer) uploadProfile(t *testing.T, token string, file []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "profile.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(file)
+	writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/user/profile", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	request.Header.Set("Authorization", "Bearer "+token)
+	return server.do(request)
+}
+
+func TestUploadProfile(t *testing.T) {
+	server := newTestServer(t, map[string]string{"IMAGE_MAX_BYTES": "65536", "PROFILE_SIZES": "16,32"})
+	user := server.createUser(t, "user@example.com")
+	token := server.jwt.GenerateToken(user.ID, true, providers.AccessTokenExpiry)
+
+	var response struct {
+		Data struct {
+			Filepath string            `json:"filepath"`
+			Profiles map[string]string `json:"profiles"`
+		} `json:"data"`
+	}
+	decodeResponse(t, server.uploadProfile(t, token, pngImage(t, 40, 30)), http.StatusOK, &response)
+	if response.Data.Filepath == "" || len(response.Data.Profiles) != 2 {
+		t.Fatalf("got %+v", response.Data)
+	}
+
+	for name, test := range map[string]struct {
+		file   []byte
+		status int
+		code   string
+	}{
+		// the file fits in the room left for the multipart envelope
+		"over IMAGE_MAX_BYTES": {bytes.Repeat([]byte{0}, 65537), http.StatusRequestEntityTooLarge, lib.ImageTooLarge},
+		// the body is cut before the file is read completely
+		"over the body limit": {bytes.Repeat([]byte{0}, 65536+1<<20), http.StatusRequestEntityTooLarge, lib.ImageTooLarge},
+		"not an image":        {[]byte("<svg></svg>"), http.StatusUnprocessableEntity, lib.InvalidImage},
+	} {
+		recorder := server.uploadProfile(t, token, test.file)
+		if recorder.Code != test.status || errorCode(t, recorder) != test.code {
+			t.Errorf("%s: got %d %s", name, recorder.Code, recorder.Body)
+		}
+	}
+}
@@ -2,22 +2,41 @@ package server
 
 import (
 	"GoApp/controllers"
+	"GoApp/db"
 	"GoApp/middlewares"
+	"GoApp/openapi"
 	"GoApp/providers"
+	"log/slog"
+	"net/http"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 type Controllers struct {
 	healthController controllers.HealthController
 	authController   controllers.AuthController
 	userController   controllers.UserController
+	uploadController controllers.UploadController
+	avatarController controllers.AvatarController
+	oauthController  controllers.OAuthController
+	oidcController   controllers.OIDCController
+	tokenController  controllers.TokenController
+	deviceController controllers.DeviceController
+	scimController   controllers.SCIMController
 }
 
 type Providers struct {
-	jwtService providers.JWTService
+	jwtService          providers.JWTService
+	sessionCookies      providers.SessionCookieService
+	revokedTokenService db.RevokedTokenService
+	clientService       db.ClientService
+	tenantService       db.TenantService
+	blobStore           providers.BlobStore
+	logger              *slog.Logger
 }
 
 func NewRouter(configs *providers.Config, controllers *Controllers, providers *Providers) *gin.Engine {
@@ -32,26 +51,86 @@ func NewRouter(configs *providers.Config, controllers *Controllers, providers *P
 	config.AllowMethods = []string{"*"}
 	config.AllowHeaders = []string{"*"}
 	config.AllowCredentials = true
+	config.ExposeHeaders = []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires", middlewares.RequestIdHeader}
 
 	router.Use(cors.New(config))
+	router.Use(middlewares.RequestIdMiddleware())
+
+	router.Use(otelgin.Middleware(configs.AppName))
+	router.Use(middlewares.MetricsMiddleware())
 
 	// Global middlewares
-	// Logger middlewares will write the logs to gin.DefaultWriter even if you set with GIN_MODE=release.
-	// By default gin.DefaultWriter = os.Stdout
-	router.Use(gin.Logger())
+	// Logger middlewares writes one structured record per request through the application logger.
+	router.Use(middlewares.LoggerMiddleware(providers.logger))
 
-	// Recovery middlewares recovers from any panics and writes a 500 if there was one.
-	router.Use(gin.Recovery())
+	// Recovery middlewares recovers from any panics, logs them and writes a 500 if there was one.
+	router.Use(middlewares.RecoveryMiddleware(providers.logger))
 
-	router.Use(static.Serve("/public", static.LocalFile("public", false)))
+	if configs.StorageDriver == "local" {
+		router.Use(static.Serve("/public", static.LocalFile(configs.StoragePath, false)))
+	}
 
 	// Routes
 	router.GET("/", controllers.healthController.Status)
+	router.GET("/healthz", controllers.healthController.Liveness)
+	router.GET("/readyz", controllers.healthController.Readiness)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/public/avatar/:file", controllers.avatarController.Avatar)
+
+	// API documentation, generated from apiRoutes
+	document := apiDocument(configs)
+	router.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, document)
+	})
+	router.GET("/docs/*filepath", openapi.DocsHandler("../openapi.json"))
+
+	// OpenID Connect, for the registered clients
+	router.GET("/.well-known/openid-configuration", controllers.oidcController.Discovery)
+	router.GET("/.well-known/jwks.json", controllers.oidcController.JWKS)
+
+	// for the registered clients and their users, outside of v1 as they have no auth key
+	oauth := router.Group("oauth")
+	oauth.Use(middlewares.BodyLimitMiddleware(configs.RequestMaxBytes))
+	{
+		clientAuth := middlewares.AuthenticateClient(providers.clientService, false)
+		userAuth := middlewares.AuthorizeClientJWT(providers.jwtService, providers.revokedTokenService)
+
+		oauth.POST("revoke", clientAuth, controllers.oauthController.Revoke)
+		oauth.POST("introspect", clientAuth, controllers.oauthController.Introspect)
+		oauth.GET("authorize", controllers.oidcController.Authorize)
+		oauth.POST("authorize", controllers.oidcController.AuthorizeForm)
+		// public clients get tokens too, with the PKCE verifier as proof
+		oauth.POST("token", middlewares.AuthenticateClient(providers.clientService, true), controllers.tokenController.Token)
+		oauth.POST("device/code", middlewares.AuthenticateClient(providers.clientService, true), controllers.deviceController.DeviceCode)
+		oauth.GET("userinfo", userAuth, controllers.oidcController.UserInfo)
+		oauth.POST("userinfo", userAuth, controllers.oidcController.UserInfo)
+	}
+
+	// for the identity providers of the tenants, outside of v1 as they have no auth key
+	scim := router.Group("scim/v2")
+	scim.Use(middlewares.BodyLimitMiddleware(configs.RequestMaxBytes))
+	{
+		tenantAuth := middlewares.AuthenticateTenant(providers.tenantService)
+
+		scim.GET("ServiceProviderConfig", controllers.scimController.ServiceProviderConfig)
+		scim.GET("Schemas", controllers.scimController.Schemas)
+		scim.GET("Schemas/:id", controllers.scimController.Schema)
+		scim.GET("Users", tenantAuth, controllers.scimController.Users)
+		scim.POST("Users", tenantAuth, controllers.scimController.CreateUser)
+		scim.GET("Users/:id", tenantAuth, controllers.scimController.User)
+		scim.PUT("Users/:id", tenantAuth, controllers.scimController.ReplaceUser)
+		scim.PATCH("Users/:id", tenantAuth, controllers.scimController.PatchUser)
+		scim.DELETE("Users/:id", tenantAuth, controllers.scimController.DeleteUser)
+	}
 
 	v1 := router.Group("v1")
 	v1.Use(middlewares.AuthMiddleware(configs.AuthKey))
 	{
+		// JSON bodies, the uploads are bounded by the image size instead
+		bodyLimit := middlewares.BodyLimitMiddleware(configs.RequestMaxBytes)
+
 		auth := v1.Group("auth")
+		auth.Use(bodyLimit)
 		{
 			auth.POST("login", middlewares.RecaptchaMiddleware(configs.RecaptchaSecret, "login"), controllers.authController.Login)
 			auth.POST("register", middlewares.RecaptchaMiddleware(configs.RecaptchaSecret, "register"), controllers.authController.Register)
@@ -61,15 +140,31 @@ func NewRouter(configs *providers.Config, controllers *Controllers, providers *P
 			auth.POST("reset-password", middlewares.RecaptchaMiddleware(configs.RecaptchaSecret, "reset-password"), controllers.authController.ResetPass)
 			auth.PUT("refresh/:tokenId", controllers.authController.RefreshToken)
 			auth.PUT("logout/:tokenId", controllers.authController.Logout)
+			// cookie sessions, the refresh token cookie is scoped to /v1/auth
+			auth.PUT("refresh", controllers.authController.RefreshToken)
+			auth.PUT("logout", controllers.authController.Logout)
 		}
 
 		user := v1.Group("user")
-		user.Use(middlewares.AuthorizeJWT(providers.jwtService))
+		user.Use(middlewares.AuthorizeJWT(providers.jwtService, providers.sessionCookies, providers.revokedTokenService))
 		{
 			user.GET("details", controllers.userController.Me)
-			user.POST("change-password", controllers.userController.ChangePassword)
+			user.POST("change-password", bodyLimit, controllers.userController.ChangePassword)
 			user.POST("profile", controllers.userController.UploadProfile)
-			user.POST("details", controllers.userController.UpdateUserDetails)
+			user.POST("details", bodyLimit, controllers.userController.UpdateUserDetails)
+			// the page of FE_DEVICE_URL, approving the TVs and CLIs
+			user.GET("device", controllers.deviceController.Device)
+			user.POST("device", bodyLimit, controllers.deviceController.DecideDevice)
+		}
+
+		uploads := v1.Group("uploads")
+		uploads.Use(middlewares.AuthorizeJWT(providers.jwtService, providers.sessionCookies, providers.revokedTokenService))
+		{
+			uploads.OPTIONS("", controllers.uploadController.Options)
+			uploads.POST("", controllers.uploadController.Create)
+			uploads.HEAD(":uploadId", controllers.uploadController.Head)
+			uploads.PATCH(":uploadId", controllers.uploadController.Patch)
+			uploads.DELETE(":uploadId", controllers.uploadController.Delete)
 		}
 	}
 	return router
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"GoApp/controllers"
+	"GoApp/db"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// scim sends a SCIM request as the identity provider of a tenant
+func (server *testServer) scim(method, path, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, "/scim/v2/"+path, strings.NewReader(body))
+	if body != "" {
+		request.Header.Set("Content-Type", "application/scim+json")
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	return server.do(request)
+}
+
+func (server *testServer) createTenant(t *testing.T, token string) {
+	t.Helper()
+	if _, err := server.database.tenantService.CreateTenant(context.Background(), "tenant", token); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// provision creates a user of the tenant of token
+func (server *testServer) provision(t *testing.T, token, userName string) controllers.SCIMUser {
+	t.Helper()
+	var user controllers.SCIMUser
+	body := fmt.Sprintf(`{"schemas":[%q],"userName":%q,"name":{"givenName":"Ada","familyName":"Lovelace"},"password":%q,"externalId":"ignored"}`,
+		controllers.SCIMUserSchema, userName, testPassword)
+	decodeResponse(t, server.scim(http.MethodPost, "Users", token, body), http.StatusCreated, &user)
+	return user
+}
+
+func TestSCIMTenantIsolation(t *testing.T) {
+	server := newTestServer(t, nil)
+	server.createTenant(t, "tenant-a")
+	server.createTenant(t, "tenant-b")
+	user := server.provision(t, "tenant-a", "ada@example.com")
+	local := server.createUser(t, "local@example.com")
+
+	for _, id := range []string{user.Id, local.ID} {
+		for _, request := range []struct{ method, body string }{
+			{http.MethodGet, ""},
+			{http.MethodPut, `{"userName":"taken@example.com"}`},
+			{http.MethodPatch, `{"Operations":[{"op":"replace","path":"active","value":false}]}`},
+			{http.MethodDelete, ""},
+		} {
+			if recorder := server.scim(request.method, "Users/"+id, "tenant-b", request.body); recorder.Code != http.StatusNotFound {
+				t.Errorf("%s of a user of another tenant: got %d %s", request.method, recorder.Code, recorder.Body)
+			}
+		}
+	}
+
+	var list controllers.SCIMUserList
+	decodeResponse(t, server.scim(http.MethodGet, "Users", "tenant-b", ""), http.StatusOK, &list)
+	if list.TotalResults != 0 || len(list.Resources) != 0 {
+		t.Fatalf("tenant b lists %+v", list)
+	}
+	decodeResponse(t, server.scim(http.MethodGet, "Users?filter="+url.QueryEscape(`userName eq "ada@example.com"`), "tenant-b", ""), http.StatusOK, &list)
+	if list.TotalResults != 0 {
+		t.Fatalf("tenant b finds the users of tenant a: %+v", list)
+	}
+	decodeResponse(t, server.scim(http.MethodGet, "Users/"+user.Id, "tenant-a", ""), http.StatusOK, nil)
+
+	if recorder := server.scim(http.MethodGet, "Users", "unknown", ""); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown tenant token: got %d", recorder.Code)
+	}
+}
+
+func TestSCIMListUsers(t *testing.T) {
+	server := newTestServer(t, nil)
+	server.createTenant(t, "tenant")
+	for i := 0; i < 3; i++ {
+		server.provision(t, "tenant", fmt.Sprintf("user%d@example.com", i))
+	}
+
+	for query, want := range map[string]struct {
+		total             int64
+		items, startIndex int
+	}{
+		"":                       {3, 3, 1},
+		"?count=2":               {3, 2, 1},
+		"?startIndex=3&count=2":  {3, 1, 3},
+		"?startIndex=0":          {3, 3, 1},
+		"?startIndex=-5&count=1": {3, 1, 1},
+		"?count=-1":              {3, 0, 1},
+		"?count=0":               {3, 0, 1},
+		"?startIndex=10":         {3, 0, 10},
+		"?filter=" + url.QueryEscape(`userName eq "user1@example.com"`): {1, 1, 1},
+		"?filter=" + url.QueryEscape(`userName eq ""`):                  {0, 0, 1},
+	} {
+		var list controllers.SCIMUserList
+		decodeResponse(t, server.scim(http.MethodGet, "Users"+query, "tenant", ""), http.StatusOK, &list)
+		if list.TotalResults != want.total || len(list.Resources) != want.items || list.ItemsPerPage != want.items || list.StartIndex != want.startIndex {
+			t.Errorf("%q: got total %d, %d items from %d", query, list.TotalResults, len(list.Resources), list.StartIndex)
+		}
+	}
+
+	for _, query := range []string{"?count=many", "?filter=" + url.QueryEscape(`userName co "user"`)} {
+		if recorder := server.scim(http.MethodGet, "Users"+query, "tenant", ""); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%q: got %d %s", query, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestSCIMDeactivation(t *testing.T) {
+	server := newTestServer(t, nil)
+	server.createTenant(t, "tenant")
+	ctx := context.Background()
+
+	for name, body := range map[string]string{
+		"PATCH with path":    `{"Operations":[{"op":"Replace","path":"active","value":"False"}]}`,
+		"PATCH without path": `{"Operations":[{"op":"replace","value":{"active":false}}]}`,
+		"PUT":                `{"userName":"%s","active":false}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			email := strings.ReplaceAll(strings.ToLower(name), " ", "-") + "@example.com"
+			user := server.provision(t, "tenant", email)
+			refreshToken, err := server.database.refreshTokenService.CreateRefreshToken(ctx, user.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			method := http.MethodPatch
+			if name == "PUT" {
+				method, body = http.MethodPut, fmt.Sprintf(body, email)
+			}
+			var updated controllers.SCIMUser
+			decodeResponse(t, server.scim(method, "Users/"+user.Id, "tenant", body), http.StatusOK, &updated)
+			if updated.Active == nil || *updated.Active {
+				t.Fatalf("got %+v", updated)
+			}
+			if _, err := server.database.refreshTokenService.FindRefreshToken(ctx, refreshToken); !errors.Is(err, db.ErrNotFound) {
+				t.Fatalf("refresh token left after deactivation: %v", err)
+			}
+
+			// nor can the user sign in again by themselves
+			request := httptest.NewRequest(http.MethodPost, "/v1/auth/login", strings.NewReader(`{"email":"`+email+`","password":"`+testPassword+`"}`))
+			request.Header.Set("Content-Type", "application/json")
+			if recorder := server.do(request); recorder.Code != http.StatusForbidden {
+				t.Fatalf("login of a deactivated user: got %d %s", recorder.Code, recorder.Body)
+			}
+
+			// the identity provider reactivates them
+			decodeResponse(t, server.scim(http.MethodPatch, "Users/"+user.Id, "tenant", `{"Operations":[{"op":"Replace","path":"active","value":"True"}]}`), http.StatusOK, &updated)
+			if !*updated.Active {
+				t.Fatalf("got %+v", updated)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"GoApp/db"
+	dto "GoApp/dto/auth"
+	"GoApp/providers"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// defaultFixtures are demo accounts for local and staging environments
+//
+//go:embed fixtures/users.json
+var defaultFixtures []byte
+
+type userFixture struct {
+	dto.RegisterCredentials
+	Admin bool `json:"admin"`
+}
+
+// seed creates the fixture users, existing ones are left untouched so that
+// seeding twice is harmless
+func seed(configs *providers.Config, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := flags.String("file", "", "JSON list of users, the built-in demo users when empty")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *file == "" && configs.Env == "production" {
+		return errors.New("refusing to seed the demo users in production, pass --file")
+	}
+
+	data := defaultFixtures
+	if *file != "" {
+		var err error
+		if data, err = os.ReadFile(*file); err != nil {
+			return err
+		}
+	}
+	var fixtures []userFixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return fmt.Errorf("fixtures: %w", err)
+	}
+
+	return withDatabase(configs, func(ctx context.Context, database *database) error {
+		for _, fixture := range fixtures {
+			user, err := provisionUser(ctx, database.userService, fixture.RegisterCredentials, fixture.Admin)
+			if errors.Is(err, db.ErrDuplicate) {
+				fmt.Printf("Skipped %s, it already exists\n", *fixture.Email)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Created user %s\n", *user.Email)
+		}
+		return nil
+	})
+}
@@ -4,30 +4,187 @@ import (
 	"GoApp/controllers"
 	"GoApp/db"
 	"GoApp/providers"
-	"log"
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
-func Init() {
-	var configs providers.Config = *providers.GetConfig()
-
-	var dbClient = db.GetClient(configs)
-	var userService db.UserService = db.NewUserService(dbClient, &configs)
-	var refreshTokenService db.RefreshTokenService = db.NewRefreshTokenService(dbClient, &configs)
-	var emailService providers.EmailService = providers.NewEmailService(&configs)
-	var jwtService providers.JWTService = providers.NewJWTService(&configs)
-	var healthController controllers.HealthController = controllers.HealthControllerHandler()
-	var authController controllers.AuthController = controllers.AuthHandler(&jwtService, &userService, &refreshTokenService, &emailService, &configs)
-	var userController controllers.UserController = controllers.UserHandler(&userService, &configs)
-
-	r := NewRouter(&configs, &Controllers{
-		healthController: healthController,
-		authController:   authController,
-		userController:   userController,
+func Init(config *providers.Config) {
+	var configs providers.Config = *config
+
+	logger := providers.NewLogger(&configs)
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := providers.InitTracing(context.Background(), &configs)
+	if err != nil {
+		logger.Error("Tracing setup", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	var database = openDatabase(&configs, logger)
+	app, dependencies, err := newApp(&configs, database, logger)
+	if err != nil {
+		logger.Error("OpenID Connect setup", slog.Any("error", err))
+		os.Exit(1)
+	}
+	var refreshTokenService db.RefreshTokenService = database.refreshTokenService
+	var uploadService db.UploadService = database.uploadService
+	var revokedTokenService db.RevokedTokenService = database.revokedTokenService
+	var authorizationCodeService db.AuthorizationCodeService = database.authorizationCodeService
+	var deviceAuthorizationService db.DeviceAuthorizationService = database.deviceAuthorizationService
+	var blobStore providers.BlobStore = dependencies.blobStore
+
+	providers.RegisterActiveRefreshTokens(refreshTokenService.CountRefreshTokens)
+
+	// background workers run until the server starts shutting down
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(4)
+	go func() {
+		defer workers.Done()
+		cleanupUploads(workersCtx, logger, uploadService, blobStore, time.Minute)
+	}()
+	go func() {
+		defer workers.Done()
+		removeExpired(workersCtx, logger, "revoked tokens", revokedTokenService.RemoveExpiredRevokedTokens, time.Hour)
+	}()
+	go func() {
+		defer workers.Done()
+		removeExpired(workersCtx, logger, "authorization codes", authorizationCodeService.RemoveExpiredAuthorizationCodes, time.Hour)
+	}()
+	go func() {
+		defer workers.Done()
+		removeExpired(workersCtx, logger, "device authorizations", deviceAuthorizationService.RemoveExpiredDeviceAuthorizations, time.Hour)
+	}()
+
+	r := NewRouter(&configs, app, dependencies)
+
+	srv := &http.Server{
+		Addr:              ":" + configs.Port,
+		Handler:           r,
+		ReadTimeout:       configs.HttpReadTimeout,
+		ReadHeaderTimeout: configs.HttpReadHeaderTimeout,
+		WriteTimeout:      configs.HttpWriteTimeout,
+		IdleTimeout:       configs.HttpIdleTimeout,
+		MaxHeaderBytes:    configs.HttpMaxHeaderBytes,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Listening", slog.String("addr", srv.Addr))
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != nil && err != http.ErrServerClosed {
+			logger.Error("HTTP server", slog.Any("error", err))
+			os.Exit(1)
+		}
+	case <-ctx.Done():
+		// a second signal kills the process right away
+		stop()
+	}
+
+	logger.Info("Shutting down...")
+	// fail readiness first and give load balancers time to notice
+	app.healthController.Drain()
+	time.Sleep(configs.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), configs.ShutdownTimeout)
+	defer cancel()
+
+	// stop accepting connections and wait for in-flight requests to finish
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("HTTP server shutdown", slog.Any("error", err))
+	}
+
+	stopWorkers()
+	workers.Wait()
+
+	if err := database.close(shutdownCtx); err != nil {
+		logger.Error("Database disconnect", slog.Any("error", err))
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Tracing shutdown", slog.Any("error", err))
+	}
+	logger.Info("Server stopped")
+}
+
+// newApp builds the controllers and the router dependencies on top of the
+// services of database
+func newApp(configs *providers.Config, database *database, logger *slog.Logger) (*Controllers, *Providers, error) {
+	var userService db.UserService = database.userService
+	var refreshTokenService db.RefreshTokenService = database.refreshTokenService
+	var uploadService db.UploadService = database.uploadService
+	var clientService db.ClientService = database.clientService
+	var revokedTokenService db.RevokedTokenService = database.revokedTokenService
+	var authorizationCodeService db.AuthorizationCodeService = database.authorizationCodeService
+	var deviceAuthorizationService db.DeviceAuthorizationService = database.deviceAuthorizationService
+	var emailService providers.EmailService = providers.NewEmailService(configs)
+	var jwtService providers.JWTService = providers.NewJWTService(configs)
+	var sessionCookies providers.SessionCookieService = providers.NewSessionCookieService(configs)
+	var blobStore providers.BlobStore = providers.NewBlobStore(configs)
+	idTokenService, err := providers.NewIDTokenService(configs, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	var imageService providers.ImageService = providers.NewImageService(configs)
+	var avatarService providers.AvatarService = providers.NewAvatarService(configs)
+
+	return &Controllers{
+		healthController: controllers.HealthControllerHandler(healthChecks(configs, database, emailService, blobStore), logger),
+		authController:   controllers.AuthHandler(&jwtService, &userService, &refreshTokenService, &emailService, &blobStore, &sessionCookies, configs, logger),
+		userController:   controllers.UserHandler(&userService, &blobStore, &imageService, configs, logger),
+		uploadController: controllers.UploadHandler(&userService, &uploadService, &blobStore, &imageService, configs, logger),
+		avatarController: controllers.AvatarHandler(&userService, &avatarService, configs, logger),
+		oauthController:  controllers.OAuthHandler(&jwtService, &refreshTokenService, &revokedTokenService, configs, logger),
+		oidcController:   controllers.OIDCHandler(&idTokenService, &userService, &refreshTokenService, &clientService, &authorizationCodeService, &sessionCookies, &blobStore, configs, logger),
+		tokenController:  controllers.TokenHandler(&jwtService, &idTokenService, &userService, &refreshTokenService, &authorizationCodeService, &deviceAuthorizationService, configs, logger),
+		deviceController: controllers.DeviceHandler(&clientService, &deviceAuthorizationService, configs, logger),
+		scimController:   controllers.SCIMHandler(&userService, &refreshTokenService, configs, logger),
 	}, &Providers{
-		jwtService: jwtService,
-	})
+		jwtService:          jwtService,
+		sessionCookies:      sessionCookies,
+		revokedTokenService: revokedTokenService,
+		clientService:       clientService,
+		tenantService:       database.tenantService,
+		blobStore:           blobStore,
+		logger:              logger,
+	}, nil
+}
 
-	if err := r.Run(); err != nil {
-		log.Fatal(err)
+// healthChecks lists the dependencies probed by the readiness endpoint
+func healthChecks(configs *providers.Config, database *database, emailService providers.EmailService, blobStore providers.BlobStore) []controllers.HealthCheck {
+	checks := []controllers.HealthCheck{
+		{
+			Name:  configs.DatabaseDriver,
+			Check: database.ping,
+		},
+		{
+			Name: "storage",
+			Check: func(ctx context.Context) error {
+				return providers.CheckBlobStore(ctx, blobStore)
+			},
+			CacheFor: configs.StorageHealthInterval,
+		},
+	}
+	if configs.SmtpHealthCheck {
+		checks = append(checks, controllers.HealthCheck{
+			Name:     "smtp",
+			Check:    emailService.Ping,
+			Timeout:  5 * time.Second,
+			CacheFor: configs.SmtpHealthInterval,
+			Optional: true,
+		})
 	}
+	return checks
 }
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"GoApp/db"
+	dto "GoApp/dto/auth"
+	"GoApp/providers"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	// the templates are loaded relative to the repository root, where the server runs
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+const testAuthKey = "key"
+
+const testPassword = "Secret123!"
+
+// testServer is the whole application on the in-memory database
+type testServer struct {
+	router   *gin.Engine
+	database *database
+	configs  *providers.Config
+	jwt      providers.JWTService
+}
+
+// newTestServer loads the config from the environment like the server does,
+// env overrides the test defaults
+func newTestServer(t *testing.T, env map[string]string) *testServer {
+	defaults := map[string]string{
+		"DATABASE_DRIVER":   "memory",
+		"JWT_SECRET":        "secret",
+		"AUTH_KEY":          testAuthKey,
+		"SMTP_SENDER":       "noreply@example.com",
+		"SMTP_HOST":         "localhost",
+		"SMTP_HEALTH_CHECK": "false",
+		"FE_VERIFY_URL":     "http://localhost/verify",
+		"FE_RESET_PASS_URL": "http://localhost/reset",
+		"FE_DEVICE_URL":     "http://localhost/device",
+		"DOMAIN":            "http://localhost:3000",
+		"STORAGE_PATH":      t.TempDir(),
+	}
+	for name, value := range env {
+		defaults[name] = value
+	}
+	for name, value := range defaults {
+		t.Setenv(name, value)
+	}
+	configs, err := providers.LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	database := openDatabase(configs, logger)
+	app, dependencies, err := newApp(configs, database, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{
+		router:   NewRouter(configs, app, dependencies),
+		database: database,
+		configs:  configs,
+		jwt:      dependencies.jwtService,
+	}
+}
+
+// do sends the request through the router, with the auth key of the v1 routes
+func (server *testServer) do(request *http.Request) *httptest.ResponseRecorder {
+	if request.Header.Get("X-Auth-Key") == "" {
+		request.Header.Set("X-Auth-Key", testAuthKey)
+	}
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// createUser registers an activated user with testPassword
+func (server *testServer) createUser(t *testing.T, email string) *db.User {
+	ctx := context.Background()
+	password, firstname, lastname := testPassword, "Ada", "Lovelace"
+	user, err := server.database.userService.CreateUser(ctx, dto.RegisterCredentials{Email: &email, Password: &password, Firstname: &firstname, Lastname: &lastname})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err = server.database.userService.ActivateUser(ctx, email, user.ActivationCode, ""); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// createClient registers a client, a public one when secret is empty
+func (server *testServer) createClient(t *testing.T, secret string, redirectURIs []string, scopes []string) *db.Client {
+	client, err := server.database.clientService.CreateClient(context.Background(), "test", secret, redirectURIs, scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// postForm posts form to path as the client, with HTTP Basic for the
+// confidential clients and the client_id parameter for the public ones
+func (server *testServer) postForm(path string, form url.Values, clientId, secret string) *httptest.ResponseRecorder {
+	if secret == "" && clientId != "" {
+		form.Set("client_id", clientId)
+	}
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		request.SetBasicAuth(clientId, secret)
+	}
+	return server.do(request)
+}
+
+// get sends a GET with the bearer token, when there is one
+func (server *testServer) get(path, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return server.do(request)
+}
+
+// decodeResponse checks the status of the response and decodes its JSON body into value
+func decodeResponse(t *testing.T, recorder *httptest.ResponseRecorder, status int, value interface{}) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Fatalf("got status %d, want %d: %s", recorder.Code, status, recorder.Body)
+	}
+	if value != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), value); err != nil {
+			t.Fatalf("%v: %s", err, recorder.Body)
+		}
+	}
+}
+
+// errorCode returns the error code of the envelope of a failed response
+func errorCode(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%v: %s", err, recorder.Body)
+	}
+	return body.Error
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"GoApp/lib"
+	"GoApp/providers"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// loginWithCookies signs user in with a cookie session, returning its cookies and csrf token
+func loginWithCookies(t *testing.T, server *testServer, email string) ([]*http.Cookie, string) {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, "/v1/auth/login", strings.NewReader(`{"email":"`+email+`","password":"`+testPassword+`"}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(providers.SessionModeHeader, "cookie")
+	recorder := server.do(request)
+	var response struct {
+		Data struct {
+			CSRFToken    string `json:"csrfToken"`
+			AccessToken  string `json:"accessToken"`
+			RefreshToken string `json:"refreshToken"`
+		} `json:"data"`
+	}
+	decodeResponse(t, recorder, http.StatusOK, &response)
+	if response.Data.CSRFToken == "" || response.Data.AccessToken != "" || response.Data.RefreshToken != "" {
+		t.Fatalf("the tokens of a cookie session are in the body: %s", recorder.Body)
+	}
+	return recorder.Result().Cookies(), response.Data.CSRFToken
+}
+
+func TestCookieSessionCSRF(t *testing.T) {
+	server := newTestServer(t, map[string]string{"SESSION_COOKIES": "true", "ALLOWED_ORIGIN": "https://app.example.com"})
+	server.createUser(t, "user@example.com")
+
+	send := func(method, path string, cookies []*http.Cookie, headers map[string]string) *httptest.ResponseRecorder {
+		var body *strings.Reader
+		if method == http.MethodPost {
+			body = strings.NewReader(`{"firstname":"Grace","lastname":"Hopper"}`)
+		} else {
+			body = strings.NewReader("")
+		}
+		request := httptest.NewRequest(method, path, body)
+		request.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		return server.do(request)
+	}
+
+	cookies, csrfToken := loginWithCookies(t, server, "user@example.com")
+	routes := []struct{ method, path string }{
+		{http.MethodPut, "/v1/auth/refresh"},
+		{http.MethodPost, "/v1/user/details"},
+		{http.MethodPut, "/v1/auth/logout"},
+	}
+	for name, headers := range map[string]map[string]string{
+		"missing token":    {},
+		"mismatched token": {providers.CSRFHeader: "forged"},
+	} {
+		for _, route := range routes {
+			recorder := send(route.method, route.path, cookies, headers)
+			if recorder.Code != http.StatusForbidden || errorCode(t, recorder) != lib.CSRFCheckFailed {
+				t.Errorf("%s %s with %s: got %d %s", route.method, route.path, name, recorder.Code, recorder.Body)
+			}
+		}
+	}
+
+	// the cors middleware turns foreign origins away before the csrf check
+	for _, route := range routes {
+		recorder := send(route.method, route.path, cookies, map[string]string{providers.CSRFHeader: csrfToken, "Origin": "https://attacker.example.com"})
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf("%s %s from a foreign origin: got %d %s", route.method, route.path, recorder.Code, recorder.Body)
+		}
+	}
+
+	// safe methods only need the cookie
+	if recorder := send(http.MethodGet, "/v1/user/details", cookies, nil); recorder.Code != http.StatusOK {
+		t.Fatalf("GET without a csrf token: got %d %s", recorder.Code, recorder.Body)
+	}
+
+	headers := map[string]string{providers.CSRFHeader: csrfToken, "Origin": "https://app.example.com"}
+	for _, route := range routes {
+		if recorder := send(route.method, route.path, cookies, headers); recorder.Code != http.StatusOK {
+			t.Fatalf("%s %s: got %d %s", route.method, route.path, recorder.Code, recorder.Body)
+		}
+	}
+	// logged out, the refresh token of the cookie is gone
+	if recorder := send(http.MethodPut, "/v1/auth/refresh", cookies, headers); errorCode(t, recorder) != lib.TokenNotFound {
+		t.Fatalf("refresh after logout: got %d %s", recorder.Code, recorder.Body)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"GoApp/db"
+	"GoApp/providers"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func createTenant(configs *providers.Config, args []string) error {
+	flags := flag.NewFlagSet("tenant create", flag.ContinueOnError)
+	name := flags.String("name", "", "name of the tenant, such as the customer organization")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return usageError("tenant create needs a --name")
+	}
+	token := randomSecret(32)
+
+	return withDatabase(configs, func(ctx context.Context, database *database) error {
+		tenant, err := database.tenantService.CreateTenant(ctx, *name, token)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created tenant %s\n", tenant.Name)
+		fmt.Printf("tenant_id=%s\n", tenant.TenantId)
+		fmt.Printf("scim_url=%s/scim/v2\n", configs.Domain)
+		fmt.Printf("token=%s\n", token)
+		fmt.Fprintln(os.Stderr, "Store the token in the identity provider now, only its hash is kept.")
+		return nil
+	})
+}
+
+func listTenants(configs *providers.Config, args []string) error {
+	if _, err := parseFlags(flag.NewFlagSet("tenant list", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+
+	return withDatabase(configs, func(ctx context.Context, database *database) error {
+		tenants, err := database.tenantService.ListTenants(ctx)
+		if err != nil {
+			return err
+		}
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "TENANT ID\tNAME\tCREATED")
+		for _, tenant := range tenants {
+			fmt.Fprintf(table, "%s\t%s\t%s\n", tenant.TenantId, tenant.Name, tenant.CreatedAt.Local().Format(time.RFC3339))
+		}
+		return table.Flush()
+	})
+}
+
+func deleteTenant(configs *providers.Config, args []string) error {
+	args, err := parseFlags(flag.NewFlagSet("tenant delete", flag.ContinueOnError), args, "<tenant-id>")
+	if err != nil {
+		return err
+	}
+
+	return withDatabase(configs, func(ctx context.Context, database *database) error {
+		err := database.tenantService.RemoveTenant(ctx, args[0])
+		if errors.Is(err, db.ErrNotFound) {
+			return fmt.Errorf("tenant %s: %w", args[0], err)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deleted tenant %s, its users keep their accounts\n", args[0])
+		return nil
+	})
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"GoApp/controllers"
+	"GoApp/lib"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestClientCredentialsGrant(t *testing.T) {
+	server := newTestServer(t, nil)
+	service := server.createClient(t, "service-secret", nil, []string{"users:read", "users:write"})
+	relyingParty := server.createClient(t, "rp-secret", []string{testRedirectURI}, nil)
+	public := server.createClient(t, "", []string{testRedirectURI}, nil)
+
+	token := func(clientId, secret, scope string) (controllers.TokenResponse, int, string) {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		if scope != "" {
+			form.Set("scope", scope)
+		}
+		recorder := server.postForm("/oauth/token", form, clientId, secret)
+		var response controllers.TokenResponse
+		if recorder.Code == http.StatusOK {
+			decodeResponse(t, recorder, http.StatusOK, &response)
+			return response, recorder.Code, ""
+		}
+		return response, recorder.Code, errorCode(t, recorder)
+	}
+
+	for name, test := range map[string]struct {
+		scope, want string
+	}{
+		"every allowed scope": {"", "users:read users:write"},
+		"narrowed scope":      {"users:read", "users:read"},
+	} {
+		response, status, code := token(service.ClientId, "service-secret", test.scope)
+		if status != http.StatusOK || response.Scope != test.want || response.RefreshToken != "" || response.IdToken != "" {
+			t.Errorf("%s: got %d %s %+v", name, status, code, response)
+			continue
+		}
+		introspection := introspect(t, server, service.ClientId, "service-secret", response.AccessToken)
+		if !introspection.Active || introspection.Sub != service.ClientId || introspection.Scope != test.want {
+			t.Errorf("%s: introspected %+v", name, introspection)
+		}
+		// the service accounts are not users
+		recorder := server.get("/v1/user/details", response.AccessToken)
+		if recorder.Code != http.StatusForbidden || errorCode(t, recorder) != lib.UserRequired {
+			t.Errorf("%s: service token on a user route: got %d %s", name, recorder.Code, recorder.Body)
+		}
+	}
+
+	for name, test := range map[string]struct {
+		clientId, secret, scope string
+		status                  int
+		code                    string
+	}{
+		"widened scope":       {service.ClientId, "service-secret", "users:read admin", http.StatusBadRequest, lib.OAuthInvalidScope},
+		"wrong secret":        {service.ClientId, "wrong", "", http.StatusUnauthorized, lib.OAuthInvalidClient},
+		"relying party":       {relyingParty.ClientId, "rp-secret", "", http.StatusBadRequest, lib.OAuthUnauthorizedClient},
+		"relying party scope": {relyingParty.ClientId, "rp-secret", "openid", http.StatusBadRequest, lib.OAuthUnauthorizedClient},
+		"public client":       {public.ClientId, "", "", http.StatusBadRequest, lib.OAuthUnauthorizedClient},
+	} {
+		if _, status, code := token(test.clientId, test.secret, test.scope); status != test.status || code != test.code {
+			t.Errorf("%s: got %d %s, want %d %s", name, status, code, test.status, test.code)
+		}
+	}
+}
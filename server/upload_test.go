@@ -0,0 +1,172 @@
+package server
+
+import (
+	"GoApp/db"
+	"GoApp/lib"
+	"GoApp/providers"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// tus sends a request of the tus protocol as the user of token
+func (server *testServer) tus(method, path, token string, headers map[string]string, body []byte) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request := httptest.NewRequest(method, path, reader)
+	request.Header.Set("Tus-Resumable", "1.0.0")
+	request.Header.Set("Authorization", "Bearer "+token)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	return server.do(request)
+}
+
+// createUpload starts an upload of length bytes and returns its location
+func (server *testServer) createUpload(t *testing.T, token string, length int) string {
+	t.Helper()
+	recorder := server.tus(http.MethodPost, "/v1/uploads", token, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": "purpose " + base64.StdEncoding.EncodeToString([]byte("profile")),
+	}, nil)
+	if recorder.Code != http.StatusCreated || recorder.Header().Get("Location") == "" {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+	return recorder.Header().Get("Location")
+}
+
+// patchUpload sends chunk at offset
+func (server *testServer) patchUpload(location, token string, offset int, chunk []byte) *httptest.ResponseRecorder {
+	return server.tus(http.MethodPatch, location, token, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	}, chunk)
+}
+
+func TestTusCreate(t *testing.T) {
+	server := newTestServer(t, map[string]string{"IMAGE_MAX_BYTES": "65536"})
+	user := server.createUser(t, "user@example.com")
+	token := server.jwt.GenerateToken(user.ID, true, providers.AccessTokenExpiry)
+
+	for name, test := range map[string]struct {
+		length, metadata string
+		status           int
+		code             string
+	}{
+		"no metadata":          {"1024", "", http.StatusCreated, ""},
+		"not base64":           {"1024", "purpose profile", http.StatusBadRequest, lib.InvalidParameter},
+		"too many fields":      {"1024", "purpose cHJvZmlsZQ== extra", http.StatusBadRequest, lib.InvalidParameter},
+		"unsupported purpose":  {"1024", "purpose " + base64.StdEncoding.EncodeToString([]byte("avatar")), http.StatusBadRequest, lib.InvalidParameter},
+		"missing length":       {"", "", http.StatusBadRequest, lib.InvalidParameter},
+		"empty upload":         {"0", "", http.StatusBadRequest, lib.InvalidParameter},
+		"over IMAGE_MAX_BYTES": {"65537", "", http.StatusRequestEntityTooLarge, lib.ImageTooLarge},
+	} {
+		recorder := server.tus(http.MethodPost, "/v1/uploads", token, map[string]string{"Upload-Length": test.length, "Upload-Metadata": test.metadata}, nil)
+		if recorder.Code != test.status || (test.code != "" && errorCode(t, recorder) != test.code) {
+			t.Errorf("%s: got %d %s", name, recorder.Code, recorder.Body)
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/uploads", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Upload-Length", "1024")
+	if recorder := server.do(request); recorder.Code != http.StatusPreconditionFailed || errorCode(t, recorder) != lib.UnsupportedTusVersion {
+		t.Errorf("without Tus-Resumable: got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestTusUpload(t *testing.T) {
+	server := newTestServer(t, map[string]string{"IMAGE_MAX_BYTES": "65536", "PROFILE_SIZES": "16,32"})
+	user := server.createUser(t, "user@example.com")
+	token := server.jwt.GenerateToken(user.ID, true, providers.AccessTokenExpiry)
+	other := server.jwt.GenerateToken(server.createUser(t, "other@example.com").ID, true, providers.AccessTokenExpiry)
+
+	file := pngImage(t, 40, 30)
+	half := len(file) / 2
+	location := server.createUpload(t, token, len(file))
+
+	if recorder := server.patchUpload(location, token, 0, file[:half]); recorder.Code != http.StatusNoContent || recorder.Header().Get("Upload-Offset") != strconv.Itoa(half) {
+		t.Fatalf("first chunk: got %d %s", recorder.Code, recorder.Body)
+	}
+
+	for name, test := range map[string]struct {
+		token       string
+		offset      int
+		chunk       []byte
+		contentType string
+		status      int
+		code        string
+	}{
+		// the client resends a chunk it believes lost
+		"offset behind":   {token, 0, file[:half], "", http.StatusConflict, lib.UploadOffsetConflict},
+		"offset ahead":    {token, half + 1, file[half+1:], "", http.StatusConflict, lib.UploadOffsetConflict},
+		"past the length": {token, half, append(append([]byte{}, file[half:]...), 0), "", http.StatusBadRequest, lib.InvalidParameter},
+		"empty chunk":     {token, half, []byte{}, "", http.StatusBadRequest, lib.InvalidParameter},
+		"content type":    {token, half, file[half:], "application/octet-stream", http.StatusUnsupportedMediaType, lib.UnsupportedMediaType},
+		"other user":      {other, half, file[half:], "", http.StatusNotFound, lib.UploadNotFound},
+	} {
+		headers := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": strconv.Itoa(test.offset)}
+		if test.contentType != "" {
+			headers["Content-Type"] = test.contentType
+		}
+		recorder := server.tus(http.MethodPatch, location, test.token, headers, test.chunk)
+		if recorder.Code != test.status || errorCode(t, recorder) != test.code {
+			t.Errorf("%s: got %d %s", name, recorder.Code, recorder.Body)
+		}
+	}
+
+	// the refused chunks were not recorded
+	recorder := server.tus(http.MethodHead, location, token, nil, nil)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Upload-Offset") != strconv.Itoa(half) || recorder.Header().Get("Upload-Length") != strconv.Itoa(len(file)) {
+		t.Fatalf("head: got %d %v", recorder.Code, recorder.Header())
+	}
+
+	// the last chunk completes the upload, which becomes the profile picture
+	if recorder := server.patchUpload(location, token, half, file[half:]); recorder.Code != http.StatusNoContent || recorder.Header().Get("Upload-Offset") != strconv.Itoa(len(file)) {
+		t.Fatalf("last chunk: got %d %s", recorder.Code, recorder.Body)
+	}
+	stored, err := server.database.userService.FindById(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Profile == "" || len(stored.ProfileSizes) != 2 {
+		t.Errorf("the profile was not set: %q %v", stored.Profile, stored.ProfileSizes)
+	}
+	if _, err := server.database.uploadService.FindUpload(context.Background(), location[len("/v1/uploads/"):]); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("the completed upload was kept: %v", err)
+	}
+	if recorder := server.tus(http.MethodHead, location, token, nil, nil); recorder.Code != http.StatusNotFound {
+		t.Errorf("head after completion: got %d", recorder.Code)
+	}
+}
+
+func TestTusUploadNotAnImage(t *testing.T) {
+	server := newTestServer(t, map[string]string{"IMAGE_MAX_BYTES": "65536"})
+	user := server.createUser(t, "user@example.com")
+	token := server.jwt.GenerateToken(user.ID, true, providers.AccessTokenExpiry)
+
+	file := []byte("<svg></svg>")
+	location := server.createUpload(t, token, len(file))
+	if recorder := server.patchUpload(location, token, 0, file); recorder.Code != http.StatusUnprocessableEntity || errorCode(t, recorder) != lib.InvalidImage {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+	// a failed upload is discarded too, the client starts over
+	if _, err := server.database.uploadService.FindUpload(context.Background(), location[len("/v1/uploads/"):]); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("the failed upload was kept: %v", err)
+	}
+	stored, err := server.database.userService.FindById(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Profile != "" {
+		t.Errorf("got profile %q", stored.Profile)
+	}
+}
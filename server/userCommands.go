@@ -0,0 +1,152 @@
+package server
+
+import (
+	"GoApp/db"
+	dto "GoApp/dto/auth"
+	"GoApp/lib"
+	"GoApp/providers"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// provisionUser creates an activated user, the operator vouches for the email
+func provisionUser(ctx context.Context, users db.UserService, credentials dto.RegisterCredentials, admin bool) (*db.User, error) {
+	// the same rules as the registration form
+	if err := lib.Validate(credentials); err != nil {
+		return nil, err
+	}
+
+	user, err := users.CreateUser(ctx, credentials)
+	if errors.Is(err, db.ErrDuplicate) {
+		return nil, fmt.Errorf("user %s: %w", *credentials.Email, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err = users.ActivateUser(ctx, *user.Email, user.ActivationCode, "")
+	if err != nil {
+		return nil, err
+	}
+	if admin {
+		if err := users.UpdateAdmin(ctx, user.ID, true); err != nil {
+			return nil, err
+		}
+		user.Admin = true
+	}
+	return user, nil
+}
+
+func createUser(configs *providers.Config, args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the user")
+	password := flags.String("password", "", "password, generated and printed when empty")
+	firstname := flags.String("firstname", "", "first name")
+	lastname := flags.String("lastname", "", "last name")
+	admin := flags.Bool("admin", false, "make the user an administrator")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	generated := *password == ""
+	if generated {
+		*password = randomSecret(12)
+	}
+
+	return withDatabase(configs, func(ctx context.Context, database *database) error {
+		user, err := provisionUser(ctx, database.userService, dto.RegisterCredentials{
+			Email:     email,
+			Password:  password,
+			Firstname: firstname,
+			Lastname:  lastname,
+		}, *admin)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created user %s with id %s\n", *user.Email, user.ID)
+		if generated {
+			fmt.Printf("Password: %s\n", *password)
+		}
+		return nil
+	})
+}
+
+func activateUser(configs *providers.Config, args []string) error {
+	args, err := parseFlags(flag.NewFlagSet("user activate", flag.ContinueOnError), args, "<email>")
+	if err != nil {
+		return err
+	}
+
+	return withDatabase(configs, func(ctx context.Context, database *database) error {
+		user, err := database.userService.FindUser(ctx, args[0])
+		if err != nil {
+			return fmt.Errorf("user %s: %w", args[0], err)
+		}
+		if user.Activated {
+			fmt.Printf("User %s is already activated\n", *user.Email)
+			return nil
+		}
+		// the identity provider of the tenant reactivates its users
+		if user.Deprovisioned() {
+			return fmt.Errorf("user %s was deactivated by the SCIM provisioning of its tenant", *user.Email)
+		}
+		if _, err := database.userService.ActivateUser(ctx, *user.Email, user.ActivationCode, ""); err != nil {
+			return err
+		}
+		fmt.Printf("Activated user %s\n", *user.Email)
+		return nil
+	})
+}
+
+func resetPassword(configs *providers.Config, args []string) error {
+	flags := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	password := flags.String("password", "", "new password, generated and printed when empty")
+	args, err := parseFlags(flags, args, "<email>")
+	if err != nil {
+		return err
+	}
+	generated := *password == ""
+	if generated {
+		*password = randomSecret(12)
+	}
+
+	return withDatabase(configs, func(ctx context.Context, database *database) error {
+		user, err := database.userService.FindUser(ctx, args[0])
+		if err != nil {
+			return fmt.Errorf("user %s: %w", args[0], err)
+		}
+		if err := database.userService.UpdatePassword(ctx, user.ID, *password); err != nil {
+			return err
+		}
+		// whoever knew the old password may still hold a session
+		count, err := database.refreshTokenService.RemoveUserRefreshTokens(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reset the password of %s and ended %d sessions\n", *user.Email, count)
+		if generated {
+			fmt.Printf("Password: %s\n", *password)
+		}
+		return nil
+	})
+}
+
+func revokeTokens(configs *providers.Config, args []string) error {
+	args, err := parseFlags(flag.NewFlagSet("tokens revoke", flag.ContinueOnError), args, "<email>")
+	if err != nil {
+		return err
+	}
+
+	return withDatabase(configs, func(ctx context.Context, database *database) error {
+		user, err := database.userService.FindUser(ctx, args[0])
+		if err != nil {
+			return fmt.Errorf("user %s: %w", args[0], err)
+		}
+		count, err := database.refreshTokenService.RemoveUserRefreshTokens(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Ended %d sessions of %s, access tokens stay valid until they expire\n", count, *user.Email)
+		return nil
+	})
+}
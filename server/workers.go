@@ -0,0 +1,53 @@
+package server
+
+import (
+	"GoApp/controllers"
+	"GoApp/db"
+	"GoApp/providers"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// cleanupUploads periodically discards upload sessions that expired before
+// they were completed, until ctx is cancelled
+func cleanupUploads(ctx context.Context, logger *slog.Logger, uploadService db.UploadService, blobStore providers.BlobStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			uploads, err := uploadService.FindExpiredUploads(ctx, time.Now())
+			if err != nil {
+				logger.Error("finding expired uploads", slog.Any("error", err))
+				continue
+			}
+			for i := range uploads {
+				if err := controllers.DiscardUpload(ctx, uploadService, blobStore, &uploads[i]); err != nil {
+					logger.Error("discarding expired upload", slog.String("uploadId", uploads[i].UploadId), slog.Any("error", err))
+				}
+			}
+		}
+	}
+}
+
+// removeExpired periodically calls remove, which removes the records expired
+// by then such as the revoked access tokens, until ctx is cancelled
+func removeExpired(ctx context.Context, logger *slog.Logger, what string, remove func(ctx context.Context, now time.Time) (int64, error), interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := remove(ctx, time.Now()); err != nil {
+				logger.Error("removing expired "+what, slog.Any("error", err))
+			}
+		}
+	}
+}